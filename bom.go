@@ -0,0 +1,60 @@
+package xmlquery
+
+import (
+	"bytes"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// utf8BOM is the UTF-8 encoded byte order mark.
+const utf8BOM = "\xef\xbb\xbf"
+
+// stripBOM skips the byte order mark starting the input, if any, and
+// returns the encoding it denotes: "UTF-8", "UTF-16LE" or "UTF-16BE", or
+// the empty string. UTF-16 input is then decoded to UTF-8.
+func (c *cachedReader) stripBOM() string {
+	if c.inMemory {
+		if bytes.HasPrefix(c.src, []byte(utf8BOM)) {
+			c.src = c.src[len(utf8BOM):]
+			return "UTF-8"
+		}
+		return ""
+	}
+	head, _ := c.buffer.Peek(len(utf8BOM))
+	var endianness unicode.Endianness
+	var name string
+	switch {
+	case bytes.HasPrefix(head, []byte(utf8BOM)):
+		c.buffer.Discard(len(utf8BOM))
+		return "UTF-8"
+	case bytes.HasPrefix(head, []byte{0xff, 0xfe}):
+		endianness, name = unicode.LittleEndian, "UTF-16LE"
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}):
+		endianness, name = unicode.BigEndian, "UTF-16BE"
+	default:
+		return ""
+	}
+	decoder := unicode.UTF16(endianness, unicode.ExpectBOM).NewDecoder()
+	c.buffer = newBufferedReader(transform.NewReader(c.buffer, decoder), c.buffer.Size())
+	return name
+}
+
+// hasUTF16BOM reports whether data starts with a UTF-16 byte order mark.
+func hasUTF16BOM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xff, 0xfe}) || bytes.HasPrefix(data, []byte{0xfe, 0xff})
+}
+
+// ByteOrderMark returns the encoding denoted by the byte order mark that
+// started the document of n when parsed, "UTF-8", "UTF-16LE" or
+// "UTF-16BE", or the empty string if there was none. The mark is not part
+// of the tree; see WithBOM to write one.
+func (n *Node) ByteOrderMark() string {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.document == nil {
+		return ""
+	}
+	return n.document.bom
+}
@@ -0,0 +1,79 @@
+package xmlquery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+func encodeUTF16(t *testing.T, s string, endianness unicode.Endianness) []byte {
+	b, err := unicode.UTF16(endianness, unicode.UseBOM).NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseBOM(t *testing.T) {
+	const s = `<?xml version="1.0" encoding="UTF-16"?><a b="é">text</a>`
+	tests := []struct {
+		name string
+		data []byte
+		bom  string
+	}{
+		{"none", []byte(`<a b="é">text</a>`), ""},
+		{"UTF-8", []byte(utf8BOM + `<a b="é">text</a>`), "UTF-8"},
+		{"UTF-16LE", encodeUTF16(t, s, unicode.LittleEndian), "UTF-16LE"},
+		{"UTF-16BE", encodeUTF16(t, s, unicode.BigEndian), "UTF-16BE"},
+		{"UTF-16LE undeclared", encodeUTF16(t, `<a b="é">text</a>`, unicode.LittleEndian), "UTF-16LE"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, parse := range []func([]byte) (*Node, error){
+				func(data []byte) (*Node, error) { return Parse(bytes.NewReader(data)) },
+				ParseBytes,
+			} {
+				doc, err := parse(test.data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				testValue(t, doc.ByteOrderMark(), test.bom)
+				a := FindOne(doc, "//a")
+				testValue(t, a.SelectAttr("b"), "é")
+				testValue(t, a.InnerText(), "text")
+				testValue(t, a.ByteOrderMark(), test.bom)
+			}
+		})
+	}
+}
+
+func TestParserResetBOM(t *testing.T) {
+	p := NewParser(ParserOptions{})
+	p.Reset(bytes.NewReader(encodeUTF16(t, `<a>1</a>`, unicode.BigEndian)))
+	doc, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.ByteOrderMark(), "UTF-16BE")
+	p.Reset(strings.NewReader(`<a>2</a>`))
+	doc, err = p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.ByteOrderMark(), "")
+	testValue(t, doc.InnerText(), "2")
+}
+
+func TestWithBOM(t *testing.T) {
+	doc, err := Parse(strings.NewReader(utf8BOM + `<a>text</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.OutputXMLWithOptions(WithoutDeclaration()), `<a>text</a>`)
+	testValue(t, doc.OutputXMLWithOptions(WithBOM(), WithoutDeclaration()), utf8BOM+`<a>text</a>`)
+	testValue(t, doc.OutputXMLWithOptions(WithBOM()), utf8BOM+doc.OutputXML(false))
+	// Only documents start with a byte order mark.
+	testValue(t, FindOne(doc, "//a").OutputXMLWithOptions(WithBOM(), WithOutputSelf()), `<a>text</a>`)
+}
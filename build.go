@@ -0,0 +1,218 @@
+package xmlquery
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// MarshalXPath is the reverse of UnmarshalXPath: it writes the fields of the
+// struct v, or pointer to it, that carry an `xpath` tag into the tree rooted
+// at top, creating intermediate elements as needed:
+//
+//	type Order struct {
+//		ID    string   `xpath:"/order/@id"`
+//		Name  string   `xpath:"/order/customer/name"`
+//		Items []string `xpath:"/order/items/item"`
+//	}
+//	doc := &xmlquery.Node{Type: xmlquery.DocumentNode}
+//	err := xmlquery.MarshalXPath(doc, &Order{...})
+//
+// Only simple location paths are supported: element names separated by
+// slashes, each optionally followed by a position such as item[2], "." for
+// the current element and a final @name step for an attribute. A leading
+// slash starts from the document node. Existing elements are reused, so
+// MarshalXPath also updates documents in place.
+//
+// Slice fields write one element per item, the N-th item at the N-th
+// element of the last step. Struct fields are written recursively, with
+// their paths relative to the element of the field. Nil pointers are
+// skipped. Other values are written as text: strings, booleans, numbers and
+// encoding.TextMarshaler are supported.
+func MarshalXPath(top *Node, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errors.New("xmlquery: MarshalXPath requires a struct or a pointer to a struct")
+	}
+	return marshalStruct(top, rv)
+}
+
+func marshalStruct(n *Node, sv reflect.Value) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		path := field.Tag.Get("xpath")
+		if path == "" || path == "-" || field.PkgPath != "" {
+			continue
+		}
+		if err := marshalField(n, path, sv.Field(i)); err != nil {
+			return fmt.Errorf("xmlquery: field %s: %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+type buildStep struct {
+	name     string
+	position int // 1-based, 0 if not specified
+	attr     bool
+}
+
+func parseBuildPath(path string) (absolute bool, steps []buildStep, err error) {
+	if strings.HasPrefix(path, "/") {
+		absolute = true
+		path = path[1:]
+	}
+	for i, s := range strings.Split(path, "/") {
+		var step buildStep
+		if strings.HasPrefix(s, "@") {
+			if i != strings.Count(path, "/") {
+				return false, nil, fmt.Errorf("attribute step %s must be the last one", s)
+			}
+			step.attr = true
+			s = s[1:]
+		} else if j := strings.IndexByte(s, '['); j > 0 && strings.HasSuffix(s, "]") {
+			if step.position, err = strconv.Atoi(s[j+1 : len(s)-1]); err != nil || step.position < 1 {
+				return false, nil, fmt.Errorf("unsupported predicate in %s", s)
+			}
+			s = s[:j]
+		}
+		if s == "" || strings.ContainsAny(s, "[]()*|=' \"") {
+			return false, nil, fmt.Errorf("unsupported path %q", path)
+		}
+		step.name = s
+		steps = append(steps, step)
+	}
+	return absolute, steps, nil
+}
+
+func marshalField(n *Node, path string, fv reflect.Value) error {
+	absolute, steps, err := parseBuildPath(path)
+	if err != nil {
+		return err
+	}
+	if absolute {
+		for n.Parent != nil {
+			n = n.Parent
+		}
+	}
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	last := steps[len(steps)-1]
+	for _, step := range steps[:len(steps)-1] {
+		n = buildElement(n, step)
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 && !last.attr {
+		for i := 0; i < fv.Len(); i++ {
+			step := last
+			step.position = last.position + i
+			if last.position == 0 {
+				step.position = i + 1
+			}
+			if err := marshalValue(buildElement(n, step), fv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if last.attr {
+		s, err := marshalText(fv)
+		if err != nil {
+			return err
+		}
+		n.SetAttr(last.name, s)
+		return nil
+	}
+	return marshalValue(buildElement(n, last), fv)
+}
+
+func marshalValue(n *Node, fv reflect.Value) error {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Struct && !fv.Type().Implements(textMarshalerType) && !reflect.PtrTo(fv.Type()).Implements(textMarshalerType) {
+		return marshalStruct(n, fv)
+	}
+	s, err := marshalText(fv)
+	if err != nil {
+		return err
+	}
+	for n.FirstChild != nil {
+		RemoveFromTree(n.FirstChild)
+	}
+	AddChild(n, &Node{Type: TextNode, Data: s, level: n.level + 1})
+	return nil
+}
+
+// buildElement returns the child element of n matched by step, creating it
+// and any missing preceding siblings of the same name.
+func buildElement(n *Node, step buildStep) *Node {
+	if step.name == "." {
+		return n
+	}
+	position := step.position
+	if position == 0 {
+		position = 1
+	}
+	prefix, local := "", step.name
+	if i := strings.IndexByte(local, ':'); i > 0 {
+		prefix, local = local[:i], local[i+1:]
+	}
+	count := 0
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == ElementNode && child.Data == local && child.Prefix == prefix {
+			if count++; count == position {
+				return child
+			}
+		}
+	}
+	var elem *Node
+	for ; count < position; count++ {
+		elem = &Node{Type: ElementNode, Data: local, Prefix: prefix, level: n.level + 1}
+		AddChild(n, elem)
+	}
+	return elem
+}
+
+func marshalText(fv reflect.Value) (string, error) {
+	if fv.Type().Implements(textMarshalerType) {
+		b, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textMarshalerType) {
+		b, err := fv.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("cannot marshal %s", fv.Type())
+}
@@ -0,0 +1,67 @@
+package xmlquery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarshalXPath(t *testing.T) {
+	type item struct {
+		SKU string `xpath:"@sku"`
+		Qty int    `xpath:"qty"`
+	}
+	type order struct {
+		ID      string    `xpath:"/order/@id"`
+		Name    string    `xpath:"/order/customer/name"`
+		Email   *string   `xpath:"/order/customer/email"`
+		Created time.Time `xpath:"/order/created"`
+		Tags    []string  `xpath:"/order/tags/tag"`
+		Items   []item    `xpath:"/order/items/item"`
+		Paid    bool      `xpath:"/order/status/@paid"`
+	}
+	doc := &Node{Type: DocumentNode}
+	v := order{
+		ID:      "42",
+		Name:    "Tom & Jerry",
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:    []string{"a", "b"},
+		Items:   []item{{"x1", 2}, {"x2", 1}},
+		Paid:    true,
+	}
+	if err := MarshalXPath(doc, &v); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<order id="42"><customer><name>Tom &amp; Jerry</name></customer><created>2020-01-02T03:04:05Z</created>` +
+		`<tags><tag>a</tag><tag>b</tag></tags><items><item sku="x1"><qty>2</qty></item><item sku="x2"><qty>1</qty></item></items>` +
+		`<status paid="true"></status></order>`
+	testValue(t, doc.OutputXML(false), expected)
+
+	var got order
+	if err := UnmarshalXPath(doc, &got); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, got.Items[1].SKU, "x2")
+	testValue(t, got.Created.Equal(v.Created), true)
+}
+
+func TestMarshalXPathUpdate(t *testing.T) {
+	doc := loadXML(`<config><server port="80"><host>old</host><alias>a</alias></server></config>`)
+	var v struct {
+		Port  int      `xpath:"/config/server/@port"`
+		Host  string   `xpath:"/config/server/host"`
+		Alias []string `xpath:"/config/server/alias"`
+		Third string   `xpath:"/config/server/alias[3]"`
+	}
+	v.Port, v.Host, v.Alias, v.Third = 8080, "new", []string{"b", "c"}, "d"
+	if err := MarshalXPath(FindOne(doc, "//server"), v); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "/config").OutputXML(true), `<config><server port="8080"><host>new</host><alias>b</alias><alias>c</alias><alias>d</alias></server></config>`)
+
+	var w struct {
+		Bad string `xpath:"//server[@port=1]"`
+	}
+	if err := MarshalXPath(doc, &w); err == nil {
+		t.Fatal("expected an unsupported path error but nil")
+	}
+}
@@ -9,35 +9,82 @@ import (
 )
 
 // DisableSelectorCache will disable caching for the query selector if value is true.
+//
+// Deprecated: use Configure(WithSelectorCache(0)), which is safe for
+// concurrent use.
 var DisableSelectorCache = false
 
 // SelectorCacheMaxEntries allows how many selector object can be caching. Default is 50.
 // Will disable caching if SelectorCacheMaxEntries <= 0.
+//
+// Deprecated: use Configure(WithSelectorCache(n)), which is safe for
+// concurrent use.
 var SelectorCacheMaxEntries = 50
 
-var (
-	cacheOnce  sync.Once
-	cache      *lru.Cache
-	cacheMutex sync.Mutex
-)
+// SelectorCache is a cache of compiled XPath expressions, safe for
+// concurrent use. The functions taking an expression as a string share one,
+// sized by WithSelectorCache; a caller needing a cache of its own size
+// compiles its expressions with a SelectorCache and queries with
+// QuerySelector and QuerySelectorAll.
+type SelectorCache struct {
+	mu    sync.Mutex
+	cache *lru.Cache
+}
 
-func getQuery(expr string) (*xpath.Expr, error) {
-	if DisableSelectorCache || SelectorCacheMaxEntries <= 0 {
+// NewSelectorCache returns a SelectorCache keeping at most maxEntries
+// expressions. A value <= 0 disables caching.
+func NewSelectorCache(maxEntries int) *SelectorCache {
+	return &SelectorCache{cache: lru.New(maxEntries)}
+}
+
+// Compile returns the compiled expression of expr, from the cache if
+// there.
+func (c *SelectorCache) Compile(expr string) (*xpath.Expr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.compile(expr)
+}
+
+// compile is Compile with c.mu held.
+func (c *SelectorCache) compile(expr string) (*xpath.Expr, error) {
+	if c.cache.MaxEntries <= 0 {
 		return xpath.Compile(expr)
 	}
-	cacheOnce.Do(func() {
-		cache = lru.New(SelectorCacheMaxEntries)
-	})
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-	if v, ok := cache.Get(expr); ok {
+	if v, ok := c.cache.Get(expr); ok {
 		return v.(*xpath.Expr), nil
 	}
 	v, err := xpath.Compile(expr)
 	if err != nil {
 		return nil, err
 	}
-	cache.Add(expr, v)
+	c.cache.Add(expr, v)
 	return v, nil
+}
 
+// resize sets the maximum number of expressions of c to maxEntries,
+// evicting the least recently used beyond it. c.mu must be held.
+func (c *SelectorCache) resize(maxEntries int) {
+	c.cache.MaxEntries = maxEntries
+	for c.cache.Len() > maxEntries {
+		c.cache.RemoveOldest()
+	}
+}
+
+// sharedCache is the SelectorCache of getQuery.
+var sharedCache = NewSelectorCache(SelectorCacheMaxEntries)
+
+func getQuery(expr string) (*xpath.Expr, error) {
+	disabled, entries := DisableSelectorCache, SelectorCacheMaxEntries
+	if c := currentConfig(); c.cacheSet {
+		disabled, entries = false, c.cacheEntries
+	}
+	if disabled || entries <= 0 {
+		return xpath.Compile(expr)
+	}
+	sharedCache.mu.Lock()
+	defer sharedCache.mu.Unlock()
+	if sharedCache.cache.MaxEntries != entries {
+		sharedCache.resize(entries)
+	}
+	return sharedCache.compile(expr)
 }
@@ -2,43 +2,161 @@ package xmlquery
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 )
 
+// cdataStart starts a CDATA section.
+const cdataStart = "<![CDATA["
+
+// defaultCacheCap is the default maximum number of bytes of a token kept
+// by cachedReader.
+const defaultCacheCap = 4096
+
+// cachedReader keeps the bytes read between StartCaching and StopCaching,
+// so the parser can look at the raw text of a token. The cache grows as
+// needed up to cacheCap bytes; the bytes beyond are dropped and reported by
+// Truncated.
 type cachedReader struct {
 	buffer *bufio.Reader
 	cache []byte
 	cacheCap int
 	cacheLen int
 	caching bool
+	truncated bool
+	head [len(cdataStart)]byte // first bytes cached, whatever cacheCap
+	headLen int
+	offset int64 // number of bytes read so far
+	cacheOffset int64 // offset of the first cached byte
+	last byte // last byte read
+	prev byte // last byte read before the first cached byte
+	limit int64 // maximum number of bytes to read, 0 if unlimited
+	lines int // number of line feeds read
+	lineStart int64 // offset of the line of the last byte read
+	prevLineStart int64 // offset of the line before
+	onEntity func(name []byte) // called when the ';' of an entity reference is read, nil if not needed
+	entity []byte // name of the entity reference being read
+	inEntity bool
+	src []byte // the input held in memory, see newSourceReader
+	inMemory bool
 }
 
 func newCachedReader(r *bufio.Reader) *cachedReader {
 	return &cachedReader{
 		buffer:   r,
-		cache:    make([]byte, 4096),
-		cacheCap: 4096,
+		cache:    make([]byte, 256),
+		cacheCap: defaultCacheCap,
 		cacheLen: 0,
 		caching:  false,
 	}
 }
 
+// newSourceReader returns a cachedReader reading src in place: the raw
+// text of the tokens is sliced from src instead of being cached.
+func newSourceReader(src []byte) *cachedReader {
+	return &cachedReader{src: src, inMemory: true, cacheCap: defaultCacheCap}
+}
+
+// SetCapacity sets the maximum number of bytes kept per token.
+func (c *cachedReader) SetCapacity(n int) {
+	c.cacheCap = n
+	if len(c.cache) > n {
+		c.cache = c.cache[:n]
+	}
+}
+
 func (c *cachedReader) StartCaching() {
+	c.cacheOffset = c.offset
+	c.prev = c.last
 	c.cacheLen = 0
+	c.headLen = 0
 	c.caching = true
+	c.truncated = false
+}
+
+// Truncated reports whether bytes were dropped from the cache since the
+// last call to StartCaching.
+func (c *cachedReader) Truncated() bool {
+	return c.truncated
+}
+
+func (c *cachedReader) cacheByte(b byte) {
+	if c.cacheLen == len(c.cache) {
+		if c.cacheLen >= c.cacheCap {
+			c.truncated = true
+			return
+		}
+		size := 2 * len(c.cache)
+		if size == 0 {
+			size = 256
+		}
+		if size > c.cacheCap {
+			size = c.cacheCap
+		}
+		cache := make([]byte, size)
+		copy(cache, c.cache[:c.cacheLen])
+		c.cache = cache
+	}
+	c.cache[c.cacheLen] = b
+	c.cacheLen++
 }
 
 func (c *cachedReader) ReadByte() (byte, error) {
+	if c.inMemory {
+		if c.offset >= int64(len(c.src)) {
+			return 0, io.EOF
+		}
+		if c.limit > 0 && c.offset >= c.limit {
+			return 0, c.limitError()
+		}
+		b := c.src[c.offset]
+		c.offset++
+		c.last = b
+		if b == '\n' {
+			c.newLine()
+		}
+		if c.onEntity != nil {
+			c.scanEntity(b)
+		}
+		return b, nil
+	}
 	if !c.caching {
-		return c.buffer.ReadByte()
+		b, err := c.buffer.ReadByte()
+		if err == nil {
+			if c.limit > 0 && c.offset >= c.limit {
+				return 0, c.limitError()
+			}
+			c.offset++
+			c.last = b
+			if b == '\n' {
+				c.newLine()
+			}
+			if c.onEntity != nil {
+				c.scanEntity(b)
+			}
+		}
+		return b, err
 	}
 	b, err := c.buffer.ReadByte()
 	if err != nil {
 		return b, err
 	}
-	if c.cacheLen < c.cacheCap {
-		c.cache[c.cacheLen] = b
-		c.cacheLen++
+	if c.limit > 0 && c.offset >= c.limit {
+		return 0, c.limitError()
+	}
+	c.offset++
+	c.last = b
+	if b == '\n' {
+		c.newLine()
+	}
+	if c.onEntity != nil {
+		c.scanEntity(b)
+	}
+	if c.headLen < len(c.head) {
+		c.head[c.headLen] = b
+		c.headLen++
 	}
+	c.cacheByte(b)
 	return b, err
 }
 
@@ -46,24 +164,152 @@ func (c *cachedReader) Cache() []byte {
 	return c.cache[:c.cacheLen]
 }
 
+// Raw returns the cached bytes between the offsets start and end, as
+// reported by xml.Decoder.InputOffset before and after reading a token.
+// As the decoder may have read ahead one byte before caching started, start
+// may precede the cache by one byte, which is then prepended. The result is
+// shorter than end-start if the cache was truncated.
+func (c *cachedReader) Raw(start, end int64) []byte {
+	var raw []byte
+	if end <= start {
+		return raw
+	}
+	if c.inMemory {
+		return c.src[start:end]
+	}
+	if start < c.cacheOffset {
+		raw = append(raw, c.prev)
+	}
+	n := end - c.cacheOffset
+	if n > int64(c.cacheLen) {
+		n = int64(c.cacheLen)
+	}
+	if n > 0 {
+		raw = append(raw, c.cache[:n]...)
+	}
+	return raw
+}
+
+// IsCDATA reports whether the token read from the offset start, as for
+// Raw, is a CDATA section. Unlike the cached bytes, the start of the token
+// is kept whatever the capacity of the cache.
+func (c *cachedReader) IsCDATA(start int64) bool {
+	if c.inMemory {
+		return start < int64(len(c.src)) && bytes.HasPrefix(c.src[start:], []byte(cdataStart))
+	}
+	var b [len(cdataStart) + 1]byte
+	head := b[:0]
+	if start < c.cacheOffset {
+		head = append(head, c.prev)
+	}
+	head = append(head, c.head[:c.headLen]...)
+	return bytes.HasPrefix(head, []byte(cdataStart))
+}
+
+// Reset makes c read from r, keeping its cache buffer.
+func (c *cachedReader) Reset(r io.Reader) {
+	c.buffer.Reset(r)
+	c.cacheLen = 0
+	c.caching = false
+	c.truncated = false
+	c.offset = 0
+	c.cacheOffset = 0
+	c.last = 0
+	c.prev = 0
+	c.lines = 0
+	c.lineStart = 0
+	c.prevLineStart = 0
+	c.inEntity = false
+}
+
 func (c *cachedReader) StopCaching() {
 	c.caching = false
 }
 
 func (c *cachedReader) Read(p []byte) (int, error) {
+	if c.inMemory {
+		if c.offset >= int64(len(c.src)) {
+			return 0, io.EOF
+		}
+		n := copy(p, c.src[c.offset:])
+		if c.limit > 0 && c.offset+int64(n) > c.limit {
+			return 0, c.limitError()
+		}
+		if n > 0 {
+			c.offset += int64(n)
+			c.last = p[n-1]
+		}
+		return n, nil
+	}
 	n, err := c.buffer.Read(p)
 	if err != nil {
 		return n, err
 	}
-	if c.caching && c.cacheLen < c.cacheCap {
-		for i := 0; i < n; i++ {
-			c.cache[c.cacheLen] = p[i]
-			c.cacheLen++
-			if c.cacheLen >= c.cacheCap {
-				break
-			}
+	if c.limit > 0 && c.offset+int64(n) > c.limit {
+		return 0, c.limitError()
+	}
+	if n > 0 {
+		c.offset += int64(n)
+		c.last = p[n-1]
+	}
+	if c.caching {
+		c.headLen += copy(c.head[c.headLen:], p[:n])
+		for i := 0; i < n && !c.truncated; i++ {
+			c.cacheByte(p[i])
 		}
 	}
 	return n, err
 }
 
+
+// limitError returns the error reported once more than c.limit bytes are
+// read.
+func (c *cachedReader) limitError() error {
+	return &LimitError{Limit: "MaxBytes", Max: c.limit, Offset: c.limit}
+}
+
+// maxEntityName is the maximum length of the entity names reported to
+// onEntity.
+const maxEntityName = 256
+
+// scanEntity follows the entity references in the bytes read, so that
+// onEntity is called with the name of each one as its ';' is read, before
+// the decoder looks the entity up. It is also called for references in
+// comments, CDATA sections and processing instructions, which the decoder
+// does not look up.
+func (c *cachedReader) scanEntity(b byte) {
+	switch {
+	case b == '&':
+		c.entity = c.entity[:0]
+		c.inEntity = true
+	case !c.inEntity:
+	case b == ';':
+		c.inEntity = false
+		if len(c.entity) > 0 {
+			c.onEntity(c.entity)
+		}
+	case len(c.entity) < maxEntityName && (b >= 0x80 || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_' || b == '-' || b == '.' || b == ':'):
+		c.entity = append(c.entity, b)
+	default:
+		c.inEntity = false
+	}
+}
+
+func (c *cachedReader) newLine() {
+	c.lines++
+	c.prevLineStart = c.lineStart
+	c.lineStart = c.offset
+}
+
+// position returns the line and column, both counted from 1, of offset,
+// which must not precede the last byte read by more than one byte, as for
+// the start of a token reported by xml.Decoder.InputOffset. Only the bytes
+// read by ReadByte are accounted for.
+func (c *cachedReader) position(offset int64) (line, column int) {
+	line, lineStart := c.lines+1, c.lineStart
+	if offset < lineStart {
+		// The line feed read ahead follows offset.
+		line, lineStart = line-1, c.prevLineStart
+	}
+	return line, int(offset-lineStart) + 1
+}
@@ -40,3 +40,40 @@ func TestCaching(t *testing.T) {
 		t.Fatalf("Incorrect cached buffer value")
 	}
 }
+
+func TestCachingGrowth(t *testing.T) {
+	s := strings.Repeat("x", 1000)
+	cachedReader := newCachedReader(bufio.NewReader(strings.NewReader(s)))
+	cachedReader.StartCaching()
+	for i := 0; i < len(s); i++ {
+		if _, err := cachedReader.ReadByte(); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if v := string(cachedReader.Cache()); v != s {
+		t.Fatalf("Expected %d cached bytes, got %d instead.", len(s), len(v))
+	}
+	if cachedReader.Truncated() {
+		t.Fatal("Expected cache not to be truncated")
+	}
+}
+
+func TestCachingTruncated(t *testing.T) {
+	cachedReader := newCachedReader(bufio.NewReader(strings.NewReader("ABCDEF")))
+	cachedReader.SetCapacity(4)
+	cachedReader.StartCaching()
+	tmpBuf := make([]byte, 10)
+	if _, err := cachedReader.Read(tmpBuf); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Equal(cachedReader.Cache(), []byte("ABCD")) {
+		t.Fatalf("Incorrect cached buffer value %q", cachedReader.Cache())
+	}
+	if !cachedReader.Truncated() {
+		t.Fatal("Expected cache to be truncated")
+	}
+	cachedReader.StartCaching()
+	if cachedReader.Truncated() {
+		t.Fatal("Expected StartCaching to reset truncation")
+	}
+}
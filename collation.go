@@ -0,0 +1,135 @@
+package xmlquery
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/antchfx/xpath"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation sorts and compares the string values of nodes according to
+// the rules of a language, where XPath compares strings byte-wise. The
+// comparisons of an expression itself cannot use a collation; Collation
+// applies to the nodes it selects. A Collation is safe for concurrent use.
+type Collation struct {
+	mu       sync.Mutex
+	collator *collate.Collator
+}
+
+// NewCollation returns a collation for the language tag. Options such as
+// collate.IgnoreCase or collate.Loose adjust the comparisons.
+func NewCollation(tag language.Tag, opts ...collate.Option) *Collation {
+	return &Collation{collator: collate.New(tag, opts...)}
+}
+
+// Compare returns -1, 0 or 1 as a sorts before, equal to or after b.
+func (c *Collation) Compare(a, b string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collator.CompareString(a, b)
+}
+
+// Sort sorts nodes in place by the string value of keyExpr evaluated from
+// each node, such as "." for its inner text or "@name" for an attribute.
+// The sort is stable.
+func (c *Collation) Sort(nodes []*Node, keyExpr string) error {
+	keys, err := sortKeys(nodes, keyExpr)
+	if err != nil {
+		return err
+	}
+	indexes := make([]int, len(nodes))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	c.mu.Lock()
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return c.collator.CompareString(keys[indexes[i]], keys[indexes[j]]) < 0
+	})
+	c.mu.Unlock()
+	sorted := make([]*Node, len(nodes))
+	for i, k := range indexes {
+		sorted[i] = nodes[k]
+	}
+	copy(nodes, sorted)
+	return nil
+}
+
+// QueryAll is like the QueryAll function, but returns the nodes sorted by
+// keyExpr, see Sort.
+func (c *Collation) QueryAll(top *Node, expr, keyExpr string) ([]*Node, error) {
+	nodes, err := QueryAll(top, expr)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Sort(nodes, keyExpr); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Filter returns the nodes whose string value of keyExpr compares to value
+// as op, one of =, !=, <, <=, > and >=, according to the collation.
+func (c *Collation) Filter(nodes []*Node, keyExpr, op, value string) ([]*Node, error) {
+	var accept func(int) bool
+	switch op {
+	case "=":
+		accept = func(r int) bool { return r == 0 }
+	case "!=":
+		accept = func(r int) bool { return r != 0 }
+	case "<":
+		accept = func(r int) bool { return r < 0 }
+	case "<=":
+		accept = func(r int) bool { return r <= 0 }
+	case ">":
+		accept = func(r int) bool { return r > 0 }
+	case ">=":
+		accept = func(r int) bool { return r >= 0 }
+	default:
+		return nil, fmt.Errorf("xmlquery: invalid comparison operator %s", op)
+	}
+	keys, err := sortKeys(nodes, keyExpr)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Node
+	for i, n := range nodes {
+		if accept(c.Compare(keys[i], value)) {
+			list = append(list, n)
+		}
+	}
+	return list, nil
+}
+
+// sortKeys returns the string values of keyExpr evaluated from each node.
+func sortKeys(nodes []*Node, keyExpr string) ([]string, error) {
+	exp, err := getQuery(keyExpr)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(nodes))
+	for i, n := range nodes {
+		keys[i] = evaluateString(n, exp)
+	}
+	return keys, nil
+}
+
+// evaluateString returns the XPath string value of exp evaluated from n.
+func evaluateString(n *Node, exp *xpath.Expr) string {
+	switch v := exp.Evaluate(CreateXPathNavigator(n)).(type) {
+	case *xpath.NodeIterator:
+		if v.MoveNext() {
+			return v.Current().Value()
+		}
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,71 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestCollation(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<names>
+		<name lang="sv">Örjan</name>
+		<name>Zoé</name>
+		<name>Émile</name>
+		<name>eva</name>
+		<name>Adam</name>
+	</names>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := func(nodes []*Node) string {
+		var list []string
+		for _, n := range nodes {
+			list = append(list, n.InnerText())
+		}
+		return strings.Join(list, ",")
+	}
+
+	fr := NewCollation(language.French)
+	nodes, err := fr.QueryAll(doc, "//name", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(nodes); got != "Adam,Émile,eva,Örjan,Zoé" {
+		t.Fatalf("French order: %s", got)
+	}
+	// In Swedish, Ö sorts after Z.
+	sv := NewCollation(language.Swedish)
+	if err := sv.Sort(nodes, "."); err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(nodes); got != "Adam,Émile,eva,Zoé,Örjan" {
+		t.Fatalf("Swedish order: %s", got)
+	}
+
+	loose := NewCollation(language.French, collate.Loose)
+	list, err := loose.Filter(Find(doc, "//name"), ".", "=", "emile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(list); got != "Émile" {
+		t.Fatalf("loose equality: %s", got)
+	}
+	list, err = fr.Filter(Find(doc, "//name"), ".", "<", "F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(list); got != "Émile,eva,Adam" {
+		t.Fatalf("less than F: %s", got)
+	}
+	if _, err := fr.Filter(nil, ".", "~", "x"); err == nil {
+		t.Fatal("expected an error for an invalid operator")
+	}
+	if err := fr.Sort(nodes, "@["); err == nil {
+		t.Fatal("expected an error for an invalid key expression")
+	}
+	if fr.Compare("é", "f") >= 0 {
+		t.Fatal("é must sort before f")
+	}
+}
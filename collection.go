@@ -0,0 +1,99 @@
+package xmlquery
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Collection is a set of named documents that can be queried together, for
+// example to check references across the files of a project.
+type Collection struct {
+	names []string
+	docs  map[string]*Node
+}
+
+// CollectionResult is a node found in a document of a Collection.
+type CollectionResult struct {
+	// Source is the name of the document holding Node.
+	Source string
+	Node   *Node
+}
+
+// NewCollection returns an empty collection.
+func NewCollection() *Collection {
+	return &Collection{docs: make(map[string]*Node)}
+}
+
+// Add adds doc to the collection under name, replacing any document of the
+// same name.
+func (c *Collection) Add(name string, doc *Node) {
+	if _, ok := c.docs[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.docs[name] = doc
+}
+
+// AddFile parses the file at path and adds it to the collection under its
+// path, which is also its source name.
+func (c *Collection) AddFile(path string, options ParserOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	options.SourceName = path
+	doc, err := ParseWithOptions(f, options)
+	if err != nil {
+		return err
+	}
+	c.Add(path, doc)
+	return nil
+}
+
+// Doc returns the document added under name, or nil.
+func (c *Collection) Doc(name string) *Node {
+	return c.docs[name]
+}
+
+// Names returns the names of the documents, in the order they were added.
+func (c *Collection) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+var docCall = regexp.MustCompile(`^\s*doc\(\s*(?:'([^']*)'|"([^"]*)")\s*\)`)
+
+// Find evaluates expr against every document of the collection, in the
+// order they were added, and returns the matching nodes with the name of
+// their document.
+//
+// An expression starting with doc('name') is evaluated against the named
+// document only: doc('b.xml')//item selects the item elements of b.xml,
+// and doc('b.xml') its document node. doc() is only recognized there, not
+// within predicates or other expressions.
+func (c *Collection) Find(expr string) ([]CollectionResult, error) {
+	names := c.names
+	if m := docCall.FindStringSubmatch(expr); m != nil {
+		name := m[1] + m[2]
+		doc, ok := c.docs[name]
+		if !ok {
+			return nil, fmt.Errorf("xmlquery: no document %s in the collection", name)
+		}
+		expr = expr[len(m[0]):]
+		if expr == "" {
+			return []CollectionResult{{Source: name, Node: doc}}, nil
+		}
+		names = []string{name}
+	}
+	var results []CollectionResult
+	for _, name := range names {
+		list, err := QueryAll(c.docs[name], expr)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range list {
+			results = append(results, CollectionResult{Source: name, Node: n})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,86 @@
+package xmlquery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollection(t *testing.T) {
+	c := NewCollection()
+	for name, s := range map[string]string{
+		"a.xml": `<defs><def id="x"/><def id="y"/></defs>`,
+		"b.xml": `<uses><use ref="x"/><use ref="z"/><def id="w"/></uses>`,
+	} {
+		doc, err := Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Add(name, doc)
+	}
+
+	results, err := c.Find("//def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]int{}
+	for _, r := range results {
+		sources[r.Source]++
+	}
+	if len(results) != 3 || sources["a.xml"] != 2 || sources["b.xml"] != 1 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	// Check the references of b.xml against the definitions of a.xml.
+	uses, err := c.Find("doc('b.xml')//use/@ref")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing []string
+	for _, use := range uses {
+		if ref := use.Node.InnerText(); c.Doc("a.xml") != nil && FindOne(c.Doc("a.xml"), "//def[@id='"+ref+"']") == nil {
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) != 1 || missing[0] != "z" {
+		t.Fatalf("got missing references %v", missing)
+	}
+
+	if results, err := c.Find(`doc("a.xml")`); err != nil || len(results) != 1 || results[0].Node.Type != DocumentNode {
+		t.Fatalf("doc() alone: %v %v", results, err)
+	}
+	if _, err := c.Find("doc('c.xml')//x"); err == nil {
+		t.Fatal("expected an error for an unknown document")
+	}
+	if _, err := c.Find("//def["); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+}
+
+func TestCollectionAddFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlquery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.xml")
+	if err := ioutil.WriteFile(path, []byte(`<a><b/></a>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCollection()
+	if err := c.AddFile(path, ParserOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := c.Find("//b")
+	if err != nil || len(results) != 1 || results[0].Source != path || results[0].Node.SourceName() != path {
+		t.Fatalf("unexpected results %+v, %v", results, err)
+	}
+	if err := c.AddFile(filepath.Join(dir, "missing.xml"), ParserOptions{}); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+	if names := c.Names(); len(names) != 1 || names[0] != path {
+		t.Fatalf("got names %v", names)
+	}
+}
@@ -0,0 +1,82 @@
+package xmlquery
+
+import (
+	"sync"
+)
+
+// GlobalOption configures the package defaults, see Configure.
+type GlobalOption func(*globalConfiguration)
+
+type globalConfiguration struct {
+	cacheSet      bool
+	cacheEntries  int
+	queryHook     func(QueryEvent)
+	parserOptions ParserOptions
+	outputOptions []OutputOption
+}
+
+var (
+	globalMutex  sync.RWMutex
+	globalConfig = &globalConfiguration{}
+)
+
+// Configure sets the package defaults. Options not given keep their
+// current value. Unlike assigning the package variables it replaces, such
+// as SelectorCacheMaxEntries, Configure is safe to call while other
+// goroutines run queries.
+func Configure(opts ...GlobalOption) {
+	globalMutex.Lock()
+	defer globalMutex.Unlock()
+	c := *globalConfig
+	c.outputOptions = append([]OutputOption(nil), c.outputOptions...)
+	for _, opt := range opts {
+		opt(&c)
+	}
+	globalConfig = &c
+}
+
+// currentConfig returns the configuration set by Configure. It must not
+// be modified.
+func currentConfig() *globalConfiguration {
+	globalMutex.RLock()
+	defer globalMutex.RUnlock()
+	return globalConfig
+}
+
+// WithSelectorCache sets the number of compiled expressions kept in the
+// selector cache. A value <= 0 disables the cache. It takes precedence over
+// DisableSelectorCache and SelectorCacheMaxEntries. A caller needing a cache
+// of another size uses a SelectorCache of its own.
+func WithSelectorCache(maxEntries int) GlobalOption {
+	return func(c *globalConfiguration) {
+		c.cacheSet = true
+		c.cacheEntries = maxEntries
+	}
+}
+
+// WithQueryHook sets the function called after every evaluation of an
+// expression, see QueryHook. A nil fn removes the hook.
+func WithQueryHook(fn func(QueryEvent)) GlobalOption {
+	return func(c *globalConfiguration) {
+		c.queryHook = fn
+	}
+}
+
+// WithDefaultParserOptions sets the options used by Parse, LoadURL and
+// CreateStreamParser, which parse without explicit options, for example to
+// enforce stream limits. ParseWithOptions and the other functions taking
+// ParserOptions use the options they are given.
+func WithDefaultParserOptions(options ParserOptions) GlobalOption {
+	return func(c *globalConfiguration) {
+		c.parserOptions = options
+	}
+}
+
+// WithDefaultOutputOptions sets the options applied before the options
+// given to OutputXML, OutputXMLWithOptions, Write, WriteWithOptions and
+// WriteChecked.
+func WithDefaultOutputOptions(opts ...OutputOption) GlobalOption {
+	return func(c *globalConfiguration) {
+		c.outputOptions = append([]OutputOption(nil), opts...)
+	}
+}
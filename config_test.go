@@ -0,0 +1,115 @@
+package xmlquery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// restoreConfig restores the configuration in effect when it was called.
+func restoreConfig() func() {
+	saved := currentConfig()
+	return func() {
+		globalMutex.Lock()
+		globalConfig = saved
+		globalMutex.Unlock()
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer restoreConfig()()
+
+	var exprs []string
+	Configure(
+		WithQueryHook(func(e QueryEvent) { exprs = append(exprs, e.Expr) }),
+		WithDefaultOutputOptions(WithEmptyTagSupport()),
+		WithDefaultParserOptions(ParserOptions{Limits: Limits{MaxNodes: 10}}),
+	)
+	doc, err := Parse(strings.NewReader(`<a><b></b></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := FindOne(doc, "//b"); n == nil {
+		t.Fatal("//b not found")
+	}
+	if len(exprs) != 1 || exprs[0] != "//b" {
+		t.Fatalf("hook not called: %v", exprs)
+	}
+	if got := doc.SelectElement("a").OutputXML(true); got != `<a><b/></a>` {
+		t.Fatalf("default output options not applied: %s", got)
+	}
+
+	// Options not given keep their value.
+	Configure(WithSelectorCache(0))
+	FindOne(doc, "//a")
+	if exprs[len(exprs)-1] != "//a" {
+		t.Fatal("query hook lost by a later Configure call")
+	}
+
+	// The default parser options apply to the stream parser.
+	var b strings.Builder
+	b.WriteString("<r>")
+	for i := 0; i < 20; i++ {
+		b.WriteString("<x><y/><y/></x>")
+	}
+	b.WriteString("</r>")
+	sp, err := CreateStreamParser(strings.NewReader(b.String()), "/r/x/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.p.limits.MaxNodes != 10 {
+		t.Fatalf("default parser options not applied, MaxNodes=%d", sp.p.limits.MaxNodes)
+	}
+}
+
+func TestConfigureSelectorCache(t *testing.T) {
+	defer restoreConfig()()
+
+	Configure(WithSelectorCache(0))
+	a, _ := getQuery("//configure-cache")
+	b, _ := getQuery("//configure-cache")
+	if a == b {
+		t.Fatal("expression cached while the cache is disabled")
+	}
+	Configure(WithSelectorCache(10))
+	a, _ = getQuery("//configure-cache")
+	b, _ = getQuery("//configure-cache")
+	if a != b {
+		t.Fatal("expression not cached")
+	}
+
+	// A smaller size evicts the expressions beyond it once.
+	for i := 0; i < 10; i++ {
+		getQuery(fmt.Sprintf("//configure-cache[%d]", i))
+	}
+	Configure(WithSelectorCache(2))
+	getQuery("//configure-cache")
+	if n := sharedCache.cache.Len(); n != 2 {
+		t.Fatalf("got %d cached expressions", n)
+	}
+}
+
+func TestSelectorCache(t *testing.T) {
+	c := NewSelectorCache(1)
+	a, err := c.Compile("//book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := c.Compile("//book"); a != b {
+		t.Fatal("expression not cached")
+	}
+	c.Compile("//magazine")
+	if b, _ := c.Compile("//book"); a == b {
+		t.Fatal("expression not evicted")
+	}
+	testValue(t, len(QuerySelectorAll(doc, a)), 3)
+	if _, err := c.Compile("//a[@a==1]"); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+
+	c = NewSelectorCache(0)
+	a, _ = c.Compile("//book")
+	if b, _ := c.Compile("//book"); a == b {
+		t.Fatal("expression cached while the cache is disabled")
+	}
+}
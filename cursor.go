@@ -0,0 +1,114 @@
+package xmlquery
+
+import (
+	"github.com/antchfx/xpath"
+)
+
+// ResultCursor pages through the nodes matching an expression without
+// collecting them all: the expression is evaluated lazily, as batches are
+// requested. The tree must not be changed while the cursor is used.
+type ResultCursor struct {
+	top    *Node
+	expr   string
+	it     *xpath.NodeIterator
+	offset int
+	done   bool
+	count  int // total number of matches, -1 until counted
+}
+
+// NewResultCursor returns a cursor over the nodes matching expr evaluated
+// from top. Returns an error if the expression `expr` cannot be parsed.
+func NewResultCursor(top *Node, expr string) (*ResultCursor, error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultCursor{
+		top:   top,
+		expr:  expr,
+		it:    exp.Select(CreateXPathNavigator(top)),
+		count: -1,
+	}, nil
+}
+
+// Next returns the next batch of at most n matching nodes. It returns an
+// empty batch once all nodes were returned. Returns an error if the
+// expression cannot be evaluated, after which the cursor is done.
+func (c *ResultCursor) Next(n int) (batch []*Node, err error) {
+	defer c.fail(&err)
+	defer recoverEval(c.expr, &err)
+	for len(batch) < n && !c.done {
+		if !c.it.MoveNext() {
+			c.done = true
+			break
+		}
+		batch = append(batch, getCurrentNode(c.it))
+	}
+	c.offset += len(batch)
+	return batch, nil
+}
+
+// Skip moves past the next n matching nodes, for example to jump to a
+// page, and returns the number of nodes skipped. Errors are as for Next.
+func (c *ResultCursor) Skip(n int) (skipped int, err error) {
+	defer c.fail(&err)
+	defer recoverEval(c.expr, &err)
+	for skipped < n && !c.done {
+		if !c.it.MoveNext() {
+			c.done = true
+			break
+		}
+		skipped++
+	}
+	c.offset += skipped
+	return skipped, nil
+}
+
+// fail ends the cursor once its evaluation failed.
+func (c *ResultCursor) fail(err *error) {
+	if *err != nil {
+		c.done = true
+	}
+}
+
+// Offset returns the number of nodes returned or skipped so far.
+func (c *ResultCursor) Offset() int {
+	return c.offset
+}
+
+// Done reports whether all matching nodes were returned or skipped.
+func (c *ResultCursor) Done() bool {
+	return c.done
+}
+
+// Count returns the total number of matching nodes. Once the cursor is done
+// the count is known; before, it is computed by a separate evaluation of
+// count(expr), which walks the tree but does not collect the nodes. The
+// result is kept for later calls.
+func (c *ResultCursor) Count() (int, error) {
+	if c.done {
+		return c.offset, nil
+	}
+	if c.count < 0 {
+		n, err := Count(c.top, c.expr)
+		if err != nil {
+			return 0, err
+		}
+		c.count = n
+	}
+	return c.count, nil
+}
+
+// EstimateCount returns the number of matching nodes known without further
+// evaluation: the exact total once the cursor is done or Count was called,
+// and otherwise a lower bound, the offset plus one if more nodes may
+// follow. exact reports which one it is.
+func (c *ResultCursor) EstimateCount() (n int, exact bool) {
+	switch {
+	case c.done:
+		return c.offset, true
+	case c.count >= 0:
+		return c.count, true
+	}
+	return c.offset + 1, false
+}
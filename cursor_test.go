@@ -0,0 +1,76 @@
+package xmlquery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestResultCursor(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<list>")
+	for i := 1; i <= 25; i++ {
+		fmt.Fprintf(&b, "<item>%d</item>", i)
+	}
+	b.WriteString("</list>")
+	doc, err := Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewResultCursor(doc, "//item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, exact := c.EstimateCount(); n != 1 || exact {
+		t.Fatalf("got estimate %d, %v", n, exact)
+	}
+	page, err := c.Next(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 10 || page[0].InnerText() != "1" || page[9].InnerText() != "10" {
+		t.Fatalf("unexpected first page %v", page)
+	}
+	if n, exact := c.EstimateCount(); n != 11 || exact {
+		t.Fatalf("got estimate %d, %v", n, exact)
+	}
+	if n, err := c.Count(); err != nil || n != 25 {
+		t.Fatalf("got count %d, %v", n, err)
+	}
+	if n, exact := c.EstimateCount(); n != 25 || !exact {
+		t.Fatalf("got estimate %d, %v", n, exact)
+	}
+	if n, err := c.Skip(10); err != nil || n != 10 || c.Offset() != 20 {
+		t.Fatalf("skipped %d, offset %d", n, c.Offset())
+	}
+	page, err = c.Next(10)
+	if err != nil || len(page) != 5 || page[0].InnerText() != "21" || !c.Done() {
+		t.Fatalf("unexpected last page %v", page)
+	}
+	if page, err := c.Next(10); err != nil || len(page) != 0 {
+		t.Fatal("expected an empty page at the end")
+	}
+	if n, _ := c.Count(); n != 25 {
+		t.Fatalf("got count %d", n)
+	}
+
+	if _, err := NewResultCursor(doc, "//item["); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	c, err = NewResultCursor(doc, "//item[matches(., concat('(', .))]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Next(10); err == nil || !c.Done() {
+		t.Fatalf("expected an evaluation error, got %v", err)
+	}
+	c, err = NewResultCursor(doc, "//item[matches(., concat('(', .))]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Skip(10); err == nil {
+		t.Fatal("Skip: expected an evaluation error")
+	}
+}
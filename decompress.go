@@ -0,0 +1,79 @@
+package xmlquery
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Decompressor returns a reader that decompresses r.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+type decompressor struct {
+	magic []byte
+	fn    Decompressor
+}
+
+var (
+	decompressorsMutex sync.RWMutex
+	decompressors      = []decompressor{
+		{magic: []byte{0x1f, 0x8b}, fn: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{magic: []byte("BZh"), fn: func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }},
+	}
+)
+
+// RegisterDecompressor registers a decompressor for inputs starting with the
+// given magic bytes, for example 28 b5 2f fd for zstd. Parse and
+// StreamParser decompress such inputs transparently, unless
+// ParserOptions.DisableDecompression is set. gzip and bzip2 are registered
+// by default; registering the same magic bytes again replaces the
+// decompressor.
+func RegisterDecompressor(magic []byte, fn Decompressor) {
+	decompressorsMutex.Lock()
+	defer decompressorsMutex.Unlock()
+	for i, d := range decompressors {
+		if bytes.Equal(d.magic, magic) {
+			decompressors[i].fn = fn
+			return
+		}
+	}
+	decompressors = append(decompressors, decompressor{magic: append([]byte(nil), magic...), fn: fn})
+}
+
+// compressed reports whether data starts with the magic bytes of a
+// registered decompressor.
+func compressed(data []byte) bool {
+	decompressorsMutex.RLock()
+	defer decompressorsMutex.RUnlock()
+	for _, d := range decompressors {
+		if bytes.HasPrefix(data, d.magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// decompress returns a reader over the decompressed content of r if it
+// starts with the magic bytes of a registered decompressor, or a reader over
+// r itself otherwise.
+func decompress(r io.Reader) (io.Reader, error) {
+	decompressorsMutex.RLock()
+	defer decompressorsMutex.RUnlock()
+	n := 0
+	for _, d := range decompressors {
+		if len(d.magic) > n {
+			n = len(d.magic)
+		}
+	}
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(n)
+	for _, d := range decompressors {
+		if bytes.HasPrefix(head, d.magic) {
+			return d.fn(br)
+		}
+	}
+	return br, nil
+}
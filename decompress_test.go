@@ -0,0 +1,61 @@
+package xmlquery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func gzipString(s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.Bytes()
+}
+
+func TestParseGzip(t *testing.T) {
+	data := gzipString(`<a><b>1</b><b>2</b></a>`)
+	doc, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, len(Find(doc, "//b")), 2)
+
+	sp, err := CreateStreamParser(bytes.NewReader(data), "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := sp.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, n.InnerText(), "1")
+
+	_, err = ParseWithOptions(bytes.NewReader(data), ParserOptions{DisableDecompression: true})
+	if err == nil {
+		t.Fatal("expected a syntax error but nil")
+	}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	RegisterDecompressor([]byte("REV:"), func(r io.Reader) (io.Reader, error) {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		b = b[4:]
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return bytes.NewReader(b), nil
+	})
+	doc, err := Parse(strings.NewReader("REV:>a/<x>a<"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "/a").InnerText(), "x")
+}
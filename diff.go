@@ -0,0 +1,235 @@
+package xmlquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind int
+
+const (
+	// ChangeAdded is a node found only in the new tree.
+	ChangeAdded ChangeKind = iota
+	// ChangeRemoved is a node found only in the old tree.
+	ChangeRemoved
+	// ChangeModified is a node found in both trees with different
+	// attributes or data. Changes of its children are reported separately.
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a difference between two trees, see Diff.
+type Change struct {
+	Kind ChangeKind
+	// Path is the XPath location of the node, in the old tree unless the
+	// node was added, for example /catalog/book[2]/price.
+	Path string
+	// Old and New are the node in the old and in the new tree; Old is nil
+	// for added nodes and New for removed nodes.
+	Old, New *Node
+}
+
+// Diff returns the changes turning the tree rooted at a into the tree
+// rooted at b, in document order. Nodes are compared as by Equal, using
+// the same options. Children are matched in order: unchanged children are
+// kept in place, and children of the same type and name in between are
+// compared with each other, the others being added or removed.
+func Diff(a, b *Node, opts ...CompareOption) []Change {
+	config := &compareConfiguration{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	var changes []Change
+	if a.Type != b.Type || !config.sameName(a, b) {
+		return append(changes, Change{Kind: ChangeModified, Path: nodePath(a), Old: a, New: b})
+	}
+	config.diff(a, b, &changes)
+	return changes
+}
+
+// diff appends the changes between a and b, which have the same type and
+// name, to changes.
+func (c *compareConfiguration) diff(a, b *Node, changes *[]Change) {
+	modified := !c.sameAttrs(a, b)
+	switch a.Type {
+	case TextNode, CharDataNode, CommentNode, NotationNode:
+		modified = modified || !c.equal(a, b)
+	}
+	if modified {
+		*changes = append(*changes, Change{Kind: ChangeModified, Path: nodePath(a), Old: a, New: b})
+	}
+	var xs, ys []*Node
+	for x := c.next(a.FirstChild); x != nil; x = c.next(x.NextSibling) {
+		xs = append(xs, x)
+	}
+	for y := c.next(b.FirstChild); y != nil; y = c.next(y.NextSibling) {
+		ys = append(ys, y)
+	}
+	// lcs[i][j] is the length of the longest common subsequence of equal
+	// nodes of xs[i:] and ys[j:].
+	lcs := make([][]int, len(xs)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(ys)+1)
+	}
+	for i := len(xs) - 1; i >= 0; i-- {
+		for j := len(ys) - 1; j >= 0; j-- {
+			switch {
+			case c.equal(xs[i], ys[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j, i0, j0 := 0, 0, 0, 0
+	for i < len(xs) && j < len(ys) {
+		switch {
+		case lcs[i][j] == lcs[i+1][j+1]+1 && c.equal(xs[i], ys[j]):
+			c.diffGap(xs[i0:i], ys[j0:j], changes)
+			i, j = i+1, j+1
+			i0, j0 = i, j
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	c.diffGap(xs[i0:], ys[j0:], changes)
+}
+
+// diffGap appends the changes between the unmatched children xs and ys,
+// comparing those of the same type and name in order.
+func (c *compareConfiguration) diffGap(xs, ys []*Node, changes *[]Change) {
+	for len(xs) > 0 || len(ys) > 0 {
+		switch {
+		case len(ys) == 0:
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Path: nodePath(xs[0]), Old: xs[0]})
+			xs = xs[1:]
+		case len(xs) == 0:
+			*changes = append(*changes, Change{Kind: ChangeAdded, Path: nodePath(ys[0]), New: ys[0]})
+			ys = ys[1:]
+		case xs[0].Type == ys[0].Type && c.sameName(xs[0], ys[0]):
+			c.diff(xs[0], ys[0], changes)
+			xs, ys = xs[1:], ys[1:]
+		default:
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Path: nodePath(xs[0]), Old: xs[0]})
+			xs = xs[1:]
+		}
+	}
+}
+
+// nodePath returns the absolute XPath location of n, with a position
+// predicate where n has siblings matching the same step.
+func nodePath(n *Node) string {
+	var steps []string
+	for ; n != nil && n.Type != DocumentNode && n.Type != FragmentNode; n = n.Parent {
+		step := pathStep(n)
+		pos, count := 0, 0
+		first := n
+		for first.PrevSibling != nil {
+			first = first.PrevSibling
+		}
+		for s := first; s != nil; s = s.NextSibling {
+			if pathStep(s) == step {
+				count++
+				if s == n {
+					pos = count
+				}
+			}
+		}
+		if count > 1 {
+			step += fmt.Sprintf("[%d]", pos)
+		}
+		steps = append(steps, step)
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return "/" + strings.Join(steps, "/")
+}
+
+func pathStep(n *Node) string {
+	switch n.Type {
+	case ElementNode:
+		return n.qualifiedName()
+	case TextNode, CharDataNode:
+		return "text()"
+	case CommentNode:
+		return "comment()"
+	case DeclarationNode:
+		return "processing-instruction('" + n.Data + "')"
+	}
+	return "node()"
+}
+
+// DiffText returns a readable report of the changes between a and b, see
+// Diff, or "" if there are none. Like a unified diff, it has a hunk for
+// each change, headed by the XPath location of the node and listing the
+// indented XML output of the removed and added nodes. For modified
+// elements, only the start tags are listed.
+//
+//	--- a
+//	+++ b
+//	@@ /catalog/book[2]/price/text() @@
+//	-10
+//	+12
+//
+// The headers show the source names of the documents, see
+// Node.SourceName, if set.
+func DiffText(a, b *Node, opts ...CompareOption) string {
+	changes := Diff(a, b, opts...)
+	if len(changes) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", diffLabel(a, "a"), diffLabel(b, "b"))
+	for _, change := range changes {
+		fmt.Fprintf(&sb, "@@ %s @@\n", change.Path)
+		whole := change.Kind != ChangeModified || change.Old.Type != ElementNode ||
+			change.New.Type != ElementNode || change.Old.qualifiedName() != change.New.qualifiedName()
+		if change.Old != nil {
+			for _, line := range diffLines(change.Old, whole) {
+				sb.WriteString("-" + line + "\n")
+			}
+		}
+		if change.New != nil {
+			for _, line := range diffLines(change.New, whole) {
+				sb.WriteString("+" + line + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func diffLabel(n *Node, name string) string {
+	if source := n.SourceName(); source != "" {
+		return source
+	}
+	return name
+}
+
+// diffLines returns the lines of the XML output of n, or of its start tag
+// only unless whole is set.
+func diffLines(n *Node, whole bool) []string {
+	if !whole {
+		tag := &Node{Type: n.Type, Data: n.Data, Prefix: n.Prefix, Attr: n.Attr}
+		s := tag.OutputXMLWithOptions(WithOutputSelf())
+		return []string{strings.TrimSuffix(s, "</"+n.qualifiedName()+">")}
+	}
+	s := n.OutputXMLWithOptions(WithOutputSelf(), WithIndentation("  "))
+	return strings.Split(strings.Trim(s, "\n"), "\n")
+}
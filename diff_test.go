@@ -0,0 +1,46 @@
+package xmlquery
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := loadXML(`<catalog><book id="1"><price>10</price></book><book id="2"><price>10</price><!-- old --></book><book id="3"/></catalog>`)
+	b := loadXML(`<catalog><book id="1"><price>10</price></book><book id="2" lang="en"><price>12</price></book><book id="4"/></catalog>`)
+	var got []string
+	for _, change := range Diff(a, b) {
+		got = append(got, change.Kind.String()+" "+change.Path)
+	}
+	testValue(t, fmt.Sprint(got), "[modified /catalog/book[2] modified /catalog/book[2]/price/text() removed /catalog/book[2]/comment() modified /catalog/book[3]]")
+
+	if changes := Diff(a, a); len(changes) != 0 {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+
+	a = loadXML(`<list><item>a</item><item>b</item></list>`)
+	b = loadXML(`<list><item>x</item><item>a</item><item>b</item></list>`)
+	changes := Diff(a, b)
+	if len(changes) != 1 || changes[0].Kind != ChangeAdded || changes[0].Path != "/list/item[1]" {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	a := loadXML(`<catalog><book id="2"><price>10</price></book></catalog>`)
+	b := loadXML(`<catalog><book id="2" lang="en"><price>12</price></book><book id="3"><title>New</title></book></catalog>`)
+	testValue(t, DiffText(a, b), `--- a
++++ b
+@@ /catalog/book @@
+-<book id="2">
++<book id="2" lang="en">
+@@ /catalog/book/price/text() @@
+-10
++12
+@@ /catalog/book[2] @@
++<book id="3">
++  <title>New</title>
++</book>
+`)
+	testValue(t, DiffText(a, a), "")
+}
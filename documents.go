@@ -0,0 +1,92 @@
+package xmlquery
+
+import "io"
+
+// DocumentReader reads a sequence of XML documents written back to back
+// in a stream, such as a log of XML records, each starting with an XML
+// declaration or directly with its root element:
+//
+//	dr := xmlquery.NewDocumentReader(r, xmlquery.ParserOptions{})
+//	for {
+//		doc, err := dr.Read()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// A document ends with its root element: the comments and processing
+// instructions that follow belong to the next document, and those after
+// the last root element are dropped. Whitespace outside the root elements
+// is dropped. The documents must be in the same encoding. The limits of
+// the options apply to each document, except Limits.MaxBytes, which bounds
+// the whole stream.
+type DocumentReader struct {
+	p   *parser
+	err error
+}
+
+// NewDocumentReader returns a DocumentReader parsing the documents of r
+// with options.
+func NewDocumentReader(r io.Reader, options ParserOptions) *DocumentReader {
+	dr := &DocumentReader{}
+	if !options.DisableDecompression {
+		if r, dr.err = decompress(r); dr.err != nil {
+			return dr
+		}
+	}
+	dr.p = createParser(r, options.BufferSize)
+	options.apply(dr.p)
+	dr.p.splitDocuments = true
+	return dr
+}
+
+// Read returns the next document of the stream, or io.EOF after the last.
+// Once Read returns an error, it keeps returning it.
+func (dr *DocumentReader) Read() (*Node, error) {
+	if dr.err != nil {
+		return nil, dr.err
+	}
+	p := dr.p
+	if p.doc.FirstChild != nil {
+		p.nextDocument()
+	}
+	doc, err := p.parse()
+	if err == io.EOF && hasElement(p.doc) {
+		// The elements left open at the end of the stream were closed,
+		// see ParserOptions.Recover.
+		return p.doc, nil
+	}
+	if err != nil {
+		if err != io.EOF {
+			err = p.sourceError(err)
+		}
+		dr.err = err
+		return nil, err
+	}
+	return doc, nil
+}
+
+// nextDocument makes p add the nodes to a new document, the previous one
+// being complete.
+func (p *parser) nextDocument() {
+	doc := &Node{Type: DocumentNode}
+	if info := p.doc.document; info != nil {
+		doc.document = &documentInfo{source: info.source, base: info.base, bom: info.bom}
+	}
+	p.doc, p.prev, p.level = doc, doc, 0
+	p.retainedNodes, p.retainedBytes = 0, 0
+}
+
+// hasElement reports whether n has an element child.
+func hasElement(n *Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == ElementNode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package xmlquery
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func readDocuments(t *testing.T, s string, options ParserOptions) []*Node {
+	dr := NewDocumentReader(strings.NewReader(s), options)
+	var docs []*Node
+	for {
+		doc, err := dr.Read()
+		if err == io.EOF {
+			return docs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func TestDocumentReader(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<record id="1"><msg>first</msg></record>
+<?xml version="1.0" encoding="UTF-8"?>
+<!-- second -->
+<r:record xmlns:r="urn:r" id="2"/>
+<record id="3">third</record>
+<!-- trailing -->
+`
+	docs := readDocuments(t, s, ParserOptions{})
+	if len(docs) != 3 {
+		t.Fatalf("got %d documents", len(docs))
+	}
+	testValue(t, docs[0].OutputXML(false), `<?xml version="1.0"?><record id="1"><msg>first</msg></record>`)
+	testValue(t, docs[1].OutputXML(false), `<?xml version="1.0" encoding="UTF-8"?><!-- second --><r:record xmlns:r="urn:r" id="2"></r:record>`)
+	testValue(t, FindOne(docs[1], "/*").NamespaceURI, "urn:r")
+	testValue(t, docs[1].DeclaredEncoding(), "UTF-8")
+	testValue(t, FindOne(docs[2], "/record").SelectAttr("id"), "3")
+	testValue(t, FindOne(docs[2], "/record").InnerText(), "third")
+	// The namespaces of a document are not in scope in the next ones.
+	testValue(t, len(FindOne(docs[2], "/record").NamespaceDecls()), 0)
+
+	if docs := readDocuments(t, "  \n", ParserOptions{}); len(docs) != 0 {
+		t.Fatalf("got %d documents", len(docs))
+	}
+}
+
+func TestDocumentReaderEncoding(t *testing.T) {
+	s := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>caf\xe9</a>" +
+		"<?xml version=\"1.0\" encoding=\"iso-8859-1\"?><a>th\xe9</a>"
+	docs := readDocuments(t, s, ParserOptions{SourceName: "log"})
+	if len(docs) != 2 {
+		t.Fatalf("got %d documents", len(docs))
+	}
+	testValue(t, docs[0].InnerText(), "café")
+	testValue(t, docs[1].InnerText(), "thé")
+	testValue(t, docs[1].Encoding(), "ISO-8859-1")
+	testValue(t, docs[1].SourceName(), "log")
+
+	dr := NewDocumentReader(strings.NewReader(s[:strings.Index(s, "</a>")+4]+`<?xml version="1.0" encoding="windows-1252"?><a/>`), ParserOptions{})
+	if _, err := dr.Read(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := dr.Read()
+	if err == nil || !strings.Contains(err.Error(), "differs from ISO-8859-1") {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err2 := dr.Read(); err2 != err {
+		t.Fatalf("got error %v after %v", err2, err)
+	}
+}
+
+func TestDocumentReaderErrors(t *testing.T) {
+	dr := NewDocumentReader(strings.NewReader("<a/>\n<b>\n</c>"), ParserOptions{SourceName: "log"})
+	if _, err := dr.Read(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := dr.Read()
+	if err == nil || !strings.HasPrefix(err.Error(), "log:3: ") {
+		t.Fatalf("got error %v", err)
+	}
+
+	docs := readDocuments(t, "<a/><b><c>", ParserOptions{Recover: true})
+	if len(docs) != 2 {
+		t.Fatalf("got %d documents", len(docs))
+	}
+	testValue(t, docs[1].OutputXML(false), `<?xml version="1.0"?><b><c></c></b>`)
+}
@@ -0,0 +1,440 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// DocType holds the declarations of a <!DOCTYPE> directive, as returned
+// by Node.DocType. Parameter entity references in the internal subset are
+// not expanded, and the declarations they would produce are missing.
+type DocType struct {
+	// Name is the name of the document element.
+	Name string
+	// PublicID and SystemID are the identifiers of the external subset,
+	// empty if not given.
+	PublicID string
+	SystemID string
+	// The declarations of the internal subset, in document order.
+	Entities   []EntityDecl
+	Elements   []ElementDecl
+	Attributes []AttributeDecl
+	Notations  []NotationDecl
+}
+
+// EntityDecl is an <!ENTITY> declaration.
+type EntityDecl struct {
+	Name string
+	// Parameter reports whether it is a parameter entity, declared with %.
+	Parameter bool
+	// Value is the literal value of an internal entity, as written.
+	Value string
+	// PublicID and SystemID identify an external entity; NData names the
+	// notation of an unparsed one.
+	PublicID string
+	SystemID string
+	NData    string
+}
+
+// ElementDecl is an <!ELEMENT> declaration.
+type ElementDecl struct {
+	Name string
+	// ContentSpec is the content model, such as EMPTY, ANY or
+	// (title,para*), as written.
+	ContentSpec string
+}
+
+// AttributeDecl is an attribute definition of an <!ATTLIST> declaration.
+type AttributeDecl struct {
+	// Element and Name are the qualified names of the element and of the
+	// attribute, as written.
+	Element string
+	Name    string
+	// Type is the attribute type, such as CDATA, ID or (draft|final).
+	Type string
+	// Default is #REQUIRED, #IMPLIED, #FIXED, or empty if the attribute
+	// has a default value that is not fixed.
+	Default string
+	// Value is the default value, with its references replaced and its
+	// white space normalized.
+	Value string
+}
+
+// NotationDecl is a <!NOTATION> declaration.
+type NotationDecl struct {
+	Name     string
+	PublicID string
+	SystemID string
+}
+
+// Entity returns the declaration of the general entity with the given
+// name, or nil. The first declaration is binding.
+func (d *DocType) Entity(name string) *EntityDecl {
+	for i, e := range d.Entities {
+		if e.Name == name && !e.Parameter {
+			return &d.Entities[i]
+		}
+	}
+	return nil
+}
+
+// AttributeDefaults returns the attributes of the element with the given
+// qualified name that have a default value. The first declaration of an
+// attribute is binding.
+func (d *DocType) AttributeDefaults(element string) []AttributeDecl {
+	var attrs []AttributeDecl
+	for i, a := range d.Attributes {
+		if a.Element != element || a.Default == "#REQUIRED" || a.Default == "#IMPLIED" {
+			continue
+		}
+		binding := true
+		for _, b := range d.Attributes[:i] {
+			if b.Element == element && b.Name == a.Name {
+				binding = false
+				break
+			}
+		}
+		if binding {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// DocType returns the declarations of the <!DOCTYPE> directive n, or of
+// the document of n, or nil if there is none.
+func (n *Node) DocType() *DocType {
+	if n.Type == NotationNode {
+		return parseDocType(n.Data)
+	}
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == NotationNode {
+			if d := parseDocType(child.Data); d != nil {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// dtdAttrDefault is an attribute default value declared by an <!ATTLIST>
+// declaration of the internal DTD subset.
+type dtdAttrDefault struct {
+	name  string // qualified attribute name, as written in the DTD
+	value string
+	fixed bool
+}
+
+// parseDTDAttrDefaults adds to defaults the attribute defaults declared in the
+// internal subset of a <!DOCTYPE> directive, keyed by qualified element
+// name. Attributes declared #REQUIRED or #IMPLIED have no default and are
+// left out. The first declaration of an attribute is binding, as required
+// by the XML specification.
+func parseDTDAttrDefaults(directive string, defaults map[string][]dtdAttrDefault) {
+	if d := parseDocType(directive); d != nil {
+		addDTDAttrDefaults(d, defaults)
+	}
+}
+
+// addDTDAttrDefaults adds to defaults the attribute defaults declared in d
+// for attributes that have none yet.
+func addDTDAttrDefaults(d *DocType, defaults map[string][]dtdAttrDefault) {
+	for _, a := range d.Attributes {
+		if a.Default == "#REQUIRED" || a.Default == "#IMPLIED" {
+			continue
+		}
+		declared := false
+		for _, def := range defaults[a.Element] {
+			if def.name == a.Name {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			defaults[a.Element] = append(defaults[a.Element], dtdAttrDefault{name: a.Name, value: a.Value, fixed: a.Default == "#FIXED"})
+		}
+	}
+}
+
+// parseDocType returns the declarations of a <!DOCTYPE> directive, or nil
+// if directive is not one.
+func parseDocType(directive string) *DocType {
+	if !strings.HasPrefix(directive, "DOCTYPE") {
+		return nil
+	}
+	head, s := directive[len("DOCTYPE"):], ""
+	var quote byte
+	for i := 0; i < len(head); i++ {
+		if c := head[i]; quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '[' {
+			head, s = head[:i], head[i+1:]
+			break
+		}
+	}
+	d := &DocType{}
+	tokens := dtdTokens(head)
+	if len(tokens) > 0 {
+		d.Name = tokens[0]
+		d.PublicID, d.SystemID, _ = dtdExternalID(tokens[1:])
+	}
+	for len(s) > 0 {
+		var decl string
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s[4:], "-->")
+			if end < 0 {
+				return d
+			}
+			s = s[4+end+3:]
+		case strings.HasPrefix(s, "<?"):
+			end := strings.Index(s[2:], "?>")
+			if end < 0 {
+				return d
+			}
+			s = s[2+end+2:]
+		case strings.HasPrefix(s, "<!ENTITY"):
+			decl, s = dtdDeclaration(s[len("<!ENTITY"):])
+			d.parseEntity(dtdTokens(decl))
+		case strings.HasPrefix(s, "<!ELEMENT"):
+			decl, s = dtdDeclaration(s[len("<!ELEMENT"):])
+			if tokens := dtdTokens(decl); len(tokens) >= 2 {
+				d.Elements = append(d.Elements, ElementDecl{Name: tokens[0], ContentSpec: strings.Join(tokens[1:], " ")})
+			}
+		case strings.HasPrefix(s, "<!ATTLIST"):
+			decl, s = dtdDeclaration(s[len("<!ATTLIST"):])
+			d.parseAttlist(dtdTokens(decl))
+		case strings.HasPrefix(s, "<!NOTATION"):
+			decl, s = dtdDeclaration(s[len("<!NOTATION"):])
+			if tokens := dtdTokens(decl); len(tokens) >= 2 {
+				n := NotationDecl{Name: tokens[0]}
+				n.PublicID, n.SystemID, _ = dtdExternalID(tokens[1:])
+				d.Notations = append(d.Notations, n)
+			}
+		case strings.HasPrefix(s, "<"):
+			// Skip any other markup declaration, including quoted literals
+			// that may contain markup.
+			_, s = dtdDeclaration(s[1:])
+		default:
+			s = s[1:]
+		}
+	}
+	return d
+}
+
+// dtdExternalID parses the SYSTEM or PUBLIC external identifier at the
+// start of tokens and returns the remaining tokens. A public identifier
+// without a system identifier is allowed, as in notation declarations.
+func dtdExternalID(tokens []string) (publicID, systemID string, rest []string) {
+	if len(tokens) < 2 {
+		return "", "", tokens
+	}
+	switch tokens[0] {
+	case "SYSTEM":
+		return "", dtdLiteral(tokens[1]), tokens[2:]
+	case "PUBLIC":
+		publicID = dtdLiteral(tokens[1])
+		if len(tokens) > 2 && isDTDLiteral(tokens[2]) {
+			return publicID, dtdLiteral(tokens[2]), tokens[3:]
+		}
+		return publicID, "", tokens[2:]
+	}
+	return "", "", tokens
+}
+
+func isDTDLiteral(token string) bool {
+	return len(token) >= 2 && (token[0] == '"' || token[0] == '\'')
+}
+
+// dtdLiteral returns the quoted literal token without its quotes.
+func dtdLiteral(token string) string {
+	if !isDTDLiteral(token) {
+		return token
+	}
+	return token[1 : len(token)-1]
+}
+
+func (d *DocType) parseEntity(tokens []string) {
+	var e EntityDecl
+	if len(tokens) > 0 && tokens[0] == "%" {
+		e.Parameter = true
+		tokens = tokens[1:]
+	}
+	if len(tokens) < 2 {
+		return
+	}
+	e.Name = tokens[0]
+	if isDTDLiteral(tokens[1]) {
+		e.Value = dtdLiteral(tokens[1])
+	} else {
+		var rest []string
+		e.PublicID, e.SystemID, rest = dtdExternalID(tokens[1:])
+		if len(rest) >= 2 && rest[0] == "NDATA" {
+			e.NData = rest[1]
+		}
+	}
+	d.Entities = append(d.Entities, e)
+}
+
+// dtdDeclaration returns the body of a markup declaration up to its closing
+// '>', which is not part of the body, and the remaining input.
+func dtdDeclaration(s string) (string, string) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// dtdTokens splits a declaration body into names, keywords, parenthesized
+// groups and quoted literals. Quoted literals keep their quotes.
+func dtdTokens(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return append(tokens, s[i:]+string(c))
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case c == '(':
+			// A group may be nested and followed by an occurrence
+			// indicator, as in content models.
+			j, depth := i, 0
+			for ; j < len(s); j++ {
+				if s[j] == '(' {
+					depth++
+				} else if s[j] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			if j == len(s) {
+				return append(tokens, s[i:])
+			}
+			j++
+			if j < len(s) && strings.IndexByte("?*+", s[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n\"'(%", rune(s[j])) || j == i {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func (d *DocType) parseAttlist(tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	elem := tokens[0]
+	tokens = tokens[1:]
+	for len(tokens) >= 3 {
+		a := AttributeDecl{Element: elem, Name: tokens[0], Type: tokens[1]}
+		rest := tokens[2:]
+		if tokens[1] == "NOTATION" {
+			if len(tokens) < 4 {
+				return
+			}
+			a.Type += " " + tokens[2]
+			rest = tokens[3:]
+		}
+		switch rest[0] {
+		case "#REQUIRED", "#IMPLIED":
+			a.Default = rest[0]
+			d.Attributes = append(d.Attributes, a)
+			tokens = rest[1:]
+			continue
+		case "#FIXED":
+			if len(rest) < 2 {
+				return
+			}
+			a.Default = rest[0]
+			rest = rest[1:]
+		}
+		if !isDTDLiteral(rest[0]) {
+			return
+		}
+		a.Value = dtdAttrValue(dtdLiteral(rest[0]))
+		d.Attributes = append(d.Attributes, a)
+		tokens = rest[1:]
+	}
+}
+
+// dtdAttrValue replaces the entity and character references of a default
+// value and normalizes its white space characters to spaces.
+func dtdAttrValue(s string) string {
+	return unescapeReferences(strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, s))
+}
+
+// applyDTDAttrDefaults adds to attrs the declared defaults of the element
+// that are not specified. The namespace declarations among the defaults are
+// added first and declared, so that prefixed default attributes are resolved
+// against them as well as the namespace declarations in scope.
+func (p *parser) applyDTDAttrDefaults(name string, attrs []xml.Attr) []xml.Attr {
+	for _, xmlns := range []bool{true, false} {
+		n := len(attrs)
+		for _, def := range p.attrDefaults[name] {
+			if (def.name == "xmlns" || strings.HasPrefix(def.name, "xmlns:")) != xmlns {
+				continue
+			}
+			attr := xml.Attr{Name: xml.Name{Local: def.name}, Value: def.value}
+			if i := strings.IndexByte(def.name, ':'); i > 0 {
+				attr.Name = xml.Name{Space: def.name[:i], Local: def.name[i+1:]}
+				if attr.Name.Space != "xmlns" {
+					if uri, ok := p.namespaceOf(attr.Name.Space); ok {
+						attr.Name.Space = uri
+					}
+				}
+			}
+			specified := false
+			for _, a := range attrs {
+				if a.Name == attr.Name {
+					specified = true
+					break
+				}
+			}
+			if !specified {
+				attrs = append(attrs, attr)
+			}
+		}
+		if xmlns {
+			p.declareNamespaces(attrs[n:])
+		}
+	}
+	return attrs
+}
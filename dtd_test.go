@@ -0,0 +1,79 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocType(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<!DOCTYPE book PUBLIC "-//Example//DTD Book//EN" "book.dtd" [
+	<!-- <!ENTITY ignored "x"> -->
+	<!ENTITY % common "id ID #IMPLIED">
+	<!ENTITY copy "&#169; 2024">
+	<!ENTITY logo SYSTEM "logo.png" NDATA png>
+	<!ELEMENT book (title,(para|note)*)>
+	<!ELEMENT br EMPTY>
+	<!ATTLIST book
+		status (draft|final) "draft"
+		lang CDATA #IMPLIED
+		format NOTATION (png) #FIXED "png">
+	<!ATTLIST book status CDATA "ignored">
+	<!NOTATION png PUBLIC "image/png">
+	<?pi <!ENTITY ignored "x">?>
+]>
+<book/>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := doc.DocType()
+	if d == nil {
+		t.Fatal("no DOCTYPE found")
+	}
+	testValue(t, d.Name, "book")
+	testValue(t, d.PublicID, "-//Example//DTD Book//EN")
+	testValue(t, d.SystemID, "book.dtd")
+
+	if len(d.Entities) != 3 {
+		t.Fatalf("got entities %+v", d.Entities)
+	}
+	if e := d.Entities[0]; !e.Parameter || e.Name != "common" || e.Value != "id ID #IMPLIED" {
+		t.Errorf("got parameter entity %+v", e)
+	}
+	if e := d.Entity("copy"); e == nil || e.Value != "&#169; 2024" {
+		t.Errorf("got entity copy %+v", e)
+	}
+	if e := d.Entity("logo"); e == nil || e.SystemID != "logo.png" || e.NData != "png" {
+		t.Errorf("got entity logo %+v", e)
+	}
+	if d.Entity("common") != nil || d.Entity("ignored") != nil {
+		t.Error("unexpected entity")
+	}
+
+	if len(d.Elements) != 2 {
+		t.Fatalf("got elements %+v", d.Elements)
+	}
+	testValue(t, d.Elements[0].ContentSpec, "(title,(para|note)*)")
+	testValue(t, d.Elements[1].ContentSpec, "EMPTY")
+
+	if len(d.Attributes) != 4 {
+		t.Fatalf("got attributes %+v", d.Attributes)
+	}
+	testValue(t, d.Attributes[2].Type, "NOTATION (png)")
+	defaults := d.AttributeDefaults("book")
+	if len(defaults) != 2 || defaults[0].Value != "draft" || defaults[1].Default != "#FIXED" {
+		t.Errorf("got defaults %+v", defaults)
+	}
+
+	if len(d.Notations) != 1 || d.Notations[0].PublicID != "image/png" || d.Notations[0].SystemID != "" {
+		t.Errorf("got notations %+v", d.Notations)
+	}
+
+	if n := FindOne(doc, "/book"); n.DocType() == nil {
+		t.Error("expected the DOCTYPE of the document")
+	}
+	if loadXML(`<a/>`).DocType() != nil {
+		t.Error("unexpected DOCTYPE")
+	}
+}
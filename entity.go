@@ -0,0 +1,221 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Resolver loads the external entities and the external DTD subset that a
+// document references by their public and system identifiers, see
+// ParserOptions.ExternalResolver. The system identifier is as written in
+// the document, usually a URI relative to the document.
+type Resolver interface {
+	Resolve(publicID, systemID string) (io.ReadCloser, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface.
+type ResolverFunc func(publicID, systemID string) (io.ReadCloser, error)
+
+// Resolve calls f(publicID, systemID).
+func (f ResolverFunc) Resolve(publicID, systemID string) (io.ReadCloser, error) {
+	return f(publicID, systemID)
+}
+
+// loadDTD records the entities declared by the <!DOCTYPE> directive and
+// loads its external subset, if any, with the external resolver. The
+// declarations of the internal subset take precedence.
+func (p *parser) loadDTD(directive string) error {
+	d := parseDocType(directive)
+	if d == nil {
+		return nil
+	}
+	p.declareEntities(d)
+	if d.SystemID == "" || p.externalResolver == nil {
+		return nil
+	}
+	data, err := p.loadExternal(d.PublicID, d.SystemID)
+	if err != nil {
+		return fmt.Errorf("xmlquery: loading external DTD %s: %w", d.SystemID, err)
+	}
+	ext := parseDocType("DOCTYPE " + d.Name + " [" + data + "]")
+	p.declareEntities(ext)
+	if p.attrDefaults != nil {
+		addDTDAttrDefaults(ext, p.attrDefaults)
+	}
+	return nil
+}
+
+// declareEntities records the general entities declared in d that are
+// not yet declared: the parsed external entities if they are resolved, and
+// the internal entities if they are expanded.
+func (p *parser) declareEntities(d *DocType) {
+	for _, e := range d.Entities {
+		if e.Parameter || e.NData != "" {
+			continue
+		}
+		if _, ok := p.externalEntities[e.Name]; ok {
+			continue
+		}
+		if _, ok := p.internalEntities[e.Name]; ok {
+			continue
+		}
+		if e.SystemID == "" && p.internalEntities != nil {
+			p.internalEntities[e.Name] = e.Value
+		} else if e.SystemID != "" && p.externalResolver != nil {
+			if p.externalEntities == nil {
+				p.externalEntities = map[string]EntityDecl{}
+			}
+			p.externalEntities[e.Name] = e
+		}
+	}
+}
+
+// loadExternal returns the text of the external entity identified by
+// publicID and systemID, without its text declaration.
+func (p *parser) loadExternal(publicID, systemID string) (string, error) {
+	r, err := p.externalResolver.Resolve(publicID, systemID)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s := string(b)
+	if strings.HasPrefix(s, "<?xml") {
+		if end := strings.Index(s, "?>"); end >= 0 {
+			s = s[end+2:]
+		}
+	}
+	return s, nil
+}
+
+// ErrEntityExpansionLimit is returned, wrapped, by parsing when entity
+// references expand to more text than ParserOptions.MaxEntityExpansion
+// or nest deeper than ParserOptions.MaxEntityDepth.
+var ErrEntityExpansionLimit = errors.New("xmlquery: entity expansion limit exceeded")
+
+// resolveEntity adds to the entities of the decoder the replacement text
+// of the internal entity name, the value of the external entity name, as
+// loaded by the external resolver, or else the value given by the entity
+// resolver, unless it is already known. It is called as the reference is
+// read, before the decoder looks it up, and accounts for the expansion.
+func (p *parser) resolveEntity(name []byte) {
+	if value, ok := p.decoder.Entity[string(name)]; ok {
+		p.countExpansion(string(name), value)
+		return
+	}
+	switch s := string(name); s {
+	case "lt", "gt", "amp", "apos", "quot":
+	default:
+		if _, failed := p.entityErrs[s]; failed {
+			return
+		}
+		var value string
+		var err error
+		if _, ok := p.internalEntities[s]; ok {
+			var b strings.Builder
+			err = p.expandEntity(s, 1, map[string]bool{}, &b)
+			value = b.String()
+		} else if e, ok := p.externalEntities[s]; ok {
+			value, err = p.loadExternal(e.PublicID, e.SystemID)
+		} else if p.entityResolver != nil {
+			value, err = p.entityResolver(s)
+		} else {
+			return
+		}
+		if err != nil {
+			p.failEntity(s, err)
+			return
+		}
+		p.decoder.Entity[s] = value
+		p.countExpansion(s, value)
+	}
+}
+
+// failEntity makes the decoder fail on the reference to the entity name,
+// see entityError.
+func (p *parser) failEntity(name string, err error) {
+	if p.entityErrs == nil {
+		p.entityErrs = map[string]error{}
+	}
+	p.entityErrs[name] = err
+	delete(p.decoder.Entity, name)
+}
+
+// countExpansion accounts for a reference to the entity name replaced by
+// value.
+func (p *parser) countExpansion(name, value string) {
+	p.entityBytes += int64(len(value))
+	if p.maxEntityExpansion > 0 && p.entityBytes > p.maxEntityExpansion {
+		p.failEntity(name, fmt.Errorf("%w: more than %d bytes expanded", ErrEntityExpansionLimit, p.maxEntityExpansion))
+	}
+}
+
+// expandEntity writes to b the replacement text of the internal entity
+// name, referenced at the given depth, in which the references are
+// replaced recursively. open holds the entities being expanded.
+func (p *parser) expandEntity(name string, depth int, open map[string]bool, b *strings.Builder) error {
+	if p.maxEntityDepth > 0 && depth > p.maxEntityDepth {
+		return fmt.Errorf("%w: references nested more than %d deep", ErrEntityExpansionLimit, p.maxEntityDepth)
+	}
+	if open[name] {
+		return fmt.Errorf("xmlquery: entity &%s; references itself", name)
+	}
+	open[name] = true
+	defer delete(open, name)
+	value := p.internalEntities[name]
+	for {
+		i := strings.IndexByte(value, '&')
+		if i < 0 {
+			b.WriteString(value)
+			break
+		}
+		b.WriteString(value[:i])
+		value = value[i+1:]
+		end := strings.IndexByte(value, ';')
+		if end < 0 {
+			return fmt.Errorf("xmlquery: malformed reference in entity &%s;", name)
+		}
+		ref := value[:end]
+		value = value[end+1:]
+		if _, ok := p.internalEntities[ref]; ok {
+			if err := p.expandEntity(ref, depth+1, open, b); err != nil {
+				return err
+			}
+		} else if v, ok := p.decoder.Entity[ref]; ok {
+			b.WriteString(v)
+		} else if text := unescapeReferences("&" + ref + ";"); text[0] != '&' || ref == "amp" {
+			b.WriteString(text)
+		} else {
+			return fmt.Errorf("xmlquery: undeclared entity &%s; in entity &%s;", ref, name)
+		}
+		if p.maxEntityExpansion > 0 && p.entityBytes+int64(b.Len()) > p.maxEntityExpansion {
+			return fmt.Errorf("%w: more than %d bytes expanded", ErrEntityExpansionLimit, p.maxEntityExpansion)
+		}
+	}
+	return nil
+}
+
+// entityError returns the error of the entity resolver for the entity the
+// decoder failed on with err, or err.
+func (p *parser) entityError(err error) error {
+	syntaxErr, ok := err.(*xml.SyntaxError)
+	if !ok || p.entityErrs == nil {
+		return err
+	}
+	name := strings.TrimPrefix(syntaxErr.Msg, "invalid character entity &")
+	if len(name) == len(syntaxErr.Msg) || !strings.HasSuffix(name, ";") {
+		return err
+	}
+	name = name[:len(name)-1]
+	if resolveErr, ok := p.entityErrs[name]; ok {
+		return fmt.Errorf("xmlquery: line %d: resolving entity &%s;: %w", syntaxErr.Line, name, resolveErr)
+	}
+	return err
+}
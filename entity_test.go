@@ -0,0 +1,153 @@
+package xmlquery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEntityResolver(t *testing.T) {
+	var calls []string
+	options := ParserOptions{
+		Decoder: &DecoderOptions{Strict: true, Entity: map[string]string{"known": "k"}},
+		EntityResolver: func(name string) (string, error) {
+			calls = append(calls, name)
+			if name == "copy" {
+				return "©", nil
+			}
+			return "", errors.New("unknown entity")
+		},
+	}
+	s := `<a title="&copy; 2024">&copy; &known; &amp; &#48; &copy;<![CDATA[&cdata;]]></a>`
+	doc, err := ParseWithOptions(strings.NewReader(s), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := FindOne(doc, "/a")
+	testValue(t, a.SelectAttr("title"), "© 2024")
+	testValue(t, a.InnerText(), "© k & 0 ©&cdata;")
+	if len(calls) != 2 || calls[0] != "copy" || calls[1] != "cdata" {
+		t.Errorf("got resolver calls %v", calls)
+	}
+	if _, ok := options.Decoder.Entity["copy"]; ok {
+		t.Error("the entities of the options were modified")
+	}
+
+	// The references are still followed after a switch of encoding.
+	doc, err = ParseWithOptions(strings.NewReader(`<?xml version="1.0" encoding="ISO-8859-1"?><a>&copy;</a>`), ParserOptions{EntityResolver: options.EntityResolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "/a").InnerText(), "©")
+
+	_, err = ParseWithOptions(strings.NewReader(`<a>&other;</a>`), options)
+	if err == nil || !strings.Contains(err.Error(), "unknown entity") {
+		t.Fatalf("expected the resolver error, got %v", err)
+	}
+}
+
+func TestExternalResolver(t *testing.T) {
+	files := map[string]string{
+		"book.dtd":    `<!ENTITY legal SYSTEM "legal.txt"><!ATTLIST book lang CDATA "en" status CDATA "ext">`,
+		"chapter.txt": `<?xml encoding="UTF-8"?>Chapter <1>`,
+		"legal.txt":   `All rights reserved.`,
+	}
+	var loaded []string
+	resolver := ResolverFunc(func(publicID, systemID string) (io.ReadCloser, error) {
+		loaded = append(loaded, systemID)
+		s, ok := files[systemID]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return ioutil.NopCloser(strings.NewReader(s)), nil
+	})
+	s := `<!DOCTYPE book SYSTEM "book.dtd" [
+	<!ENTITY chapter SYSTEM "chapter.txt">
+	<!ENTITY missing SYSTEM "missing.txt">
+	<!ATTLIST book status CDATA "int">
+]>
+<book>&chapter; &legal;</book>`
+
+	// External entities are not loaded by default.
+	if _, err := Parse(strings.NewReader(s)); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{ExternalResolver: resolver, ApplyDTDDefaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := FindOne(doc, "/book")
+	testValue(t, book.InnerText(), "Chapter <1> All rights reserved.")
+	testValue(t, book.SelectAttr("lang"), "en")
+	testValue(t, book.SelectAttr("status"), "int")
+	testValue(t, strings.Join(loaded, ","), "book.dtd,chapter.txt,legal.txt")
+
+	_, err = ParseWithOptions(strings.NewReader(strings.Replace(s, "&legal;", "&missing;", 1)), ParserOptions{ExternalResolver: resolver})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected the resolver error, got %v", err)
+	}
+}
+
+func TestExpandEntities(t *testing.T) {
+	s := `<!DOCTYPE a [
+	<!ENTITY name "xml&#113;uery">
+	<!ENTITY title "&name; &amp; &lt;co&gt;">
+	<!ENTITY name "ignored">
+]>
+<a t="&title;">&title;</a>`
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{ExpandEntities: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := FindOne(doc, "/a")
+	testValue(t, a.InnerText(), "xmlquery & <co>")
+	testValue(t, a.SelectAttr("t"), "xmlquery & <co>")
+
+	if _, err := Parse(strings.NewReader(s)); err == nil {
+		t.Fatal("expected an error without expansion")
+	}
+
+	s = `<!DOCTYPE a [<!ENTITY a "&b;"><!ENTITY b "&a;">]><a>&a;</a>`
+	if _, err := ParseWithOptions(strings.NewReader(s), ParserOptions{ExpandEntities: true}); err == nil || !strings.Contains(err.Error(), "references itself") {
+		t.Fatalf("expected a recursion error, got %v", err)
+	}
+}
+
+func TestEntityExpansionLimits(t *testing.T) {
+	// The billion laughs attack expands to 10^9 "lol".
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE lolz [<!ENTITY lol0 "lol">`)
+	for i := 1; i < 10; i++ {
+		ref := strings.Repeat(fmt.Sprintf("&lol%d;", i-1), 10)
+		fmt.Fprintf(&b, `<!ENTITY lol%d "%s">`, i, ref)
+	}
+	b.WriteString(`]><lolz>&lol9;</lolz>`)
+	_, err := ParseWithOptions(strings.NewReader(b.String()), ParserOptions{ExpandEntities: true, MaxEntityExpansion: 1 << 20})
+	if !errors.Is(err, ErrEntityExpansionLimit) {
+		t.Fatalf("expected an expansion limit error, got %v", err)
+	}
+	_, err = ParseWithOptions(strings.NewReader(b.String()), ParserOptions{ExpandEntities: true, MaxEntityDepth: 5})
+	if !errors.Is(err, ErrEntityExpansionLimit) {
+		t.Fatalf("expected an expansion depth error, got %v", err)
+	}
+	doc, err := ParseWithOptions(strings.NewReader(strings.Replace(b.String(), "&lol9;", "&lol2;", 1)), ParserOptions{ExpandEntities: true, MaxEntityExpansion: 300, MaxEntityDepth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(FindOne(doc, "/lolz").InnerText()); n != 300 {
+		t.Fatalf("got %d bytes of text", n)
+	}
+
+	// Every reference counts, whatever provides the value.
+	options := ParserOptions{Decoder: &DecoderOptions{Strict: true, Entity: map[string]string{"e": "12345"}}, MaxEntityExpansion: 10}
+	if _, err := ParseWithOptions(strings.NewReader(`<a>&e;&e;</a>`), options); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWithOptions(strings.NewReader(`<a>&e;&e;&e;</a>`), options); !errors.Is(err, ErrEntityExpansionLimit) {
+		t.Fatalf("expected an expansion limit error, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package xmlquery
+
+import "strings"
+
+type compareConfiguration struct {
+	namespaceAware   bool
+	ignoreComments   bool
+	ignoreWhitespace bool
+}
+
+// CompareOption configures Equal.
+type CompareOption func(*compareConfiguration)
+
+// WithNamespaceAwareCompare compares elements and attributes by namespace
+// URI and local name rather than by prefix, and ignores namespace
+// declarations, so <a:item> and <b:item> bound to the same URI are equal.
+func WithNamespaceAwareCompare() CompareOption {
+	return func(c *compareConfiguration) {
+		c.namespaceAware = true
+	}
+}
+
+// WithCompareIgnoreComments skips comments when comparing.
+func WithCompareIgnoreComments() CompareOption {
+	return func(c *compareConfiguration) {
+		c.ignoreComments = true
+	}
+}
+
+// WithCompareIgnoreWhitespace skips whitespace-only text nodes and trims the
+// remaining text when comparing.
+func WithCompareIgnoreWhitespace() CompareOption {
+	return func(c *compareConfiguration) {
+		c.ignoreWhitespace = true
+	}
+}
+
+// Equal reports whether the subtrees rooted at a and b are equal. Nodes are
+// compared by type, name and data, elements also by their attributes,
+// regardless of attribute order, and by their children, in order.
+func Equal(a, b *Node, opts ...CompareOption) bool {
+	config := &compareConfiguration{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config.equal(a, b)
+}
+
+func (c *compareConfiguration) equal(a, b *Node) bool {
+	if a.Type != b.Type || !c.sameName(a, b) || !c.sameAttrs(a, b) {
+		return false
+	}
+	switch a.Type {
+	case TextNode, CharDataNode:
+		if c.ignoreWhitespace {
+			return strings.TrimSpace(a.Data) == strings.TrimSpace(b.Data)
+		}
+		return a.Data == b.Data
+	case CommentNode, NotationNode:
+		return a.Data == b.Data
+	}
+	x, y := c.next(a.FirstChild), c.next(b.FirstChild)
+	for ; x != nil && y != nil; x, y = c.next(x.NextSibling), c.next(y.NextSibling) {
+		if !c.equal(x, y) {
+			return false
+		}
+	}
+	return x == nil && y == nil
+}
+
+// next returns n or its first following sibling that takes part in the
+// comparison.
+func (c *compareConfiguration) next(n *Node) *Node {
+	for ; n != nil; n = n.NextSibling {
+		if c.ignoreComments && n.Type == CommentNode {
+			continue
+		}
+		if c.ignoreWhitespace && n.Type == TextNode && strings.TrimSpace(n.Data) == "" {
+			continue
+		}
+		return n
+	}
+	return nil
+}
+
+func (c *compareConfiguration) sameName(a, b *Node) bool {
+	if a.Type != ElementNode && a.Type != DeclarationNode {
+		return true
+	}
+	if c.namespaceAware {
+		return a.Data == b.Data && a.NamespaceURI == b.NamespaceURI
+	}
+	return a.Data == b.Data && a.Prefix == b.Prefix
+}
+
+func (c *compareConfiguration) sameAttrs(a, b *Node) bool {
+	x, y := c.attrs(a), c.attrs(b)
+	if len(x) != len(y) {
+		return false
+	}
+	for key, value := range x {
+		if v, ok := y[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compareConfiguration) attrs(n *Node) map[Attr]string {
+	m := make(map[Attr]string, len(n.Attr))
+	for _, attr := range n.Attr {
+		var key Attr
+		if c.namespaceAware {
+			if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+				continue
+			}
+			key.Name.Local = attr.Name.Local
+			key.NamespaceURI = attr.NamespaceURI
+		} else {
+			key.Name = attr.Name
+		}
+		m[key] = attr.Value
+	}
+	return m
+}
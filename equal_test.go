@@ -0,0 +1,27 @@
+package xmlquery
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	a := loadXML(`<r><b x="1" y="2">t</b><!-- c --></r>`)
+	b := loadXML(`<r><b y="2" x="1">t</b><!-- c --></r>`)
+	testTrue(t, Equal(a, b))
+	c := loadXML(`<r><b y="2" x="1">u</b></r>`)
+	testTrue(t, !Equal(a, c))
+	d := loadXML(`<r>
+		<b y="2" x="1"> t </b>
+	</r>`)
+	testTrue(t, !Equal(a, d))
+	testTrue(t, Equal(a, d, WithCompareIgnoreComments(), WithCompareIgnoreWhitespace()))
+}
+
+func TestEqualNamespaceAware(t *testing.T) {
+	a := loadXML(`<a:env xmlns:a="urn:soap"><a:item a:id="1">x</a:item></a:env>`)
+	b := loadXML(`<b:env xmlns:b="urn:soap"><b:item b:id="1">x</b:item></b:env>`)
+	c := loadXML(`<env xmlns="urn:soap" xmlns:s="urn:soap"><item s:id="1">x</item></env>`)
+	d := loadXML(`<b:env xmlns:b="urn:other"><b:item b:id="1">x</b:item></b:env>`)
+	testTrue(t, !Equal(a, b))
+	testTrue(t, Equal(a, b, WithNamespaceAwareCompare()))
+	testTrue(t, Equal(a, c, WithNamespaceAwareCompare()))
+	testTrue(t, !Equal(a, d, WithNamespaceAwareCompare()))
+}
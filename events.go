@@ -0,0 +1,182 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// ElementEvent is an element reported by ParseEvents. Its fields hold what
+// the fields of the same name of the element Node built by Parse would.
+type ElementEvent struct {
+	Data         string
+	Prefix       string
+	NamespaceURI string
+	Attr         []Attr
+	// Depth is the nesting depth of the element, 1 for the root element.
+	Depth int
+}
+
+// EventHandlers holds the callbacks ParseEvents calls as it reads a
+// document. A nil callback skips the events of its kind. A callback
+// returning an error stops parsing, and ParseEvents returns that error.
+// The arguments of the callbacks are only valid until they return.
+type EventHandlers struct {
+	OnStartElement func(e *ElementEvent) error
+	// OnEndElement is given the same ElementEvent as OnStartElement was.
+	OnEndElement func(e *ElementEvent) error
+	// OnText is given text and CDATA sections, cdata reporting which.
+	OnText     func(text []byte, cdata bool) error
+	OnComment  func(comment []byte) error
+	OnProcInst func(target string, inst []byte) error
+}
+
+// ParseEvents reads the XML document from r and calls handlers for its
+// elements, text, comments and processing instructions in document order,
+// without building a tree. The prefixes and namespaces of elements and
+// attributes are resolved as by Parse. The options apply as they would to
+// ParseWithOptions, except for those about the nodes of the tree, such as
+// Whitespace, TextTrim, Skip or Limits.MaxNodes.
+func ParseEvents(r io.Reader, handlers EventHandlers, options ParserOptions) error {
+	if !options.DisableDecompression {
+		var err error
+		if r, err = decompress(r); err != nil {
+			return err
+		}
+	}
+	er := newEventReader(r, options)
+	if err := er.parseEvents(handlers); err != nil {
+		return er.p.sourceError(err)
+	}
+	return nil
+}
+
+// eventReader reads the tokens of a document for ParseEvents and
+// PullParser, resolving the names of the elements as the tree parser does.
+type eventReader struct {
+	p        *parser
+	elements []ElementEvent // The open elements, innermost last.
+	closed   ElementEvent   // The element of the last end tag read.
+	start    int64          // The offset of the last token read.
+}
+
+func newEventReader(r io.Reader, options ParserOptions) *eventReader {
+	p := createParser(r, options.BufferSize)
+	options.apply(p)
+	// The levels are those the tree parser gives to the elements, so the
+	// namespace declarations are scoped alike.
+	p.level = 1
+	return &eventReader{p: p}
+}
+
+// next reads the next token. The token and the element it starts or ends
+// are only valid until the next call.
+func (er *eventReader) next() (xml.Token, error) {
+	p := er.p
+	p.once.Do(p.start)
+	er.start = p.decoder.InputOffset()
+	p.reader.StartCaching()
+	tok, err := p.decoder.Token()
+	p.reader.StopCaching()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, p.entityError(err)
+	}
+	switch tok := tok.(type) {
+	case xml.StartElement:
+		if p.limits.MaxDepth > 0 && len(er.elements) >= p.limits.MaxDepth {
+			return nil, &LimitError{Limit: "MaxDepth", Max: int64(p.limits.MaxDepth), Offset: er.start}
+		}
+		p.declareNamespaces(tok.Attr)
+		if err := p.checkAttrLimits(tok, er.start); err != nil {
+			return nil, err
+		}
+		if err := p.checkNamespace(tok); err != nil {
+			return nil, err
+		}
+		prefix, err := p.elementPrefix(tok.Name, p.reader.Raw(er.start, p.decoder.InputOffset()))
+		if err != nil {
+			return nil, err
+		}
+		er.elements = append(er.elements, ElementEvent{
+			Data:         tok.Name.Local,
+			Prefix:       prefix,
+			NamespaceURI: tok.Name.Space,
+			Attr:         p.attributes(tok.Attr),
+			Depth:        len(er.elements) + 1,
+		})
+		p.level++
+	case xml.EndElement:
+		p.level--
+		p.endNamespaces()
+		er.closed = er.elements[len(er.elements)-1]
+		er.elements = er.elements[:len(er.elements)-1]
+	case xml.CharData:
+		if p.xml11 {
+			return xml.CharData(restoreControlBytes(tok)), nil
+		}
+	case xml.ProcInst:
+		tok.Inst = p.declarationInst(tok.Target, tok.Inst)
+		return tok, nil
+	}
+	return tok, nil
+}
+
+// element returns the element started or ended by tok, the last token
+// read.
+func (er *eventReader) element(tok xml.Token) *ElementEvent {
+	switch tok.(type) {
+	case xml.StartElement:
+		return &er.elements[len(er.elements)-1]
+	case xml.EndElement:
+		return &er.closed
+	}
+	return nil
+}
+
+// parseEvents reads the tokens of the document for ParseEvents.
+func (er *eventReader) parseEvents(handlers EventHandlers) error {
+	for {
+		tok, err := er.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if handlers.OnStartElement != nil {
+				if err := handlers.OnStartElement(er.element(tok)); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			if handlers.OnEndElement != nil {
+				if err := handlers.OnEndElement(er.element(tok)); err != nil {
+					return err
+				}
+			}
+		case xml.CharData:
+			if handlers.OnText != nil {
+				if err := handlers.OnText(tok, er.p.reader.IsCDATA(er.start)); err != nil {
+					return err
+				}
+			}
+		case xml.Comment:
+			if handlers.OnComment != nil {
+				if err := handlers.OnComment(tok); err != nil {
+					return err
+				}
+			}
+		case xml.ProcInst:
+			if handlers.OnProcInst != nil {
+				if err := handlers.OnProcInst(tok.Target, tok.Inst); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package xmlquery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseEvents(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<!-- books -->
+<b:books xmlns:b="urn:books" xmlns="urn:default" xmlns:x="urn:x">
+<b:book x:id="1"><title>A &amp; B</title><![CDATA[<raw>]]></b:book>
+<x:book xmlns:x="urn:other" x:id="2"/>
+<book x:id="3"/>
+</b:books>`
+	var events []string
+	handlers := EventHandlers{
+		OnStartElement: func(e *ElementEvent) error {
+			var attrs []string
+			for _, attr := range e.Attr {
+				attrs = append(attrs, fmt.Sprintf("%s:%s{%s}=%s", attr.Name.Space, attr.Name.Local, attr.NamespaceURI, attr.Value))
+			}
+			events = append(events, fmt.Sprintf("start %d %s:%s{%s} %s", e.Depth, e.Prefix, e.Data, e.NamespaceURI, strings.Join(attrs, " ")))
+			return nil
+		},
+		OnEndElement: func(e *ElementEvent) error {
+			events = append(events, fmt.Sprintf("end %d %s:%s", e.Depth, e.Prefix, e.Data))
+			return nil
+		},
+		OnText: func(text []byte, cdata bool) error {
+			if s := strings.TrimSpace(string(text)); s != "" {
+				events = append(events, fmt.Sprintf("text %q %v", s, cdata))
+			}
+			return nil
+		},
+		OnComment: func(comment []byte) error {
+			events = append(events, fmt.Sprintf("comment %q", comment))
+			return nil
+		},
+		OnProcInst: func(target string, inst []byte) error {
+			events = append(events, fmt.Sprintf("pi %s", target))
+			return nil
+		},
+	}
+	if err := ParseEvents(strings.NewReader(s), handlers, ParserOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`pi xml`,
+		`comment " books "`,
+		`start 1 b:books{urn:books} xmlns:b{xmlns}=urn:books :xmlns{}=urn:default xmlns:x{xmlns}=urn:x`,
+		`start 2 b:book{urn:books} x:id{urn:x}=1`,
+		`start 3 :title{urn:default} `,
+		`text "A & B" false`,
+		`end 3 :title`,
+		`text "<raw>" true`,
+		`end 2 b:book`,
+		`start 2 x:book{urn:other} xmlns:x{xmlns}=urn:other x:id{urn:other}=2`,
+		`end 2 x:book`,
+		`start 2 :book{urn:default} x:id{urn:x}=3`,
+		`end 2 :book`,
+		`end 1 b:books`,
+	}
+	testValue(t, strings.Join(events, "\n"), strings.Join(want, "\n"))
+
+	// The elements and attributes are named as in the tree.
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var i int
+	nodes := Find(doc, "//*")
+	err = ParseEvents(strings.NewReader(s), EventHandlers{OnStartElement: func(e *ElementEvent) error {
+		n := nodes[i]
+		i++
+		testValue(t, e.Data, n.Data)
+		testValue(t, e.Prefix, n.Prefix)
+		testValue(t, e.NamespaceURI, n.NamespaceURI)
+		testValue(t, fmt.Sprint(e.Attr), fmt.Sprint(n.Attr))
+		return nil
+	}}, ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, i, len(nodes))
+}
+
+func TestParseEventsErrors(t *testing.T) {
+	stop := errors.New("stop")
+	var n int
+	err := ParseEvents(strings.NewReader(`<a><b/><c/></a>`), EventHandlers{OnStartElement: func(e *ElementEvent) error {
+		if n++; e.Data == "b" {
+			return stop
+		}
+		return nil
+	}}, ParserOptions{})
+	if err != stop || n != 2 {
+		t.Fatalf("got error %v after %d elements", err, n)
+	}
+
+	err = ParseEvents(strings.NewReader(`<a><x:b/></a>`), EventHandlers{}, ParserOptions{})
+	if err == nil || !strings.Contains(err.Error(), "namespace x is missing") {
+		t.Fatalf("got error %v", err)
+	}
+
+	err = ParseEvents(strings.NewReader(`<a><b><c/></b></a>`), EventHandlers{}, ParserOptions{Limits: Limits{MaxDepth: 2}})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxDepth" {
+		t.Fatalf("got error %v", err)
+	}
+
+	err = ParseEvents(strings.NewReader("<a>\n<b>\n</a>"), EventHandlers{}, ParserOptions{SourceName: "x.xml"})
+	if err == nil || !strings.HasPrefix(err.Error(), "x.xml:3: ") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func BenchmarkParseEvents(b *testing.B) {
+	data := largeDocument(5000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var elements int
+		err := ParseEvents(bytes.NewReader(data), EventHandlers{OnStartElement: func(e *ElementEvent) error {
+			elements++
+			return nil
+		}}, ParserOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,568 @@
+package xmlquery
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EXIOptions configures ParseEXIWithOptions. EXI streams do not always carry
+// their options in the header, so the options used by the encoder must be
+// supplied by the caller. Only schema-less streams are supported.
+type EXIOptions struct {
+	// ByteAligned selects the byte-alignment mode instead of the default
+	// bit-packed mode.
+	ByteAligned bool
+	// PreserveComments must be set if the stream was encoded with
+	// comments preserved.
+	PreserveComments bool
+	// PreservePIs must be set if the stream was encoded with processing
+	// instructions preserved.
+	PreservePIs bool
+}
+
+// ParseEXI returns the parse tree for the schema-less, bit-packed
+// Efficient XML Interchange (EXI) stream read from r.
+func ParseEXI(r io.Reader) (*Node, error) {
+	return ParseEXIWithOptions(r, EXIOptions{})
+}
+
+// ParseEXIWithOptions is like ParseEXI, but with custom options.
+func ParseEXIWithOptions(r io.Reader, options EXIOptions) (*Node, error) {
+	d := newEXIDecoder(bufio.NewReader(r), options)
+	doc, err := d.decode()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return doc, err
+}
+
+// EXI events.
+const (
+	exiSD = iota
+	exiED
+	exiSE
+	exiEE
+	exiAT
+	exiCH
+	exiCM
+	exiPI
+)
+
+// exiProduction is an entry of an EXI grammar. A production either has an
+// event, or is a group of productions whose event codes share a prefix.
+type exiProduction struct {
+	event int
+	qname *exiQName // nil for wildcard events
+	group []*exiProduction
+	next  int  // exiStartTagContent or exiElementContent
+	learn bool // whether matching the production extends the grammar
+}
+
+const (
+	exiStartTagContent = iota
+	exiElementContent
+)
+
+type exiQName struct {
+	uri, local string
+}
+
+type exiElementGrammar struct {
+	startTag []*exiProduction
+	content  []*exiProduction
+}
+
+type exiDecoder struct {
+	r       *bufio.Reader
+	options EXIOptions
+	buf     byte
+	nbits   uint
+
+	uris        []string
+	localNames  map[string][]string
+	qnames      map[exiQName]*exiQName
+	grammars    map[*exiQName]*exiElementGrammar
+	globalValue []string
+	localValue  map[*exiQName][]string
+}
+
+func newEXIDecoder(r *bufio.Reader, options EXIOptions) *exiDecoder {
+	d := &exiDecoder{
+		r:       r,
+		options: options,
+		uris:    []string{"", "http://www.w3.org/XML/1998/namespace", "http://www.w3.org/2001/XMLSchema-instance"},
+		localNames: map[string][]string{
+			"http://www.w3.org/XML/1998/namespace":      {"base", "id", "lang", "space"},
+			"http://www.w3.org/2001/XMLSchema-instance": {"nil", "type"},
+		},
+		qnames:     map[exiQName]*exiQName{},
+		grammars:   map[*exiQName]*exiElementGrammar{},
+		localValue: map[*exiQName][]string{},
+	}
+	return d
+}
+
+func (d *exiDecoder) decode() (*Node, error) {
+	if err := d.decodeHeader(); err != nil {
+		return nil, err
+	}
+
+	// Document grammar; SD has a single production and no event code.
+	doc := &Node{Type: DocumentNode}
+	decl := &Node{
+		Type:  DeclarationNode,
+		Data:  "xml",
+		Attr:  []Attr{{Name: newXMLName("version"), Value: "1.0"}},
+		level: 1,
+	}
+	AddChild(doc, decl)
+	docContent := append([]*exiProduction{{event: exiSE}}, d.miscGroup()...)
+	docEnd := append([]*exiProduction{{event: exiED}}, d.miscGroup()...)
+
+	for _, grammar := range [][]*exiProduction{docContent, docEnd} {
+		for done := false; !done; {
+			prod, err := d.decodeEventCode(grammar)
+			if err != nil {
+				return nil, err
+			}
+			switch prod.event {
+			case exiSE:
+				if err = d.decodeElement(doc, nil, 1); err != nil {
+					return nil, err
+				}
+				done = true
+			case exiED:
+				return doc, nil
+			default:
+				if err = d.decodeMisc(doc, prod.event, 1); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+func (d *exiDecoder) decodeHeader() error {
+	if b, err := d.r.Peek(4); err == nil && string(b) == "$EXI" {
+		d.r.Discard(4)
+	}
+	bits, err := d.readBits(2)
+	if err != nil {
+		return err
+	}
+	if bits != 2 {
+		return errors.New("xmlquery: invalid EXI header distinguishing bits")
+	}
+	hasOptions, err := d.readBits(1)
+	if err != nil {
+		return err
+	}
+	if hasOptions != 0 {
+		return errors.New("xmlquery: EXI options in the header are not supported")
+	}
+	// Format version: a preview bit followed by 4-bit chunks.
+	if _, err = d.readBits(1); err != nil {
+		return err
+	}
+	version := uint64(1)
+	for {
+		v, err := d.readBits(4)
+		if err != nil {
+			return err
+		}
+		version += v
+		if v < 15 {
+			break
+		}
+	}
+	if version != 1 {
+		return fmt.Errorf("xmlquery: unsupported EXI format version %d", version)
+	}
+	if d.options.ByteAligned {
+		d.nbits = 0
+	}
+	return nil
+}
+
+// miscGroup returns the comment and processing instruction productions
+// allowed by the fidelity options, as a second-level group.
+func (d *exiDecoder) miscGroup() []*exiProduction {
+	var group []*exiProduction
+	if d.options.PreserveComments {
+		group = append(group, &exiProduction{event: exiCM})
+	}
+	if d.options.PreservePIs {
+		group = append(group, &exiProduction{event: exiPI})
+	}
+	if len(group) == 0 {
+		return nil
+	}
+	return []*exiProduction{{group: group}}
+}
+
+func (d *exiDecoder) newElementGrammar() *exiElementGrammar {
+	childContent := []*exiProduction{
+		{event: exiSE, next: exiElementContent, learn: true},
+		{event: exiCH, next: exiElementContent, learn: true},
+	}
+	if misc := d.miscGroup(); misc != nil {
+		for _, p := range misc[0].group {
+			p.next = exiElementContent
+		}
+		childContent = append(childContent, misc[0])
+	}
+	startTag := append([]*exiProduction{
+		{event: exiEE, learn: true},
+		{event: exiAT, next: exiStartTagContent, learn: true},
+	}, childContent...)
+	return &exiElementGrammar{
+		startTag: []*exiProduction{{group: startTag}},
+		content:  []*exiProduction{{event: exiEE}, {group: childContent}},
+	}
+}
+
+// exiMaxDepth is the maximum nesting depth of the elements of an EXI
+// stream, as they are decoded recursively.
+const exiMaxDepth = 10000
+
+func (d *exiDecoder) decodeElement(parent *Node, qname *exiQName, level int) error {
+	if level > exiMaxDepth {
+		return fmt.Errorf("xmlquery: EXI elements nested deeper than %d", exiMaxDepth)
+	}
+	var err error
+	if qname == nil {
+		if qname, err = d.decodeQName(); err != nil {
+			return err
+		}
+	}
+	node := &Node{Type: ElementNode, Data: qname.local, NamespaceURI: qname.uri, level: level}
+	if qname.uri != parent.NamespaceURI {
+		node.Attr = append(node.Attr, Attr{Name: newXMLName("xmlns"), Value: qname.uri})
+	}
+	AddChild(parent, node)
+
+	g := d.grammars[qname]
+	if g == nil {
+		g = d.newElementGrammar()
+		d.grammars[qname] = g
+	}
+	state := exiStartTagContent
+	for {
+		grammar := g.startTag
+		if state == exiElementContent {
+			grammar = g.content
+		}
+		prod, err := d.decodeEventCode(grammar)
+		if err != nil {
+			return err
+		}
+		// Built-in productions are learned with event code 0, so that the
+		// next occurrence of the same event is encoded more compactly.
+		learn := func(p *exiProduction) {
+			if state == exiStartTagContent {
+				g.startTag = append([]*exiProduction{p}, g.startTag...)
+			} else {
+				g.content = append([]*exiProduction{p}, g.content...)
+			}
+		}
+		switch prod.event {
+		case exiEE:
+			if prod.learn {
+				learn(&exiProduction{event: exiEE})
+			}
+			return nil
+		case exiAT:
+			at := prod.qname
+			if at == nil {
+				if at, err = d.decodeQName(); err != nil {
+					return err
+				}
+				learn(&exiProduction{event: exiAT, qname: at, next: exiStartTagContent})
+			}
+			value, err := d.decodeValue(at)
+			if err != nil {
+				return err
+			}
+			d.addAttr(node, at, value)
+		case exiSE:
+			se := prod.qname
+			if se == nil {
+				if se, err = d.decodeQName(); err != nil {
+					return err
+				}
+				learn(&exiProduction{event: exiSE, qname: se, next: exiElementContent})
+			}
+			if err = d.decodeElement(node, se, level+1); err != nil {
+				return err
+			}
+		case exiCH:
+			if prod.learn {
+				learn(&exiProduction{event: exiCH, next: exiElementContent})
+			}
+			value, err := d.decodeValue(qname)
+			if err != nil {
+				return err
+			}
+			if value != "" {
+				if last := node.LastChild; last != nil && last.Type == TextNode {
+					last.Data += value
+				} else {
+					AddChild(node, &Node{Type: TextNode, Data: value, level: level + 1})
+				}
+			}
+		default:
+			if err = d.decodeMisc(node, prod.event, level+1); err != nil {
+				return err
+			}
+		}
+		state = prod.next
+	}
+}
+
+// addAttr adds an attribute in namespace-aware form, declaring a prefix for
+// its namespace if needed.
+func (d *exiDecoder) addAttr(n *Node, qname *exiQName, value string) {
+	attr := Attr{Name: newXMLName(qname.local), Value: value, NamespaceURI: qname.uri}
+	switch qname.uri {
+	case "":
+	case "http://www.w3.org/XML/1998/namespace":
+		attr.Name.Space = "xml"
+	default:
+		prefix := ""
+		for p := n; p != nil && prefix == ""; p = p.Parent {
+			for _, a := range p.Attr {
+				if a.Name.Space == "xmlns" && a.Value == qname.uri {
+					prefix = a.Name.Local
+					break
+				}
+			}
+		}
+		if prefix == "" {
+			prefix = fmt.Sprintf("ns%d", len(n.Attr))
+			n.Attr = append(n.Attr, Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: qname.uri})
+		}
+		attr.Name.Space = prefix
+	}
+	n.Attr = append(n.Attr, attr)
+}
+
+func (d *exiDecoder) decodeMisc(parent *Node, event, level int) error {
+	switch event {
+	case exiCM:
+		s, err := d.readString()
+		if err != nil {
+			return err
+		}
+		AddChild(parent, &Node{Type: CommentNode, Data: s, level: level})
+	case exiPI:
+		target, err := d.readString()
+		if err != nil {
+			return err
+		}
+		inst, err := d.readString()
+		if err != nil {
+			return err
+		}
+		node := &Node{Type: DeclarationNode, Data: target, level: level}
+		for _, pair := range strings.Split(inst, " ") {
+			pair = strings.TrimSpace(pair)
+			if i := strings.Index(pair, "="); i > 0 {
+				AddAttr(node, pair[:i], strings.Trim(pair[i+1:], `"'`))
+			}
+		}
+		AddChild(parent, node)
+	}
+	return nil
+}
+
+// decodeEventCode reads an event code and returns the matched production.
+func (d *exiDecoder) decodeEventCode(grammar []*exiProduction) (*exiProduction, error) {
+	for {
+		i, err := d.readNBit(bitsFor(len(grammar)))
+		if err != nil {
+			return nil, err
+		}
+		if int(i) >= len(grammar) {
+			return nil, fmt.Errorf("xmlquery: invalid EXI event code %d", i)
+		}
+		prod := grammar[i]
+		if prod.group == nil {
+			return prod, nil
+		}
+		grammar = prod.group
+	}
+}
+
+func (d *exiDecoder) decodeQName() (*exiQName, error) {
+	i, err := d.readNBit(bitsFor(len(d.uris) + 1))
+	if err != nil {
+		return nil, err
+	}
+	var uri string
+	if i == 0 {
+		if uri, err = d.readString(); err != nil {
+			return nil, err
+		}
+		d.uris = append(d.uris, uri)
+	} else if int(i) <= len(d.uris) {
+		uri = d.uris[i-1]
+	} else {
+		return nil, fmt.Errorf("xmlquery: invalid EXI uri id %d", i-1)
+	}
+
+	var local string
+	n, err := d.readUint()
+	if err != nil {
+		return nil, err
+	}
+	names := d.localNames[uri]
+	if n == 0 {
+		i, err := d.readNBit(bitsFor(len(names)))
+		if err != nil {
+			return nil, err
+		}
+		if int(i) >= len(names) {
+			return nil, fmt.Errorf("xmlquery: invalid EXI local-name id %d", i)
+		}
+		local = names[i]
+	} else {
+		if local, err = d.readChars(n - 1); err != nil {
+			return nil, err
+		}
+		d.localNames[uri] = append(names, local)
+	}
+
+	key := exiQName{uri: uri, local: local}
+	qname := d.qnames[key]
+	if qname == nil {
+		qname = &key
+		d.qnames[key] = qname
+	}
+	return qname, nil
+}
+
+// decodeValue reads a string value through the value string table.
+func (d *exiDecoder) decodeValue(qname *exiQName) (string, error) {
+	n, err := d.readUint()
+	if err != nil {
+		return "", err
+	}
+	switch n {
+	case 0:
+		local := d.localValue[qname]
+		i, err := d.readNBit(bitsFor(len(local)))
+		if err != nil {
+			return "", err
+		}
+		if int(i) >= len(local) {
+			return "", fmt.Errorf("xmlquery: invalid EXI local value id %d", i)
+		}
+		return local[i], nil
+	case 1:
+		i, err := d.readNBit(bitsFor(len(d.globalValue)))
+		if err != nil {
+			return "", err
+		}
+		if int(i) >= len(d.globalValue) {
+			return "", fmt.Errorf("xmlquery: invalid EXI global value id %d", i)
+		}
+		return d.globalValue[i], nil
+	}
+	s, err := d.readChars(n - 2)
+	if err != nil {
+		return "", err
+	}
+	if s != "" {
+		d.localValue[qname] = append(d.localValue[qname], s)
+		d.globalValue = append(d.globalValue, s)
+	}
+	return s, nil
+}
+
+func (d *exiDecoder) readString() (string, error) {
+	n, err := d.readUint()
+	if err != nil {
+		return "", err
+	}
+	return d.readChars(n)
+}
+
+func (d *exiDecoder) readChars(n uint64) (string, error) {
+	var b strings.Builder
+	for ; n > 0; n-- {
+		c, err := d.readUint()
+		if err != nil {
+			return "", err
+		}
+		if c > 0x10FFFF {
+			return "", fmt.Errorf("xmlquery: invalid EXI character %d", c)
+		}
+		b.WriteRune(rune(c))
+	}
+	return b.String(), nil
+}
+
+// readUint reads an EXI Unsigned Integer: 7-bit groups, least significant
+// first, with the high bit of each octet flagging continuation.
+func (d *exiDecoder) readUint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := d.readBits(8)
+		if err != nil {
+			return 0, err
+		}
+		v |= (b & 0x7F) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("xmlquery: EXI unsigned integer overflow")
+}
+
+// readNBit reads an n-bit unsigned integer, which is byte-aligned in the
+// byte-alignment mode.
+func (d *exiDecoder) readNBit(n uint) (uint64, error) {
+	if !d.options.ByteAligned || n == 0 {
+		return d.readBits(n)
+	}
+	var v uint64
+	for i := uint(0); i < (n+7)/8; i++ {
+		b, err := d.readBits(8)
+		if err != nil {
+			return 0, err
+		}
+		v |= b << (8 * i)
+	}
+	return v, nil
+}
+
+func (d *exiDecoder) readBits(n uint) (uint64, error) {
+	var v uint64
+	for ; n > 0; n-- {
+		if d.nbits == 0 {
+			b, err := d.r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			d.buf = b
+			d.nbits = 8
+		}
+		d.nbits--
+		v = v<<1 | uint64(d.buf>>d.nbits&1)
+	}
+	return v, nil
+}
+
+// bitsFor returns the number of bits needed to represent n distinct values.
+func bitsFor(n int) uint {
+	var bits uint
+	for 1<<bits < n {
+		bits++
+	}
+	return bits
+}
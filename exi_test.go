@@ -0,0 +1,148 @@
+package xmlquery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseEXI(t *testing.T) {
+	// <r x="1"><b>hi</b><b>hi</b></r>, schema-less and bit-packed.
+	data := []byte{0x80, 0x40, 0x9C, 0x94, 0x09, 0xE0, 0x0C, 0xC7, 0x20, 0x4C, 0x58, 0x23, 0x43, 0x4A, 0x40, 0x20, 0x01}
+	doc, err := ParseEXI(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0"?><r x="1"><b>hi</b><b>hi</b></r>`
+	if got := doc.OutputXML(false); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if list := Find(doc, "//b[.='hi']"); len(list) != 2 {
+		t.Fatalf("expected 2 b elements, got %d", len(list))
+	}
+}
+
+func TestParseEXIWithCookie(t *testing.T) {
+	data := append([]byte("$EXI"), 0x80, 0x40, 0x9C, 0x94, 0x09, 0xE0, 0x0C, 0xC7, 0x20, 0x4C, 0x58, 0x23, 0x43, 0x4A, 0x40, 0x20, 0x01)
+	if _, err := ParseEXI(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseEXIErrors(t *testing.T) {
+	if _, err := ParseEXI(bytes.NewReader([]byte("<a/>"))); err == nil {
+		t.Fatal("expected an invalid header error but nil")
+	}
+	if _, err := ParseEXI(bytes.NewReader([]byte{0xA0})); err == nil {
+		t.Fatal("expected an unsupported header options error but nil")
+	}
+	if _, err := ParseEXI(bytes.NewReader([]byte{0x80, 0x40, 0x9C})); err == nil {
+		t.Fatal("expected an unexpected EOF error but nil")
+	}
+}
+
+// exiBits packs a string of bits, ignoring spaces, into bytes padded with
+// zeros.
+func exiBits(s string) []byte {
+	var b []byte
+	n := 0
+	for _, c := range s {
+		if c == ' ' {
+			continue
+		}
+		if n%8 == 0 {
+			b = append(b, 0)
+		}
+		if c == '1' {
+			b[len(b)-1] |= 0x80 >> uint(n%8)
+		}
+		n++
+	}
+	return b
+}
+
+func TestParseEXIByteAligned(t *testing.T) {
+	data := []byte{
+		0x80,                  // header
+		0x01, 0x00, 0x01, 'c', // CM "c"
+		0x00, 0x00, 0x01, 'u', 0x02, 'a', // SE {u}a, with a new uri
+		0x01, 0x01, 0x02, 'x', 0x03, 'v', // AT x="v", adding "v" to the value tables
+		0x01, 0x04, 0x01, 0x01, 'p', 0x05, 'k', '=', '"', '1', '"', // PI p k="1"
+		0x01, 0x01, 0x01, // CH "v", from the global value table
+		0x01, // EE
+		0x00, // ED
+	}
+	options := EXIOptions{ByteAligned: true, PreserveComments: true, PreservePIs: true}
+	doc, err := ParseEXIWithOptions(bytes.NewReader(data), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0"?><!--c--><a xmlns="u" x="v"><?p k="1"?>v</a>`
+	if got := doc.OutputXML(false); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	testValue(t, FindOne(doc, "/*").NamespaceURI, "u")
+
+	// Without the fidelity options, the event codes are read differently.
+	if _, err := ParseEXIWithOptions(bytes.NewReader(data), EXIOptions{ByteAligned: true}); err == nil {
+		t.Fatal("expected an error without the fidelity options but nil")
+	}
+}
+
+func TestParseEXINamespaces(t *testing.T) {
+	data := exiBits("10000000" + // header
+		"01 00000010 01110010" + // SE r
+		"01 00 00000001 01101110 00000010 01110100" + // AT {n}t, with a new uri
+		"00000011 01111010" + // ="z"
+		"1 10 001 00000010 01100011" + // SE c
+		"01 100 00000000" + // AT {n}t, from the local-name table
+		"00000000" + // ="z", from the local value table
+		"1 00" + // EE
+		"0") // EE
+	doc, err := ParseEXI(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<r xmlns:ns0="n" ns0:t="z"><c ns0:t="z"></c></r>`
+	if got := FindOne(doc, "/r").OutputXML(true); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	c := FindOne(doc, "//c")
+	testValue(t, c.Attr[0].NamespaceURI, "n")
+	testValue(t, FindOne(doc, "//c/@*[namespace-uri()='n' and local-name()='t']").InnerText(), "z")
+
+	for n := 1; n < len(data)-1; n++ {
+		if _, err := ParseEXI(bytes.NewReader(data[:n])); err == nil {
+			t.Fatalf("expected an error for %d bytes but nil", n)
+		}
+	}
+}
+
+func TestParseEXIMalformed(t *testing.T) {
+	tests := map[string]struct {
+		data    []byte
+		options EXIOptions
+	}{
+		"invalid EXI event code":         {[]byte{0x80, 0x05}, EXIOptions{ByteAligned: true, PreserveComments: true}},
+		"invalid EXI local-name id":      {exiBits("10000000 01 00000000"), EXIOptions{}},
+		"invalid EXI local value id":     {exiBits("10000000 01 00000010 01110010 01 01 00000010 01100001 00000000"), EXIOptions{}},
+		"invalid EXI global value id":    {exiBits("10000000 01 00000010 01110010 01 01 00000010 01100001 00000001"), EXIOptions{}},
+		"invalid EXI character":          {exiBits("10000000 01 00000010 11111111 11111111 11111111 01111111"), EXIOptions{}},
+		"EXI unsigned integer overflow":  {append([]byte{0x80, 0x01}, bytes.Repeat([]byte{0xFF}, 12)...), EXIOptions{ByteAligned: true}},
+		"invalid EXI uri id":             {[]byte{0x80, 0x40}, EXIOptions{ByteAligned: true}},
+		"unsupported EXI format version": {exiBits("10000001"), EXIOptions{}},
+	}
+	for want, test := range tests {
+		_, err := ParseEXIWithOptions(bytes.NewReader(test.data), test.options)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v", want, err)
+		}
+	}
+
+	// <e><e>... nested beyond the maximum depth; the nested elements are
+	// encoded with the production learned by the grammar of e.
+	deep := exiBits("10000000 01 00000010 01100101 10 01 00000000" + strings.Repeat("0", exiMaxDepth))
+	if _, err := ParseEXI(bytes.NewReader(deep)); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Fatalf("expected a depth error but got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+)
+
+// fragmentWrapper is the name of the element a fragment is parsed in.
+const fragmentWrapper = "xmlquery-fragment"
+
+// ParseFragment parses a sequence of nodes that need not form a document,
+// such as no element or several elements with text around them, and
+// returns them as the children of a FragmentNode. An XML declaration at
+// the start of the input is left out.
+func ParseFragment(r io.Reader) (*Node, error) {
+	return ParseFragmentWithOptions(r, currentConfig().parserOptions)
+}
+
+// ParseFragmentWithOptions is like ParseFragment, but with custom options.
+// The prefixes bound by options.Namespaces are declared for the fragment,
+// so it may use the prefixes of the document it was taken from.
+func ParseFragmentWithOptions(r io.Reader, options ParserOptions) (*Node, error) {
+	if !options.DisableDecompression {
+		var err error
+		if r, err = decompress(r); err != nil {
+			return nil, err
+		}
+		options.DisableDecompression = true
+	}
+	// The fragment is parsed as the content of a wrapper element, which
+	// declares the namespaces and holds the top-level nodes.
+	var b strings.Builder
+	b.WriteString("<" + fragmentWrapper)
+	prefixes := make([]string, 0, len(options.Namespaces))
+	for prefix := range options.Namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		attr := "xmlns"
+		if prefix != "" {
+			attr += ":" + prefix
+		}
+		b.WriteString(" " + attr + `="`)
+		xml.EscapeText(&b, []byte(options.Namespaces[prefix]))
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+	start, end := b.String(), "</"+fragmentWrapper+">"
+	// The limits apply to the fragment, not to the wrapper.
+	if options.Limits.MaxDepth > 0 {
+		options.Limits.MaxDepth++
+	}
+	if options.Limits.MaxNodes > 0 {
+		options.Limits.MaxNodes++
+	}
+	if options.Limits.MaxBytes > 0 {
+		options.Limits.MaxBytes += int64(len(start) + len(end))
+	}
+	wrapperSize := (&Node{Type: ElementNode, Data: fragmentWrapper}).size()
+	if options.Limits.MaxNodeBytes > 0 {
+		options.Limits.MaxNodeBytes += wrapperSize
+	}
+	doc, err := ParseWithOptions(io.MultiReader(strings.NewReader(start), r, strings.NewReader(end)), options)
+	if limitErr, ok := err.(*LimitError); ok {
+		limitErr.Offset -= int64(len(start))
+		switch limitErr.Limit {
+		case "MaxBytes":
+			limitErr.Max -= int64(len(start) + len(end))
+		case "MaxNodeBytes":
+			limitErr.Max -= wrapperSize
+		default:
+			limitErr.Max--
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var wrapper *Node
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type == ElementNode && n.Data == fragmentWrapper {
+			wrapper = n
+		}
+	}
+	frag := &Node{Type: FragmentNode, document: doc.document}
+	if first := wrapper.FirstChild; first != nil && first.Type == DeclarationNode && first.Data == "xml" {
+		RemoveFromTree(first)
+	}
+	for n := wrapper.FirstChild; n != nil; n = wrapper.FirstChild {
+		RemoveFromTree(n)
+		AddChild(frag, n)
+	}
+	if options.WithLineNumbers {
+		shiftPositions(frag, int64(len(start)))
+	}
+	return frag, nil
+}
+
+// shiftPositions removes the offset of the wrapper start tag, on the first
+// line, from the positions of the nodes of the fragment frag.
+func shiftPositions(frag *Node, offset int64) {
+	shift := func(pos *Position) {
+		if pos.Line == 1 {
+			pos.Column -= int(offset)
+		}
+		pos.Offset -= offset
+	}
+	var walk func(*Node)
+	walk = func(n *Node) {
+		n.level--
+		if n.position != nil {
+			shift(&n.position.start)
+			shift(&n.position.end)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for child := frag.FirstChild; child != nil; child = child.NextSibling {
+		walk(child)
+	}
+}
@@ -0,0 +1,84 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFragment(t *testing.T) {
+	frag, err := ParseFragment(strings.NewReader(`<a>1</a>text<b x="2"/><!-- c -->`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frag.Type != FragmentNode {
+		t.Fatalf("unexpected type %v", frag.Type)
+	}
+	testValue(t, frag.OutputXML(true), `<a>1</a>text<b x="2"></b><!-- c -->`)
+	testValue(t, FindOne(frag, "/b/@x").InnerText(), "2")
+	if list := Find(frag, "/*"); len(list) != 2 {
+		t.Fatalf("got %d top-level elements", len(list))
+	}
+
+	frag, err = ParseFragment(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frag.FirstChild != nil {
+		t.Fatal("expected an empty fragment")
+	}
+}
+
+func TestAddFragment(t *testing.T) {
+	doc := loadXML(`<list><item>1</item></list>`)
+	list := FindOne(doc, "/list")
+	frag, err := ParseFragment(strings.NewReader(`<item>2</item><item>3</item>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddChild(list, frag)
+	testValue(t, list.OutputXML(true), `<list><item>1</item><item>2</item><item>3</item></list>`)
+	if frag.FirstChild != nil {
+		t.Fatal("the fragment was not emptied")
+	}
+
+	frag, err = ParseFragment(strings.NewReader(`<item>4</item><!-- end -->`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddSibling(FindOne(list, "item"), frag)
+	testValue(t, list.OutputXML(true), `<list><item>1</item><item>2</item><item>3</item><item>4</item><!-- end --></list>`)
+	if n := FindOne(doc, "/list/item[4]"); n == nil || n.Parent != list {
+		t.Fatal("the added nodes are not children of the list")
+	}
+}
+
+func TestParseFragmentWithOptions(t *testing.T) {
+	frag, err := ParseFragment(strings.NewReader(`<?xml version="1.0"?><!-- c -->text<a/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, frag.OutputXML(true), `<!-- c -->text<a></a>`)
+
+	frag, err = ParseFragmentWithOptions(strings.NewReader(`<x:a>1</x:a><x:b/>`), ParserOptions{
+		Namespaces: map[string]string{"x": "urn:x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := Find(frag, "/*"); len(list) != 2 || list[0].NamespaceURI != "urn:x" || list[1].Prefix != "x" {
+		t.Fatalf("unexpected elements %v", list)
+	}
+
+	frag, err = ParseFragmentWithOptions(strings.NewReader("<a/>\n  <b/>"), ParserOptions{WithLineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, ok := FindOne(frag, "/a").Position()
+	if !ok || pos.Line != 1 || pos.Column != 1 || pos.Offset != 0 {
+		t.Fatalf("unexpected position of a: %+v", pos)
+	}
+	pos, _ = FindOne(frag, "/b").Position()
+	if pos.Line != 2 || pos.Column != 3 || pos.Offset != 7 {
+		t.Fatalf("unexpected position of b: %+v", pos)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.16
+// +build go1.16
+
+package xmlquery
+
+import (
+	"io/fs"
+)
+
+// ParseFile parses the file name of fsys, such as an embed.FS, with the
+// default parser options, see Configure. The name is the source name of
+// the document, see Node.SourceName.
+func ParseFile(fsys fs.FS, name string) (*Node, error) {
+	return parseFile(fsys, name, currentConfig().parserOptions)
+}
+
+// ParseFS parses the files of fsys matching pattern, as defined by
+// fs.Glob, and returns the documents by file name. Each name is also the
+// source name of its document. ParseFS stops at the first file that cannot
+// be parsed.
+func ParseFS(fsys fs.FS, pattern string, options ParserOptions) (map[string]*Node, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]*Node, len(names))
+	for _, name := range names {
+		doc, err := parseFile(fsys, name, options)
+		if err != nil {
+			return nil, err
+		}
+		docs[name] = doc
+	}
+	return docs, nil
+}
+
+func parseFile(fsys fs.FS, name string, options ParserOptions) (*Node, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	options.SourceName = name
+	return ParseWithOptions(f, options)
+}
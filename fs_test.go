@@ -0,0 +1,44 @@
+//go:build go1.16
+// +build go1.16
+
+package xmlquery
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/a.xml": {Data: []byte(`<a>1</a>`)},
+		"templates/b.xml": {Data: []byte(`<b>2</b>`)},
+		"templates/c.txt": {Data: []byte(`not xml`)},
+		"bad.xml":         {Data: []byte(`<a>`)},
+	}
+	docs, err := ParseFS(fsys, "templates/*.xml", ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("got %d documents", len(docs))
+	}
+	doc := docs["templates/b.xml"]
+	testValue(t, FindOne(doc, "/b").InnerText(), "2")
+	testValue(t, doc.SourceName(), "templates/b.xml")
+
+	doc, err = ParseFile(fsys, "templates/a.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "/a").InnerText(), "1")
+
+	_, err = ParseFS(fsys, "*.xml", ParserOptions{})
+	var sourceErr *SourceError
+	if !errors.As(err, &sourceErr) || sourceErr.Source != "bad.xml" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := ParseFile(fsys, "missing.xml"); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
@@ -6,4 +6,5 @@ require (
 	github.com/antchfx/xpath v1.3.3
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da
 	golang.org/x/net v0.33.0
+	golang.org/x/text v0.21.0
 )
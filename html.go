@@ -0,0 +1,33 @@
+package xmlquery
+
+import "io"
+
+// HTMLOptions returns parser options suited to near-XHTML content, such as
+// legacy feeds or scraped pages, that is mostly well-formed XML but for
+// the liberties HTML allows:
+//
+//   - the HTML void elements, such as <br> or <img>, need no end tag, see
+//     HTMLAutoClose;
+//   - the HTML named entities, such as &nbsp; or &copy;, are resolved, see
+//     HTMLEntities;
+//   - the decoder is not strict, so unknown entities and stray ampersands
+//     are kept as text, attribute values may be unquoted or missing, and
+//     undeclared namespace prefixes are accepted;
+//   - end tags may be omitted or mismatched, see Recover.
+//
+// It is not an HTML parser: the content of script and style elements must
+// still escape its < characters, and element names are case-sensitive.
+// Use golang.org/x/net/html for arbitrary HTML. The returned options can
+// be adjusted before use.
+func HTMLOptions() ParserOptions {
+	return ParserOptions{
+		HTMLEntities:  true,
+		HTMLAutoClose: true,
+		Recover:       true,
+	}
+}
+
+// ParseHTML is like Parse, but with the options of HTMLOptions.
+func ParseHTML(r io.Reader) (*Node, error) {
+	return ParseWithOptions(r, HTMLOptions())
+}
@@ -0,0 +1,36 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHTML(t *testing.T) {
+	s := `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>A &amp; B&nbsp;&mdash; news</title></head>
+<body>
+<p class=intro>Fish &chips; &amp; more<br>next line
+<input type="checkbox" checked>
+<fb:like href="x"/>
+<img src="a.png">
+</body>
+</html>`
+	if _, err := Parse(strings.NewReader(s)); err == nil {
+		t.Fatal("expected the document to be rejected by Parse")
+	}
+	doc, err := ParseHTML(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "//title").InnerText(), "A & B\u00a0\u2014 news")
+	p := FindOne(doc, "//p")
+	testValue(t, p.SelectAttr("class"), "intro")
+	testValue(t, strings.HasPrefix(p.InnerText(), "Fish &chips; & more"), true)
+	testValue(t, len(Find(doc, "//br")), 1)
+	testValue(t, FindOne(doc, "//input").SelectAttr("checked"), "checked")
+	testValue(t, FindOne(doc, "//*[local-name()='like']").SelectAttr("href"), "x")
+	// The <p> left open is closed by </body>.
+	testValue(t, FindOne(doc, "//img").Parent.Data, "p")
+	testValue(t, FindOne(doc, "//body").Parent.Data, "html")
+}
@@ -0,0 +1,137 @@
+package xmlquery
+
+import (
+	"regexp"
+	"sync"
+)
+
+// nodeIndex holds the indexes of a tree, rebuilt once the tree changes.
+type nodeIndex struct {
+	mu    sync.Mutex
+	built *indexData
+}
+
+// indexData maps the element names and id attribute values of a tree to
+// its elements, in document order. It is not modified once built.
+type indexData struct {
+	tree     *treeInfo // the tree of the node when built
+	revision uint64
+	byName   map[string][]*Node
+	byID     map[string][]*Node
+	xmlIDs   map[string]*Node // first element with each xml:id value
+}
+
+// EnableIndex builds indexes of the element names and id and xml:id
+// attributes of the tree rooted at n. While enabled, GetElementByID is
+// served from the indexes, and QueryAll and Query serve the simplest
+// expressions evaluated from n from the indexes instead of walking the
+// tree:
+//
+//	//name
+//	//name[@id='x']
+//	/a/b/c
+//
+// Other expressions are evaluated as usual. The indexes are rebuilt on the
+// next query once the tree is changed by the functions of this package,
+// such as AddChild or SetAttr; changes made by assigning the fields of a
+// Node directly are not detected. Only the changes to the tree of n count,
+// and queries may run concurrently as long as the tree is not changed, but
+// EnableIndex and DisableIndex must not be called while n is queried.
+func EnableIndex(n *Node) {
+	n.index = &nodeIndex{built: buildIndex(n)}
+}
+
+// DisableIndex drops the indexes built by EnableIndex.
+func DisableIndex(n *Node) {
+	n.index = nil
+}
+
+func buildIndex(top *Node) *indexData {
+	t := track(top)
+	idx := &indexData{
+		tree:     t,
+		revision: t.revision,
+		byName:   make(map[string][]*Node),
+		byID:     make(map[string][]*Node),
+		xmlIDs:   make(map[string]*Node),
+	}
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != ElementNode {
+				continue
+			}
+			if child.Prefix == "" {
+				idx.byName[child.Data] = append(idx.byName[child.Data], child)
+			}
+			for _, attr := range child.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "id" {
+					idx.byID[attr.Value] = append(idx.byID[attr.Value], child)
+				}
+			}
+			if id, ok := xmlIDOf(child); ok && idx.xmlIDs[id] == nil {
+				idx.xmlIDs[id] = child
+			}
+			walk(child)
+		}
+	}
+	walk(top)
+	return idx
+}
+
+var (
+	planDescendant = regexp.MustCompile(`^//([A-Za-z_][\w.\-]*)$`)
+	planID         = regexp.MustCompile(`^//([A-Za-z_][\w.\-]*)\[@id\s*=\s*(?:'([^']*)'|"([^"]*)")\]$`)
+	planPath       = regexp.MustCompile(`^(?:/[A-Za-z_][\w.\-]*)+$`)
+	planStep       = regexp.MustCompile(`[A-Za-z_][\w.\-]*`)
+)
+
+// planQuery returns the nodes matching expr evaluated from top, if top is
+// indexed and expr is one of the shapes served by the indexes. Names with
+// a prefix are never planned, since their resolution depends on the
+// namespaces of the expression.
+func planQuery(top *Node, expr string) ([]*Node, bool) {
+	if top.index == nil {
+		return nil, false
+	}
+	if m := planDescendant.FindStringSubmatch(expr); m != nil {
+		list := top.currentIndex().byName[m[1]]
+		return append([]*Node(nil), list...), true
+	}
+	if m := planID.FindStringSubmatch(expr); m != nil {
+		var list []*Node
+		for _, n := range top.currentIndex().byID[m[2]+m[3]] {
+			if n.Data == m[1] && n.Prefix == "" {
+				list = append(list, n)
+			}
+		}
+		return list, true
+	}
+	if planPath.MatchString(expr) {
+		list := []*Node{top}
+		for _, name := range planStep.FindAllString(expr, -1) {
+			var next []*Node
+			for _, n := range list {
+				for child := n.FirstChild; child != nil; child = child.NextSibling {
+					if child.Type == ElementNode && child.Data == name && child.Prefix == "" {
+						next = append(next, child)
+					}
+				}
+			}
+			list = next
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// currentIndex returns the indexes of n, rebuilt if the tree has changed.
+func (n *Node) currentIndex() *indexData {
+	idx := n.index
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if t := track(n); idx.built.tree != t || idx.built.revision != t.revision {
+		idx.built = buildIndex(n)
+	}
+	return idx.built
+}
@@ -0,0 +1,94 @@
+package xmlquery
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEnableIndex(t *testing.T) {
+	s := `<library xmlns:x="urn:x">
+		<shelf><book id="a">A</book><book id="b">B</book></shelf>
+		<shelf><book id="c">C</book><x:book id="d">D</x:book><note id="a"/></shelf>
+	</library>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs := []string{
+		"//book",
+		"//book[@id='c']",
+		`//book[@id="a"]`,
+		"//note[@id='b']",
+		"/library/shelf/book",
+		"/library/shelf",
+		"/shelf",
+		"//x:book",
+		"//book[2]",
+	}
+	want := make(map[string][]*Node)
+	for _, expr := range exprs {
+		want[expr] = Find(doc, expr)
+	}
+	EnableIndex(doc)
+	if _, ok := planQuery(doc, "//book"); !ok {
+		t.Fatal("//book not served by the index")
+	}
+	if _, ok := planQuery(doc, "//x:book"); ok {
+		t.Fatal("prefixed names must not be planned")
+	}
+	for _, expr := range exprs {
+		if got := Find(doc, expr); fmt.Sprint(got) != fmt.Sprint(want[expr]) {
+			t.Errorf("%s: got %v, want %v", expr, got, want[expr])
+		}
+	}
+	if n := FindOne(doc, "//book[@id='c']"); n == nil || n.InnerText() != "C" {
+		t.Fatal("FindOne did not use the index")
+	}
+
+	// Changes through the package functions refresh the index.
+	book := &Node{Type: ElementNode, Data: "book"}
+	AddChild(FindOne(doc, "/library/shelf"), book)
+	book.SetAttr("id", "e")
+	if got := Find(doc, "//book"); len(got) != 4 || got[2] != book {
+		t.Fatalf("index not refreshed after AddChild: %v", got)
+	}
+	if FindOne(doc, "//book[@id='e']") != book {
+		t.Fatal("index not refreshed after SetAttr")
+	}
+	DisableIndex(doc)
+	if _, ok := planQuery(doc, "//book"); ok {
+		t.Fatal("index not disabled")
+	}
+}
+
+func TestEnableIndexConcurrent(t *testing.T) {
+	doc := loadXML(`<r><a>1</a><a>2</a></r>`)
+	other := loadXML(`<r/>`)
+	EnableIndex(doc)
+	built := doc.index.built
+
+	// The index of doc is not rebuilt by queries nor by changes to other
+	// trees.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := Find(doc, "//a"); len(got) != 2 {
+					t.Errorf("got %d nodes", len(got))
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		AddChild(other.FirstChild, &Node{Type: ElementNode, Data: "a"})
+	}
+	wg.Wait()
+	if doc.index.built != built {
+		t.Fatal("index rebuilt without changes to its tree")
+	}
+}
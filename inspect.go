@@ -0,0 +1,142 @@
+package xmlquery
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// PathInfo describes a distinct element path of a document.
+type PathInfo struct {
+	// Path is the absolute location path of the elements, for example
+	// /catalog/book/title. Prefixed names are written as prefix:name.
+	Path string
+	// Count is the number of elements found at the path.
+	Count int
+	// HasAttr reports whether any of the elements has attributes.
+	HasAttr bool
+	// HasText reports whether any of the elements has text content other
+	// than whitespace as a direct child.
+	HasText bool
+}
+
+// Outline returns every distinct element path of the tree rooted at doc, in
+// the order in which they first appear.
+func Outline(doc *Node) []PathInfo {
+	var paths []PathInfo
+	index := map[string]int{}
+	var walk func(*Node, string)
+	walk = func(n *Node, parent string) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != ElementNode {
+				continue
+			}
+			path := parent + "/" + child.qualifiedName()
+			i, ok := index[path]
+			if !ok {
+				i = len(paths)
+				index[path] = i
+				paths = append(paths, PathInfo{Path: path})
+			}
+			info := &paths[i]
+			info.Count++
+			if len(child.Attr) > 0 {
+				info.HasAttr = true
+			}
+			for c := child.FirstChild; c != nil && !info.HasText; c = c.NextSibling {
+				if (c.Type == TextNode || c.Type == CharDataNode) && strings.TrimSpace(c.Data) != "" {
+					info.HasText = true
+				}
+			}
+			walk(child, path)
+		}
+	}
+	if doc.Type == ElementNode {
+		walk(&Node{FirstChild: doc}, "")
+	} else {
+		walk(doc, "")
+	}
+	return paths
+}
+
+func (n *Node) qualifiedName() string {
+	if n.Prefix == "" {
+		return n.Data
+	}
+	return n.Prefix + ":" + n.Data
+}
+
+// DocumentStats holds statistics about a tree, see Stats.
+type DocumentStats struct {
+	// Elements counts elements by qualified name.
+	Elements map[string]int
+	// Attributes counts attributes by qualified name.
+	Attributes map[string]int
+	// Nodes counts nodes by type, including the root node.
+	Nodes map[NodeType]int
+	// MaxDepth is the deepest element nesting; a root element has depth 1.
+	MaxDepth int
+	// TextBytes is the total size of text and CDATA content in bytes.
+	TextBytes int
+}
+
+// Stats walks the tree rooted at doc and returns its statistics.
+func Stats(doc *Node) *DocumentStats {
+	stats := &DocumentStats{
+		Elements:   map[string]int{},
+		Attributes: map[string]int{},
+		Nodes:      map[NodeType]int{},
+	}
+	var walk func(*Node, int)
+	walk = func(n *Node, depth int) {
+		stats.Nodes[n.Type]++
+		switch n.Type {
+		case ElementNode:
+			depth++
+			if depth > stats.MaxDepth {
+				stats.MaxDepth = depth
+			}
+			stats.Elements[n.qualifiedName()]++
+			for _, attr := range n.Attr {
+				name := attr.Name.Local
+				if attr.Name.Space != "" {
+					name = attr.Name.Space + ":" + name
+				}
+				stats.Attributes[name]++
+			}
+		case TextNode, CharDataNode:
+			stats.TextBytes += len(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, depth)
+		}
+	}
+	walk(doc, 0)
+	return stats
+}
+
+// EstimateSize returns an estimate of the memory, in bytes, held by the
+// subtree rooted at n: the node structures, their strings and attribute
+// slices. Strings shared between nodes are counted every time, so the
+// estimate errs on the high side.
+func (n *Node) EstimateSize() int64 {
+	var size int64
+	var walk func(*Node)
+	walk = func(n *Node) {
+		size += n.size()
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return size
+}
+
+// size returns the estimated memory held by n alone.
+func (n *Node) size() int64 {
+	size := int64(unsafe.Sizeof(*n)) + int64(len(n.Data)+len(n.Prefix)+len(n.NamespaceURI))
+	size += int64(cap(n.Attr)) * int64(unsafe.Sizeof(Attr{}))
+	for _, attr := range n.Attr {
+		size += int64(len(attr.Name.Space) + len(attr.Name.Local) + len(attr.Value) + len(attr.NamespaceURI))
+	}
+	return size
+}
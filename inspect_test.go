@@ -0,0 +1,59 @@
+package xmlquery
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+func TestOutline(t *testing.T) {
+	paths := Outline(doc)
+	var got []string
+	for _, p := range paths {
+		got = append(got, fmt.Sprintf("%s %d %v %v", p.Path, p.Count, p.HasAttr, p.HasText))
+	}
+	expected := "[/catalog 1 false false /catalog/book 3 true false /catalog/book/author 3 false true " +
+		"/catalog/book/title 3 false true /catalog/book/genre 3 false true /catalog/book/price 3 false true " +
+		"/catalog/book/publish_date 3 false true /catalog/book/description 3 false true]"
+	testValue(t, fmt.Sprint(got), expected)
+
+	for _, p := range paths {
+		if n := len(Find(doc, p.Path)); n != p.Count {
+			t.Fatalf("%s: expected %d nodes, got %d", p.Path, p.Count, n)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	doc := loadXML(`<a x="1"><b y="2" x="3">hi</b><b><c><![CDATA[abc]]></c></b><!-- n --></a>`)
+	stats := Stats(doc)
+	testValue(t, stats.Elements["a"], 1)
+	testValue(t, stats.Elements["b"], 2)
+	testValue(t, stats.Elements["c"], 1)
+	testValue(t, stats.Attributes["x"], 2)
+	testValue(t, stats.Attributes["y"], 1)
+	testValue(t, stats.MaxDepth, 3)
+	testValue(t, stats.TextBytes, 5)
+	testValue(t, stats.Nodes[DocumentNode], 1)
+	testValue(t, stats.Nodes[ElementNode], 4)
+	testValue(t, stats.Nodes[CommentNode], 1)
+	testValue(t, stats.Nodes[CharDataNode], 1)
+}
+
+func TestEstimateSize(t *testing.T) {
+	doc := loadXML(`<a id="1"><b>text</b></a>`)
+	a := FindOne(doc, "//a")
+	b := FindOne(doc, "//b")
+	if a.EstimateSize() <= b.EstimateSize() || b.EstimateSize() <= b.FirstChild.EstimateSize() {
+		t.Fatal("expected the estimate to grow with the subtree")
+	}
+	node := int64(unsafe.Sizeof(Node{}))
+	if v := b.FirstChild.EstimateSize(); v != node+4 {
+		t.Errorf("expected %d for the text node but got %d", node+4, v)
+	}
+	before := b.EstimateSize()
+	b.SetAttr("lang", "en")
+	if v := b.EstimateSize(); v < before+int64(unsafe.Sizeof(Attr{}))+6 {
+		t.Errorf("expected attributes to be counted, got %d from %d", v, before)
+	}
+}
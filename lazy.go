@@ -0,0 +1,346 @@
+package xmlquery
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/antchfx/xpath"
+)
+
+// LazyDocument is a skeleton index of an XML document: it holds the elements
+// of the document with their attributes and byte offsets, but none of their
+// text, comments or processing instructions. The full subtree of an element
+// is parsed from the underlying io.ReaderAt when first requested, which
+// gives random access into documents too large to be kept in memory.
+//
+// LazyDocument is experimental. Offsets are byte offsets of the input as
+// read, so the document must be encoded in UTF-8; entities declared in the
+// DTD are not known when a subtree is materialized.
+type LazyDocument struct {
+	r    io.ReaderAt
+	root *LazyElement
+}
+
+// LazyElement is an element of a LazyDocument.
+type LazyElement struct {
+	Data         string
+	Prefix       string
+	NamespaceURI string
+	Attr         []Attr
+	// Offset and End are the byte offsets of the element start tag and of
+	// the end of its end tag in the input.
+	Offset, End int64
+
+	Parent   *LazyElement
+	children []*LazyElement
+	index    int // index in the children of Parent
+	scope    namespaceScope
+	doc      *LazyDocument
+	node     *Node
+}
+
+// ParseLazy reads the document of size bytes from r and builds its skeleton
+// index. The input is read once from start to end; subtrees are read again
+// when materialized.
+func ParseLazy(r io.ReaderAt, size int64) (*LazyDocument, error) {
+	doc := &LazyDocument{r: r}
+	doc.root = &LazyElement{doc: doc, scope: namespaceScope{"xml": xmlNamespaceURI}, End: size}
+	decoder := xml.NewDecoder(io.NewSectionReader(r, 0, size))
+	curr := doc.root
+	for {
+		offset := decoder.InputOffset()
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			e := &LazyElement{
+				Data:   tok.Name.Local,
+				Prefix: tok.Name.Space,
+				Offset: offset,
+				Parent: curr,
+				index:  len(curr.children),
+				doc:    doc,
+			}
+			for _, attr := range tok.Attr {
+				a := Attr{Name: attr.Name, Value: attr.Value}
+				if attr.Name.Space == "xmlns" {
+					a.NamespaceURI = "xmlns"
+				}
+				e.Attr = append(e.Attr, a)
+			}
+			e.scope = curr.scope.declare(&Node{Attr: e.Attr})
+			if e.Prefix != "" {
+				uri, ok := e.scope[e.Prefix]
+				if !ok {
+					return nil, fmt.Errorf("xmlquery: prefix %s of element %s is not declared", e.Prefix, e.Data)
+				}
+				e.NamespaceURI = uri
+			} else {
+				e.NamespaceURI = e.scope[""]
+			}
+			for i, attr := range e.Attr {
+				if prefix := attr.Name.Space; prefix != "" && prefix != "xmlns" {
+					e.Attr[i].NamespaceURI = e.scope[prefix]
+				}
+			}
+			curr.children = append(curr.children, e)
+			curr = e
+		case xml.EndElement:
+			if curr == doc.root || tok.Name.Local != curr.Data || tok.Name.Space != curr.Prefix {
+				return nil, fmt.Errorf("xmlquery: unexpected end element </%s> at offset %d", tok.Name.Local, offset)
+			}
+			curr.End = decoder.InputOffset()
+			curr = curr.Parent
+		}
+	}
+	if curr != doc.root {
+		return nil, fmt.Errorf("xmlquery: unexpected EOF, element <%s> is not closed", curr.Data)
+	}
+	return doc, nil
+}
+
+// DocumentElement returns the root element of the document, or nil if it
+// has none.
+func (d *LazyDocument) DocumentElement() *LazyElement {
+	if len(d.root.children) == 0 {
+		return nil
+	}
+	return d.root.children[0]
+}
+
+// QueryAll evaluates expr against the skeleton of the document and returns
+// the matching elements. Expressions may test element names and
+// attributes freely; the string value of an element, as used by
+// predicates like [.='x'], materializes it. Text, comment and processing
+// instruction nodes are not part of the skeleton and never match.
+// Returns an error if expr cannot be parsed or evaluated.
+func (d *LazyDocument) QueryAll(expr string) (elems []*LazyElement, err error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	defer recoverEval(expr, &err)
+	t := exp.Select(&lazyNavigator{root: d.root, curr: d.root, attr: -1})
+	for t.MoveNext() {
+		nav := t.Current().(*lazyNavigator)
+		if nav.attr == -1 && nav.curr != d.root {
+			elems = append(elems, nav.curr)
+		}
+	}
+	return elems, nil
+}
+
+// Query is like QueryAll, but returns the first matching element only.
+func (d *LazyDocument) Query(expr string) (elem *LazyElement, err error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	defer recoverEval(expr, &err)
+	t := exp.Select(&lazyNavigator{root: d.root, curr: d.root, attr: -1})
+	for t.MoveNext() {
+		nav := t.Current().(*lazyNavigator)
+		if nav.attr == -1 && nav.curr != d.root {
+			return nav.curr, nil
+		}
+	}
+	return nil, nil
+}
+
+// Children returns the child elements of e.
+func (e *LazyElement) Children() []*LazyElement {
+	return e.children
+}
+
+// SelectAttr returns the attribute value with the specified name, like
+// Node.SelectAttr.
+func (e *LazyElement) SelectAttr(name string) string {
+	return (&Node{Attr: e.Attr}).SelectAttr(name)
+}
+
+// Node returns the subtree of e, parsing it from the input the first time.
+// The returned node has no parent; the namespaces it inherits are resolved
+// but their declarations are not copied onto it.
+func (e *LazyElement) Node() (*Node, error) {
+	if e.node != nil {
+		return e.node, nil
+	}
+	if e.Parent == nil {
+		return nil, fmt.Errorf("xmlquery: the document node cannot be materialized")
+	}
+	// Wrap the element in one declaring the namespaces it inherits.
+	var wrapper bytes.Buffer
+	wrapper.WriteString("<xmlquery-lazy")
+	for prefix, uri := range e.Parent.scope {
+		if prefix == "xml" {
+			continue
+		}
+		if prefix == "" {
+			wrapper.WriteString(` xmlns="`)
+		} else {
+			fmt.Fprintf(&wrapper, ` xmlns:%s="`, prefix)
+		}
+		xml.EscapeText(&wrapper, []byte(uri))
+		wrapper.WriteByte('"')
+	}
+	wrapper.WriteByte('>')
+	r := io.MultiReader(
+		&wrapper,
+		io.NewSectionReader(e.doc.r, e.Offset, e.End-e.Offset),
+		strings.NewReader("</xmlquery-lazy>"),
+	)
+	doc, err := ParseWithOptions(r, ParserOptions{DisableDecompression: true})
+	if err != nil {
+		return nil, err
+	}
+	wrap := doc.FirstChild
+	for wrap != nil && wrap.Type != ElementNode {
+		wrap = wrap.NextSibling
+	}
+	if wrap == nil || wrap.FirstChild == nil || wrap.FirstChild.Type != ElementNode {
+		return nil, fmt.Errorf("xmlquery: no element at offset %d", e.Offset)
+	}
+	n := wrap.FirstChild
+	n.Parent, n.NextSibling = nil, nil
+	e.node = n
+	return n, nil
+}
+
+// Release drops the materialized subtree of e, if any, so it can be
+// garbage collected.
+func (e *LazyElement) Release() {
+	e.node = nil
+}
+
+// lazyNavigator is an xpath.NodeNavigator over the skeleton of a
+// LazyDocument.
+type lazyNavigator struct {
+	root, curr *LazyElement
+	attr       int
+}
+
+func (x *lazyNavigator) NodeType() xpath.NodeType {
+	switch {
+	case x.curr == x.root:
+		return xpath.RootNode
+	case x.attr != -1:
+		return xpath.AttributeNode
+	}
+	return xpath.ElementNode
+}
+
+func (x *lazyNavigator) LocalName() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Name.Local
+	}
+	return x.curr.Data
+}
+
+func (x *lazyNavigator) Prefix() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Name.Space
+	}
+	return x.curr.Prefix
+}
+
+func (x *lazyNavigator) NamespaceURL() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].NamespaceURI
+	}
+	return x.curr.NamespaceURI
+}
+
+func (x *lazyNavigator) Value() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Value
+	}
+	if x.curr == x.root {
+		return ""
+	}
+	n, err := x.curr.Node()
+	if err != nil {
+		return ""
+	}
+	return n.InnerText()
+}
+
+func (x *lazyNavigator) Copy() xpath.NodeNavigator {
+	n := *x
+	return &n
+}
+
+func (x *lazyNavigator) MoveToRoot() {
+	x.curr, x.attr = x.root, -1
+}
+
+func (x *lazyNavigator) MoveToParent() bool {
+	if x.attr != -1 {
+		x.attr = -1
+		return true
+	} else if x.curr.Parent != nil {
+		x.curr = x.curr.Parent
+		return true
+	}
+	return false
+}
+
+func (x *lazyNavigator) MoveToNextAttribute() bool {
+	if x.attr >= len(x.curr.Attr)-1 {
+		return false
+	}
+	x.attr++
+	return true
+}
+
+func (x *lazyNavigator) MoveToChild() bool {
+	if x.attr != -1 || len(x.curr.children) == 0 {
+		return false
+	}
+	x.curr = x.curr.children[0]
+	return true
+}
+
+func (x *lazyNavigator) MoveToFirst() bool {
+	if x.attr != -1 || x.curr.Parent == nil || x.curr.index == 0 {
+		return false
+	}
+	x.curr = x.curr.Parent.children[0]
+	return true
+}
+
+func (x *lazyNavigator) MoveToNext() bool {
+	if x.attr != -1 || x.curr.Parent == nil || x.curr.index+1 >= len(x.curr.Parent.children) {
+		return false
+	}
+	x.curr = x.curr.Parent.children[x.curr.index+1]
+	return true
+}
+
+func (x *lazyNavigator) MoveToPrevious() bool {
+	if x.attr != -1 || x.curr.Parent == nil || x.curr.index == 0 {
+		return false
+	}
+	x.curr = x.curr.Parent.children[x.curr.index-1]
+	return true
+}
+
+func (x *lazyNavigator) MoveTo(other xpath.NodeNavigator) bool {
+	node, ok := other.(*lazyNavigator)
+	if !ok || node.root != x.root {
+		return false
+	}
+	x.curr, x.attr = node.curr, node.attr
+	return true
+}
+
+func (x *lazyNavigator) String() string {
+	return x.Value()
+}
@@ -0,0 +1,92 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLazy(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<catalog xmlns="urn:catalog" xmlns:x="urn:x">
+	<!-- records -->
+	<record id="1"><title>One</title></record>
+	<record id="2" x:flag="yes"><title>Two &amp; more</title><x:note/></record>
+	<record id="3"><title>Three</title></record>
+</catalog>`
+	r := strings.NewReader(s)
+	doc, err := ParseLazy(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := doc.DocumentElement()
+	if root.Data != "catalog" || root.NamespaceURI != "urn:catalog" || len(root.Children()) != 3 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+
+	e, err := doc.Query("//record[@id='2']")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil {
+		t.Fatal("record 2 not found")
+	}
+	if e.node != nil {
+		t.Fatal("record materialized by an attribute query")
+	}
+	if got := s[e.Offset:e.End]; !strings.HasPrefix(got, `<record id="2"`) || !strings.HasSuffix(got, `</record>`) {
+		t.Fatalf("wrong offsets: %q", got)
+	}
+	if e.SelectAttr("x:flag") != "yes" {
+		t.Fatal("prefixed attribute not indexed")
+	}
+
+	n, err := e.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Parent != nil || n.NamespaceURI != "urn:catalog" {
+		t.Fatalf("unexpected node %+v", n)
+	}
+	if got := FindOne(n, "title").InnerText(); got != "Two & more" {
+		t.Fatalf("got title %q", got)
+	}
+	if note := FindOne(n, "x:note"); note == nil || note.NamespaceURI != "urn:x" {
+		t.Fatal("inherited namespace not resolved")
+	}
+	if m, _ := e.Node(); m != n {
+		t.Fatal("materialized subtree not cached")
+	}
+
+	list, err := doc.QueryAll("/catalog/record[title='Three']/title | //x:note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Data == list[1].Data {
+		t.Fatalf("unexpected query result %v", list)
+	}
+	if last, _ := doc.Query("//record[last()]"); last == nil || last.SelectAttr("id") != "3" {
+		t.Fatal("positional query failed")
+	}
+}
+
+func TestParseLazy_Errors(t *testing.T) {
+	for _, s := range []string{`<a><b></a>`, `<a>`, `<p:a/>`} {
+		r := strings.NewReader(s)
+		if _, err := ParseLazy(r, r.Size()); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+
+	s := `<r><a>(</a></r>`
+	r := strings.NewReader(s)
+	doc, err := ParseLazy(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.QueryAll("//a[sum(string(.)) > 0]"); err == nil {
+		t.Error("QueryAll: expected an evaluation error")
+	}
+	if _, err := doc.Query("//a[sum(string(.)) > 0]"); err == nil {
+		t.Error("Query: expected an evaluation error")
+	}
+}
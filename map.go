@@ -0,0 +1,159 @@
+package xmlquery
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type mapConfiguration struct {
+	attrPrefix string
+	textKey    string
+}
+
+// MapOption configures ToMap and FromMap.
+type MapOption func(*mapConfiguration)
+
+// WithMapAttrPrefix sets the prefix of the keys that hold attributes. The
+// default is "@".
+func WithMapAttrPrefix(prefix string) MapOption {
+	return func(c *mapConfiguration) {
+		c.attrPrefix = prefix
+	}
+}
+
+// WithMapTextKey sets the key that holds the text of elements that also have
+// attributes or child elements. The default is "#text".
+func WithMapTextKey(key string) MapOption {
+	return func(c *mapConfiguration) {
+		c.textKey = key
+	}
+}
+
+func newMapConfiguration(opts []MapOption) *mapConfiguration {
+	config := &mapConfiguration{attrPrefix: "@", textKey: "#text"}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// ToMap converts the element n, or the root element of the document n, to
+// nested maps. An element holding only text becomes a string, other
+// elements become a map of their attributes, text and children; children
+// sharing a name are collected into a []interface{}.
+func ToMap(n *Node, opts ...MapOption) map[string]interface{} {
+	config := newMapConfiguration(opts)
+	m := map[string]interface{}{}
+	if n.Type == ElementNode {
+		m[n.qualifiedName()] = config.value(n)
+		return m
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == ElementNode {
+			m[child.qualifiedName()] = config.value(child)
+		}
+	}
+	return m
+}
+
+func (c *mapConfiguration) value(n *Node) interface{} {
+	var text strings.Builder
+	hasChildren := false
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case TextNode, CharDataNode:
+			text.WriteString(child.Data)
+		case ElementNode:
+			hasChildren = true
+		}
+	}
+	s := text.String()
+	if len(n.Attr) == 0 && !hasChildren {
+		return s
+	}
+	m := map[string]interface{}{}
+	for _, attr := range n.Attr {
+		m[c.attrPrefix+attrQualifiedName(attr)] = attr.Value
+	}
+	if s = strings.TrimSpace(s); s != "" {
+		m[c.textKey] = s
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != ElementNode {
+			continue
+		}
+		name := child.qualifiedName()
+		v := c.value(child)
+		switch prev := m[name].(type) {
+		case nil:
+			m[name] = v
+		case []interface{}:
+			m[name] = append(prev, v)
+		default:
+			m[name] = []interface{}{prev, v}
+		}
+	}
+	return m
+}
+
+// FromMap builds a document whose root element, named rootName, has the
+// content described by m, following the conventions of ToMap: keys with the
+// attribute prefix become attributes, the text key becomes text, other keys
+// become child elements, and slices become repeated elements. Keys are
+// written in sorted order. Values other than maps and slices are written
+// with fmt.Sprint; nil values produce empty elements.
+func FromMap(m map[string]interface{}, rootName string, opts ...MapOption) (*Node, error) {
+	config := newMapConfiguration(opts)
+	doc := &Node{Type: DocumentNode}
+	if err := config.build(doc, rootName, m); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (c *mapConfiguration) build(parent *Node, name string, v interface{}) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n<>&\"'/=") {
+		return fmt.Errorf("xmlquery: invalid element name %q", name)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < rv.Len(); i++ {
+			if err := c.build(parent, name, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	xmlName := newXMLName(name)
+	n := &Node{Type: ElementNode, Data: xmlName.Local, Prefix: xmlName.Space, level: parent.level + 1}
+	AddChild(parent, n)
+	switch {
+	case v == nil:
+		return nil
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			value := rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()
+			switch {
+			case k == c.textKey:
+				AddChild(n, &Node{Type: TextNode, Data: fmt.Sprint(value), level: n.level + 1})
+			case c.attrPrefix != "" && strings.HasPrefix(k, c.attrPrefix):
+				AddAttr(n, k[len(c.attrPrefix):], fmt.Sprint(value))
+			default:
+				if err := c.build(n, k, value); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		AddChild(n, &Node{Type: TextNode, Data: fmt.Sprint(v), level: n.level + 1})
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package xmlquery
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestToMap(t *testing.T) {
+	doc := loadXML(`<catalog><book id="1"><title>A</title><tag>x</tag><tag>y</tag></book><name>c</name></catalog>`)
+	m := ToMap(doc)
+	catalog := m["catalog"].(map[string]interface{})
+	book := catalog["book"].(map[string]interface{})
+	testValue(t, book["@id"], "1")
+	testValue(t, book["title"], "A")
+	testValue(t, fmt.Sprint(book["tag"]), "[x y]")
+	testValue(t, catalog["name"], "c")
+}
+
+func TestFromMap(t *testing.T) {
+	doc, err := FromMap(map[string]interface{}{
+		"@version": 2,
+		"book": []interface{}{
+			map[string]interface{}{"@id": "1", "title": "A & B", "tag": []string{"x", "y"}},
+			map[string]interface{}{"@id": "2", "#text": "t"},
+		},
+		"empty": nil,
+	}, "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<catalog version="2"><book id="1"><tag>x</tag><tag>y</tag><title>A &amp; B</title></book><book id="2">t</book><empty></empty></catalog>`
+	testValue(t, doc.OutputXML(false), expected)
+
+	round, err := FromMap(ToMap(doc)["catalog"].(map[string]interface{}), "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, round.OutputXML(false), expected)
+
+	if _, err := FromMap(map[string]interface{}{"a b": 1}, "root"); err == nil {
+		t.Fatal("expected an invalid name error but nil")
+	}
+}
@@ -0,0 +1,210 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+var (
+	_ xml.Marshaler   = (*Node)(nil)
+	_ xml.Unmarshaler = (*Node)(nil)
+)
+
+// MarshalXML implements xml.Marshaler. An element node is written as is,
+// with its own name and prefixes, in place of the start element chosen by
+// the encoder; any other node is written as the children of start.
+func (n *Node) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if n.Type == ElementNode {
+		return marshalNode(e, n)
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if err := marshalNode(e, child); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// marshalNode writes n using lexical names, so the prefixes and namespace
+// declarations of the tree are kept instead of being regenerated by the
+// encoder.
+func marshalNode(e *xml.Encoder, n *Node) error {
+	switch n.Type {
+	case ElementNode:
+		name := xml.Name{Local: n.Data}
+		if n.Prefix != "" {
+			name.Local = n.Prefix + ":" + n.Data
+		}
+		start := xml.StartElement{Name: name}
+		for _, attr := range n.Attr {
+			local := attr.Name.Local
+			if attr.Name.Space != "" {
+				local = attr.Name.Space + ":" + local
+			}
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: local}, Value: attr.Value})
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if err := marshalNode(e, child); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case DeclarationNode:
+		// The XML declaration is only allowed at the start of the output.
+		if n.Data == "xml" {
+			return nil
+		}
+	case DocumentNode, FragmentNode:
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if err := marshalNode(e, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if tok := nodeStartToken(n); tok != nil {
+		return e.EncodeToken(tok)
+	}
+	return nil
+}
+
+// UnmarshalXML implements xml.Unmarshaler. It captures the element start and
+// its content as an element node, so that arbitrary XML can be queried after
+// decoding a known envelope. Namespaces declared outside of the element are
+// redeclared inside it, as the default namespace for elements where it
+// leaves the names of their descendants unchanged and with generated
+// prefixes otherwise, so the captured tree is self-contained.
+func (n *Node) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*n = Node{}
+	u := &nodeUnmarshaler{}
+	u.start(n, start, 1)
+	curr := n
+	for level := 1; level > 0; {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		var node *Node
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			node = &Node{}
+			AddChild(curr, node)
+			u.start(node, tok, level+1)
+			curr = node
+			level++
+			continue
+		case xml.EndElement:
+			u.end()
+			curr = curr.Parent
+			level--
+			continue
+		case xml.CharData:
+			node = &Node{Type: TextNode, Data: string(tok)}
+		case xml.Comment:
+			node = &Node{Type: CommentNode, Data: string(tok)}
+		case xml.Directive:
+			node = &Node{Type: NotationNode, Data: string(tok)}
+		case xml.ProcInst:
+			node = &Node{Type: DeclarationNode, Data: tok.Target}
+			for _, attr := range parsePseudoAttrs(string(tok.Inst)) {
+				AddAttr(node, attr.Name.Local, attr.Value)
+			}
+		}
+		node.level = level + 1
+		AddChild(curr, node)
+	}
+	return nil
+}
+
+type nodeUnmarshaler struct {
+	scopes   []map[string]string // namespace URI to prefix
+	defaults []string            // default namespace of each scope
+}
+
+// defaultNamespace returns the default namespace declared in the captured
+// tree for the next element.
+func (u *nodeUnmarshaler) defaultNamespace() string {
+	if len(u.defaults) == 0 {
+		return ""
+	}
+	return u.defaults[len(u.defaults)-1]
+}
+
+func (u *nodeUnmarshaler) prefix(uri string) (string, bool) {
+	if uri == "http://www.w3.org/XML/1998/namespace" {
+		return "xml", true
+	}
+	for i := len(u.scopes) - 1; i >= 0; i-- {
+		if prefix, ok := u.scopes[i][uri]; ok {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+func (u *nodeUnmarshaler) start(n *Node, tok xml.StartElement, level int) {
+	scope := map[string]string{}
+	u.scopes = append(u.scopes, scope)
+	def, declared := u.defaultNamespace(), false
+	for _, attr := range tok.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			scope[attr.Value] = ""
+			def, declared = attr.Value, true
+		} else if attr.Name.Space == "xmlns" {
+			scope[attr.Value] = attr.Name.Local
+		}
+	}
+
+	n.Type = ElementNode
+	n.Data = tok.Name.Local
+	n.NamespaceURI = tok.Name.Space
+	n.level = level
+	if uri := tok.Name.Space; uri != "" {
+		prefix, ok := u.prefix(uri)
+		if ok && prefix == "" && uri != def {
+			ok = false
+		}
+		if !ok {
+			if def == "" && !declared {
+				// Unqualified descendants are in no namespace, so the
+				// default namespace can only be taken where none is.
+				def = uri
+				scope[uri] = ""
+				n.Attr = append(n.Attr, Attr{Name: xml.Name{Local: "xmlns"}, Value: uri})
+			} else {
+				prefix = fmt.Sprintf("ns%d", len(n.Attr))
+				scope[uri] = prefix
+				n.Attr = append(n.Attr, Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: uri, NamespaceURI: "xmlns"})
+			}
+		}
+		n.Prefix = prefix
+	} else if def != "" {
+		def = ""
+		n.Attr = append(n.Attr, Attr{Name: xml.Name{Local: "xmlns"}})
+	}
+	u.defaults = append(u.defaults, def)
+	for _, attr := range tok.Attr {
+		a := Attr{Name: attr.Name, Value: attr.Value, NamespaceURI: attr.Name.Space}
+		if uri := attr.Name.Space; uri != "" && uri != "xmlns" {
+			prefix, ok := u.prefix(uri)
+			if !ok || prefix == "" {
+				prefix = fmt.Sprintf("ns%d", len(n.Attr))
+				scope[uri] = prefix
+				n.Attr = append(n.Attr, Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: uri, NamespaceURI: "xmlns"})
+			}
+			a.Name.Space = prefix
+		}
+		n.Attr = append(n.Attr, a)
+	}
+}
+
+func (u *nodeUnmarshaler) end() {
+	u.scopes = u.scopes[:len(u.scopes)-1]
+	u.defaults = u.defaults[:len(u.defaults)-1]
+}
@@ -0,0 +1,93 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+type testEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	ID      string   `xml:"Header>ID"`
+	Body    *Node    `xml:"Body"`
+}
+
+func TestUnmarshalNode(t *testing.T) {
+	s := `<Envelope xmlns:a="urn:a"><Header><ID>42</ID></Header><Body><a:order no="1"><a:item a:sku="x"/><!-- c --></a:order></Body></Envelope>`
+	var env testEnvelope
+	if err := xml.Unmarshal([]byte(s), &env); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, env.ID, "42")
+	if env.Body == nil || env.Body.Data != "Body" {
+		t.Fatalf("expected Body element, got %v", env.Body)
+	}
+	item := FindOne(env.Body, "//*[namespace-uri()='urn:a' and local-name()='item']")
+	if item == nil {
+		t.Fatal("item is not found")
+	}
+	if FindOne(env.Body, "//*[@*[namespace-uri()='urn:a' and local-name()='sku']='x']") != item {
+		t.Fatal("item sku attribute is not found")
+	}
+	expected := `<Body><order xmlns="urn:a" no="1"><item xmlns:ns0="urn:a" ns0:sku="x"></item><!-- c --></order></Body>`
+	if got := env.Body.OutputXML(true); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestMarshalNode(t *testing.T) {
+	doc := loadXML(`<Body><p:order xmlns:p="urn:p" no="1"><p:item>a &amp; b</p:item></p:order></Body>`)
+	env := testEnvelope{ID: "7", Body: FindOne(doc, "/Body")}
+	b, err := xml.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<Envelope><Header><ID>7</ID></Header><Body><p:order xmlns:p="urn:p" no="1"><p:item>a &amp; b</p:item></p:order></Body></Envelope>`
+	testValue(t, string(b), expected)
+
+	var got testEnvelope
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(got.Body, "//p:item").InnerText(), "a & b")
+}
+
+func TestUnmarshalNodeNamespaces(t *testing.T) {
+	tests := []struct{ s, expected string }{
+		// The unqualified descendants stay in no namespace.
+		{`<env xmlns:p="u"><p:a><b/></p:a></env>`, `<a xmlns="u"><b xmlns=""></b></a>`},
+		{`<env xmlns:p="u"><p:a><p:b/><c xmlns="v"><d/></c></p:a></env>`, `<a xmlns="u"><b></b><c xmlns="v"><d></d></c></a>`},
+		// The default namespace declared on the element is kept.
+		{`<env xmlns:p="u"><p:a xmlns="v"><b/></p:a></env>`, `<ns0:a xmlns:ns0="u" xmlns="v"><b></b></ns0:a>`},
+		{`<env xmlns:p="u"><a xmlns="v"><p:b><c/></p:b></a></env>`, `<a xmlns="v"><ns0:b xmlns:ns0="u"><c></c></ns0:b></a>`},
+	}
+	for _, test := range tests {
+		var env struct {
+			A *Node `xml:",any"`
+		}
+		if err := xml.Unmarshal([]byte(test.s), &env); err != nil {
+			t.Fatal(err)
+		}
+		if got := env.A.OutputXML(true); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.s, test.expected, got)
+		}
+		doc, err := Parse(strings.NewReader(env.A.OutputXML(true)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range Find(doc, "//*") {
+			orig := FindOne(env.A, "descendant-or-self::*[local-name()='"+n.Data+"']")
+			testValue(t, n.NamespaceURI, orig.NamespaceURI)
+		}
+	}
+}
+
+func TestUnmarshalNodeProcInst(t *testing.T) {
+	var env struct {
+		A *Node `xml:"a"`
+	}
+	if err := xml.Unmarshal([]byte(`<env><a><?pi x="1" y="2"?></a></env>`), &env); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, env.A.OutputXML(true), `<a><?pi x="1" y="2"?></a>`)
+}
@@ -0,0 +1,295 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+const xmlNamespaceURI = "http://www.w3.org/XML/1998/namespace"
+
+// namespaceScope maps the prefixes in scope to their namespace URIs, the
+// empty prefix being the default namespace.
+type namespaceScope map[string]string
+
+// declare returns the scope of n's children, adding the namespaces n
+// declares to s.
+func (s namespaceScope) declare(n *Node) namespaceScope {
+	scope := s
+	copied := false
+	for _, attr := range n.Attr {
+		if prefix, ok := xmlnsPrefixOf(attr); ok {
+			if !copied {
+				scope, copied = s.copy(), true
+			}
+			scope[prefix] = attr.Value
+		}
+	}
+	return scope
+}
+
+func (s namespaceScope) copy() namespaceScope {
+	scope := make(namespaceScope, len(s)+1)
+	for k, v := range s {
+		scope[k] = v
+	}
+	return scope
+}
+
+// prefixFor returns a non-empty prefix bound to uri in scope.
+func (s namespaceScope) prefixFor(uri string) (string, bool) {
+	for prefix, v := range s {
+		if prefix != "" && v == uri {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// scopeOf returns the namespaces in scope at n, those n declares included.
+// n may be nil.
+func scopeOf(n *Node) namespaceScope {
+	var ancestors []*Node
+	for ; n != nil; n = n.Parent {
+		ancestors = append(ancestors, n)
+	}
+	scope := namespaceScope{"xml": xmlNamespaceURI}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if ancestors[i].Type == ElementNode {
+			scope = scope.declare(ancestors[i])
+		}
+	}
+	return scope
+}
+
+// xmlnsPrefixOf returns the prefix declared by an xmlns attribute, the
+// empty string for a default namespace declaration.
+func xmlnsPrefixOf(attr Attr) (string, bool) {
+	switch {
+	case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		return "", true
+	case attr.Name.Space == "xmlns":
+		return attr.Name.Local, true
+	}
+	return "", false
+}
+
+// NamespaceDecl is a namespace declaration made by an xmlns attribute.
+type NamespaceDecl struct {
+	// Prefix is the declared prefix, empty for the default namespace.
+	Prefix string
+	URI    string
+}
+
+// NamespaceDecls returns the namespace declarations made by the element n,
+// in the order of its xmlns attributes. Like the other attributes, they are
+// kept in Attr and written by OutputXML as they were parsed.
+func (n *Node) NamespaceDecls() []NamespaceDecl {
+	var decls []NamespaceDecl
+	for _, attr := range n.Attr {
+		if prefix, ok := xmlnsPrefixOf(attr); ok {
+			decls = append(decls, NamespaceDecl{Prefix: prefix, URI: attr.Value})
+		}
+	}
+	return decls
+}
+
+// RepairNamespaces makes the subtree rooted at n namespace-well-formed, so
+// it can be serialized and parsed back after nodes were created or moved
+// between documents. The prefix of every element and attribute is checked
+// against the declarations in scope, those of n's ancestors included:
+//
+//   - missing xmlns declarations are added to the element needing them;
+//   - a prefix whose declaration on the same element binds another URI is
+//     replaced by a prefix already bound to the URI, or by a generated one;
+//   - namespaced attributes without a prefix get one;
+//   - the NamespaceURI of a prefixed node without one is set from the
+//     declaration of its prefix.
+//
+// RepairNamespaces returns an error if a prefix without namespace URI is
+// not declared, or if an element in no namespace declares a default
+// namespace.
+func RepairNamespaces(n *Node) error {
+	scope := scopeOf(n.Parent)
+	if n.Type == DocumentNode || n.Type == FragmentNode {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if err := repairNamespaces(child, scope); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return repairNamespaces(n, scope)
+}
+
+func repairNamespaces(n *Node, scope namespaceScope) error {
+	if n.Type != ElementNode {
+		return nil
+	}
+	// declared reports whether n itself declares prefix.
+	declared := func(prefix string) bool {
+		for _, attr := range n.Attr {
+			if p, ok := xmlnsPrefixOf(attr); ok && p == prefix {
+				return true
+			}
+		}
+		return false
+	}
+	scope = scope.declare(n)
+	bind := func(prefix, uri string) {
+		if prefix == "" {
+			n.Attr = append(n.Attr, Attr{Name: xml.Name{Local: "xmlns"}, Value: uri})
+		} else {
+			n.Attr = append(n.Attr, Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: uri, NamespaceURI: "xmlns"})
+		}
+		scope = scope.copy()
+		scope[prefix] = uri
+	}
+	generate := func(uri string) string {
+		for i := 0; ; i++ {
+			prefix := fmt.Sprintf("ns%d", i)
+			if _, ok := scope[prefix]; !ok {
+				if !declared(prefix) {
+					bind(prefix, uri)
+					return prefix
+				}
+			}
+		}
+	}
+
+	switch {
+	case n.NamespaceURI == "" && n.Prefix != "":
+		uri, ok := scope[n.Prefix]
+		if !ok {
+			return fmt.Errorf("xmlquery: prefix %s of element %s is not declared", n.Prefix, n.Data)
+		}
+		n.NamespaceURI = uri
+	case n.NamespaceURI == "":
+		if uri := scope[""]; uri != "" {
+			if declared("") {
+				return fmt.Errorf("xmlquery: element %s is in no namespace but declares the default namespace %s", n.Data, uri)
+			}
+			bind("", "")
+		}
+	default:
+		if uri, ok := scope[n.Prefix]; !ok || uri != n.NamespaceURI {
+			if !declared(n.Prefix) {
+				bind(n.Prefix, n.NamespaceURI)
+			} else if prefix, ok := scope.prefixFor(n.NamespaceURI); ok {
+				n.Prefix = prefix
+			} else {
+				n.Prefix = generate(n.NamespaceURI)
+			}
+		}
+	}
+
+	for i, count := 0, len(n.Attr); i < count; i++ {
+		attr := n.Attr[i]
+		if _, ok := xmlnsPrefixOf(attr); ok {
+			continue
+		}
+		prefix := attr.Name.Space
+		switch {
+		case attr.NamespaceURI == "" && prefix != "":
+			uri, ok := scope[prefix]
+			if !ok {
+				return fmt.Errorf("xmlquery: prefix %s of attribute %s is not declared", prefix, attr.Name.Local)
+			}
+			n.Attr[i].NamespaceURI = uri
+		case attr.NamespaceURI != "":
+			if uri, ok := scope[prefix]; prefix != "" && ok && uri == attr.NamespaceURI {
+				continue
+			}
+			// The prefix of the element itself cannot be rebound.
+			if prefix != "" && prefix != n.Prefix && !declared(prefix) {
+				bind(prefix, attr.NamespaceURI)
+			} else if p, ok := scope.prefixFor(attr.NamespaceURI); ok {
+				n.Attr[i].Name.Space = p
+			} else {
+				n.Attr[i].Name.Space = generate(attr.NamespaceURI)
+			}
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if err := repairNamespaces(child, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attrIndexNS returns the index in n.Attr of the attribute with the
+// expanded name {namespaceURI}local, or -1. The namespace of a prefixed
+// attribute without NamespaceURI, such as one added with AddAttr, is that
+// declared for its prefix.
+func (n *Node) attrIndexNS(namespaceURI, local string) int {
+	var scope namespaceScope
+	for i, attr := range n.Attr {
+		if attr.Name.Local != local {
+			continue
+		}
+		if _, ok := xmlnsPrefixOf(attr); ok {
+			continue
+		}
+		uri := attr.NamespaceURI
+		if uri == "" && attr.Name.Space != "" {
+			if scope == nil {
+				scope = scopeOf(n)
+			}
+			uri = scope[attr.Name.Space]
+		}
+		if uri == namespaceURI {
+			return i
+		}
+	}
+	return -1
+}
+
+// SelectAttrNS returns the value of the attribute with the namespace URI
+// namespaceURI, "" for none, and the local name local, whatever its
+// prefix, or "" if there is no such attribute.
+func (n *Node) SelectAttrNS(namespaceURI, local string) string {
+	if i := n.attrIndexNS(namespaceURI, local); i >= 0 {
+		return n.Attr[i].Value
+	}
+	return ""
+}
+
+// SetAttrNS sets the value of the attribute with the namespace URI
+// namespaceURI, "" for none, and the local name local, whatever its
+// prefix. A new attribute gets a prefix bound to namespaceURI where n is;
+// if there is none, a prefix is generated and declared on n, so the
+// attribute is written out with the right namespace.
+func (n *Node) SetAttrNS(namespaceURI, local, value string) {
+	touch(n)
+	if i := n.attrIndexNS(namespaceURI, local); i >= 0 {
+		n.Attr[i].Value = value
+		return
+	}
+	attr := Attr{Name: xml.Name{Local: local}, Value: value, NamespaceURI: namespaceURI}
+	if namespaceURI != "" {
+		scope := scopeOf(n)
+		prefix, ok := scope.prefixFor(namespaceURI)
+		if !ok {
+			for i := 0; ; i++ {
+				prefix = fmt.Sprintf("ns%d", i)
+				if _, taken := scope[prefix]; !taken {
+					break
+				}
+			}
+			n.Attr = append(n.Attr, Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: namespaceURI, NamespaceURI: "xmlns"})
+		}
+		attr.Name.Space = prefix
+	}
+	n.Attr = append(n.Attr, attr)
+}
+
+// RemoveAttrNS removes the attribute with the namespace URI namespaceURI,
+// "" for none, and the local name local, whatever its prefix. Namespace
+// declarations are kept.
+func (n *Node) RemoveAttrNS(namespaceURI, local string) {
+	if i := n.attrIndexNS(namespaceURI, local); i >= 0 {
+		touch(n)
+		n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+	}
+}
@@ -0,0 +1,123 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xpath"
+)
+
+func TestRepairNamespaces(t *testing.T) {
+	src := loadXML(`<a:root xmlns:a="urn:a"><a:item a:id="1"><a:child/></a:item></a:root>`)
+	item := FindOne(src, "//*[local-name()='item']")
+	RemoveFromTree(item)
+	doc := loadXML(`<root xmlns="urn:y"><plain/></root>`)
+	root := FindOne(doc, "/*")
+	AddChild(root, item)
+	plain := &Node{Type: ElementNode, Data: "plain"}
+	AddChild(root, plain)
+	attr := &Node{Type: ElementNode, Data: "attr", NamespaceURI: "urn:y"}
+	attr.Attr = append(attr.Attr, Attr{Name: xml.Name{Local: "k"}, Value: "v", NamespaceURI: "urn:k"})
+	AddChild(root, attr)
+
+	if err := RepairNamespaces(doc); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, root.OutputXML(true), `<root xmlns="urn:y"><plain></plain><a:item a:id="1" xmlns:a="urn:a"><a:child></a:child></a:item><plain xmlns=""></plain><attr ns0:k="v" xmlns:ns0="urn:k"></attr></root>`)
+
+	doc, err := Parse(strings.NewReader(root.OutputXML(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for expr, uri := range map[string]string{
+		"//*[local-name()='child']":                     "urn:a",
+		"//*[local-name()='plain'][2]":                  "",
+		"//*[local-name()='attr']/@*[local-name()='k']": "urn:k",
+	} {
+		v := xpath.MustCompile("namespace-uri(" + expr + ")").Evaluate(CreateXPathNavigator(doc))
+		if v != uri {
+			t.Errorf("%s: expected namespace %q but got %q", expr, uri, v)
+		}
+	}
+}
+
+func TestRepairNamespaces_Conflicts(t *testing.T) {
+	doc := loadXML(`<p:root xmlns:p="urn:p"><p:item/></p:root>`)
+	item := FindOne(doc, "//*[local-name()='item']")
+	// The element declares p itself, so it is renamed rather than rebound.
+	item.NamespaceURI = "urn:q"
+	item.Attr = append(item.Attr, Attr{Name: xml.Name{Space: "xmlns", Local: "p"}, Value: "urn:other", NamespaceURI: "xmlns"})
+	// An attribute cannot rebind the prefix of its element.
+	root := FindOne(doc, "/*")
+	root.Attr = append(root.Attr, Attr{Name: xml.Name{Space: "p", Local: "x"}, Value: "1", NamespaceURI: "urn:x"})
+
+	if err := RepairNamespaces(doc); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, root.OutputXML(true), `<p:root xmlns:p="urn:p" ns0:x="1" xmlns:ns0="urn:x"><ns1:item xmlns:p="urn:other" xmlns:ns1="urn:q"></ns1:item></p:root>`)
+
+	n := &Node{Type: ElementNode, Data: "a", Prefix: "undeclared"}
+	if err := RepairNamespaces(n); err == nil {
+		t.Fatal("expected an error for an undeclared prefix")
+	}
+}
+
+func TestAttrNS(t *testing.T) {
+	const xsi = "http://www.w3.org/2001/XMLSchema-instance"
+	doc := loadXML(`<root xmlns:s="` + xsi + `"><item s:schemaLocation="a.xsd" id="1"/></root>`)
+	item := FindOne(doc, "//item")
+	testValue(t, item.SelectAttrNS(xsi, "schemaLocation"), "a.xsd")
+	testValue(t, item.SelectAttrNS("", "id"), "1")
+	testValue(t, item.SelectAttrNS("", "schemaLocation"), "")
+
+	// The existing attribute is found whatever its prefix.
+	item.SetAttrNS(xsi, "schemaLocation", "b.xsd")
+	testValue(t, item.OutputXML(true), `<item s:schemaLocation="b.xsd" id="1"></item>`)
+
+	// A new attribute uses the prefix in scope.
+	item.SetAttrNS(xsi, "nil", "true")
+	testValue(t, item.OutputXML(true), `<item s:schemaLocation="b.xsd" id="1" s:nil="true"></item>`)
+
+	// Otherwise a prefix is declared.
+	item.SetAttrNS("urn:x", "a", "1")
+	testValue(t, item.OutputXML(true), `<item s:schemaLocation="b.xsd" id="1" s:nil="true" xmlns:ns0="urn:x" ns0:a="1"></item>`)
+	reparsed := loadXML(doc.OutputXML(false))
+	testValue(t, FindOne(reparsed, "//item").SelectAttrNS("urn:x", "a"), "1")
+
+	item.SetAttrNS(xmlNamespaceURI, "lang", "en")
+	testValue(t, item.SelectAttr("xml:lang"), "en")
+
+	item.RemoveAttrNS(xsi, "schemaLocation")
+	item.RemoveAttrNS("", "id")
+	testValue(t, item.OutputXML(true), `<item s:nil="true" xmlns:ns0="urn:x" ns0:a="1" xml:lang="en"></item>`)
+
+	// Attributes added by qualified name are resolved through the
+	// declarations in scope.
+	AddAttr(item, "s:type", "T")
+	testValue(t, item.SelectAttrNS(xsi, "type"), "T")
+}
+
+func TestNamespaceDecls(t *testing.T) {
+	tests := []string{
+		// A declaration does not leak out of the element making it.
+		`<r xmlns:p="u"><a xmlns:q="u"></a><b p:x="1"></b></r>`,
+		// An attribute is not in the default namespace.
+		`<r xmlns:p="u"><p:a xmlns="u" p:x="1"><b p:y="2"></b></p:a></r>`,
+		// A prefix declared again shadows the outer declaration.
+		`<r xmlns:p="u" xmlns:q="u"><a xmlns:q="v" p:x="1" q:y="2"></a></r>`,
+	}
+	for _, s := range tests {
+		doc, err := Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testValue(t, FindOne(doc, "/*").OutputXML(true), s)
+	}
+
+	doc := loadXML(`<r xmlns="u" a="1" xmlns:p="v"/>`)
+	decls := FindOne(doc, "/*").NamespaceDecls()
+	if len(decls) != 2 || decls[0] != (NamespaceDecl{"", "u"}) || decls[1] != (NamespaceDecl{"p", "v"}) {
+		t.Fatalf("got declarations %+v", decls)
+	}
+}
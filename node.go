@@ -2,11 +2,16 @@ package xmlquery
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"html"
 	"io"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+	"unsafe"
 )
 
 // A NodeType is the type of a Node.
@@ -31,6 +36,10 @@ const (
 	AttributeNode
 	// NotationNode is a directive represents in document (for example, <!text...>).
 	NotationNode
+	// FragmentNode holds a sequence of top-level nodes that do not form a
+	// document, such as several elements, see ParseFragment. Adding a
+	// fragment with AddChild or AddSibling moves its children instead.
+	FragmentNode
 )
 
 type Attr struct {
@@ -50,7 +59,13 @@ type Node struct {
 	NamespaceURI string
 	Attr         []Attr
 
-	level int // node level in the tree
+	level     int            // node level in the tree
+	tree      unsafe.Pointer // *treeInfo, shared by the nodes of the tree, see track
+	textCache unsafe.Pointer // *innerTextCache, see InnerTextCached
+	index     *nodeIndex     // see EnableIndex
+	document  *documentInfo  // DocumentNode only, see SourceName
+	position  *nodePosition  // see Position
+	raw       *rawText       // see RawText
 }
 
 type outputConfiguration struct {
@@ -59,6 +74,14 @@ type outputConfiguration struct {
 	emptyElementTagSupport bool
 	skipComments           bool
 	useIndentation         string
+	writeDeclaration       bool
+	omitDeclaration        bool
+	writeBOM               bool
+	cdataAsText            bool
+	skipNodeTypes          uint64 // bit set of the NodeTypes left out
+	maxLineWidth           int
+	controlCharPolicy      ControlCharPolicy
+	err                    error // first error met, see WriteChecked
 }
 
 type OutputOption func(*outputConfiguration)
@@ -99,6 +122,131 @@ func WithIndentation(indentation string) OutputOption {
 	}
 }
 
+// WithDeclaration writes an <?xml version="1.0" encoding="UTF-8"?>
+// declaration before a document that does not start with one.
+func WithDeclaration() OutputOption {
+	return func(oc *outputConfiguration) {
+		oc.writeDeclaration = true
+	}
+}
+
+// WithoutDeclaration skips the <?xml?> declaration when writing a document,
+// so that it can be embedded in another document. Other processing
+// instructions are kept.
+func WithoutDeclaration() OutputOption {
+	return func(oc *outputConfiguration) {
+		oc.omitDeclaration = true
+	}
+}
+
+// WithBOM writes a UTF-8 byte order mark before a document, such as the
+// one it was parsed with; see Node.ByteOrderMark.
+func WithBOM() OutputOption {
+	return func(oc *outputConfiguration) {
+		oc.writeBOM = true
+	}
+}
+
+// WithoutNodeTypes leaves the nodes of the given types out of the output,
+// the subtrees of elements included. For example,
+// WithoutNodeTypes(CommentNode, DeclarationNode) strips the comments and
+// processing instructions while keeping them in the tree.
+func WithoutNodeTypes(types ...NodeType) OutputOption {
+	return func(oc *outputConfiguration) {
+		for _, t := range types {
+			oc.skipNodeTypes |= 1 << t
+		}
+	}
+}
+
+// WithMaxLineWidth wraps text content and attribute lists so that lines
+// stay within width columns where possible. Text is broken at spaces and
+// continued at the indentation of the element content; attributes that do
+// not fit are moved to lines of their own. Text within the scope of
+// xml:space="preserve", or written with WithPreserveSpace, is not wrapped,
+// and a single word or attribute longer than width is never broken.
+func WithMaxLineWidth(width int) OutputOption {
+	return func(oc *outputConfiguration) {
+		oc.maxLineWidth = width
+	}
+}
+
+// ControlCharPolicy specifies how the control characters that XML forbids
+// (U+0000 to U+001F except tab, line feed and carriage return) or
+// discourages (U+007F to U+009F except U+0085) are written in text and
+// attribute values.
+type ControlCharPolicy int
+
+const (
+	// ControlCharKeep writes control characters unchanged.
+	ControlCharKeep ControlCharPolicy = iota
+	// ControlCharStrip leaves control characters out.
+	ControlCharStrip
+	// ControlCharReplace replaces control characters with U+FFFD.
+	ControlCharReplace
+	// ControlCharEscape writes control characters as character references
+	// such as &#x1;. Note that references to the forbidden characters are
+	// only well-formed in XML 1.1.
+	ControlCharEscape
+	// ControlCharError stops the output at the first control character,
+	// which WriteChecked reports as an error.
+	ControlCharError
+)
+
+// WithControlCharPolicy sets how control characters are written.
+func WithControlCharPolicy(policy ControlCharPolicy) OutputOption {
+	return func(oc *outputConfiguration) {
+		oc.controlCharPolicy = policy
+	}
+}
+
+func isControlChar(r rune) bool {
+	return (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || (r >= 0x7F && r <= 0x9F && r != 0x85)
+}
+
+// controlChars applies the control character policy to s, using escape to
+// write a character reference.
+func (c *outputConfiguration) controlChars(s string, escape func(r rune) string) string {
+	if c.controlCharPolicy == ControlCharKeep || strings.IndexFunc(s, isControlChar) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if !isControlChar(r) {
+			b.WriteRune(r)
+			continue
+		}
+		switch c.controlCharPolicy {
+		case ControlCharReplace:
+			b.WriteRune(utf8.RuneError)
+		case ControlCharEscape:
+			b.WriteString(escape(r))
+		case ControlCharError:
+			if c.err == nil {
+				c.err = fmt.Errorf("xmlquery: control character %U cannot be written", r)
+			}
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+func characterReference(r rune) string {
+	return fmt.Sprintf("&#x%X;", r)
+}
+
+// escape escapes s for use in text or an attribute value.
+func (c *outputConfiguration) escape(s string) string {
+	return c.controlChars(html.EscapeString(s), characterReference)
+}
+
+// WithCDATAAsText writes CDATA sections as escaped text.
+func WithCDATAAsText() OutputOption {
+	return func(oc *outputConfiguration) {
+		oc.cdataAsText = true
+	}
+}
+
 func newXMLName(name string) xml.Name {
 	if i := strings.IndexByte(name, ':'); i > 0 {
 		return xml.Name{
@@ -117,6 +265,32 @@ func (n *Node) Level() int {
 
 // InnerText returns the text between the start and end tags of the object.
 func (n *Node) InnerText() string {
+	switch n.Type {
+	case TextNode, CharDataNode:
+		return n.Data
+	case CommentNode:
+		return ""
+	}
+	// The common case of an element holding a single text node needs no
+	// copy.
+	if child := n.FirstChild; child != nil && child == n.LastChild && (child.Type == TextNode || child.Type == CharDataNode) {
+		return child.Data
+	}
+
+	var size func(*Node) int
+	size = func(n *Node) int {
+		switch n.Type {
+		case TextNode, CharDataNode:
+			return len(n.Data)
+		case CommentNode:
+			return 0
+		}
+		total := 0
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			total += size(child)
+		}
+		return total
+	}
 	var output func(*strings.Builder, *Node)
 	output = func(b *strings.Builder, n *Node) {
 		switch n.Type {
@@ -131,10 +305,119 @@ func (n *Node) InnerText() string {
 	}
 
 	var b strings.Builder
+	b.Grow(size(n))
 	output(&b, n)
 	return b.String()
 }
 
+// treeInfo is shared by the nodes of a tree once InnerTextCached or
+// EnableIndex is used on it, see track. The nodes of a tree built without
+// them share none.
+type treeInfo struct {
+	revision uint64 // number of changes made to the tree, see touch
+}
+
+// treeMutex serializes the allocations of treeInfo by track.
+var treeMutex sync.Mutex
+
+func (n *Node) treeInfo() *treeInfo {
+	return (*treeInfo)(atomic.LoadPointer(&n.tree))
+}
+
+// touch records a change made to the tree of n through the functions of
+// this package, invalidating the results of InnerTextCached and the
+// indexes of EnableIndex for that tree only. The parser does not call it
+// while building a tree.
+func touch(n *Node) {
+	if t := n.treeInfo(); t != nil {
+		t.revision++
+	}
+}
+
+// track returns the treeInfo of the tree of n, allocating it for all the
+// nodes of the tree the first time.
+func track(n *Node) *treeInfo {
+	if t := n.treeInfo(); t != nil {
+		return t
+	}
+	treeMutex.Lock()
+	defer treeMutex.Unlock()
+	top := root(n)
+	t := top.treeInfo()
+	if t == nil {
+		t = &treeInfo{}
+		setTree(top, t)
+	}
+	// Attribute nodes are not children of their element.
+	atomic.StorePointer(&n.tree, unsafe.Pointer(t))
+	return t
+}
+
+// joinTree makes n, just added to the tree of parent, share the treeInfo
+// of that tree. If only n had one, the tree of parent takes it.
+func joinTree(parent, n *Node) {
+	t, nt := parent.treeInfo(), n.treeInfo()
+	switch {
+	case t == nt:
+	case t != nil:
+		setTree(n, t)
+	default:
+		setTree(root(parent), nt)
+	}
+}
+
+// setTree makes the nodes of the subtree of n share t.
+func setTree(n *Node, t *treeInfo) {
+	for c := n; c != nil; c = nextInSubtree(c, n) {
+		atomic.StorePointer(&c.tree, unsafe.Pointer(t))
+	}
+}
+
+// nextInSubtree returns the node after c in document order within the
+// subtree of top, or nil.
+func nextInSubtree(c, top *Node) *Node {
+	if c.FirstChild != nil {
+		return c.FirstChild
+	}
+	for c != top {
+		if c.NextSibling != nil {
+			return c.NextSibling
+		}
+		c = c.Parent
+	}
+	return nil
+}
+
+// root returns the root of the tree of n.
+func root(n *Node) *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
+
+type innerTextCache struct {
+	tree     *treeInfo // the tree of the node when cached
+	revision uint64
+	text     string
+}
+
+// InnerTextCached is like InnerText, but keeps the result on the node until
+// its tree is changed by the functions of this package, such as AddChild or
+// RemoveFromTree. Changes made by assigning the fields of a Node directly
+// are not detected. It is safe to call InnerTextCached concurrently on the
+// same tree, as long as the tree is not changed.
+func (n *Node) InnerTextCached() string {
+	t := track(n)
+	c := (*innerTextCache)(atomic.LoadPointer(&n.textCache))
+	if c != nil && c.tree == t && c.revision == t.revision {
+		return c.text
+	}
+	text := n.InnerText()
+	atomic.StorePointer(&n.textCache, unsafe.Pointer(&innerTextCache{tree: t, revision: t.revision, text: text}))
+	return text
+}
+
 func (n *Node) sanitizedData(preserveSpaces bool) string {
 	if preserveSpaces {
 		return n.Data
@@ -199,15 +482,83 @@ func (i *indentation) Close() {
 	i.hasChild = true
 }
 
+// prefix returns the indentation of the current level plus extra levels,
+// or the empty string without indentation.
+func (i *indentation) prefix(extra int) string {
+	if i == nil {
+		return ""
+	}
+	return strings.Repeat(i.indent, i.level+extra)
+}
+
+// columnWriter keeps track of the column of the output, for
+// WithMaxLineWidth.
+type columnWriter struct {
+	w   io.Writer
+	col int
+}
+
+func (cw *columnWriter) Write(p []byte) (int, error) {
+	if i := bytes.LastIndexByte(p, '\n'); i >= 0 {
+		cw.col = utf8.RuneCount(p[i+1:])
+	} else {
+		cw.col += utf8.RuneCount(p)
+	}
+	return cw.w.Write(p)
+}
+
+// wrapText writes text, replacing the spaces after which a word would
+// exceed width by line breaks followed by indent.
+func (cw *columnWriter) wrapText(text string, width int, indent string) {
+	for i, word := range strings.Split(text, " ") {
+		if i > 0 {
+			if cw.col+1+utf8.RuneCountInString(word) > width && cw.col > len(indent) {
+				io.WriteString(cw, "\n"+indent)
+			} else {
+				io.WriteString(cw, " ")
+			}
+		}
+		io.WriteString(cw, word)
+	}
+}
+
 func outputXML(w io.Writer, n *Node, preserveSpaces bool, config *outputConfiguration, indent *indentation) {
+	if config.skipNodeTypes&(1<<n.Type) != 0 || config.err != nil {
+		return
+	}
 	preserveSpaces = calculatePreserveSpaces(n, preserveSpaces)
 	switch n.Type {
 	case TextNode:
-		io.WriteString(w, html.EscapeString(n.sanitizedData(preserveSpaces)))
+		var text string
+		if raw, ok := n.RawText(); ok {
+			text = raw
+			if !preserveSpaces {
+				text = strings.TrimSpace(raw)
+			}
+			text = config.controlChars(text, characterReference)
+		} else {
+			text = config.escape(n.sanitizedData(preserveSpaces))
+		}
+		if cw, ok := w.(*columnWriter); ok && !preserveSpaces {
+			cw.wrapText(text, config.maxLineWidth, indent.prefix(0))
+			return
+		}
+		io.WriteString(w, text)
 		return
 	case CharDataNode:
+		if config.cdataAsText {
+			io.WriteString(w, config.escape(n.Data))
+			return
+		}
+		// A "]]>" in the data would end the section early, so it is split
+		// across two sections, as are character references.
 		io.WriteString(w, "<![CDATA[")
-		io.WriteString(w, n.Data)
+		io.WriteString(w, config.controlChars(strings.ReplaceAll(n.Data, "]]>", "]]]]><![CDATA[>"), func(r rune) string {
+			return "]]>" + characterReference(r) + "<![CDATA["
+		}))
+		if config.err != nil {
+			return
+		}
 		io.WriteString(w, "]]>")
 		return
 	case CommentNode:
@@ -221,6 +572,11 @@ func outputXML(w io.Writer, n *Node, preserveSpaces bool, config *outputConfigur
 		indent.NewLine()
 		fmt.Fprintf(w, "<!%s>", n.Data)
 		return
+	case FragmentNode:
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			outputXML(w, child, preserveSpaces, config, indent)
+		}
+		return
 	case DeclarationNode:
 		io.WriteString(w, "<?" + n.Data)
 	default:
@@ -232,14 +588,30 @@ func outputXML(w io.Writer, n *Node, preserveSpaces bool, config *outputConfigur
 		}
 	}
 
-	for _, attr := range n.Attr {
+	for i, attr := range n.Attr {
+		sep := " "
+		if cw, ok := w.(*columnWriter); ok && i > 0 {
+			size := utf8.RuneCountInString(attr.Name.Local+config.escape(attr.Value)) + 4
+			if attr.Name.Space != "" {
+				size += utf8.RuneCountInString(attr.Name.Space) + 1
+			}
+			if cw.col+size > config.maxLineWidth {
+				sep = "\n  "
+				if indent != nil {
+					sep = "\n" + indent.prefix(0)
+				}
+			}
+		}
 		if attr.Name.Space != "" {
-			fmt.Fprintf(w, ` %s:%s=`, attr.Name.Space, attr.Name.Local)
+			fmt.Fprintf(w, `%s%s:%s=`, sep, attr.Name.Space, attr.Name.Local)
 		} else {
-			fmt.Fprintf(w, ` %s=`, attr.Name.Local)
+			fmt.Fprintf(w, `%s%s=`, sep, attr.Name.Local)
 		}
 
-		fmt.Fprintf(w, `"%v"`, html.EscapeString(attr.Value))
+		fmt.Fprintf(w, `"%v"`, config.escape(attr.Value))
+		if config.err != nil {
+			return
+		}
 	}
 	if n.Type == DeclarationNode {
 		io.WriteString(w, "?>")
@@ -255,6 +627,9 @@ func outputXML(w io.Writer, n *Node, preserveSpaces bool, config *outputConfigur
 	for child := n.FirstChild; child != nil; child = child.NextSibling {
 		outputXML(w, child, preserveSpaces, config, indent)
 	}
+	if config.err != nil {
+		return
+	}
 	if n.Type != DeclarationNode {
 		indent.Close()
 		if n.Prefix == "" {
@@ -290,27 +665,60 @@ func (n *Node) Write(writer io.Writer, self bool) {
 
 // WriteWithOptions writes xml with given options to given writer.
 func (n *Node) WriteWithOptions(writer io.Writer, opts ...OutputOption) {
+	n.WriteChecked(writer, opts...)
+}
+
+// WriteChecked is like WriteWithOptions, but returns the first error met:
+// a write error of writer, or a control character under ControlCharError.
+func (n *Node) WriteChecked(writer io.Writer, opts ...OutputOption) error {
 	config := &outputConfiguration{}
 	// Set the options
+	for _, opt := range currentConfig().outputOptions {
+		opt(config)
+	}
 	for _, opt := range opts {
 		opt(config)
 	}
 	pastPreserveSpaces := config.preserveSpaces
 	preserveSpaces := calculatePreserveSpaces(n, pastPreserveSpaces)
-	b := bufio.NewWriter(writer)
-	defer b.Flush()
+	bw := bufio.NewWriter(writer)
+	var b io.Writer = bw
+	if config.maxLineWidth > 0 {
+		b = &columnWriter{w: bw}
+	}
 
-	if config.printSelf && n.Type != DocumentNode {
+	if config.writeBOM && n.Type == DocumentNode {
+		io.WriteString(b, utf8BOM)
+	}
+	if config.writeDeclaration && !config.omitDeclaration && n.Type == DocumentNode {
+		if first := n.FirstChild; first == nil || first.Type != DeclarationNode || first.Data != "xml" {
+			io.WriteString(b, `<?xml version="1.0" encoding="UTF-8"?>`)
+		}
+	}
+	if config.printSelf && n.Type != DocumentNode && n.Type != FragmentNode {
 		outputXML(b, n, preserveSpaces, config, newIndentation(config.useIndentation, b))
 	} else {
 		for n := n.FirstChild; n != nil; n = n.NextSibling {
+			if config.omitDeclaration && n.Type == DeclarationNode && n.Data == "xml" {
+				continue
+			}
 			outputXML(b, n, preserveSpaces, config, newIndentation(config.useIndentation, b))
 		}
 	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return config.err
 }
 
 // AddAttr adds a new attribute specified by 'key' and 'val' to a node 'n'.
 func AddAttr(n *Node, key, val string) {
+	touch(n)
+	addAttr(n, key, val)
+}
+
+// addAttr is AddAttr for the parser, see touch.
+func addAttr(n *Node, key, val string) {
 	attr := Attr{
 		Name:  newXMLName(key),
 		Value: val,
@@ -324,6 +732,7 @@ func (n *Node) SetAttr(key, value string) {
 	name := newXMLName(key)
 	for i, attr := range n.Attr {
 		if attr.Name == name {
+			touch(n)
 			n.Attr[i].Value = value
 			return
 		}
@@ -336,6 +745,7 @@ func (n *Node) RemoveAttr(key string) {
 	name := newXMLName(key)
 	for i, attr := range n.Attr {
 		if attr.Name == name {
+			touch(n)
 			n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
 			return
 		}
@@ -343,7 +753,22 @@ func (n *Node) RemoveAttr(key string) {
 }
 
 // AddChild adds a new node 'n' to a node 'parent' as its last child.
+// If 'n' is a FragmentNode, its children are moved to 'parent' instead,
+// leaving it empty.
 func AddChild(parent, n *Node) {
+	if n.Type == FragmentNode {
+		for child := n.FirstChild; child != nil; child = n.FirstChild {
+			RemoveFromTree(child)
+			AddChild(parent, child)
+		}
+		return
+	}
+	touch(parent)
+	addChild(parent, n)
+}
+
+// addChild is AddChild for the parser, see touch.
+func addChild(parent, n *Node) {
 	n.Parent = parent
 	n.NextSibling = nil
 	if parent.FirstChild == nil {
@@ -355,14 +780,29 @@ func AddChild(parent, n *Node) {
 	}
 
 	parent.LastChild = n
+	joinTree(parent, n)
 }
 
 // AddSibling adds a new node 'n' as a sibling of a given node 'sibling'.
 // Note it is not necessarily true that the new node 'n' would be added
 // immediately after 'sibling'. If 'sibling' isn't the last child of its
 // parent, then the new node 'n' will be added at the end of the sibling
-// chain of their parent.
+// chain of their parent. If 'n' is a FragmentNode, its children are moved
+// instead, leaving it empty.
 func AddSibling(sibling, n *Node) {
+	if n.Type == FragmentNode {
+		for child := n.FirstChild; child != nil; child = n.FirstChild {
+			RemoveFromTree(child)
+			AddSibling(sibling, child)
+		}
+		return
+	}
+	touch(sibling)
+	addSibling(sibling, n)
+}
+
+// addSibling is AddSibling for the parser, see touch.
+func addSibling(sibling, n *Node) {
 	for t := sibling.NextSibling; t != nil; t = t.NextSibling {
 		sibling = t
 	}
@@ -373,11 +813,64 @@ func AddSibling(sibling, n *Node) {
 	if sibling.Parent != nil {
 		sibling.Parent.LastChild = n
 	}
+	joinTree(sibling, n)
+}
+
+// CloneFiltered returns a deep copy of the subtree rooted at n, leaving out
+// the nodes, and their subtrees, for which keep returns false. The copy is
+// detached from n's tree. CloneFiltered returns nil if n itself is rejected.
+func CloneFiltered(n *Node, keep func(*Node) bool) *Node {
+	if !keep(n) {
+		return nil
+	}
+	return copyNode(n, nil, keep)
+}
+
+// copyNode returns a deep copy of n and the nodes of its subtree accepted by
+// keep, attached to parent. A nil keep accepts all nodes.
+func copyNode(n, parent *Node, keep func(*Node) bool) *Node {
+	m := &Node{
+		Parent:       parent,
+		Type:         n.Type,
+		Data:         n.Data,
+		Prefix:       n.Prefix,
+		NamespaceURI: n.NamespaceURI,
+		level:        n.level,
+		raw:          n.raw,
+	}
+	if n.Attr != nil {
+		m.Attr = make([]Attr, len(n.Attr))
+		copy(m.Attr, n.Attr)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if keep != nil && !keep(child) {
+			continue
+		}
+		c := copyNode(child, m, keep)
+		if m.FirstChild == nil {
+			m.FirstChild = c
+		} else {
+			m.LastChild.NextSibling = c
+			c.PrevSibling = m.LastChild
+		}
+		m.LastChild = c
+	}
+	return m
 }
 
 // RemoveFromTree removes a node and its subtree from the document
 // tree it is in. If the node is the root of the tree, then it's no-op.
 func RemoveFromTree(n *Node) {
+	if n.Parent == nil {
+		return
+	}
+	touch(n)
+	removeFromTree(n)
+}
+
+// removeFromTree is RemoveFromTree for the parser, see touch. The nodes
+// removed keep the treeInfo of the tree.
+func removeFromTree(n *Node) {
 	if n.Parent == nil {
 		return
 	}
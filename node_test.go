@@ -5,6 +5,7 @@ import (
 	"html"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -349,6 +350,24 @@ func TestSelectElement(t *testing.T) {
 	}
 }
 
+func TestSelectElementNS(t *testing.T) {
+	s := `<root xmlns:a="urn:a" xmlns:b="urn:b"><a:item id="1"/><b:item id="2"/><item id="3"/><a:item id="4"/></root>`
+	root := findNode(loadXML(s), "root")
+	if n := root.SelectElementNS("urn:b", "item"); n == nil || n.SelectAttr("id") != "2" {
+		t.Fatal("expected b:item with id 2")
+	}
+	if n := root.SelectElementNS("", "item"); n == nil || n.SelectAttr("id") != "3" {
+		t.Fatal("expected item with id 3")
+	}
+	if n := root.SelectElementNS("urn:c", "item"); n != nil {
+		t.Fatal("expected nil for an unknown namespace")
+	}
+	ns := root.SelectElementsNS("urn:a", "item")
+	if len(ns) != 2 || ns[0].SelectAttr("id") != "1" || ns[1].SelectAttr("id") != "4" {
+		t.Fatalf("expected a:item elements 1 and 4, got %d elements", len(ns))
+	}
+}
+
 func TestEscapeOutputValue(t *testing.T) {
 	data := `<AAA>&lt;*&gt;</AAA>`
 
@@ -746,3 +765,235 @@ func TestOutputXMLWithSingleQuotes(t *testing.T) {
 		t.Errorf(`expected "%s", obtained "%s"`, expected, output)
 	}
 }
+
+func TestCloneFiltered(t *testing.T) {
+	doc := loadXML(`<root xmlns:p="urn:private"><!-- c --><a id="1">x<p:secret>s</p:secret></a><b>y</b></root>`)
+	root := FindOne(doc, "/root")
+	clone := CloneFiltered(root, func(n *Node) bool {
+		return n.Type != CommentNode && n.NamespaceURI != "urn:private"
+	})
+	testValue(t, clone.OutputXML(true), `<root xmlns:p="urn:private"><a id="1">x</a><b>y</b></root>`)
+	verifyNodePointers(t, clone)
+	if clone.Parent != nil {
+		t.Fatal("expected the clone to be detached")
+	}
+	clone.FirstChild.Attr[0].Value = "2"
+	testAttr(t, FindOne(doc, "//a"), "id", "1")
+	testValue(t, root.OutputXML(true), `<root xmlns:p="urn:private"><!-- c --><a id="1">x<p:secret>s</p:secret></a><b>y</b></root>`)
+
+	if CloneFiltered(root, func(n *Node) bool { return false }) != nil {
+		t.Fatal("expected nil when the root is rejected")
+	}
+}
+
+func TestOutputXMLWithIndentationAndEmptyTags(t *testing.T) {
+	doc := loadXML(`<?xml version="1.0"?><a><b/><c>x</c><d><e/></d></a>`)
+	expected := `<?xml version="1.0"?>
+<a>
+  <b/>
+  <c>x</c>
+  <d>
+    <e/>
+  </d>
+</a>`
+	testValue(t, doc.OutputXMLWithOptions(WithIndentation("  "), WithEmptyTagSupport()), expected)
+}
+
+func TestOutputXMLWithDeclaration(t *testing.T) {
+	doc := &Node{Type: DocumentNode}
+	AddChild(doc, &Node{Type: ElementNode, Data: "a"})
+	testValue(t, doc.OutputXMLWithOptions(WithDeclaration()), `<?xml version="1.0" encoding="UTF-8"?><a></a>`)
+
+	doc = loadXML(`<?xml version="1.0" encoding="ISO-8859-1"?><a/>`)
+	testValue(t, doc.OutputXMLWithOptions(WithDeclaration()), `<?xml version="1.0" encoding="ISO-8859-1"?><a></a>`)
+	testValue(t, FindOne(doc, "//a").OutputXMLWithOptions(WithDeclaration(), WithOutputSelf()), `<a></a>`)
+}
+
+func TestOutputXMLWithCDATA(t *testing.T) {
+	doc := loadXML(`<a><![CDATA[x < y]]></a>`)
+	a := FindOne(doc, "//a")
+	testValue(t, a.OutputXMLWithOptions(WithOutputSelf(), WithCDATAAsText()), `<a>x &lt; y</a>`)
+
+	a.FirstChild.Data = "]]>"
+	testValue(t, a.OutputXML(true), `<a><![CDATA[]]]]><![CDATA[>]]></a>`)
+	if v := loadXML(a.OutputXML(true)).InnerText(); v != "]]>" {
+		t.Errorf("expected %q after round trip but got %q", "]]>", v)
+	}
+}
+
+func TestInnerTextCached(t *testing.T) {
+	doc := loadXML(`<a>x<b>y<!-- c --><![CDATA[z]]></b></a>`)
+	a := FindOne(doc, "//a")
+	testValue(t, a.InnerText(), "xyz")
+	testValue(t, a.InnerTextCached(), "xyz")
+	testValue(t, a.InnerTextCached(), "xyz")
+
+	AddChild(a, &Node{Type: TextNode, Data: "!"})
+	testValue(t, a.InnerTextCached(), "xyz!")
+	b := FindOne(doc, "//b")
+	testValue(t, b.InnerTextCached(), "yz")
+	RemoveFromTree(b)
+	testValue(t, a.InnerTextCached(), "x!")
+
+	// A detached subtree is a tree of its own.
+	AddChild(b, &Node{Type: TextNode, Data: "?"})
+	testValue(t, b.InnerTextCached(), "yz?")
+	testValue(t, a.InnerTextCached(), "x!")
+	AddChild(a, b)
+	testValue(t, a.InnerTextCached(), "x!yz?")
+
+	// Changes to other trees leave the cache of the tree alone.
+	revision := doc.treeInfo().revision
+	other := loadXML(`<a/>`)
+	FindOne(other, "//a").InnerTextCached()
+	AddChild(FindOne(other, "//a"), &Node{Type: TextNode, Data: "other"})
+	testValue(t, doc.treeInfo().revision, revision)
+
+	// The nodes added share the tree of their parent.
+	c := &Node{Type: ElementNode, Data: "c"}
+	AddChild(c, &Node{Type: TextNode, Data: "c"})
+	AddChild(a, c)
+	testValue(t, c.FirstChild.treeInfo(), doc.treeInfo())
+	testValue(t, a.InnerTextCached(), "x!yz?c")
+	AddChild(c, &Node{Type: TextNode, Data: "!"})
+	testValue(t, a.InnerTextCached(), "x!yz?c!")
+	// A tree whose nodes are added to another takes its treeInfo.
+	d := &Node{Type: ElementNode, Data: "d"}
+	AddChild(d, &Node{Type: TextNode, Data: "d"})
+	RemoveFromTree(b)
+	AddChild(d, b)
+	testValue(t, d.treeInfo(), doc.treeInfo())
+	testValue(t, a.InnerTextCached(), "x!c!")
+}
+
+func TestParseUntracked(t *testing.T) {
+	// The trees built by the parser are not tracked, whether or not other
+	// trees are.
+	FindOne(loadXML(`<a>x</a>`), "//a").InnerTextCached()
+	doc := loadXML(`<a><b>x</b></a>`)
+	for n := doc; n != nil; n = nextInSubtree(n, doc) {
+		if n.treeInfo() != nil {
+			t.Fatalf("%s is tracked", n.Data)
+		}
+	}
+
+	// Reading from a stream parser changes the tree once.
+	sp, err := CreateStreamParser(strings.NewReader(`<a><b>1</b><b>2</b></a>`), "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := sp.Read()
+	a := first.Parent
+	testValue(t, a.InnerTextCached(), "1")
+	sp.Read()
+	testValue(t, a.InnerTextCached(), "2")
+}
+
+func TestInnerTextCachedConcurrent(t *testing.T) {
+	doc := loadXML(`<a>x<b>y</b></a>`)
+	other := loadXML(`<a/>`)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := FindOne(doc, "//a").InnerTextCached(); got != "xy" {
+					t.Errorf("got %q", got)
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		AddChild(FindOne(other, "//a"), &Node{Type: TextNode, Data: "z"})
+	}
+	wg.Wait()
+}
+
+func benchmarkInnerTextDoc() *Node {
+	var b strings.Builder
+	b.WriteString("<root>")
+	for i := 0; i < 1000; i++ {
+		b.WriteString("<p>Lorem <em>ipsum</em> dolor sit amet, consectetur adipiscing elit.</p>")
+	}
+	b.WriteString("</root>")
+	return loadXML(b.String())
+}
+
+func BenchmarkInnerText(b *testing.B) {
+	root := FindOne(benchmarkInnerTextDoc(), "/root")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.InnerText()
+	}
+}
+
+func BenchmarkInnerTextCached(b *testing.B) {
+	root := FindOne(benchmarkInnerTextDoc(), "/root")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.InnerTextCached()
+	}
+}
+
+func TestOutputXMLWithoutDeclaration(t *testing.T) {
+	doc := loadXML(`<?xml version="1.0" encoding="UTF-8"?><?xml-stylesheet href="a.css"?><a><b/></a>`)
+	testValue(t, doc.OutputXMLWithOptions(WithoutDeclaration()), `<?xml-stylesheet href="a.css"?><a><b></b></a>`)
+	testValue(t, doc.OutputXMLWithOptions(WithoutDeclaration(), WithDeclaration()), `<?xml-stylesheet href="a.css"?><a><b></b></a>`)
+	testValue(t, doc.OutputXML(false), `<?xml version="1.0" encoding="UTF-8"?><?xml-stylesheet href="a.css"?><a><b></b></a>`)
+}
+
+func TestOutputXMLWithoutNodeTypes(t *testing.T) {
+	doc := loadXML(`<?xml version="1.0"?><?review status="draft"?><a><!-- note --><b>x<![CDATA[y]]></b><c/></a>`)
+	testValue(t, doc.OutputXMLWithOptions(WithoutNodeTypes(CommentNode, DeclarationNode)), `<a><b>x<![CDATA[y]]></b><c></c></a>`)
+	testValue(t, doc.OutputXMLWithOptions(WithoutNodeTypes(CharDataNode, ElementNode)), `<?xml version="1.0"?><?review status="draft"?>`)
+	if FindOne(doc, "//comment()") == nil {
+		t.Fatal("expected the tree to keep the comment")
+	}
+}
+
+func TestOutputXMLWithMaxLineWidth(t *testing.T) {
+	doc := loadXML(`<root><string name="greeting" description="Shown on the start page" context="home">Welcome to the application, we hope you enjoy your stay here</string><pre xml:space="preserve">do not wrap this text even though it is long</pre></root>`)
+	expected := `<?xml version="1.0"?>
+<root>
+  <string name="greeting"
+    description="Shown on the start page"
+    context="home">Welcome to the
+    application, we hope you enjoy your
+    stay here</string>
+  <pre xml:space="preserve">do not wrap this text even though it is long</pre>
+</root>`
+	testValue(t, doc.OutputXMLWithOptions(WithIndentation("  "), WithMaxLineWidth(40)), expected)
+
+	expected = `<?xml version="1.0"?><p a="1"
+  b="2">one
+two three</p>`
+	testValue(t, loadXML(`<p a="1" b="2">one two three</p>`).OutputXMLWithOptions(WithMaxLineWidth(12)), expected)
+}
+
+func TestOutputXMLWithControlCharPolicy(t *testing.T) {
+	doc := &Node{Type: DocumentNode}
+	a := &Node{Type: ElementNode, Data: "a"}
+	AddChild(doc, a)
+	a.SetAttr("v", "x\x01y")
+	AddChild(a, &Node{Type: TextNode, Data: "1\x7F2\t3"})
+	AddChild(a, &Node{Type: CharDataNode, Data: "c\x02d"})
+
+	testValue(t, doc.OutputXML(false), "<a v=\"x\x01y\">1\x7F2\t3<![CDATA[c\x02d]]></a>")
+	testValue(t, doc.OutputXMLWithOptions(WithControlCharPolicy(ControlCharStrip)), "<a v=\"xy\">12\t3<![CDATA[cd]]></a>")
+	testValue(t, doc.OutputXMLWithOptions(WithControlCharPolicy(ControlCharReplace)), "<a v=\"x�y\">1�2\t3<![CDATA[c�d]]></a>")
+	testValue(t, doc.OutputXMLWithOptions(WithControlCharPolicy(ControlCharEscape)), "<a v=\"x&#x1;y\">1&#x7F;2\t3<![CDATA[c]]>&#x2;<![CDATA[d]]></a>")
+
+	var b strings.Builder
+	err := doc.WriteChecked(&b, WithControlCharPolicy(ControlCharError))
+	if err == nil || !strings.Contains(err.Error(), "U+0001") {
+		t.Fatalf("expected a control character error but got %v", err)
+	}
+	testValue(t, b.String(), `<a v="x"`)
+	b.Reset()
+	if err := doc.WriteChecked(&b, WithControlCharPolicy(ControlCharStrip)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,16 +3,296 @@ package xmlquery
 import (
 	"encoding/xml"
 	"io"
+
+	"golang.org/x/net/html/charset"
 )
 
 type ParserOptions struct {
 	Decoder *DecoderOptions
+	// Namespaces binds prefixes to namespace URIs for the XPath expressions
+	// given to CreateStreamParserWithOptions, so that for example
+	// /x:root/x:item matches elements of a default-namespaced document.
+	// ParseFragmentWithOptions also declares them for the fragment.
+	Namespaces map[string]string
+	// DisableDecompression turns off the detection of compressed input,
+	// see RegisterDecompressor.
+	DisableDecompression bool
+	// ApplyDTDDefaults adds to elements the attributes that are declared
+	// with a default value in the internal DTD subset but are not specified
+	// in the document.
+	ApplyDTDDefaults bool
+	// Whitespace specifies what happens to text nodes consisting only of
+	// white space. The default is WhitespaceKeep.
+	Whitespace WhitespacePolicy
+	// TokenCacheSize is the maximum number of bytes of raw text kept for
+	// each token to detect element prefixes and CDATA sections. The cache
+	// grows as needed up to this size. The default is 4096 bytes; parsing
+	// fails if an element's qualified name does not fit.
+	TokenCacheSize int
+	// BufferSize is the size in bytes of the buffer the input is read
+	// through, and thus of the reads made on it; after a switch to the
+	// encoding declared by the document, the decoded input is buffered
+	// likewise. The default is 4096 bytes. Larger buffers make fewer reads,
+	// which pays off with sources where each read is costly, such as
+	// network streams or object storage.
+	BufferSize int
+	// CharsetReader, if set, returns a reader converting the input from the
+	// encoding declared by the document, named by label, to UTF-8, such as
+	// charset.NewReaderLabel does for the encodings it knows. It is not
+	// called for UTF-8 documents. A nil reader with a nil error hands the
+	// label over to the reader that would otherwise be used, so that only
+	// the encodings not otherwise supported, such as EBCDIC code pages,
+	// need to be handled. It takes precedence over Decoder.CharsetReader.
+	CharsetReader func(label string, input io.Reader) (io.Reader, error)
+	// HTMLEntities makes the decoder resolve the HTML 4 named entities, such
+	// as &nbsp; or &copy;, as listed by xml.HTMLEntity. Entities given in
+	// Decoder.Entity take precedence.
+	HTMLEntities bool
+	// HTMLAutoClose makes the decoder close the HTML void elements, such as
+	// <br> or <img>, that have no end tag, as listed by xml.HTMLAutoClose.
+	// It puts the decoder in non-strict mode, which AutoClose requires.
+	HTMLAutoClose bool
+	// MaxAttributes and MaxAttributeValueLength bound the number of
+	// attributes of an element, namespace declarations included, and the
+	// length in bytes of an attribute value. Parsing fails with an
+	// *AttrLimitError when a limit is exceeded. Zero means no limit.
+	MaxAttributes           int
+	MaxAttributeValueLength int
+	// NormalizeLineEndings replaces the CRLF pairs and lone CRs of comments,
+	// processing instructions and directives with LFs, as required by the
+	// XML specification. Text, CDATA sections and attribute values are
+	// always normalized by the decoder; a CR written as the character
+	// reference &#13; is kept, as it should be.
+	NormalizeLineEndings bool
+	// XML11 accepts XML 1.1 documents, which the decoder rejects: their
+	// NEL and LINE SEPARATOR line endings are read as LFs, and the control
+	// characters they may reference, such as &#x1;, are read into text and
+	// attribute values. The noncharacters U+FDD1 to U+FDEF must not be
+	// written literally in them. The XML 1.0 documents are read as usual.
+	XML11 bool
+	// StrictConformance turns on the options needed for the document to be
+	// processed as the XML specification requires, currently
+	// NormalizeLineEndings.
+	StrictConformance bool
+	// ValidateXMLID makes parsing fail if the value of an xml:id attribute
+	// is not an NCName or is not unique in the document, as required by
+	// https://www.w3.org/TR/xml-id/.
+	ValidateXMLID bool
+	// SourceName names the source of the document, such as a file name or
+	// URL. It is returned by Node.SourceName for the nodes of the parsed
+	// tree, and parsing errors are returned as a *SourceError mentioning
+	// it, like "config.xml:42: ...".
+	SourceName string
+	// BaseURI is the base URI of the document, against which the xml:base
+	// attributes and the references given to Node.ResolveURI are resolved.
+	// It defaults to SourceName, and for LoadURL and LoadURLWithOptions to
+	// the URL of the document.
+	BaseURI string
+	// Limits bounds the resources used by parsing, see Limits.
+	Limits Limits
+	// WithLineNumbers records the positions in the input where each node
+	// starts and ends, see Node.Position. Lines are counted as the input is
+	// read, so it works with a StreamParser without buffering the input.
+	WithLineNumbers bool
+	// Recover makes the parser repair common malformations instead of
+	// failing: elements left open at the end of the input are closed, an
+	// end tag closes the open elements up to the one it matches, and an
+	// ampersand that does not start a known reference is kept as text. An
+	// end tag matching no open element ends the document. It puts the
+	// decoder in non-strict mode. See ParseWithWarnings for the repairs
+	// made.
+	Recover bool
+	// EntityResolver is called for the first reference to each entity that
+	// is neither predefined nor in Decoder.Entity, HTML entities included.
+	// The returned value replaces the references as text; if an error is
+	// returned, parsing fails with it. The references in comments, CDATA
+	// sections and processing instructions may be resolved too, although
+	// they are not replaced.
+	EntityResolver func(name string) (string, error)
+	// ExternalResolver loads the external entities and the external DTD
+	// subset referenced by the <!DOCTYPE> directive. Referenced external
+	// entities are replaced by their text, which is not parsed as markup;
+	// the external subset provides external entities and, with
+	// ApplyDTDDefaults, attribute defaults. If nil, the default, nothing
+	// is loaded, so documents cannot make the parser read local files or
+	// URLs (XXE).
+	ExternalResolver Resolver
+	// ExpandEntities replaces the references to the general entities
+	// declared in the DTD by their replacement text, in which the entity
+	// references are replaced in turn. The replacement text is not parsed
+	// as markup. Set MaxEntityExpansion when parsing untrusted input, so
+	// that nested references cannot expand exponentially.
+	ExpandEntities bool
+	// MaxEntityExpansion bounds the total number of bytes the entity
+	// references of the document expand to, whatever provides their
+	// values, and MaxEntityDepth the nesting of the references within
+	// entity values. References in comments are counted as well. Parsing
+	// fails with an error wrapping ErrEntityExpansionLimit when a limit is
+	// exceeded. Zero means no limit.
+	MaxEntityExpansion int64
+	MaxEntityDepth     int
+	// PreserveRawText records the source text of text nodes, with their
+	// entity and character references as written, see Node.RawText. The
+	// token cache then grows to hold whole tokens, whatever TokenCacheSize.
+	PreserveRawText bool
+	// TextTrim specifies how the parser trims the white space of text
+	// nodes outside the scope of an xml:space="preserve" attribute. The
+	// default is TextTrimNone.
+	TextTrim TextTrimPolicy
+	// Skip leaves nodes out of the tree, see SkipOptions.
+	Skip SkipOptions
+}
+
+// TextTrimPolicy specifies how the parser trims the white space of text
+// nodes, so that InnerText returns clean text. Text nodes left empty are
+// dropped; CDATA sections are kept as they are.
+type TextTrimPolicy int
+
+const (
+	// TextTrimNone keeps the text as it is.
+	TextTrimNone TextTrimPolicy = iota
+	// TextTrimSpace removes the leading and trailing white space.
+	TextTrimSpace
+	// TextTrimNormalize also replaces the runs of white space within the
+	// text by a single space, like the XPath normalize-space() function.
+	TextTrimNormalize
+)
+
+// SkipOptions selects the nodes left out of the tree by the parser, for
+// callers extracting data who need a smaller tree. A StreamParser does not
+// return skipped nodes.
+type SkipOptions struct {
+	// Comments skips the comments.
+	Comments bool
+	// ProcInst skips the processing instructions; the XML declaration is
+	// kept.
+	ProcInst bool
+	// WhitespaceText skips the text nodes consisting only of white space,
+	// like WhitespaceDrop.
+	WhitespaceText bool
+}
+
+// Limits bounds the resources used by parsing untrusted input. Parsing
+// fails with a *LimitError when a limit is exceeded. Zero means no limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of elements; the document
+	// element has depth 1.
+	MaxDepth int
+	// MaxNodes is the maximum number of nodes in the tree. A StreamParser
+	// counts the nodes it retains between two target nodes, not those it
+	// has released.
+	MaxNodes int
+	// MaxNodeBytes is the maximum estimated size, as by Node.EstimateSize,
+	// of the nodes in the tree, counted like MaxNodes.
+	MaxNodeBytes int64
+	// MaxBytes is the maximum number of bytes read from the input, after
+	// decompression.
+	MaxBytes int64
 }
 
+// WhitespacePolicy specifies how the parser handles text nodes consisting
+// only of white space, such as the line breaks and indentation between
+// elements. CDATA sections are always kept.
+type WhitespacePolicy int
+
+const (
+	// WhitespaceKeep keeps whitespace-only text nodes in the tree.
+	WhitespaceKeep WhitespacePolicy = iota
+	// WhitespaceDrop drops all whitespace-only text nodes.
+	WhitespaceDrop
+	// WhitespaceDropUnlessPreserve drops whitespace-only text nodes, except
+	// within the scope of an xml:space="preserve" attribute.
+	WhitespaceDropUnlessPreserve
+)
+
 func (options ParserOptions) apply(parser *parser) {
 	if options.Decoder != nil {
 		(*options.Decoder).apply(parser.decoder)
 	}
+	if options.CharsetReader != nil {
+		parser.decoder.CharsetReader = chainCharsetReaders(options.CharsetReader, parser.decoder.CharsetReader)
+	}
+	if options.HTMLEntities {
+		entity := make(map[string]string, len(xml.HTMLEntity)+len(parser.decoder.Entity))
+		for k, v := range xml.HTMLEntity {
+			entity[k] = v
+		}
+		for k, v := range parser.decoder.Entity {
+			entity[k] = v
+		}
+		parser.decoder.Entity = entity
+	}
+	if options.EntityResolver != nil || options.ExternalResolver != nil || options.ExpandEntities || options.MaxEntityExpansion > 0 {
+		entity := make(map[string]string, len(parser.decoder.Entity))
+		for k, v := range parser.decoder.Entity {
+			entity[k] = v
+		}
+		parser.decoder.Entity = entity
+		parser.entityResolver = options.EntityResolver
+		parser.externalResolver = options.ExternalResolver
+		if options.ExpandEntities {
+			parser.internalEntities = map[string]string{}
+		}
+		parser.maxEntityExpansion = options.MaxEntityExpansion
+		parser.maxEntityDepth = options.MaxEntityDepth
+		parser.reader.onEntity = parser.resolveEntity
+	}
+	parser.normalizeEOL = options.NormalizeLineEndings || options.StrictConformance
+	parser.xml11 = options.XML11
+	if options.ValidateXMLID {
+		parser.xmlIDs = map[string]bool{}
+	}
+	if options.SourceName != "" || options.BaseURI != "" {
+		parser.doc.document = &documentInfo{source: options.SourceName, base: options.BaseURI}
+	}
+	parser.maxAttrs = options.MaxAttributes
+	parser.maxAttrLen = options.MaxAttributeValueLength
+	if options.HTMLAutoClose {
+		parser.decoder.Strict = false
+		// The AutoClose of the DecoderOptions must not be appended to.
+		autoClose := make([]string, 0, len(parser.decoder.AutoClose)+len(xml.HTMLAutoClose))
+		autoClose = append(autoClose, parser.decoder.AutoClose...)
+		parser.decoder.AutoClose = append(autoClose, xml.HTMLAutoClose...)
+	}
+	if options.ApplyDTDDefaults {
+		parser.attrDefaults = map[string][]dtdAttrDefault{}
+	}
+	parser.whitespace = options.Whitespace
+	if options.Skip.WhitespaceText {
+		parser.whitespace = WhitespaceDrop
+	}
+	parser.skip = options.Skip
+	parser.textTrim = options.TextTrim
+	if options.TokenCacheSize > 0 {
+		parser.reader.SetCapacity(options.TokenCacheSize)
+	}
+	if options.PreserveRawText && !parser.tokenInput {
+		parser.preserveRawText()
+	}
+	parser.limits = options.Limits
+	parser.positions = options.WithLineNumbers
+	if options.Recover {
+		parser.decoder.Strict = false
+		parser.recover = true
+	}
+	if options.Limits.MaxBytes > 0 {
+		parser.reader.limit = options.Limits.MaxBytes
+	}
+}
+
+// chainCharsetReaders returns a CharsetReader calling first, then next if
+// first returns a nil reader, or charset.NewReaderLabel if next is nil.
+func chainCharsetReaders(first, next func(string, io.Reader) (io.Reader, error)) func(string, io.Reader) (io.Reader, error) {
+	if next == nil {
+		next = charset.NewReaderLabel
+	}
+	return func(label string, input io.Reader) (io.Reader, error) {
+		r, err := first(label, input)
+		if r != nil || err != nil {
+			return r, err
+		}
+		return next(label, input)
+	}
 }
 
 // DecoderOptions implement the very same options than the standard
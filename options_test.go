@@ -3,7 +3,11 @@ package xmlquery
 import (
 	"bytes"
 	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestApplyOptions(t *testing.T) {
@@ -44,3 +48,183 @@ func TestApplyEmptyOptions(t *testing.T) {
 	// expecting this call to do anything
 	options.apply(parser)
 }
+
+func TestApplyHTMLOptions(t *testing.T) {
+	s := `<p>&copy; 2024&nbsp;ACME &custom;<br><img src="a.png"></p>`
+	options := ParserOptions{
+		Decoder:       &DecoderOptions{Strict: true, Entity: map[string]string{"custom": "x", "copy": "(c)"}},
+		HTMLEntities:  true,
+		HTMLAutoClose: true,
+	}
+	doc, err := ParseWithOptions(strings.NewReader(s), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := FindOne(doc, "//p")
+	if v := p.InnerText(); v != "(c) 2024\u00a0ACME x" {
+		t.Fatalf("unexpected text %q", v)
+	}
+	if FindOne(p, "br") == nil || FindOne(p, "img/@src") == nil {
+		t.Fatal("expected the void elements to be closed")
+	}
+
+	if _, err = ParseWithOptions(strings.NewReader(`<p>&nbsp;</p>`), ParserOptions{Decoder: &DecoderOptions{Strict: true}}); err == nil {
+		t.Fatal("expected an error for an unknown entity without HTMLEntities")
+	}
+	// The AutoClose of the caller is left unchanged.
+	autoClose := make([]string, 1, 1+len(xml.HTMLAutoClose))
+	autoClose[0] = "hr"
+	options = ParserOptions{Decoder: &DecoderOptions{AutoClose: autoClose}, HTMLAutoClose: true}
+	if _, err = ParseWithOptions(strings.NewReader(`<p><hr><br></p>`), options); err != nil {
+		t.Fatal(err)
+	}
+	if all := autoClose[:cap(autoClose)]; all[1] != "" {
+		t.Fatalf("AutoClose of the options appended to: %v", all)
+	}
+}
+
+// countingReader counts the Read calls made on it.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+func largeDocument(items int) []byte {
+	var b bytes.Buffer
+	b.WriteString("<feed>")
+	for i := 0; i < items; i++ {
+		fmt.Fprintf(&b, `<item id="%d"><title>Item %d</title><body>%s</body></item>`, i, i, strings.Repeat("lorem ipsum ", 8))
+	}
+	b.WriteString("</feed>")
+	return b.Bytes()
+}
+
+func TestParseWithOptions_BufferSize(t *testing.T) {
+	data := largeDocument(2000)
+	reads := func(size int) int {
+		r := &countingReader{r: bytes.NewReader(data)}
+		doc, err := ParseWithOptions(r, ParserOptions{BufferSize: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(Find(doc, "//item")); n != 2000 {
+			t.Fatalf("got %d items", n)
+		}
+		return r.reads
+	}
+	small, large := reads(0), reads(1<<20)
+	if large >= small || large > 4 {
+		t.Fatalf("got %d reads with a 1 MB buffer, %d with the default", large, small)
+	}
+
+	sp, err := CreateStreamParserWithOptions(bytes.NewReader(data), ParserOptions{BufferSize: 64 << 10}, "/feed/item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := sp.p.reader.buffer.Size(); size != 64<<10 {
+		t.Fatalf("got stream buffer size %d", size)
+	}
+}
+
+// rot13Reader decodes the x-rot13 test encoding.
+type rot13Reader struct{ r io.Reader }
+
+func (r rot13Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for i, b := range p[:n] {
+		switch {
+		case b >= 'a' && b <= 'z':
+			p[i] = 'a' + (b-'a'+13)%26
+		case b >= 'A' && b <= 'Z':
+			p[i] = 'A' + (b-'A'+13)%26
+		}
+	}
+	return n, err
+}
+
+func TestParseWithOptions_CharsetReader(t *testing.T) {
+	var labels []string
+	options := ParserOptions{
+		CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+			labels = append(labels, label)
+			switch label {
+			case "x-rot13":
+				return rot13Reader{input}, nil
+			case "x-unknown":
+				return nil, fmt.Errorf("unsupported charset %s", label)
+			}
+			return nil, nil
+		},
+	}
+	doc, err := ParseWithOptions(strings.NewReader(`<?xml version="1.0" encoding="x-rot13"?><n n="uryyb">jbeyq</n>`), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := FindOne(doc, "//a")
+	if n == nil {
+		t.Fatal("element not decoded")
+	}
+	testValue(t, n.SelectAttr("a"), "hello")
+	testValue(t, n.InnerText(), "world")
+
+	// The encodings left to the default reader.
+	doc, err = ParseWithOptions(strings.NewReader("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>caf\xe9</a>"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.InnerText(), "café")
+
+	_, err = ParseWithOptions(strings.NewReader(`<?xml version="1.0" encoding="x-unknown"?><a/>`), options)
+	if err == nil || !strings.Contains(err.Error(), "unsupported charset x-unknown") {
+		t.Fatalf("got error %v", err)
+	}
+	testValue(t, strings.Join(labels, ","), "x-rot13,ISO-8859-1,x-unknown")
+
+	// UTF-8 documents are not converted.
+	labels = nil
+	if _, err = ParseWithOptions(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?><a/>`), options); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, len(labels), 0)
+}
+
+// latencyReader simulates a source with a fixed cost per read, like a
+// network stream or object storage.
+type latencyReader struct {
+	r       io.Reader
+	latency time.Duration
+}
+
+func (l *latencyReader) Read(p []byte) (int, error) {
+	time.Sleep(l.latency)
+	return l.r.Read(p)
+}
+
+func BenchmarkParseBufferSize(b *testing.B) {
+	data := largeDocument(5000)
+	for _, size := range []int{0, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("BufferSize=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				r := &latencyReader{r: bytes.NewReader(data), latency: 100 * time.Microsecond}
+				sp, err := CreateStreamParserWithOptions(r, ParserOptions{BufferSize: size, DisableDecompression: true}, "/feed/item")
+				if err != nil {
+					b.Fatal(err)
+				}
+				for {
+					if _, err := sp.Read(); err != nil {
+						if err != io.EOF {
+							b.Fatal(err)
+						}
+						break
+					}
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package xmlquery
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,6 +19,8 @@ import (
 
 var xmlMIMERegex = regexp.MustCompile(`(?i)((application|image|message|model)/((\w|\.|-)+\+?)?|text/)(wb)?xml`)
 
+var wbxmlMIMERegex = regexp.MustCompile(`(?i)/((\w|\.|-)+\+)?wbxml`)
+
 // LoadURL loads the XML document from the specified URL.
 func LoadURL(url string) (*Node, error) {
 	resp, err := http.Get(url)
@@ -23,29 +28,77 @@ func LoadURL(url string) (*Node, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	// Make sure the Content-Type has a valid XML MIME type
-	if xmlMIMERegex.MatchString(resp.Header.Get("Content-Type")) {
-		return Parse(resp.Body)
-	}
-	return nil, fmt.Errorf("invalid XML document(%s)", resp.Header.Get("Content-Type"))
+	return parseResponse(resp, currentConfig().parserOptions)
 }
 
 // Parse returns the parse tree for the XML from the given Reader.
 func Parse(r io.Reader) (*Node, error) {
-	return ParseWithOptions(r, ParserOptions{})
+	return ParseWithOptions(r, currentConfig().parserOptions)
 }
 
 // ParseWithOptions is like parse, but with custom options
 func ParseWithOptions(r io.Reader, options ParserOptions) (*Node, error) {
-	p := createParser(r)
+	return ParseWithOptionsContext(context.Background(), r, options)
+}
+
+// ParseWithContext is like Parse, but stops once ctx is done, returning an
+// error wrapping the context's error. The context is checked between
+// tokens, so a read from r that blocks is not interrupted.
+func ParseWithContext(ctx context.Context, r io.Reader) (*Node, error) {
+	return ParseWithOptionsContext(ctx, r, currentConfig().parserOptions)
+}
+
+// ParseWithOptionsContext is like ParseWithOptions, but stops once ctx is
+// done, see ParseWithContext.
+func ParseWithOptionsContext(ctx context.Context, r io.Reader, options ParserOptions) (*Node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, canceledError(err)
+	}
+	if !options.DisableDecompression {
+		var err error
+		if r, err = decompress(r); err != nil {
+			return nil, err
+		}
+	}
+	p := createParser(r, options.BufferSize)
 	options.apply(p)
+	if ctx.Done() != nil {
+		p.ctx = ctx
+	}
 	for {
 		_, err := p.parse()
 		if err == io.EOF {
 			return p.doc, nil
 		}
 		if err != nil {
-			return nil, err
+			return nil, p.sourceError(err)
+		}
+	}
+}
+
+// ParseTokens returns the parse tree for the tokens read from tr, for
+// example a token stream produced by another library or filtered by
+// middleware. Names may carry either namespace URIs, as returned by
+// xml.Decoder.Token, or prefixes declared by xmlns attributes of the stream.
+//
+// Token streams carry no raw text: element prefixes are those declared for
+// their namespace, CDATA sections become text nodes, and the options
+// reading bytes, such as BufferSize, TokenCacheSize and decompression, are
+// ignored.
+func ParseTokens(tr xml.TokenReader, options ParserOptions) (*Node, error) {
+	p := createParser(strings.NewReader(""), 0)
+	// tr is wrapped so that an *xml.Decoder is not reconfigured by options.
+	p.decoder = xml.NewTokenDecoder(struct{ xml.TokenReader }{tr})
+	p.tokenInput = true
+	options.apply(p)
+	p.positions = false
+	for {
+		_, err := p.parse()
+		if err == io.EOF {
+			return p.doc, nil
+		}
+		if err != nil {
+			return nil, p.sourceError(err)
 		}
 	}
 }
@@ -59,43 +112,223 @@ type parser struct {
 	streamElementFilter *xpath.Expr   // If specified, it provides further filtering on the target element.
 	streamNode          *Node         // Need to remember the last target node So we can clean it up upon next Read() call.
 	streamNodePrev      *Node         // Need to remember target node's prev so upon target node removal, we can restore correct prev.
+	streamPI            *streamPI     // Under streaming mode, the processing instructions targeted instead of elements.
+	streamComments      bool          // Under streaming mode, whether comments may be target nodes.
 	reader              *cachedReader // Need to maintain a reference to the reader, so we can determine whether a node contains CDATA.
+	bufferSize          int           // Size of the input buffers, 0 for the default.
+	maxAttrs            int           // Maximum number of attributes per element, 0 if unlimited.
+	maxAttrLen          int           // Maximum length of an attribute value, 0 if unlimited.
+	normalizeEOL        bool          // Normalize the line endings of comments, processing instructions and directives.
+	tokenInput          bool          // The input is a token stream without raw text.
+	limits              Limits
+	positions           bool // Record the positions of the nodes.
+	rawText             bool // Record the source text of text nodes.
+	recover             bool // Repair malformations instead of failing, see ParserOptions.Recover.
+	warnings            []ParseWarning
+	entityResolver      func(name string) (string, error)
+	entityErrs          map[string]error // The errors of entityResolver, by entity name.
+	externalResolver    Resolver
+	externalEntities    map[string]EntityDecl // The external entities declared in the DTD, if resolved.
+	internalEntities    map[string]string     // The values of the internal entities declared in the DTD, nil unless expanded.
+	maxEntityExpansion  int64
+	maxEntityDepth      int
+	entityBytes         int64 // Number of bytes of text the entity references expanded to.
+	ctx                 context.Context
 	once                sync.Once
-	space2prefix        map[string]*xmlnsPrefix
+	namespaces          []xmlnsBinding              // The namespace declarations in scope, innermost last.
+	attrDefaults        map[string][]dtdAttrDefault // Attribute defaults declared in the DTD, nil unless enabled.
+	xmlIDs              map[string]bool             // The xml:id values seen so far, nil unless validated.
+	whitespace          WhitespacePolicy
+	skip                SkipOptions
+	textTrim            TextTrimPolicy
+	names               map[string]string // The names shared between the nodes, nil unless interned.
+	splitDocuments      bool              // Whether a document ends with its root element, see DocumentReader.
+	charset             string            // The encoding the input is decoded from, once switched to.
+	xml11               bool
+	xml11Input          *xml11Reader // The reader rewriting the input of an XML 1.1 document, if enabled.
+	retainedNodes       int          // Number of nodes in the tree, less those released under streaming mode.
+	retainedBytes       int64        // Estimated size of the retained nodes, counted if limited.
+	limitErr            error
+	stats               StreamStats
+}
+
+// xmlnsBinding is a namespace declaration made by an element at a level.
+type xmlnsBinding struct {
+	prefix string
+	uri    string
+	level  int
 }
 
-type xmlnsPrefix struct {
-	name  string
-	level int
+func createParser(r io.Reader, bufferSize int) *parser {
+	p := &parser{reader: newCachedReader(newBufferedReader(r, bufferSize)), bufferSize: bufferSize}
+	p.init()
+	return p
 }
 
-func createParser(r io.Reader) *parser {
-	reader := newCachedReader(bufio.NewReader(r))
-	p := &parser{
-		decoder: xml.NewDecoder(reader),
-		doc:     &Node{Type: DocumentNode},
-		level:   0,
-		reader:  reader,
+// newBufferedReader returns a bufio.Reader of the given size, or of the
+// default size if size is not positive.
+func newBufferedReader(r io.Reader, size int) *bufio.Reader {
+	if size <= 0 {
+		return bufio.NewReader(r)
 	}
+	return bufio.NewReaderSize(r, size)
+}
+
+// init prepares p to parse a new document from p.reader.
+func (p *parser) init() {
+	p.decoder = xml.NewDecoder(p.reader)
+	p.doc = &Node{Type: DocumentNode}
+	p.level = 0
 	if p.decoder.CharsetReader == nil {
 		p.decoder.CharsetReader = charset.NewReaderLabel
 	}
 	p.prev = p.doc
-	return p
+}
+
+func (p *parser) declareNamespaces(attrs []xml.Attr) {
+	for _, att := range attrs {
+		if att.Name.Space == "" && att.Name.Local == "xmlns" {
+			p.namespaces = append(p.namespaces, xmlnsBinding{prefix: "", uri: att.Value, level: p.level})
+		} else if att.Name.Space == "xmlns" {
+			p.namespaces = append(p.namespaces, xmlnsBinding{prefix: att.Name.Local, uri: att.Value, level: p.level})
+		}
+	}
+}
+
+// endNamespaces drops the namespace declarations of the element at the
+// current level, whose end tag was just read.
+func (p *parser) endNamespaces() {
+	i := len(p.namespaces)
+	for i > 0 && p.namespaces[i-1].level >= p.level {
+		i--
+	}
+	p.namespaces = p.namespaces[:i]
+}
+
+// prefixOf returns the prefix bound to the namespace uri in scope, the
+// innermost declaration first, and whether there is one. Attributes are
+// not in the default namespace, so for them the prefix must not be empty.
+func (p *parser) prefixOf(uri string, attr bool) (string, bool) {
+	for i := len(p.namespaces) - 1; i >= 0; i-- {
+		b := p.namespaces[i]
+		if b.uri != uri || (attr && b.prefix == "") {
+			continue
+		}
+		if p.shadowed(b.prefix, i) {
+			continue
+		}
+		return b.prefix, true
+	}
+	return "", false
+}
+
+// shadowed reports whether the prefix is declared again after the i-th
+// declaration in scope.
+func (p *parser) shadowed(prefix string, i int) bool {
+	for _, b := range p.namespaces[i+1:] {
+		if b.prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceOf returns the namespace URI bound to prefix in scope.
+func (p *parser) namespaceOf(prefix string) (string, bool) {
+	for i := len(p.namespaces) - 1; i >= 0; i-- {
+		if p.namespaces[i].prefix == prefix {
+			return p.namespaces[i].uri, true
+		}
+	}
+	return "", false
+}
+
+// start prepares p to read the first token of the document.
+func (p *parser) start() {
+	p.namespaces = append(p.namespaces, xmlnsBinding{prefix: "xml", uri: xmlNamespaceURI, level: 0})
+	bom := p.reader.stripBOM()
+	if bom != "" {
+		p.documentInfo().bom = bom
+	}
+	if p.xml11 {
+		p.xml11Input = newXML11Reader(p.reader.buffer, bom != "")
+		p.reader.buffer = newBufferedReader(p.xml11Input, p.reader.buffer.Size())
+	}
+	if charsetReader := p.decoder.CharsetReader; charsetReader != nil {
+		// Once the decoder switches to the declared encoding, cache the
+		// decoded input so the raw tokens match the decoder offsets.
+		p.decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			if p.doc.ByteOrderMark() != "" {
+				// The byte order mark takes precedence over the
+				// declared encoding; the input is already UTF-8.
+				return input, nil
+			}
+			if p.charset != "" {
+				// A further document of a sequence, see DocumentReader.
+				if !strings.EqualFold(label, p.charset) {
+					return nil, fmt.Errorf("xmlquery: document encoding %s differs from %s of the previous documents", label, p.charset)
+				}
+				p.documentInfo().encoding = p.charset
+				return input, nil
+			}
+			r, err := charsetReader(label, input)
+			if err != nil || r == nil {
+				return r, err
+			}
+			p.charset = label
+			p.documentInfo().encoding = label
+			if p.xml11Input != nil && p.xml11Input.version11 {
+				x := newXML11Reader(r, true)
+				x.state, x.version11 = xml11Content, true
+				r = x
+			}
+			reader := newCachedReader(newBufferedReader(r, p.bufferSize))
+			reader.SetCapacity(p.reader.cacheCap)
+			reader.offset = p.decoder.InputOffset()
+			reader.last = '>'
+			reader.lines = p.reader.lines
+			reader.lineStart = p.reader.lineStart
+			reader.prevLineStart = p.reader.prevLineStart
+			reader.limit = p.reader.limit
+			reader.onEntity = p.reader.onEntity
+			p.reader = reader
+			return reader, nil
+		}
+	}
 }
 
 func (p *parser) parse() (*Node, error) {
-	p.once.Do(func() {
-		p.space2prefix = map[string]*xmlnsPrefix{"http://www.w3.org/XML/1998/namespace": {name: "xml", level: 0}}
-	})
+	p.once.Do(p.start)
 
 	var streamElementNodeCounter int
 	for {
+		if p.ctx != nil {
+			if err := p.ctx.Err(); err != nil {
+				return nil, canceledError(err)
+			}
+		}
+		start := p.decoder.InputOffset()
+		var startPos Position
+		if p.positions || p.recover {
+			startPos = p.currentPosition()
+		}
 		p.reader.StartCaching()
 		tok, err := p.decoder.Token()
 		p.reader.StopCaching()
 		if err != nil {
-			return nil, err
+			if p.recover && p.recoverError(err, startPos) {
+				return nil, io.EOF
+			}
+			return nil, p.entityError(err)
+		}
+		raw := p.reader.Raw(start, p.decoder.InputOffset())
+		if p.recover {
+			switch tok := tok.(type) {
+			case xml.StartElement, xml.CharData:
+				p.checkReferences(raw, startPos)
+			case xml.EndElement:
+				p.checkEndTag(tok, raw, startPos)
+			}
 		}
 
 		switch tok := tok.(type) {
@@ -111,74 +344,62 @@ func (p *parser) parse() (*Node, error) {
 					Attr:  attributes,
 					level: 1,
 				}
-				AddChild(p.prev, node)
+				addChild(p.prev, node)
 				p.level = 1
 				p.prev = node
 			}
 
-			for _, att := range tok.Attr {
-				if att.Name.Local == "xmlns" {
-					// https://github.com/antchfx/xmlquery/issues/67
-					if prefix, ok := p.space2prefix[att.Value]; !ok || (ok && prefix.level >= p.level) {
-						p.space2prefix[att.Value] = &xmlnsPrefix{name: "", level: p.level} // reset empty if exist the default namespace
-					}
-				} else if att.Name.Space == "xmlns" {
-					// maybe there are have duplicate NamespaceURL?
-					p.space2prefix[att.Value] = &xmlnsPrefix{name: att.Name.Local, level: p.level}
-				}
+			if p.limits.MaxDepth > 0 && p.level > p.limits.MaxDepth {
+				return nil, &LimitError{Limit: "MaxDepth", Max: int64(p.limits.MaxDepth), Offset: start}
 			}
-
-			if space := tok.Name.Space; space != "" {
-				if _, found := p.space2prefix[space]; !found && p.decoder.Strict {
-					return nil, fmt.Errorf("xmlquery: invalid XML document, namespace %s is missing", space)
-				}
+			p.declareNamespaces(tok.Attr)
+			if err := p.checkAttrLimits(tok, start); err != nil {
+				return nil, err
+			}
+			if p.attrDefaults != nil {
+				tok.Attr = p.applyDTDAttrDefaults(p.qualifiedName(tok.Name), tok.Attr)
 			}
 
-			attributes := make([]Attr, len(tok.Attr))
-			for i, att := range tok.Attr {
-				name := att.Name
-				if prefix, ok := p.space2prefix[name.Space]; ok {
-					name.Space = prefix.name
-				}
-				attributes[i] = Attr{
-					Name:         name,
-					Value:        att.Value,
-					NamespaceURI: att.Name.Space,
-				}
+			if err := p.checkNamespace(tok); err != nil {
+				return nil, err
 			}
 
 			node := &Node{
 				Type:         ElementNode,
 				Data:         tok.Name.Local,
 				NamespaceURI: tok.Name.Space,
-				Attr:         attributes,
+				Attr:         p.attributes(tok.Attr),
 				level:        p.level,
+				position:     p.newPosition(startPos),
+			}
+			if p.names != nil {
+				node.Data, node.NamespaceURI = p.intern(node.Data), p.intern(node.NamespaceURI)
+			}
+			if p.xmlIDs != nil {
+				if err := p.checkXMLID(node, start); err != nil {
+					return nil, err
+				}
 			}
 
 			if p.level == p.prev.level {
-				AddSibling(p.prev, node)
+				addSibling(p.prev, node)
 			} else if p.level > p.prev.level {
-				AddChild(p.prev, node)
+				addChild(p.prev, node)
 			} else if p.level < p.prev.level {
 				for i := p.prev.level - p.level; i > 1; i-- {
 					p.prev = p.prev.Parent
 				}
-				AddSibling(p.prev.Parent, node)
+				addSibling(p.prev.Parent, node)
 			}
 
-			if node.NamespaceURI != "" {
-				if v, ok := p.space2prefix[node.NamespaceURI]; ok {
-					cached := string(p.reader.Cache())
-					if strings.HasPrefix(cached, fmt.Sprintf("%s:%s", v.name, node.Data)) || strings.HasPrefix(cached, fmt.Sprintf("<%s:%s", v.name, node.Data)) {
-						node.Prefix = v.name
-					}
-				}
+			if node.Prefix, err = p.elementPrefix(tok.Name, raw); err != nil {
+				return nil, err
 			}
 			// If we're in the streaming mode, we need to remember the node if it is the target node
 			// so that when we finish processing the node's EndElement, we know how/what to return to
 			// caller. Also we need to remove the target node from the tree upon next Read() call so
 			// memory doesn't grow unbounded.
-			if p.streamElementXPath != nil {
+			if p.streamElementXPath != nil && p.streamPI == nil {
 				if p.streamNode == nil {
 					if QuerySelector(p.doc, p.streamElementXPath) != nil {
 						p.streamNode = node
@@ -189,10 +410,15 @@ func (p *parser) parse() (*Node, error) {
 					streamElementNodeCounter++
 				}
 			}
+			p.retain(node)
 			p.prev = node
 			p.level++
 		case xml.EndElement:
 			p.level--
+			p.endNamespaces()
+			if p.positions {
+				p.closePosition()
+			}
 			// If we're in streaming mode, and we already have a potential streaming
 			// target node identified (p.streamNode != nil) then we need to check if
 			// this is the real one we want to return to caller.
@@ -215,83 +441,501 @@ func (p *parser) parse() (*Node, error) {
 					//   streamElementXPath = "/AAA/BBB["
 					//   streamElementFilter = "/AAA/BBB[. != 'b1']"
 					if p.streamElementFilter == nil || QuerySelector(p.doc, p.streamElementFilter) != nil {
+						p.stats.Matched++
 						return p.streamNode, nil
 					}
+					p.stats.Filtered++
 					// otherwise, this isn't our target node, clean things up.
 					// note we also remove the underlying *Node from the node tree, to prevent
 					// future stream node candidate selection error.
-					RemoveFromTree(p.streamNode)
+					p.release(p.streamNode)
+					removeFromTree(p.streamNode)
 					p.prev = p.streamNodePrev
 					p.streamNode = nil
 					p.streamNodePrev = nil
 				}
 			}
+			if p.splitDocuments && p.level == 1 {
+				// The root element of the document is closed.
+				return p.doc, nil
+			}
 		case xml.CharData:
-			// First, normalize the cache...
-			cached := strings.ToUpper(string(p.reader.Cache()))
 			nodeType := TextNode
-			if strings.HasPrefix(cached, "<![CDATA[") || strings.HasPrefix(cached, "![CDATA[") {
+			if p.reader.IsCDATA(start) {
 				nodeType = CharDataNode
 			}
+			if p.splitDocuments && p.level <= 1 && isWhitespace(tok) {
+				continue
+			}
+
+			if nodeType == TextNode && p.whitespace != WhitespaceKeep && isWhitespace(tok) {
+				if p.whitespace == WhitespaceDrop || !p.preserveSpaceInScope() {
+					continue
+				}
+			}
+
+			data := string(tok)
+			if p.xml11 {
+				data = restoreControls(data)
+			}
+			trimmed := false
+			if nodeType == TextNode && p.textTrim != TextTrimNone && !p.preserveSpaceInScope() {
+				trimmed = true
+				if data = trimText(data, p.textTrim); data == "" {
+					continue
+				}
+			}
 
-			node := &Node{Type: nodeType, Data: string(tok), level: p.level}
+			node := &Node{Type: nodeType, Data: data, level: p.level, position: p.newPosition(startPos)}
+			if nodeType == TextNode && !trimmed {
+				node.raw = p.newRawText(node.Data, raw, start, p.decoder.InputOffset())
+			}
 			if p.level == p.prev.level {
-				AddSibling(p.prev, node)
+				addSibling(p.prev, node)
 			} else if p.level > p.prev.level {
-				AddChild(p.prev, node)
+				addChild(p.prev, node)
 			} else if p.level < p.prev.level {
 				for i := p.prev.level - p.level; i > 1; i-- {
 					p.prev = p.prev.Parent
 				}
-				AddSibling(p.prev.Parent, node)
+				addSibling(p.prev.Parent, node)
 			}
+			p.retain(node)
 		case xml.Comment:
-			node := &Node{Type: CommentNode, Data: string(tok), level: p.level}
+			if p.skip.Comments {
+				continue
+			}
+			node := &Node{Type: CommentNode, Data: p.lineEndings(string(tok)), level: p.level, position: p.newPosition(startPos)}
+			prev := p.prev
 			if p.level == p.prev.level {
-				AddSibling(p.prev, node)
+				addSibling(p.prev, node)
 			} else if p.level > p.prev.level {
-				AddChild(p.prev, node)
+				addChild(p.prev, node)
 			} else if p.level < p.prev.level {
 				for i := p.prev.level - p.level; i > 1; i-- {
 					p.prev = p.prev.Parent
 				}
-				AddSibling(p.prev.Parent, node)
+				addSibling(p.prev.Parent, node)
+			}
+			p.retain(node)
+			if p.limitErr == nil && p.streamLeaf(node, prev) {
+				return node, nil
 			}
 		case xml.ProcInst: // Processing Instruction
-			if p.prev.Type != DeclarationNode {
+			// Processing instructions are at the level of the nodes around
+			// them, which is 1 before the root element too.
+			if p.level == 0 {
 				p.level++
 			}
-			node := &Node{Type: DeclarationNode, Data: tok.Target, level: p.level}
-			pairs := strings.Split(string(tok.Inst), " ")
-			for _, pair := range pairs {
-				pair = strings.TrimSpace(pair)
-				if i := strings.Index(pair, "="); i > 0 {
-					AddAttr(node, pair[:i], strings.Trim(pair[i+1:], `"'`))
+			if p.skip.ProcInst && tok.Target != "xml" {
+				continue
+			}
+			prev := p.prev
+			node := &Node{Type: DeclarationNode, Data: tok.Target, level: p.level, position: p.newPosition(startPos)}
+			for _, attr := range parsePseudoAttrs(p.lineEndings(string(p.declarationInst(tok.Target, tok.Inst)))) {
+				addAttr(node, attr.Name.Local, attr.Value)
+				if tok.Target == "xml" && attr.Name.Local == "encoding" {
+					p.documentInfo().declaredEncoding = attr.Value
 				}
 			}
 			if p.level == p.prev.level {
-				AddSibling(p.prev, node)
+				addSibling(p.prev, node)
 			} else if p.level > p.prev.level {
-				AddChild(p.prev, node)
+				addChild(p.prev, node)
 			} else if p.level < p.prev.level {
 				for i := p.prev.level - p.level; i > 1; i-- {
 					p.prev = p.prev.Parent
 				}
-				AddSibling(p.prev.Parent, node)
+				addSibling(p.prev.Parent, node)
 			}
+			p.retain(node)
 			p.prev = node
+			if p.limitErr == nil && p.streamLeaf(node, prev) {
+				return node, nil
+			}
 		case xml.Directive:
-			node := &Node{Type: NotationNode, Data: string(tok), level: p.level}
+			directive := p.lineEndings(string(tok))
+			if p.attrDefaults != nil {
+				parseDTDAttrDefaults(directive, p.attrDefaults)
+			}
+			if p.externalResolver != nil || p.internalEntities != nil {
+				if err := p.loadDTD(directive); err != nil {
+					return nil, err
+				}
+			}
+			node := &Node{Type: NotationNode, Data: directive, level: p.level, position: p.newPosition(startPos)}
 			if p.level == p.prev.level {
-				AddSibling(p.prev, node)
+				addSibling(p.prev, node)
 			} else if p.level > p.prev.level {
-				AddChild(p.prev, node)
+				addChild(p.prev, node)
 			} else if p.level < p.prev.level {
 				for i := p.prev.level - p.level; i > 1; i-- {
 					p.prev = p.prev.Parent
 				}
-				AddSibling(p.prev.Parent, node)
+				addSibling(p.prev.Parent, node)
 			}
+			p.retain(node)
+		}
+		if p.limitErr != nil {
+			return nil, p.limitErr
+		}
+	}
+}
+
+// canceledError wraps the error of a context that stopped parsing.
+func canceledError(err error) error {
+	return fmt.Errorf("xmlquery: parsing stopped: %w", err)
+}
+
+// checkNamespace checks, in strict mode, that the namespaces of the names
+// of the element and its attributes are declared in scope.
+func (p *parser) checkNamespace(tok xml.StartElement) error {
+	if !p.decoder.Strict {
+		return nil
+	}
+	if tok.Name.Space != "" {
+		if _, found := p.prefixOf(tok.Name.Space, false); !found {
+			return fmt.Errorf("xmlquery: invalid XML document, namespace %s is missing", tok.Name.Space)
+		}
+	}
+	for _, att := range tok.Attr {
+		if att.Name.Space == "" || att.Name.Space == "xmlns" {
+			continue
+		}
+		// The decoder leaves the prefix of an undeclared namespace as is.
+		if _, found := p.prefixOf(att.Name.Space, true); !found {
+			return fmt.Errorf("xmlquery: invalid XML document, namespace %s of attribute %s is missing", att.Name.Space, att.Name.Local)
+		}
+	}
+	return nil
+}
+
+// attributes returns the attributes of a start element, their names
+// carrying the prefix bound to their namespace in scope.
+func (p *parser) attributes(attrs []xml.Attr) []Attr {
+	attributes := make([]Attr, len(attrs))
+	for i, att := range attrs {
+		name := att.Name
+		if prefix, ok := p.prefixOf(name.Space, true); ok {
+			name.Space = prefix
+		}
+		if p.names != nil {
+			name.Space, name.Local = p.intern(name.Space), p.intern(name.Local)
+		}
+		attributes[i] = Attr{
+			Name:         name,
+			Value:        att.Value,
+			NamespaceURI: att.Name.Space,
+		}
+		if p.xml11 {
+			attributes[i].Value = restoreControls(att.Value)
+		}
+	}
+	return attributes
+}
+
+// elementPrefix returns the prefix of the element name of the start tag
+// whose raw text is raw.
+func (p *parser) elementPrefix(name xml.Name, raw []byte) (string, error) {
+	if name.Space == "" {
+		return "", nil
+	}
+	if p.tokenInput {
+		prefix, _ := p.prefixOf(name.Space, false)
+		return prefix, nil
+	}
+	// The prefix is taken from the raw text of the start tag, the decoder
+	// only reports the namespace URI.
+	qname := bytes.TrimPrefix(raw, []byte("<"))
+	if i := bytes.IndexAny(qname, " \t\r\n/>"); i >= 0 {
+		qname = qname[:i]
+	} else if p.reader.Truncated() {
+		return "", fmt.Errorf("xmlquery: element name %s exceeds the token cache size, see ParserOptions.TokenCacheSize", name.Local)
+	}
+	i := bytes.IndexByte(qname, ':')
+	if i <= 0 || string(qname[i+1:]) != name.Local {
+		return "", nil
+	}
+	if p.names != nil {
+		return p.internBytes(qname[:i]), nil
+	}
+	return string(qname[:i]), nil
+}
+
+// lineEndings returns s with its line endings normalized if enabled.
+func (p *parser) lineEndings(s string) string {
+	if !p.normalizeEOL {
+		return s
+	}
+	return normalizeLineEndings(s)
+}
+
+// normalizeLineEndings replaces the CRLF pairs and the lone CRs of s with
+// LFs, as XML processors do before parsing.
+func normalizeLineEndings(s string) string {
+	i := strings.IndexByte(s, '\r')
+	if i < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for ; i >= 0; i = strings.IndexByte(s, '\r') {
+		b.WriteString(s[:i])
+		b.WriteByte('\n')
+		s = s[i+1:]
+		if len(s) > 0 && s[0] == '\n' {
+			s = s[1:]
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// AttrLimitError is returned when an element exceeds the limits set by
+// ParserOptions.MaxAttributes or ParserOptions.MaxAttributeValueLength.
+type AttrLimitError struct {
+	// Element is the qualified name of the element.
+	Element string
+	// Attr is the qualified name of the attribute whose value is too
+	// long, empty if the element has too many attributes.
+	Attr string
+	// Offset is the byte offset in the input of the element start tag.
+	Offset int64
+	// Value is the number of attributes of the element, or the length in
+	// bytes of the attribute value; Limit is the limit it exceeds.
+	Value, Limit int
+}
+
+func (e *AttrLimitError) Error() string {
+	if e.Attr == "" {
+		return fmt.Sprintf("xmlquery: element %s at offset %d has %d attributes, limit is %d", e.Element, e.Offset, e.Value, e.Limit)
+	}
+	return fmt.Sprintf("xmlquery: attribute %s of element %s at offset %d is %d bytes long, limit is %d", e.Attr, e.Element, e.Offset, e.Value, e.Limit)
+}
+
+// checkAttrLimits checks the attributes of the start element tok, which
+// begins at offset, against the attribute limits.
+func (p *parser) checkAttrLimits(tok xml.StartElement, offset int64) error {
+	if p.maxAttrs > 0 && len(tok.Attr) > p.maxAttrs {
+		return &AttrLimitError{Element: p.qualifiedName(tok.Name), Offset: offset, Value: len(tok.Attr), Limit: p.maxAttrs}
+	}
+	if p.maxAttrLen > 0 {
+		for _, attr := range tok.Attr {
+			if len(attr.Value) > p.maxAttrLen {
+				return &AttrLimitError{
+					Element: p.qualifiedName(tok.Name),
+					Attr:    p.qualifiedName(attr.Name),
+					Offset:  offset,
+					Value:   len(attr.Value),
+					Limit:   p.maxAttrLen,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// qualifiedName returns the name with the prefix bound to its namespace in
+// scope, if any.
+func (p *parser) qualifiedName(name xml.Name) string {
+	if name.Space == "xmlns" {
+		return "xmlns:" + name.Local
+	}
+	if prefix, ok := p.prefixOf(name.Space, false); ok && prefix != "" {
+		return prefix + ":" + name.Local
+	}
+	return name.Local
+}
+
+// retain accounts for a node added to the tree, see Limits.MaxNodes.
+func (p *parser) retain(n *Node) {
+	p.retainedNodes++
+	if p.limits.MaxNodeBytes > 0 {
+		p.retainedBytes += n.size()
+	}
+	if p.streamElementXPath != nil {
+		p.stats.NodesCreated++
+		if p.retainedNodes > p.stats.PeakRetainedNodes {
+			p.stats.PeakRetainedNodes = p.retainedNodes
+		}
+	}
+	switch {
+	case p.limits.MaxNodes > 0 && p.retainedNodes > p.limits.MaxNodes:
+		p.limitErr = p.nodeLimitError(n, "MaxNodes", int64(p.limits.MaxNodes))
+	case p.limits.MaxNodeBytes > 0 && p.retainedBytes > p.limits.MaxNodeBytes:
+		p.limitErr = p.nodeLimitError(n, "MaxNodeBytes", p.limits.MaxNodeBytes)
+	}
+}
+
+// nodeLimitError returns the error reported once n exceeds limit.
+func (p *parser) nodeLimitError(n *Node, limit string, max int64) error {
+	elem := p.streamNode
+	if elem == nil {
+		elem = n
+		if n.Type != ElementNode {
+			elem = n.Parent
+		}
+	}
+	name := ""
+	if elem != nil && elem.Type == ElementNode {
+		name = elem.qualifiedName()
+	}
+	return &LimitError{Limit: limit, Max: max, Offset: p.decoder.InputOffset(), Element: name}
+}
+
+// release accounts for the subtree rooted at n being removed from the tree
+// under streaming mode.
+func (p *parser) release(n *Node) {
+	p.stats.NodesFreed++
+	p.retainedNodes--
+	if p.limits.MaxNodeBytes > 0 {
+		p.retainedBytes -= n.size()
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		p.release(child)
+	}
+}
+
+func isWhitespace(b []byte) bool {
+	for _, c := range b {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+func isXMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// trimText trims the white space of the text s as the policy says.
+func trimText(s string, policy TextTrimPolicy) string {
+	if policy == TextTrimNormalize {
+		return strings.Join(strings.FieldsFunc(s, isXMLSpace), " ")
+	}
+	return strings.TrimFunc(s, isXMLSpace)
+}
+
+// preserveSpaceInScope reports whether the xml:space attribute in scope for
+// the next node is "preserve".
+func (p *parser) preserveSpaceInScope() bool {
+	parent := p.prev
+	if p.level <= p.prev.level {
+		for i := p.prev.level - p.level; i >= 0 && parent != nil; i-- {
+			parent = parent.Parent
+		}
+	}
+	for ; parent != nil && parent.Type == ElementNode; parent = parent.Parent {
+		switch parent.SelectAttr("xml:space") {
+		case "preserve":
+			return true
+		case "default":
+			return false
+		}
+	}
+	return false
+}
+
+// parsePseudoAttrs parses the name="value" pairs of a processing
+// instruction such as <?xml-stylesheet?>. Values may be quoted with either
+// kind of quotes and contain white space; character and predefined entity
+// references are replaced. Parsing stops at the first malformed pair.
+func parsePseudoAttrs(s string) []xml.Attr {
+	var attrs []xml.Attr
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return attrs
+		}
+		name := strings.TrimRight(s[:i], " \t\r\n")
+		s = strings.TrimLeft(s[i+1:], " \t\r\n")
+		if name == "" || strings.ContainsAny(name, " \t\r\n\"'") || s == "" || (s[0] != '"' && s[0] != '\'') {
+			return attrs
+		}
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return attrs
+		}
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: name}, Value: unescapeReferences(s[1 : end+1])})
+		s = s[end+2:]
+	}
+}
+
+// unescapeReferences replaces the character and predefined entity
+// references of s. s is returned unchanged if it holds a malformed
+// reference.
+func unescapeReferences(s string) string {
+	if strings.IndexByte(s, '&') < 0 {
+		return s
+	}
+	d := xml.NewDecoder(strings.NewReader("<v a=\"" + strings.ReplaceAll(s, `"`, "&quot;") + "\"/>"))
+	if tok, err := d.Token(); err == nil {
+		if start, ok := tok.(xml.StartElement); ok && len(start.Attr) == 1 {
+			return start.Attr[0].Value
+		}
+	}
+	return s
+}
+
+// Parser parses documents one after another with the same options, reusing
+// its buffers between documents. It suits services parsing many small
+// documents. A Parser is not safe for concurrent use.
+//
+//	p := xmlquery.NewParser(xmlquery.ParserOptions{})
+//	for _, data := range documents {
+//	    p.Reset(bytes.NewReader(data))
+//	    doc, err := p.Parse()
+//	    ...
+//	}
+type Parser struct {
+	options ParserOptions
+	p       *parser
+	reader  *cachedReader
+	err     error
+}
+
+// NewParser returns a Parser using options for all documents.
+func NewParser(options ParserOptions) *Parser {
+	return &Parser{options: options}
+}
+
+// Reset makes the parser read its next document from r.
+func (ps *Parser) Reset(r io.Reader) {
+	ps.err = nil
+	if !ps.options.DisableDecompression {
+		if r, ps.err = decompress(r); ps.err != nil {
+			return
+		}
+	}
+	if ps.p == nil {
+		ps.p = createParser(r, ps.options.BufferSize)
+		ps.reader = ps.p.reader
+	} else {
+		ps.reader.Reset(r)
+		*ps.p = parser{reader: ps.reader, namespaces: ps.p.namespaces[:0], bufferSize: ps.options.BufferSize}
+		ps.p.init()
+	}
+	ps.options.apply(ps.p)
+}
+
+// Parse parses the document given to the last call to Reset and returns
+// its tree. The tree is not reused by the parser.
+func (ps *Parser) Parse() (*Node, error) {
+	if ps.err != nil {
+		return nil, ps.err
+	}
+	if ps.p == nil {
+		return nil, errors.New("xmlquery: Parse called before Reset")
+	}
+	for {
+		_, err := ps.p.parse()
+		if err == io.EOF {
+			return ps.p.doc, nil
+		}
+		if err != nil {
+			return nil, ps.p.sourceError(err)
 		}
 	}
 }
@@ -299,7 +943,9 @@ func (p *parser) parse() (*Node, error) {
 // StreamParser enables loading and parsing an XML document in a streaming
 // fashion.
 type StreamParser struct {
-	p *parser
+	p        *parser
+	closer   io.Closer
+	validate func(*Node) error
 }
 
 // CreateStreamParser creates a StreamParser. Argument streamElementXPath is
@@ -352,11 +998,17 @@ type StreamParser struct {
 // if needed, can provide additional filtering on the target element and its
 // children.
 //
+// Comments and processing instructions can be targeted as well, for example
+// with //comment() or //processing-instruction('page-break'); they are
+// returned as soon as they are read. For processing instructions, the
+// expression must end with the processing-instruction() step, the part
+// before it selecting their parent, and streamElementFilter is not used.
+//
 // CreateStreamParser returns an error if either streamElementXPath or
 // streamElementFilter, if provided, cannot be successfully parsed and compiled
 // into a valid xpath query.
 func CreateStreamParser(r io.Reader, streamElementXPath string, streamElementFilter ...string) (*StreamParser, error) {
-	return CreateStreamParserWithOptions(r, ParserOptions{}, streamElementXPath, streamElementFilter...)
+	return CreateStreamParserWithOptions(r, currentConfig().parserOptions, streamElementXPath, streamElementFilter...)
 }
 
 // CreateStreamParserWithOptions is like CreateStreamParser, but with custom options
@@ -366,24 +1018,41 @@ func CreateStreamParserWithOptions(
 	streamElementXPath string,
 	streamElementFilter ...string,
 ) (*StreamParser, error) {
-	elemXPath, err := getQuery(streamElementXPath)
+	compile := getQuery
+	if len(options.Namespaces) > 0 {
+		compile = func(expr string) (*xpath.Expr, error) {
+			return xpath.CompileWithNS(expr, options.Namespaces)
+		}
+	}
+	elemXPath, err := compile(streamElementXPath)
 	if err != nil {
 		return nil, fmt.Errorf("invalid streamElementXPath '%s', err: %s", streamElementXPath, err.Error())
 	}
 	elemFilter := (*xpath.Expr)(nil)
 	if len(streamElementFilter) > 0 {
-		elemFilter, err = getQuery(streamElementFilter[0])
+		elemFilter, err = compile(streamElementFilter[0])
 		if err != nil {
 			return nil, fmt.Errorf("invalid streamElementFilter '%s', err: %s", streamElementFilter[0], err.Error())
 		}
 	}
-	parser := createParser(r)
+	streamPI, err := parseStreamPI(streamElementXPath, compile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid streamElementXPath '%s', err: %s", streamElementXPath, err.Error())
+	}
+	if !options.DisableDecompression {
+		if r, err = decompress(r); err != nil {
+			return nil, err
+		}
+	}
+	parser := createParser(r, options.BufferSize)
 	options.apply(parser)
 	sp := &StreamParser{
 		p: parser,
 	}
 	sp.p.streamElementXPath = elemXPath
 	sp.p.streamElementFilter = elemFilter
+	sp.p.streamPI = streamPI
+	sp.p.streamComments = isStreamComment(streamElementXPath)
 	return sp, nil
 }
 
@@ -395,6 +1064,8 @@ func CreateStreamParserWithOptions(
 // undefined behavior. Also note, due to the streaming nature, calling Read()
 // will automatically remove any previous target node(s) from the document tree.
 func (sp *StreamParser) Read() (*Node, error) {
+	// The tree changes once per call, rather than per node, see touch.
+	touch(sp.p.doc)
 	// Because this is a streaming read, we need to release/remove last
 	// target node from the node tree to free up memory.
 	if sp.p.streamNode != nil {
@@ -403,12 +1074,92 @@ func (sp *StreamParser) Read() (*Node, error) {
 		// ones (for example new line text node), which would otherwise
 		// accumulate as first childs, and slow down the stream over time
 		for sp.p.streamNode.PrevSibling != nil {
-			RemoveFromTree(sp.p.streamNode.PrevSibling)
+			sp.p.release(sp.p.streamNode.PrevSibling)
+			removeFromTree(sp.p.streamNode.PrevSibling)
 		}
 		sp.p.prev = sp.p.streamNode.Parent
-		RemoveFromTree(sp.p.streamNode)
+		sp.p.release(sp.p.streamNode)
+		removeFromTree(sp.p.streamNode)
 		sp.p.streamNode = nil
 		sp.p.streamNodePrev = nil
 	}
-	return sp.p.parse()
+	n, err := sp.p.parse()
+	sp.closeOnError(err)
+	if err != nil && err != io.EOF {
+		err = sp.p.sourceError(err)
+	}
+	if err == nil && sp.validate != nil {
+		if verr := sp.validate(n); verr != nil {
+			sp.p.stats.Invalid++
+			return n, &StreamValidationError{Node: n, Err: verr}
+		}
+	}
+	return n, err
+}
+
+// StreamAncestor describes an ancestor element of a node returned by
+// StreamParser. It is a copy that stays valid after the following Read
+// calls have pruned the tree.
+type StreamAncestor struct {
+	Data         string
+	Prefix       string
+	NamespaceURI string
+	Attr         []Attr
+}
+
+// SelectAttr returns the attribute value with the specified name, like
+// Node.SelectAttr.
+func (a *StreamAncestor) SelectAttr(name string) string {
+	return (&Node{Attr: a.Attr}).SelectAttr(name)
+}
+
+// ReadWithAncestors is like Read, but also returns the ancestor elements of
+// the target node, from the root element down to its parent.
+func (sp *StreamParser) ReadWithAncestors() (*Node, []StreamAncestor, error) {
+	n, err := sp.Read()
+	if n == nil {
+		return nil, nil, err
+	}
+	var ancestors []StreamAncestor
+	for p := n.Parent; p != nil && p.Type == ElementNode; p = p.Parent {
+		a := StreamAncestor{Data: p.Data, Prefix: p.Prefix, NamespaceURI: p.NamespaceURI}
+		if p.Attr != nil {
+			a.Attr = make([]Attr, len(p.Attr))
+			copy(a.Attr, p.Attr)
+		}
+		ancestors = append(ancestors, a)
+	}
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+	return n, ancestors, err
+}
+
+// StreamStats holds cumulative statistics of a StreamParser.
+type StreamStats struct {
+	// Matched is the number of target nodes returned by Read.
+	Matched int
+	// Filtered is the number of candidates selected by the element XPath
+	// but rejected by the element filter.
+	Filtered int
+	// Invalid is the number of target nodes rejected by the validator,
+	// see SetValidator. They are counted in Matched as well.
+	Invalid int
+	// NodesCreated and NodesFreed are the numbers of nodes added to the
+	// tree and pruned from it.
+	NodesCreated int
+	NodesFreed   int
+	// PeakRetainedNodes is the largest number of nodes held in the tree at
+	// once.
+	PeakRetainedNodes int
+	// BytesConsumed is the number of bytes of (decompressed) input read
+	// by the decoder.
+	BytesConsumed int64
+}
+
+// Stats returns the statistics of the stream parser so far.
+func (sp *StreamParser) Stats() StreamStats {
+	stats := sp.p.stats
+	stats.BytesConsumed = sp.p.decoder.InputOffset()
+	return stats
 }
@@ -0,0 +1,60 @@
+package xmlquery
+
+import (
+	"bytes"
+	"io"
+)
+
+// ParseBytes returns the parse tree for the XML document held in data.
+func ParseBytes(data []byte) (*Node, error) {
+	return ParseBytesWithOptions(data, currentConfig().parserOptions)
+}
+
+// ParseBytesWithOptions is like ParseBytes, but with custom options. The
+// document is read in place: the input is neither buffered nor copied to
+// look at the raw text of the tokens, and a single copy of each name of
+// element, attribute, prefix or namespace is shared by the nodes of the
+// tree, which takes less memory.
+//
+// data must not be modified during the call, but the tree does not refer
+// to it afterwards. BufferSize and TokenCacheSize are ignored, unless the
+// document declares an encoding other than UTF-8, starts with a UTF-16 byte
+// order mark or is compressed, in which case it is parsed as by
+// ParseWithOptions.
+func ParseBytesWithOptions(data []byte, options ParserOptions) (*Node, error) {
+	if !options.DisableDecompression && compressed(data) || hasUTF16BOM(data) || options.XML11 {
+		return ParseWithOptions(bytes.NewReader(data), options)
+	}
+	p := &parser{reader: newSourceReader(data), bufferSize: options.BufferSize, names: map[string]string{}}
+	p.init()
+	options.apply(p)
+	for {
+		_, err := p.parse()
+		if err == io.EOF {
+			return p.doc, nil
+		}
+		if err != nil {
+			return nil, p.sourceError(err)
+		}
+	}
+}
+
+// intern returns the shared copy of the name s.
+func (p *parser) intern(s string) string {
+	if name, ok := p.names[s]; ok {
+		return name
+	}
+	p.names[s] = s
+	return s
+}
+
+// internBytes returns the shared copy of the name b, allocating it only
+// the first time it is seen.
+func (p *parser) internBytes(b []byte) string {
+	if name, ok := p.names[string(b)]; ok {
+		return name
+	}
+	s := string(b)
+	p.names[s] = s
+	return s
+}
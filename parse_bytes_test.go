@@ -0,0 +1,68 @@
+package xmlquery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(`<a><b>gzip</b></a>`))
+	w.Close()
+
+	tests := []string{
+		`<?xml version="1.0"?><r xmlns:p="urn:p"><p:a p:x="1">t &amp; u</p:a><p:a><![CDATA[<c>]]></p:a><!-- c --><?pi x="1"?></r>`,
+		"<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>caf\xe9<![CDATA[x]]></a>",
+		gz.String(),
+	}
+	for _, s := range tests {
+		want, err := Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseBytes([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testValue(t, got.OutputXML(true), want.OutputXML(true))
+	}
+
+	doc, err := ParseBytesWithOptions([]byte("<a>\n  <b/>\n  <b/>\n</a>"), ParserOptions{WithLineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := Find(doc, "//b")
+	if pos, _ := bs[1].Position(); pos.Line != 3 || pos.Column != 3 {
+		t.Fatalf("got position %+v", pos)
+	}
+	if bs[0].Data != bs[1].Data {
+		t.Fatal("expected equal names")
+	}
+
+	if _, err := ParseBytes([]byte(`<a><b></a>`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func BenchmarkParseBytes(b *testing.B) {
+	data := []byte(`<?xml version="1.0"?><list xmlns:p="urn:p">` + strings.Repeat(`<p:item id="1" p:kind="k"><name>n</name><![CDATA[x]]></p:item>`, 1000) + `</list>`)
+	b.Run("Parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Parse(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ParseBytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseBytes(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
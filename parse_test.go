@@ -1,12 +1,17 @@
 package xmlquery
 
 import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadURLSuccess(t *testing.T) {
@@ -656,3 +661,668 @@ func TestDirective(t *testing.T) {
 		t.Errorf("expected count is 4 but got %d", m)
 	}
 }
+
+func TestStreamParser_Namespaces(t *testing.T) {
+	s := `
+	<Objects xmlns="http://example.com/schema/2007/someschema">
+		<Object id="ObjectA">ObjectA</Object>
+		<Object id="ObjectB">ObjectB</Object>
+	</Objects>`
+
+	options := ParserOptions{
+		Namespaces: map[string]string{"x": "http://example.com/schema/2007/someschema"},
+	}
+	sp, err := CreateStreamParserWithOptions(strings.NewReader(s), options, "/x:Objects/x:Object", "/x:Objects/x:Object[@id!='ObjectA']")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	n, err := sp.Read()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	testOutputXML(t, "first call result", `<Object id="ObjectB">ObjectB</Object>`, n)
+
+	_, err = sp.Read()
+	if err != io.EOF {
+		t.Fatalf("io.EOF expected, but got %v", err)
+	}
+}
+
+func TestParseWithOptions_ApplyDTDDefaults(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<!DOCTYPE book [
+	<!-- <!ATTLIST book ignored CDATA "yes"> -->
+	<!ENTITY note "<!ATTLIST para ignored CDATA 'yes'>">
+	<!ATTLIST book
+		status (draft|final) "draft"
+		lang CDATA #IMPLIED
+		xlink:type CDATA #FIXED "simple"
+		xmlns:xlink CDATA #FIXED "http://www.w3.org/1999/xlink">
+	<!ATTLIST para role CDATA 'a &amp; b'>
+	<!ATTLIST para role CDATA "ignored">
+]>
+<book><para/><para role="note"/></book>`
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{ApplyDTDDefaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := FindOne(doc, "//book")
+	if v := book.SelectAttr("status"); v != "draft" {
+		t.Errorf("expected status=draft but got %q", v)
+	}
+	if v := book.SelectAttr("lang"); v != "" {
+		t.Errorf("expected no lang attribute but got %q", v)
+	}
+	if v := book.SelectAttr("xlink:type"); v != "simple" {
+		t.Errorf("expected xlink:type=simple but got %q", v)
+	}
+	for _, attr := range book.Attr {
+		if attr.Name.Local == "type" && attr.NamespaceURI != "http://www.w3.org/1999/xlink" {
+			t.Errorf("expected xlink:type in the xlink namespace but got %q", attr.NamespaceURI)
+		}
+	}
+	if book.SelectAttr("ignored") != "" {
+		t.Error("declaration in a comment should be ignored")
+	}
+	paras := Find(doc, "//para")
+	if v := paras[0].SelectAttr("role"); v != "a & b" {
+		t.Errorf("expected role=%q but got %q", "a & b", v)
+	}
+	if v := paras[1].SelectAttr("role"); v != "note" {
+		t.Errorf("expected role=note but got %q", v)
+	}
+	if paras[0].SelectAttr("ignored") != "" {
+		t.Error("declaration in an entity value should be ignored")
+	}
+
+	doc, err = Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := FindOne(doc, "//book").SelectAttr("status"); v != "" {
+		t.Errorf("expected no defaults without the option but got status=%q", v)
+	}
+}
+
+func TestParseWithOptions_Whitespace(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<doc>
+	<a> </a>
+	<pre xml:space="preserve">
+		<b> </b>
+		<c xml:space="default"> </c>
+	</pre>
+	<d><![CDATA[ ]]></d>
+</doc>`
+	var count func(*Node) int
+	count = func(n *Node) int {
+		c := 0
+		if n.Type == TextNode || n.Type == CharDataNode {
+			c++
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			c += count(child)
+		}
+		return c
+	}
+	for _, test := range []struct {
+		policy   WhitespacePolicy
+		expected int
+	}{
+		{WhitespaceKeep, 12},
+		{WhitespaceDrop, 1},
+		{WhitespaceDropUnlessPreserve, 5},
+	} {
+		doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{Whitespace: test.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := count(doc); v != test.expected {
+			t.Errorf("policy %d: expected %d text nodes but got %d", test.policy, test.expected, v)
+		}
+	}
+
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{Whitespace: WhitespaceDropUnlessPreserve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := FindOne(doc, "//b"); n.FirstChild == nil || n.FirstChild.Data != " " {
+		t.Error("expected whitespace to be preserved in b")
+	}
+	if n := FindOne(doc, "//c"); n.FirstChild != nil {
+		t.Error("expected whitespace to be dropped in c")
+	}
+	if n := FindOne(doc, "//d"); n.FirstChild == nil || n.FirstChild.Type != CharDataNode {
+		t.Error("expected CDATA section to be kept")
+	}
+}
+
+func TestParseWithOptions_TextTrim(t *testing.T) {
+	s := `<doc>
+	<a>  one
+		two  </a>
+	<pre xml:space="preserve"> keep  <b xml:space="default"> x  y </b></pre>
+	<c><![CDATA[ cdata ]]></c>
+</doc>`
+	for _, test := range []struct {
+		policy   TextTrimPolicy
+		expected string
+	}{
+		{TextTrimSpace, "<doc><a>one\n\t\ttwo</a><pre xml:space=\"preserve\"> keep  <b xml:space=\"default\">x  y</b></pre><c><![CDATA[ cdata ]]></c></doc>"},
+		{TextTrimNormalize, "<doc><a>one two</a><pre xml:space=\"preserve\"> keep  <b xml:space=\"default\">x y</b></pre><c><![CDATA[ cdata ]]></c></doc>"},
+	} {
+		doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{TextTrim: test.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testValue(t, FindOne(doc, "/doc").OutputXMLWithOptions(WithOutputSelf(), WithPreserveSpace()), test.expected)
+	}
+}
+
+func TestParseWithOptions_Skip(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<?xml-stylesheet href="a.xsl"?>
+<!-- head -->
+<doc>
+	<a>1<!-- note --></a>
+	<?page-break?>
+	<b> </b>
+</doc>`
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{Skip: SkipOptions{Comments: true, ProcInst: true, WhitespaceText: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.OutputXML(false), `<?xml version="1.0"?><doc><a>1</a><b></b></doc>`)
+
+	doc, err = ParseWithOptions(strings.NewReader(s), ParserOptions{Skip: SkipOptions{Comments: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FindOne(doc, "//comment()") != nil {
+		t.Error("expected the comments to be skipped")
+	}
+	if !strings.Contains(doc.OutputXML(false), "<?page-break?>") {
+		t.Error("expected the processing instructions to be kept")
+	}
+
+	sp, err := CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{Skip: SkipOptions{Comments: true}}, "//comment()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := sp.Read(); err != io.EOF {
+		t.Fatalf("expected no comment, got %v, %v", n, err)
+	}
+}
+
+func TestParseWithOptions_CDATADetection(t *testing.T) {
+	s := `<a>x<![CDATA[` + strings.Repeat("y", 50) + `]]><![CDATA[z]]>&amp;<![CDATA[q]]></a>`
+	// The detection does not depend on the token cache or the reads made.
+	for _, options := range []ParserOptions{{}, {TokenCacheSize: 4}, {TokenCacheSize: 4, BufferSize: 16}} {
+		doc, err := ParseWithOptions(strings.NewReader(s), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []NodeType
+		for n := FindOne(doc, "/a").FirstChild; n != nil; n = n.NextSibling {
+			types = append(types, n.Type)
+		}
+		testValue(t, fmt.Sprint(types), fmt.Sprint([]NodeType{TextNode, CharDataNode, CharDataNode, TextNode, CharDataNode}))
+		testValue(t, FindOne(doc, "/a").OutputXML(true), s)
+	}
+}
+
+func TestParseWithOptions_TokenCacheSize(t *testing.T) {
+	name := strings.Repeat("n", 100)
+	s := `<p:` + name + ` xmlns:p="urn:p" a="` + strings.Repeat("v", 5000) + `"/>`
+
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := doc.SelectElement("p:" + name); n == nil || n.Prefix != "p" {
+		t.Fatal("expected the prefix to be detected")
+	}
+
+	_, err = ParseWithOptions(strings.NewReader(s), ParserOptions{TokenCacheSize: 16})
+	if err == nil || !strings.Contains(err.Error(), "TokenCacheSize") {
+		t.Fatalf("expected a token cache size error but got %v", err)
+	}
+}
+
+func TestParse_RawTokenDetection(t *testing.T) {
+	s := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<p:root xmlns:p="urn:p" xmlns:q="urn:p"><!-- <p:x> --><q:item
+	a="1"/><p:item>caf` + "\xe9" + `</p:item><text>![CDATA[not cdata]]&gt;</text><p:data><![CDATA[<x/>]]></p:data><![CDATA[]]></p:root>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := Find(doc, "//*[local-name()='item']")
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items but got %d", len(items))
+	}
+	if items[0].Prefix != "q" || items[1].Prefix != "p" {
+		t.Errorf("expected prefixes q and p but got %q and %q", items[0].Prefix, items[1].Prefix)
+	}
+	if v := items[1].InnerText(); v != "café" {
+		t.Errorf("expected café but got %q", v)
+	}
+	if n := FindOne(doc, "//text"); n.FirstChild.Type != TextNode {
+		t.Error("expected text that looks like CDATA to be a TextNode")
+	}
+	data := FindOne(doc, "//*[local-name()='data']")
+	if data.Prefix != "p" || data.FirstChild.Type != CharDataNode || data.FirstChild.Data != "<x/>" {
+		t.Errorf("expected a CDATA section in p:data but got %s", data.OutputXML(true))
+	}
+}
+
+func TestStreamParser_ReadWithAncestors(t *testing.T) {
+	s := `<feed><group id="g1"><item>1</item><item>2</item></group><group id="g2"><sub><item>3</item></sub></group></feed>`
+	sp, err := CreateStreamParser(strings.NewReader(s), "//item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for {
+		n, ancestors, err := sp.ReadWithAncestors()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, a := range ancestors {
+			names = append(names, a.Data)
+		}
+		paths = append(paths, strings.Join(names, "/")+"@"+ancestors[1].SelectAttr("id")+":"+n.InnerText())
+	}
+	expected := []string{"feed/group@g1:1", "feed/group@g1:2", "feed/group/sub@g2:3"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %v but got %v", expected, paths)
+	}
+}
+
+func TestStreamParser_Limits(t *testing.T) {
+	s := `<feed><item id="1"><a/><b/></item><item id="2"><a/><b/></item><item id="huge">` + strings.Repeat("<x/>", 100) + `</item></feed>`
+	sp, err := CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{Limits: Limits{MaxNodes: 20}}, "//item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := sp.Read(); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+	_, err = sp.Read()
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("expected a *LimitError but got %v", err)
+	}
+	if limitErr.Limit != "MaxNodes" || limitErr.Element != "item" || limitErr.Offset <= int64(strings.Index(s, `id="huge"`)) {
+		t.Fatalf("unexpected error %+v", limitErr)
+	}
+
+	sp, err = CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{Limits: Limits{MaxNodes: 200, MaxNodeBytes: 1 << 20}}, "//item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := sp.Read(); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+
+	sp, err = CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{Limits: Limits{MaxNodeBytes: 1 << 10}}, "//item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := sp.Read(); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+	if _, err = sp.Read(); !errors.As(err, &limitErr) || limitErr.Limit != "MaxNodeBytes" {
+		t.Fatalf("expected a MaxNodeBytes error, got %v", err)
+	}
+}
+
+func TestStreamParser_Stats(t *testing.T) {
+	s := `<feed><item id="1"><a/></item><item id="2"><a/></item><item id="3"><a/></item></feed>`
+	sp, err := CreateStreamParser(strings.NewReader(s), "//item", "//item[@id!='2']")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := sp.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := sp.Stats()
+	if stats.Matched != 2 || stats.Filtered != 1 {
+		t.Errorf("expected 2 matched and 1 filtered but got %+v", stats)
+	}
+	// feed and the 3 items with their children; the last item is
+	// released by the Read returning io.EOF.
+	if stats.NodesCreated != 7 || stats.NodesFreed != 6 || stats.PeakRetainedNodes != 3 {
+		t.Errorf("unexpected node counts %+v", stats)
+	}
+	if stats.BytesConsumed != int64(len(s)) {
+		t.Errorf("expected %d bytes consumed but got %d", len(s), stats.BytesConsumed)
+	}
+}
+
+func TestParserReset(t *testing.T) {
+	p := NewParser(ParserOptions{})
+	if _, err := p.Parse(); err == nil {
+		t.Fatal("expected an error before Reset")
+	}
+	docs := []string{
+		`<a xmlns:x="urn:x"><x:b>1</x:b><![CDATA[c]]></a>`,
+		`<?xml version="1.0" encoding="ISO-8859-1"?><a><b>caf` + "\xe9" + `</b></a>`,
+		`<a><x:b xmlns:x="urn:y">2</x:b></a>`,
+		`<a><b>`,
+		`<c/>`,
+	}
+	var trees []*Node
+	for i, s := range docs {
+		p.Reset(strings.NewReader(s))
+		doc, err := p.Parse()
+		if i == 3 {
+			if err == nil {
+				t.Fatal("expected a syntax error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		want, err := Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := doc.OutputXML(true), want.OutputXML(true); got != want {
+			t.Fatalf("document %d: got %s, want %s", i, got, want)
+		}
+		trees = append(trees, doc)
+	}
+	if n := FindOne(trees[2], "//x:b"); n == nil || n.NamespaceURI != "urn:y" {
+		t.Fatal("namespace declarations leaked between documents")
+	}
+	if n := FindOne(trees[0], "//x:b"); n == nil || n.NamespaceURI != "urn:x" {
+		t.Fatal("previous tree changed by later documents")
+	}
+	if trees[0].LastChild.LastChild.Type != CharDataNode {
+		t.Fatal("CDATA not detected")
+	}
+}
+
+func BenchmarkParserReset(b *testing.B) {
+	data := []byte(`<order id="1"><item sku="a">1</item><item sku="b">2</item><note>fast</note></order>`)
+	b.Run("Parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Parse(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Reset", func(b *testing.B) {
+		b.ReportAllocs()
+		p := NewParser(ParserOptions{})
+		for i := 0; i < b.N; i++ {
+			p.Reset(bytes.NewReader(data))
+			if _, err := p.Parse(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestParseWithOptions_AttrLimits(t *testing.T) {
+	s := `<root xmlns:x="urn:x"><a p="1" q="2"/><x:b x:long="0123456789"/></root>`
+	if _, err := ParseWithOptions(strings.NewReader(s), ParserOptions{MaxAttributes: 2, MaxAttributeValueLength: 10}); err != nil {
+		t.Fatalf("limits not exceeded, got %v", err)
+	}
+
+	_, err := ParseWithOptions(strings.NewReader(s), ParserOptions{MaxAttributes: 1})
+	limitErr, ok := err.(*AttrLimitError)
+	if !ok {
+		t.Fatalf("expected an *AttrLimitError but got %v", err)
+	}
+	if limitErr.Element != "a" || limitErr.Attr != "" || limitErr.Value != 2 || limitErr.Limit != 1 || s[limitErr.Offset:limitErr.Offset+2] != "<a" {
+		t.Fatalf("unexpected error %+v", limitErr)
+	}
+
+	_, err = ParseWithOptions(strings.NewReader(s), ParserOptions{MaxAttributeValueLength: 9})
+	limitErr, ok = err.(*AttrLimitError)
+	if !ok {
+		t.Fatalf("expected an *AttrLimitError but got %v", err)
+	}
+	if limitErr.Element != "x:b" || limitErr.Attr != "x:long" || limitErr.Value != 10 || limitErr.Limit != 9 {
+		t.Fatalf("unexpected error %+v", limitErr)
+	}
+	if !strings.Contains(limitErr.Error(), "attribute x:long of element x:b") {
+		t.Fatalf("unexpected message %q", limitErr.Error())
+	}
+
+	sp, err := CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{MaxAttributes: 1}, "/root/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.Read(); err == nil {
+		t.Fatal("stream parser ignored the attribute limit")
+	}
+}
+
+func TestParseWithOptions_NormalizeLineEndings(t *testing.T) {
+	s := "<!DOCTYPE a [\r\n<!ENTITY e \"x\">\r\n]>\r\n<?pi a=\"1\r\n2\"?><a b=\"x\r\ny\">t\r\nu\rv<![CDATA[c\r\nd]]><!-- c\r\nm\r -->&#13;</a>"
+	for _, options := range []ParserOptions{{NormalizeLineEndings: true}, {StrictConformance: true}} {
+		doc, err := ParseWithOptions(strings.NewReader(s), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		var walk func(*Node)
+		walk = func(n *Node) {
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				got = append(got, child.Data)
+				for _, attr := range child.Attr {
+					got = append(got, attr.Value)
+				}
+				walk(child)
+			}
+		}
+		walk(doc)
+		for _, v := range got {
+			if strings.Contains(v, "\r") && v != "\r" {
+				t.Errorf("%+v: CR left in %q", options, v)
+			}
+		}
+		if a := FindOne(doc, "/a"); a.LastChild.Data != "\r" {
+			t.Errorf("%+v: character reference &#13; not kept", options)
+		}
+	}
+
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := FindOne(doc, "//comment()"); c == nil || c.Data != " c\r\nm\r " {
+		t.Fatal("comment changed without NormalizeLineEndings")
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	for s, want := range map[string]string{
+		"":             "",
+		"abc":          "abc",
+		"a\r\nb":       "a\nb",
+		"a\rb\r":       "a\nb\n",
+		"\r\r\n\n\r\n": "\n\n\n\n",
+	} {
+		if got := normalizeLineEndings(s); got != want {
+			t.Errorf("%q: got %q, want %q", s, got, want)
+		}
+	}
+}
+
+// dropComments is a token middleware removing comments.
+type dropComments struct{ tr xml.TokenReader }
+
+func (d dropComments) Token() (xml.Token, error) {
+	for {
+		tok, err := d.tr.Token()
+		if _, ok := tok.(xml.Comment); !ok || err != nil {
+			return tok, err
+		}
+	}
+}
+
+type rawTokens struct{ d *xml.Decoder }
+
+func (r rawTokens) Token() (xml.Token, error) { return r.d.RawToken() }
+
+func TestParseTokens(t *testing.T) {
+	s := `<a xmlns:p="urn:p"><!-- c --><p:b id="1">x</p:b></a>`
+	doc, err := ParseTokens(dropComments{xml.NewDecoder(strings.NewReader(s))}, ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := FindOne(doc, "//p:b")
+	if b == nil || b.NamespaceURI != "urn:p" || b.InnerText() != "x" {
+		t.Fatalf("unexpected tree %s", doc.OutputXML(false))
+	}
+	if n := FindOne(doc, "//comment()"); n != nil {
+		t.Fatal("comment was not filtered")
+	}
+
+	// Raw tokens carry prefixes instead of namespace URIs.
+	doc, err = ParseTokens(rawTokens{xml.NewDecoder(strings.NewReader(s))}, ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := FindOne(doc, "//p:b"); b == nil || b.NamespaceURI != "urn:p" {
+		t.Fatalf("unexpected tree %s", doc.OutputXML(false))
+	}
+
+	// Round trip through the tokens of a subtree.
+	sub, err := ParseTokens(NodeTokenSource(b), ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, sub.OutputXML(false), `<?xml version="1.0"?><p:b id="1" xmlns:p="urn:p">x</p:b>`)
+
+	bad := rawTokens{xml.NewDecoder(strings.NewReader(`<a></b>`))}
+	if _, err := ParseTokens(bad, ParserOptions{}); err == nil {
+		t.Fatal("expected an error for mismatched tokens")
+	}
+}
+
+func TestStreamParserNonElementNodes(t *testing.T) {
+	s := `<?xml version="1.0"?><?page-break type="soft"?><book><!-- ch1 --><p>a</p><?page-break type="hard"?><sec><?page-break type="deep"?><!-- ch2 --></sec><?other?></book>`
+	read := func(expr string, filter ...string) []string {
+		sp, err := CreateStreamParser(strings.NewReader(s), expr, filter...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for {
+			n, err := sp.Read()
+			if err == io.EOF {
+				return got
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch n.Type {
+			case CommentNode:
+				got = append(got, n.Data)
+			case DeclarationNode:
+				got = append(got, n.Data+":"+n.SelectAttr("type"))
+			default:
+				got = append(got, n.Data)
+			}
+		}
+	}
+	testValue(t, fmt.Sprint(read("//processing-instruction('page-break')")), "[page-break:soft page-break:hard page-break:deep]")
+	testValue(t, fmt.Sprint(read("//processing-instruction()")), "[page-break:soft page-break:hard page-break:deep other:]")
+	testValue(t, fmt.Sprint(read("/book/processing-instruction()")), "[page-break:hard other:]")
+	testValue(t, fmt.Sprint(read("/processing-instruction('page-break')")), "[page-break:soft]")
+	testValue(t, fmt.Sprint(read("//sec//processing-instruction()")), "[page-break:deep]")
+	testValue(t, fmt.Sprint(read("//comment()")), "[ ch1   ch2 ]")
+	testValue(t, fmt.Sprint(read("//comment()", "//comment()[contains(., 'ch2')]")), "[ ch2 ]")
+	testValue(t, fmt.Sprint(read("//p")), "[p]")
+	testValue(t, fmt.Sprint(read("//sec/comment()[1]")), "[ ch2 ]")
+	testValue(t, fmt.Sprint(read("//p[not(comment())]")), "[p]")
+	// Only a trailing comment() step targets comments.
+	for expr, want := range map[string]bool{
+		"comment()":                    true,
+		"//sec/comment()[1]":           true,
+		"/book//comment( )":            true,
+		"//p[comment()]":               false,
+		"//p[contains(., 'comment(')]": false,
+		"//comment()/..":               false,
+	} {
+		testValue(t, isStreamComment(expr), want)
+	}
+}
+
+func TestParseProcInstNesting(t *testing.T) {
+	// Processing instructions within elements, one after another or
+	// following elements, do not raise the nesting level of the nodes after
+	// them.
+	s := `<?xml version="1.0"?><?a?><?b?><book><?c?><p>a</p><?d?><?e?><sec><?f?></sec><q></q></book><?g?>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.OutputXML(false), s)
+	testValue(t, FindOne(doc, "/book/sec").Parent.Data, "book")
+	testValue(t, FindOne(doc, "/book/q").Parent.Data, "book")
+	testValue(t, FindOne(doc, "/book/p").InnerText(), "a")
+	var targets []string
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		targets = append(targets, n.Data)
+	}
+	testValue(t, strings.Join(targets, ","), "xml,a,b,book,g")
+}
+
+// cancelingReader cancels a context once read from.
+type cancelingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelingReader) Read(p []byte) (int, error) {
+	c.cancel()
+	return c.r.Read(p)
+}
+
+func TestParseWithContext(t *testing.T) {
+	s := "<a>" + strings.Repeat("<b>x</b>", 10000) + "</a>"
+	doc, err := ParseWithContext(context.Background(), strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(Find(doc, "//b")); n != 10000 {
+		t.Fatalf("got %d elements", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = ParseWithContext(ctx, &cancelingReader{r: strings.NewReader(s), cancel: cancel})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err = ParseWithOptionsContext(ctx, strings.NewReader(s), ParserOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+}
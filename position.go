@@ -0,0 +1,70 @@
+package xmlquery
+
+// Position is a location in the parsed input.
+type Position struct {
+	// Line and Column count from 1; columns count bytes.
+	Line   int
+	Column int
+	// Offset is the byte offset from the start of the input.
+	Offset int64
+}
+
+// nodePosition locates a node in the parsed input.
+type nodePosition struct {
+	start Position
+	end   Position
+}
+
+// Position returns the position in the input where n starts, such as the
+// '<' of an element's start tag, and whether it is known: positions are
+// recorded when parsing with ParserOptions.WithLineNumbers. Offsets and
+// columns count the bytes of the decoded input, which differ from those of
+// the input if the document declares an encoding other than UTF-8.
+func (n *Node) Position() (Position, bool) {
+	if n.position == nil {
+		return Position{}, false
+	}
+	return n.position.start, true
+}
+
+// EndPosition returns the position in the input just past the end of n,
+// such as the byte after the '>' of an element's end tag, and whether it
+// is known, see Position. The source text of n spans from the offset of
+// its position to that of its end position.
+func (n *Node) EndPosition() (Position, bool) {
+	if n.position == nil {
+		return Position{}, false
+	}
+	return n.position.end, true
+}
+
+// currentPosition returns the position of the current input offset of the
+// decoder.
+func (p *parser) currentPosition() Position {
+	offset := p.decoder.InputOffset()
+	line, column := p.reader.position(offset)
+	return Position{Line: line, Column: column, Offset: offset}
+}
+
+// newPosition returns the position of a node read from start up to the
+// current input offset, or nil unless positions are recorded. The end of
+// an element is set once its end tag is read, see closePosition.
+func (p *parser) newPosition(start Position) *nodePosition {
+	if !p.positions {
+		return nil
+	}
+	return &nodePosition{start: start, end: p.currentPosition()}
+}
+
+// closePosition sets the end position of the element whose end tag was
+// just read.
+func (p *parser) closePosition() {
+	for n := p.prev; n != nil; n = n.Parent {
+		if n.Type == ElementNode && n.level == p.level {
+			if n.position != nil {
+				n.position.end = p.currentPosition()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package xmlquery
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNodePosition(t *testing.T) {
+	s := "<?xml version=\"1.0\"?>\n<a>\n  <b>x</b><b>x</b>\n  <!-- c --><b\n   id=\"3\">x</b>\n</a>"
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{WithLineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(n *Node) string {
+		pos, ok := n.Position()
+		if !ok {
+			return "unknown"
+		}
+		if s[pos.Offset:pos.Offset+1] != "<" && n.Type == ElementNode {
+			t.Errorf("offset %d of %s is not at its start tag", pos.Offset, n.Data)
+		}
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	var got []string
+	for _, n := range Find(doc, "//b") {
+		got = append(got, at(n))
+	}
+	testValue(t, fmt.Sprint(got), "[3:3 3:11 4:13]")
+	testValue(t, at(FindOne(doc, "/a")), "2:1")
+	testValue(t, at(FindOne(doc, "//comment()")), "4:3")
+	testValue(t, at(FindOne(doc, "(//b)[2]/text()")), "3:14")
+	testValue(t, at(doc.FirstChild), "1:1")
+
+	doc, err = Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, at(FindOne(doc, "/a")), "unknown")
+}
+
+func TestNodePositionEncoding(t *testing.T) {
+	s := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<a>caf\xe9\n<b/></a>"
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{WithLineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, _ := FindOne(doc, "//b").Position()
+	testValue(t, fmt.Sprintf("%d:%d", pos.Line, pos.Column), "3:1")
+}
+
+func TestNodeEndPosition(t *testing.T) {
+	s := "<a>\n  <b id=\"1\">x<c/></b>\n  <b>y</b><!-- c -->\n</a>"
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{WithLineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := func(n *Node) string {
+		start, _ := n.Position()
+		end, ok := n.EndPosition()
+		if !ok {
+			return "unknown"
+		}
+		return s[start.Offset:end.Offset]
+	}
+	testValue(t, span(FindOne(doc, "/a/b[1]")), `<b id="1">x<c/></b>`)
+	testValue(t, span(FindOne(doc, "//c")), `<c/>`)
+	testValue(t, span(FindOne(doc, "/a/b[2]")), `<b>y</b>`)
+	testValue(t, span(FindOne(doc, "//comment()")), `<!-- c -->`)
+	testValue(t, span(FindOne(doc, "/a/b[2]/text()")), `y`)
+	testValue(t, span(FindOne(doc, "/a")), s)
+	end, _ := FindOne(doc, "/a/b[2]").EndPosition()
+	testValue(t, fmt.Sprintf("%d:%d", end.Line, end.Column), "3:11")
+}
+
+// chunkReader returns at most n bytes per read, like a network stream.
+type chunkReader struct {
+	s string
+	n int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.s == "" {
+		return 0, io.EOF
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n := copy(p, r.s)
+	r.s = r.s[n:]
+	return n, nil
+}
+
+func TestStreamParserPosition(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<feed>\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "  <item n=\"%d\">\n    <v>%d</v>\n  </item>\n", i, i)
+	}
+	b.WriteString("</feed>\n")
+	s := b.String()
+	sp, err := CreateStreamParserWithOptions(&chunkReader{s: s, n: 7}, ParserOptions{WithLineNumbers: true}, "/feed/item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		n, err := sp.Read()
+		if err == io.EOF {
+			if i != 1000 {
+				t.Fatalf("read %d items", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, _ := n.Position()
+		end, _ := n.EndPosition()
+		if start.Line != 2+3*i || start.Column != 3 || end.Line != 4+3*i {
+			t.Fatalf("item %d at %+v to %+v", i, start, end)
+		}
+		if v, _ := FindOne(n, "v").Position(); v.Line != 3+3*i || v.Column != 5 {
+			t.Fatalf("item %d: v at %+v", i, v)
+		}
+		if !strings.HasPrefix(s[start.Offset:end.Offset], fmt.Sprintf(`<item n="%d">`, i)) {
+			t.Fatalf("item %d: wrong offset %d", i, start.Offset)
+		}
+	}
+}
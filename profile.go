@@ -0,0 +1,124 @@
+package xmlquery
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryEvent describes an evaluation of an XPath expression.
+type QueryEvent struct {
+	// Expr is the expression as given by the caller.
+	Expr     string
+	Duration time.Duration
+	// Results is the number of nodes selected, or the count returned by
+	// Count.
+	Results int
+	Err     error
+}
+
+// QueryHook, if set, is called after every evaluation of an expression by
+// QueryAll, Query, Exists, Count, Matches and QueryAllContext, and thus by
+// Find, FindOne and the other functions built on them. It is called from the
+// goroutine that ran the query and must be safe for concurrent use.
+//
+// Deprecated: use Configure(WithQueryHook(fn)), which is safe for
+// concurrent use. A hook set by Configure takes precedence.
+var QueryHook func(QueryEvent)
+
+// startQuery returns the function reporting the evaluation of expr to
+// QueryHook, or nil if no hook is set.
+func startQuery(expr string) func(results int, err error) {
+	hook := currentConfig().queryHook
+	if hook == nil {
+		hook = QueryHook
+	}
+	if hook == nil {
+		return nil
+	}
+	start := time.Now()
+	return func(results int, err error) {
+		hook(QueryEvent{Expr: expr, Duration: time.Since(start), Results: results, Err: err})
+	}
+}
+
+// QueryProfile holds the statistics of an expression collected by a
+// QueryProfiler.
+type QueryProfile struct {
+	Expr          string
+	Count         int
+	Errors        int
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// QueryProfiler aggregates QueryEvents by expression. Its Observe method can
+// be used as query hook:
+//
+//	profiler := &xmlquery.QueryProfiler{}
+//	xmlquery.Configure(xmlquery.WithQueryHook(profiler.Observe))
+//	expvar.Publish("xpath", profiler)
+//
+// It is safe for concurrent use.
+type QueryProfiler struct {
+	mu       sync.Mutex
+	profiles map[string]*QueryProfile
+}
+
+// Observe records e.
+func (p *QueryProfiler) Observe(e QueryEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.profiles == nil {
+		p.profiles = make(map[string]*QueryProfile)
+	}
+	qp := p.profiles[e.Expr]
+	if qp == nil {
+		qp = &QueryProfile{Expr: e.Expr}
+		p.profiles[e.Expr] = qp
+	}
+	qp.Count++
+	if e.Err != nil {
+		qp.Errors++
+	}
+	qp.TotalDuration += e.Duration
+	if e.Duration > qp.MaxDuration {
+		qp.MaxDuration = e.Duration
+	}
+}
+
+// Profiles returns the statistics of the expressions observed so far, the
+// most time-consuming first.
+func (p *QueryProfiler) Profiles() []QueryProfile {
+	p.mu.Lock()
+	list := make([]QueryProfile, 0, len(p.profiles))
+	for _, qp := range p.profiles {
+		list = append(list, *qp)
+	}
+	p.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TotalDuration != list[j].TotalDuration {
+			return list[i].TotalDuration > list[j].TotalDuration
+		}
+		return list[i].Expr < list[j].Expr
+	})
+	return list
+}
+
+// Reset discards the statistics collected so far.
+func (p *QueryProfiler) Reset() {
+	p.mu.Lock()
+	p.profiles = nil
+	p.mu.Unlock()
+}
+
+// String returns the profiles as a JSON array, so that a QueryProfiler
+// can be published as an expvar.Var.
+func (p *QueryProfiler) String() string {
+	b, err := json.Marshal(p.Profiles())
+	if err != nil {
+		return "[]"
+	}
+	return string(b)
+}
@@ -0,0 +1,81 @@
+package xmlquery
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueryHook(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<a><b/><b/><c/></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []QueryEvent
+	QueryHook = func(e QueryEvent) { events = append(events, e) }
+	defer func() { QueryHook = nil }()
+
+	Find(doc, "//b")
+	FindOne(doc, "//c")
+	Count(doc, "//b")
+	Exists(doc, "//d")
+	QueryAll(doc, "//b[")
+	if len(events) != 5 {
+		t.Fatalf("got %d events", len(events))
+	}
+	for i, want := range []struct {
+		expr    string
+		results int
+		err     bool
+	}{
+		{"//b", 2, false},
+		{"//c", 1, false},
+		{"//b", 2, false},
+		{"//d", 0, false},
+		{"//b[", 0, true},
+	} {
+		e := events[i]
+		if e.Expr != want.expr || e.Results != want.results || (e.Err != nil) != want.err || e.Duration < 0 {
+			t.Errorf("event %d: got %+v", i, e)
+		}
+	}
+}
+
+func TestQueryProfiler(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<a><b/><b/><c/></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiler := &QueryProfiler{}
+	QueryHook = profiler.Observe
+	defer func() { QueryHook = nil }()
+
+	for i := 0; i < 3; i++ {
+		Find(doc, "//b")
+	}
+	FindOne(doc, "//c")
+	Exists(doc, "//c[")
+
+	profiles := profiler.Profiles()
+	if len(profiles) != 3 {
+		t.Fatalf("got %d profiles", len(profiles))
+	}
+	byExpr := make(map[string]QueryProfile)
+	for _, p := range profiles {
+		byExpr[p.Expr] = p
+	}
+	if p := byExpr["//b"]; p.Count != 3 || p.Errors != 0 || p.MaxDuration > p.TotalDuration {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	if p := byExpr["//c["]; p.Count != 1 || p.Errors != 1 {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	var decoded []QueryProfile
+	if err := json.Unmarshal([]byte(profiler.String()), &decoded); err != nil || len(decoded) != 3 {
+		t.Fatalf("String is not a JSON array of profiles: %v", err)
+	}
+	profiler.Reset()
+	if len(profiler.Profiles()) != 0 {
+		t.Fatal("profiles not reset")
+	}
+}
@@ -0,0 +1,226 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// PullEvent is the kind of token a PullParser is on.
+type PullEvent int
+
+const (
+	// PullStartElement is an element start tag, see PullParser.Element.
+	PullStartElement PullEvent = iota + 1
+	// PullEndElement is an element end tag, see PullParser.Element.
+	PullEndElement
+	// PullText is text or a CDATA section, see PullParser.CDATA.
+	PullText
+	PullComment
+	// PullProcInst is a processing instruction, see PullParser.Target.
+	PullProcInst
+	// PullDirective is a directive, such as <!DOCTYPE ...>.
+	PullDirective
+)
+
+// PullParser reads a document token by token, building nodes only for the
+// elements asked for with BuildSubtree. It lies between Parse, which
+// builds the whole tree, and StreamParser, which builds the subtrees
+// matching an expression.
+//
+//	pp := xmlquery.NewPullParser(r, xmlquery.ParserOptions{})
+//	for {
+//		event, err := pp.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//		if event == xmlquery.PullStartElement && pp.Element().Data == "item" {
+//			item, err := pp.BuildSubtree()
+//			...
+//		}
+//	}
+//
+// The names of the elements are resolved as by Parse, and the options
+// apply as they would to ParseWithOptions, except for those about the
+// nodes of the tree, such as Whitespace, TextTrim, Skip or
+// Limits.MaxNodes.
+type PullParser struct {
+	er    *eventReader
+	tok   xml.Token
+	event PullEvent
+	err   error
+}
+
+// NewPullParser returns a PullParser reading the document from r.
+func NewPullParser(r io.Reader, options ParserOptions) *PullParser {
+	pp := &PullParser{}
+	if !options.DisableDecompression {
+		if r, pp.err = decompress(r); pp.err != nil {
+			return pp
+		}
+	}
+	pp.er = newEventReader(r, options)
+	return pp
+}
+
+// Next advances to the next token and returns its kind. It returns io.EOF
+// at the end of the document. Once Next returns an error, it keeps
+// returning it.
+func (pp *PullParser) Next() (PullEvent, error) {
+	if pp.err != nil {
+		return 0, pp.err
+	}
+	tok, err := pp.er.next()
+	if err != nil {
+		if err != io.EOF {
+			err = pp.er.p.sourceError(err)
+		}
+		pp.tok, pp.event, pp.err = nil, 0, err
+		return 0, err
+	}
+	pp.tok = tok
+	switch tok.(type) {
+	case xml.StartElement:
+		pp.event = PullStartElement
+	case xml.EndElement:
+		pp.event = PullEndElement
+	case xml.CharData:
+		pp.event = PullText
+	case xml.Comment:
+		pp.event = PullComment
+	case xml.ProcInst:
+		pp.event = PullProcInst
+	case xml.Directive:
+		pp.event = PullDirective
+	}
+	return pp.event, nil
+}
+
+// Element returns the element started or ended by the current token, nil
+// if it is not a start or end tag. It is only valid until the next call
+// to Next.
+func (pp *PullParser) Element() *ElementEvent {
+	if pp.tok == nil {
+		return nil
+	}
+	return pp.er.element(pp.tok)
+}
+
+// Depth returns the number of elements open at the current token, the
+// element of a start tag included and that of an end tag not.
+func (pp *PullParser) Depth() int {
+	if pp.er == nil {
+		return 0
+	}
+	return len(pp.er.elements)
+}
+
+// Data returns the content of the current token: the text of a text token,
+// comment or directive, or the instruction of a processing instruction.
+// It is only valid until the next call to Next.
+func (pp *PullParser) Data() []byte {
+	switch tok := pp.tok.(type) {
+	case xml.CharData:
+		return tok
+	case xml.Comment:
+		return tok
+	case xml.ProcInst:
+		return tok.Inst
+	case xml.Directive:
+		return tok
+	}
+	return nil
+}
+
+// Target returns the target of the current processing instruction.
+func (pp *PullParser) Target() string {
+	if tok, ok := pp.tok.(xml.ProcInst); ok {
+		return tok.Target
+	}
+	return ""
+}
+
+// CDATA reports whether the current text token is a CDATA section.
+func (pp *PullParser) CDATA() bool {
+	return pp.event == PullText && pp.er.p.reader.IsCDATA(pp.er.start)
+}
+
+// errNotStartElement is returned by BuildSubtree and Skip when the parser
+// is not on a start tag.
+var errNotStartElement = errors.New("xmlquery: pull parser is not on a start element")
+
+// BuildSubtree reads up to the end tag of the element started by the
+// current token and returns the element with its content, as Parse would
+// build them. The element has no parent. The parser is then on the end
+// tag, so Next continues after the element.
+func (pp *PullParser) BuildSubtree() (*Node, error) {
+	if pp.event != PullStartElement {
+		return nil, errNotStartElement
+	}
+	var top, parent *Node
+	for {
+		var n *Node
+		switch tok := pp.tok.(type) {
+		case xml.StartElement:
+			e := pp.Element()
+			n = &Node{Type: ElementNode, Data: e.Data, Prefix: e.Prefix, NamespaceURI: e.NamespaceURI, Attr: e.Attr}
+		case xml.EndElement:
+			if parent = parent.Parent; parent == nil {
+				return top, nil
+			}
+		case xml.CharData:
+			n = &Node{Type: TextNode, Data: string(tok)}
+			if pp.CDATA() {
+				n.Type = CharDataNode
+			}
+		case xml.Comment:
+			n = &Node{Type: CommentNode, Data: pp.er.p.lineEndings(string(tok))}
+		case xml.ProcInst:
+			n = &Node{Type: DeclarationNode, Data: tok.Target}
+			for _, attr := range parsePseudoAttrs(pp.er.p.lineEndings(string(tok.Inst))) {
+				addAttr(n, attr.Name.Local, attr.Value)
+			}
+		case xml.Directive:
+			n = &Node{Type: NotationNode, Data: pp.er.p.lineEndings(string(tok))}
+		}
+		if n != nil {
+			if top == nil {
+				top = n
+			} else {
+				addChild(parent, n)
+			}
+			if n.Type == ElementNode {
+				parent = n
+			}
+		}
+		if _, err := pp.Next(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// Skip reads up to the end tag of the element started by the current
+// token, without building it. The parser is then on the end tag.
+func (pp *PullParser) Skip() error {
+	if pp.event != PullStartElement {
+		return errNotStartElement
+	}
+	for depth := pp.Depth(); ; {
+		event, err := pp.Next()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if event == PullEndElement && pp.Depth() < depth {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package xmlquery
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPullParser(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<!DOCTYPE feed>
+<feed xmlns="urn:feed" xmlns:m="urn:meta">
+<!-- first -->
+<item id="1"><title>One</title><m:tag>a</m:tag></item>
+<item id="2"><title><![CDATA[Two]]></title><?pi x="y"?></item>
+<other/>
+</feed>`
+	pp := NewPullParser(strings.NewReader(s), ParserOptions{})
+	var events []string
+	var items []*Node
+	for {
+		event, err := pp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch event {
+		case PullStartElement:
+			e := pp.Element()
+			if e.Data == "item" {
+				item, err := pp.BuildSubtree()
+				if err != nil {
+					t.Fatal(err)
+				}
+				items = append(items, item)
+				testValue(t, pp.Element().Data, "item")
+				testValue(t, pp.Depth(), 1)
+				continue
+			}
+			events = append(events, fmt.Sprintf("start %d %s{%s}", pp.Depth(), e.Data, e.NamespaceURI))
+		case PullEndElement:
+			events = append(events, fmt.Sprintf("end %d %s", pp.Depth(), pp.Element().Data))
+		case PullText:
+			if s := strings.TrimSpace(string(pp.Data())); s != "" {
+				events = append(events, "text "+s)
+			}
+		case PullComment:
+			events = append(events, fmt.Sprintf("comment %q", pp.Data()))
+		case PullProcInst:
+			events = append(events, "pi "+pp.Target())
+		case PullDirective:
+			events = append(events, fmt.Sprintf("directive %s", pp.Data()))
+		}
+	}
+	want := []string{
+		`pi xml`,
+		`directive DOCTYPE feed`,
+		`start 1 feed{urn:feed}`,
+		`comment " first "`,
+		`start 2 other{urn:feed}`,
+		`end 1 other`,
+		`end 0 feed`,
+	}
+	testValue(t, strings.Join(events, "\n"), strings.Join(want, "\n"))
+
+	if len(items) != 2 {
+		t.Fatalf("got %d items", len(items))
+	}
+	testValue(t, items[0].Parent == nil, true)
+	testValue(t, items[0].SelectAttr("id"), "1")
+	testValue(t, items[0].NamespaceURI, "urn:feed")
+	tag := FindOne(items[0], "//*[local-name()='tag']")
+	testValue(t, tag.Prefix, "m")
+	testValue(t, tag.NamespaceURI, "urn:meta")
+	testValue(t, items[0].OutputXML(true), `<item id="1"><title>One</title><m:tag>a</m:tag></item>`)
+	testValue(t, items[1].FirstChild.FirstChild.Type, CharDataNode)
+	testValue(t, items[1].LastChild.Type, DeclarationNode)
+	testValue(t, items[1].LastChild.SelectAttr("x"), "y")
+
+	// Once at the end, the parser stays there.
+	if _, err := pp.Next(); err != io.EOF {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestPullParserSkip(t *testing.T) {
+	pp := NewPullParser(strings.NewReader(`<a><b><c/><c/></b><d>text</d></a>`), ParserOptions{})
+	var names []string
+	for {
+		event, err := pp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event != PullStartElement {
+			continue
+		}
+		names = append(names, pp.Element().Data)
+		if pp.Element().Data == "b" {
+			if err := pp.Skip(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	testValue(t, strings.Join(names, ","), "a,b,d")
+
+	pp = NewPullParser(strings.NewReader(`<a>text</a>`), ParserOptions{})
+	if _, err := pp.BuildSubtree(); err != errNotStartElement {
+		t.Fatalf("got error %v", err)
+	}
+	pp.Next()
+	pp.Next()
+	if err := pp.Skip(); err != errNotStartElement {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestPullParserErrors(t *testing.T) {
+	pp := NewPullParser(strings.NewReader("<a>\n<b>\n</a>"), ParserOptions{SourceName: "x.xml"})
+	pp.Next()
+	_, err := pp.BuildSubtree()
+	if err == nil || !strings.HasPrefix(err.Error(), "x.xml:3: ") {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err2 := pp.Next(); err2 != err {
+		t.Fatalf("got error %v after %v", err2, err)
+	}
+}
@@ -20,6 +20,29 @@ func (n *Node) SelectElement(name string) *Node {
 	return FindOne(n, name)
 }
 
+// SelectElementsNS returns the child elements in the namespace
+// namespaceURI with the local name local.
+func (n *Node) SelectElementsNS(namespaceURI, local string) []*Node {
+	var elems []*Node
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == ElementNode && child.NamespaceURI == namespaceURI && child.Data == local {
+			elems = append(elems, child)
+		}
+	}
+	return elems
+}
+
+// SelectElementNS returns the first child element in the namespace
+// namespaceURI with the local name local, or nil.
+func (n *Node) SelectElementNS(namespaceURI, local string) *Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == ElementNode && child.NamespaceURI == namespaceURI && child.Data == local {
+			return child
+		}
+	}
+	return nil
+}
+
 // SelectAttr returns the attribute value with the specified name.
 func (n *Node) SelectAttr(name string) string {
 	if n.Type == AttributeNode {
@@ -46,7 +69,12 @@ func CreateXPathNavigator(top *Node) *NodeNavigator {
 }
 
 func getCurrentNode(it *xpath.NodeIterator) *Node {
-	n := it.Current().(*NodeNavigator)
+	return navigatorNode(it.Current().(*NodeNavigator))
+}
+
+// navigatorNode returns the node at the navigator position, or a detached
+// attribute node if it is positioned on an attribute.
+func navigatorNode(n *NodeNavigator) *Node {
 	if n.NodeType() == xpath.AttributeNode {
 		childNode := &Node{
 			Type: TextNode,
@@ -63,8 +91,9 @@ func getCurrentNode(it *xpath.NodeIterator) *Node {
 	return n.curr
 }
 
-// Find is like QueryAll but panics if `expr` is not a valid XPath expression.
-// See `QueryAll()` function.
+// Find is like QueryAll but panics if `expr` is not a valid XPath expression
+// or cannot be evaluated. See `QueryAll()` function, which should be used
+// for expressions coming from users.
 func Find(top *Node, expr string) []*Node {
 	nodes, err := QueryAll(top, expr)
 	if err != nil {
@@ -73,8 +102,9 @@ func Find(top *Node, expr string) []*Node {
 	return nodes
 }
 
-// FindOne is like Query but panics if `expr` is not a valid XPath expression.
-// See `Query()` function.
+// FindOne is like Query but panics if `expr` is not a valid XPath expression
+// or cannot be evaluated. See `Query()` function, which should be used for
+// expressions coming from users.
 func FindOne(top *Node, expr string) *Node {
 	node, err := Query(top, expr)
 	if err != nil {
@@ -83,9 +113,45 @@ func FindOne(top *Node, expr string) *Node {
 	return node
 }
 
+// FindOneOr is like FindOne but returns `def` if no node matches `expr`.
+func FindOneOr(top *Node, expr string, def *Node) *Node {
+	if node := FindOne(top, expr); node != nil {
+		return node
+	}
+	return def
+}
+
+// MustFindOne is like FindOne but panics if no node matches `expr`.
+func MustFindOne(top *Node, expr string) *Node {
+	node := FindOne(top, expr)
+	if node == nil {
+		panic(fmt.Sprintf("xmlquery: no node matches %q", expr))
+	}
+	return node
+}
+
+// ValueOf returns the inner text of the first node that matches `expr`, or
+// `fallback` if no node matches. It panics if `expr` is not a valid XPath
+// expression.
+func ValueOf(top *Node, expr string, fallback string) string {
+	if node := FindOne(top, expr); node != nil {
+		return node.InnerText()
+	}
+	return fallback
+}
+
 // QueryAll searches the XML Node that matches by the specified XPath expr.
-// Returns an error if the expression `expr` cannot be parsed.
-func QueryAll(top *Node, expr string) ([]*Node, error) {
+// Returns an error if the expression `expr` cannot be parsed or evaluated,
+// for example because a function is given an invalid regular expression;
+// QueryAll does not panic.
+func QueryAll(top *Node, expr string) (list []*Node, err error) {
+	if done := startQuery(expr); done != nil {
+		defer func() { done(len(list), err) }()
+	}
+	defer recoverEval(expr, &err)
+	if list, ok := planQuery(top, expr); ok {
+		return list, nil
+	}
 	exp, err := getQuery(expr)
 	if err != nil {
 		return nil, err
@@ -95,7 +161,23 @@ func QueryAll(top *Node, expr string) ([]*Node, error) {
 
 // Query searches the XML Node that matches by the specified XPath expr,
 // and returns first matched element.
-func Query(top *Node, expr string) (*Node, error) {
+func Query(top *Node, expr string) (node *Node, err error) {
+	if done := startQuery(expr); done != nil {
+		defer func() {
+			results := 0
+			if node != nil {
+				results = 1
+			}
+			done(results, err)
+		}()
+	}
+	defer recoverEval(expr, &err)
+	if list, ok := planQuery(top, expr); ok {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		return list[0], nil
+	}
 	exp, err := getQuery(expr)
 	if err != nil {
 		return nil, err
@@ -103,6 +185,94 @@ func Query(top *Node, expr string) (*Node, error) {
 	return QuerySelector(top, exp), nil
 }
 
+// Exists reports whether any node matches the specified XPath expr. It stops
+// at the first match instead of collecting all of them.
+// Returns an error if the expression `expr` cannot be parsed.
+func Exists(top *Node, expr string) (found bool, err error) {
+	if done := startQuery(expr); done != nil {
+		defer func() {
+			results := 0
+			if found {
+				results = 1
+			}
+			done(results, err)
+		}()
+	}
+	defer recoverEval(expr, &err)
+	exp, err := getQuery(expr)
+	if err != nil {
+		return false, err
+	}
+	return exp.Select(CreateXPathNavigator(top)).MoveNext(), nil
+}
+
+// Count returns the number of nodes that match the specified XPath expr. It
+// iterates over the matching nodes rather than collecting them. Returns an
+// error if the expression `expr` cannot be parsed or does not select a
+// node-set.
+func Count(top *Node, expr string) (count int, err error) {
+	if done := startQuery(expr); done != nil {
+		defer func() { done(count, err) }()
+	}
+	defer recoverEval(expr, &err)
+	exp, err := getQuery(expr)
+	if err != nil {
+		return 0, err
+	}
+	it, ok := exp.Evaluate(CreateXPathNavigator(top)).(*xpath.NodeIterator)
+	if !ok {
+		return 0, fmt.Errorf("xmlquery: %s does not select a node-set", expr)
+	}
+	for it.MoveNext() {
+		count++
+	}
+	return count, nil
+}
+
+// Matches reports whether the node n itself is selected by the specified
+// XPath expr, evaluated from the root of n's tree. n may also be an
+// attribute node returned by a query. Returns an error if the expression
+// `expr` cannot be parsed.
+func Matches(n *Node, expr string) (matched bool, err error) {
+	if done := startQuery(expr); done != nil {
+		defer func() {
+			results := 0
+			if matched {
+				results = 1
+			}
+			done(results, err)
+		}()
+	}
+	defer recoverEval(expr, &err)
+	exp, err := getQuery(expr)
+	if err != nil {
+		return false, err
+	}
+	target, attr := n, ""
+	if n.Type == AttributeNode && n.Parent != nil {
+		target, attr = n.Parent, n.Data
+	}
+	root := target
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	t := exp.Select(CreateXPathNavigator(root))
+	for t.MoveNext() {
+		nav := t.Current().(*NodeNavigator)
+		if nav.curr != target {
+			continue
+		}
+		if nav.NodeType() == xpath.AttributeNode {
+			if attr != "" && nav.LocalName() == attr {
+				return true, nil
+			}
+		} else if attr == "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // QuerySelectorAll searches all of the XML Node that matches the specified
 // XPath selectors.
 func QuerySelectorAll(top *Node, selector *xpath.Expr) []*Node {
@@ -143,22 +313,174 @@ func FindEachWithBreak(top *Node, expr string, cb func(int, *Node) bool) {
 	}
 }
 
+// FindEachErr calls fn for each node matching expr, in document order, and
+// stops at the first error returned by fn, which it returns. Unlike
+// FindEach, it returns an error rather than panicking if `expr` cannot be
+// parsed.
+func FindEachErr(top *Node, expr string, fn func(i int, n *Node) error) error {
+	return FindEachMatch(top, expr, func(m Match) error {
+		return fn(m.Index, m.Node)
+	})
+}
+
+// Match is a node passed to the callback of FindEachMatch.
+type Match struct {
+	Node *Node
+	// Index is the position of Node among the matches, from 0.
+	Index int
+	// Total is the number of matches.
+	Total int
+}
+
+// FindEachMatch is like FindEachErr, but passes the callback the position
+// of each match among all of them.
+func FindEachMatch(top *Node, expr string, fn func(m Match) error) error {
+	nodes, err := QueryAll(top, expr)
+	if err != nil {
+		return err
+	}
+	for i, n := range nodes {
+		if err := fn(Match{Node: n, Index: i, Total: len(nodes)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverEval turns a panic raised by the xpath package while evaluating
+// expr into an error stored in err.
+func recoverEval(expr string, err *error) {
+	if r := recover(); r != nil {
+		if e, ok := r.(error); ok {
+			*err = fmt.Errorf("xmlquery: cannot evaluate %s: %w", expr, e)
+		} else {
+			*err = fmt.Errorf("xmlquery: cannot evaluate %s: %v", expr, r)
+		}
+	}
+}
+
+// CompiledQuery is a compiled XPath expression bound to the xmlquery
+// navigator. Unlike Find and QueryAll, a CompiledQuery does not go through the
+// selector cache, so callers that hold on to their hot expressions can avoid
+// its lock. A CompiledQuery is safe for concurrent use by multiple goroutines.
+type CompiledQuery struct {
+	expr *xpath.Expr
+}
+
+// Compile parses an XPath expression and returns, if successful, a
+// CompiledQuery object that can be used to match against XML nodes.
+func Compile(expr string) (*CompiledQuery, error) {
+	exp, err := xpath.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledQuery{expr: exp}, nil
+}
+
+// MustCompile is like Compile but panics if the expression `expr` cannot be
+// parsed.
+func MustCompile(expr string) *CompiledQuery {
+	q, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Expr returns the underlying compiled xpath.Expr.
+func (q *CompiledQuery) Expr() *xpath.Expr {
+	return q.expr
+}
+
+// String returns the XPath expression the query was compiled from.
+func (q *CompiledQuery) String() string {
+	return q.expr.String()
+}
+
+// FindAll returns all the nodes under `top` that match the query. Like Find,
+// it panics if the query cannot be evaluated; see QueryAll.
+func (q *CompiledQuery) FindAll(top *Node) []*Node {
+	return QuerySelectorAll(top, q.expr)
+}
+
+// FindOne returns the first node under `top` that matches the query, or nil.
+// Like FindOne, it panics if the query cannot be evaluated; see Query.
+func (q *CompiledQuery) FindOne(top *Node) *Node {
+	return QuerySelector(top, q.expr)
+}
+
+// QueryAll is like FindAll, but returns an error rather than panicking if
+// the query cannot be evaluated.
+func (q *CompiledQuery) QueryAll(top *Node) (list []*Node, err error) {
+	defer recoverEval(q.String(), &err)
+	return QuerySelectorAll(top, q.expr), nil
+}
+
+// Query is like FindOne, but returns an error rather than panicking if the
+// query cannot be evaluated.
+func (q *CompiledQuery) Query(top *Node) (node *Node, err error) {
+	defer recoverEval(q.String(), &err)
+	return QuerySelector(top, q.expr), nil
+}
+
+// Each calls `fn` for each node under `top` that matches the query, in
+// document order, without collecting the matches into a slice first. It
+// panics if the query cannot be evaluated.
+func (q *CompiledQuery) Each(top *Node, fn func(int, *Node)) {
+	t := q.expr.Select(CreateXPathNavigator(top))
+	for i := 0; t.MoveNext(); i++ {
+		fn(i, getCurrentNode(t))
+	}
+}
+
+// NodeNavigator is an xpath.NodeNavigator over a tree of Nodes.
 type NodeNavigator struct {
 	root, curr *Node
 	attr       int
 }
 
+// Current returns the node the navigator is positioned on. When the
+// navigator is on an attribute, Current returns the element owning it.
 func (x *NodeNavigator) Current() *Node {
 	return x.curr
 }
 
+// CurrentAttr returns the attribute the navigator is positioned on, or nil
+// if the navigator is not on an attribute. The returned pointer refers to
+// the element's Attr slice, so changes through it are visible in the tree.
+func (x *NodeNavigator) CurrentAttr() *Attr {
+	if x.attr == -1 {
+		return nil
+	}
+	return &x.curr.Attr[x.attr]
+}
+
+// AttrIndex returns the index of the current attribute in Current().Attr, or
+// -1 if the navigator is not on an attribute.
+func (x *NodeNavigator) AttrIndex() int {
+	return x.attr
+}
+
+// ChildIndex returns the zero-based position of the current node among all
+// the children of its parent, or -1 if the node has no parent.
+func (x *NodeNavigator) ChildIndex() int {
+	if x.curr.Parent == nil {
+		return -1
+	}
+	i := 0
+	for n := x.curr.PrevSibling; n != nil; n = n.PrevSibling {
+		i++
+	}
+	return i
+}
+
 func (x *NodeNavigator) NodeType() xpath.NodeType {
 	switch x.curr.Type {
 	case CommentNode:
 		return xpath.CommentNode
 	case TextNode, CharDataNode, NotationNode:
 		return xpath.TextNode
-	case DeclarationNode, DocumentNode:
+	case DeclarationNode, DocumentNode, FragmentNode:
 		return xpath.RootNode
 	case ElementNode:
 		if x.attr != -1 {
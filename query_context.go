@@ -0,0 +1,102 @@
+package xmlquery
+
+import (
+	"context"
+
+	"github.com/antchfx/xpath"
+)
+
+// contextCheckInterval is the number of navigator moves between two checks
+// of the context.
+const contextCheckInterval = 256
+
+// contextNavigator is a NodeNavigator that stops moving once its context is
+// done, which makes the evaluation of an expression end early.
+type contextNavigator struct {
+	*NodeNavigator
+	state *contextState
+}
+
+// contextState is shared by a navigator and its copies.
+type contextState struct {
+	ctx   context.Context
+	moves int
+	err   error
+}
+
+func (s *contextState) done() bool {
+	if s.err != nil {
+		return true
+	}
+	s.moves++
+	if s.moves%contextCheckInterval == 0 {
+		s.err = s.ctx.Err()
+	}
+	return s.err != nil
+}
+
+func (x *contextNavigator) Copy() xpath.NodeNavigator {
+	return &contextNavigator{NodeNavigator: x.NodeNavigator.Copy().(*NodeNavigator), state: x.state}
+}
+
+func (x *contextNavigator) MoveTo(other xpath.NodeNavigator) bool {
+	if node, ok := other.(*contextNavigator); ok {
+		other = node.NodeNavigator
+	}
+	return x.NodeNavigator.MoveTo(other)
+}
+
+func (x *contextNavigator) MoveToNextAttribute() bool {
+	return !x.state.done() && x.NodeNavigator.MoveToNextAttribute()
+}
+
+func (x *contextNavigator) MoveToChild() bool {
+	return !x.state.done() && x.NodeNavigator.MoveToChild()
+}
+
+func (x *contextNavigator) MoveToFirst() bool {
+	return !x.state.done() && x.NodeNavigator.MoveToFirst()
+}
+
+func (x *contextNavigator) MoveToNext() bool {
+	return !x.state.done() && x.NodeNavigator.MoveToNext()
+}
+
+func (x *contextNavigator) MoveToPrevious() bool {
+	return !x.state.done() && x.NodeNavigator.MoveToPrevious()
+}
+
+// QueryAllContext is like QueryAll, but aborts the evaluation once ctx is
+// done, in which case it returns the context's error. The context is checked
+// periodically while the tree is walked, so that runaway expressions over
+// large documents can be stopped.
+func QueryAllContext(ctx context.Context, top *Node, expr string) (list []*Node, err error) {
+	if done := startQuery(expr); done != nil {
+		defer func() { done(len(list), err) }()
+	}
+	defer recoverEval(expr, &err)
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	state := &contextState{ctx: ctx}
+	t := exp.Select(&contextNavigator{NodeNavigator: CreateXPathNavigator(top), state: state})
+	var elems []*Node
+	for t.MoveNext() {
+		if state.err != nil {
+			break
+		}
+		nav := t.Current().(*contextNavigator)
+		elems = append(elems, navigatorNode(nav.NodeNavigator))
+	}
+	if state.err == nil {
+		state.err = ctx.Err()
+	}
+	if state.err != nil {
+		return nil, state.err
+	}
+	return elems, nil
+}
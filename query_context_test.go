@@ -0,0 +1,49 @@
+package xmlquery
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryAllContext(t *testing.T) {
+	for _, expr := range []string{"//book", "//book/@id", "//book[price > 10]/title", "//title | //price", "count(//book)", "//book[last()]"} {
+		expected := Find(doc, expr)
+		nodes, err := QueryAllContext(context.Background(), doc, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != len(expected) {
+			t.Fatalf("%s: expected %d nodes but got %d", expr, len(expected), len(nodes))
+		}
+		for i := range nodes {
+			if nodes[i].OutputXML(true) != expected[i].OutputXML(true) {
+				t.Errorf("%s: node %d differs", expr, i)
+			}
+		}
+	}
+	if _, err := QueryAllContext(context.Background(), doc, "//a[@a==1]"); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+}
+
+func TestQueryAllContext_Deadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := QueryAllContext(ctx, doc, "//book"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+
+	doc := loadXML("<r>" + strings.Repeat("<a><b><c/></b></a>", 2000) + "</r>")
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := QueryAllContext(ctx, doc, "//a//b//c[count(//a//b//c) > 0]")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded but got %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("expected the query to stop soon after the deadline, took %v", d)
+	}
+}
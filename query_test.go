@@ -2,6 +2,7 @@ package xmlquery
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -170,3 +171,266 @@ func TestMissingTextNodes(t *testing.T) {
         t.Fatalf("Expected text nodes 3, got %d", len(results))
     }
 }
+
+func TestCompile(t *testing.T) {
+	q, err := Compile("//book[genre='Fantasy']")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := q.FindAll(doc); len(list) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(list))
+	}
+	if n := q.FindOne(doc); n == nil || n.SelectAttr("id") != "bk102" {
+		t.Fatalf("expected book bk102, got %v", n)
+	}
+	var ids []string
+	q.Each(doc, func(i int, n *Node) {
+		ids = append(ids, n.SelectAttr("id"))
+	})
+	if fmt.Sprint(ids) != "[bk102 bk103]" {
+		t.Fatalf("expected [bk102 bk103], got %v", ids)
+	}
+	if q.String() != "//book[genre='Fantasy']" {
+		t.Fatalf("unexpected expression %q", q.String())
+	}
+	if _, err := Compile("//a[@a==1]"); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+}
+
+func TestMustCompilePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected MustCompile to panic")
+		}
+	}()
+	MustCompile("//a[@a==1]")
+}
+
+func TestXPathMatchesFunction(t *testing.T) {
+	list := Find(doc, `//book[matches(title, '^M\w+ ')]`)
+	if len(list) != 2 {
+		t.Fatalf("expected 2 books, got %d", len(list))
+	}
+	if _, err := QueryAll(doc, `//book[matches(title, '(')]`); err == nil {
+		t.Fatal("expected an invalid pattern error but nil")
+	}
+}
+
+func TestNavigatorCurrent(t *testing.T) {
+	doc := loadXML(`<a><b/><c id="1" name="x"/></a>`)
+	nav := CreateXPathNavigator(doc)
+	if nav.ChildIndex() != -1 {
+		t.Fatalf("expected -1 for root, got %d", nav.ChildIndex())
+	}
+	nav.MoveToChild() // xml declaration
+	nav.MoveToNext()  // a
+	nav.MoveToChild() // b
+	nav.MoveToNext()  // c
+	if nav.Current().Data != "c" {
+		t.Fatalf("expected current node c, got %s", nav.Current().Data)
+	}
+	if nav.ChildIndex() != 1 {
+		t.Fatalf("expected child index 1, got %d", nav.ChildIndex())
+	}
+	if nav.CurrentAttr() != nil || nav.AttrIndex() != -1 {
+		t.Fatal("expected no current attribute")
+	}
+	nav.MoveToNextAttribute()
+	nav.MoveToNextAttribute()
+	attr := nav.CurrentAttr()
+	if attr == nil || attr.Name.Local != "name" || nav.AttrIndex() != 1 {
+		t.Fatalf("expected attribute name, got %v", attr)
+	}
+	attr.Value = "y"
+	if v := nav.Current().SelectAttr("name"); v != "y" {
+		t.Fatalf("expected attribute change to be visible, got %s", v)
+	}
+}
+
+func TestLookupHelpers(t *testing.T) {
+	def := &Node{Type: ElementNode, Data: "default"}
+	testValue(t, FindOneOr(doc, "//book[@id='bk102']", def).SelectAttr("id"), "bk102")
+	testValue(t, FindOneOr(doc, "//book[@id='none']", def), def)
+	testValue(t, ValueOf(doc, "//book[@id='bk103']/title", "n/a"), "Maeve Ascendant")
+	testValue(t, ValueOf(doc, "//book[@id='bk103']/@id", "n/a"), "bk103")
+	testValue(t, ValueOf(doc, "//book[@id='none']/title", "n/a"), "n/a")
+	testValue(t, MustFindOne(doc, "//book[1]").SelectAttr("id"), "bk101")
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "//magazine") {
+			t.Fatalf("expected a panic naming the expression, got %v", r)
+		}
+	}()
+	MustFindOne(doc, "//magazine")
+}
+
+func TestExists(t *testing.T) {
+	ok, err := Exists(doc, "//book[genre='Fantasy']")
+	if err != nil || !ok {
+		t.Fatalf("expected a match, got %v, %v", ok, err)
+	}
+	ok, err = Exists(doc, "//error")
+	if err != nil || ok {
+		t.Fatalf("expected no match, got %v, %v", ok, err)
+	}
+	if _, err = Exists(doc, "//a[@a==1]"); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+}
+
+func TestCount(t *testing.T) {
+	n, err := Count(doc, "//book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, n, 3)
+	n, err = Count(doc, "//book[price < 10]/@id | //magazine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, n, 2)
+	if _, err = Count(doc, "//a[@a==1]"); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+	for _, expr := range []string{"1", "count(//book)", "string(//book)"} {
+		if _, err = Count(doc, expr); err == nil {
+			t.Fatalf("%s: expected an error but nil", expr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	book := FindOne(doc, "//book[genre='Fantasy']")
+	for expr, expected := range map[string]bool{
+		"//book":                   true,
+		"book":                     false,
+		"/*/book[genre='Fantasy']": true,
+		"//book[genre='Computer']": false,
+		"//book/@id":               false,
+	} {
+		ok, err := Matches(book, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("%s: expected %v but got %v", expr, expected, ok)
+		}
+	}
+	id := FindOne(book, "@id")
+	if ok, _ := Matches(id, "//book/@id"); !ok {
+		t.Error("expected the attribute to match //book/@id")
+	}
+	if ok, _ := Matches(id, "//book"); ok {
+		t.Error("expected the attribute not to match //book")
+	}
+	if _, err := Matches(book, "//a[@a==1]"); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+}
+
+func TestXPath2Functions(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<books><book><title>Midnight RAIN</title><author>Ralls</author></book><book><title>Maeve</title><author>Corets</author></book></books>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := FindOne(doc, `//book[ends-with(lower-case(title), 'rain')]`); n == nil || n.SelectElement("author").InnerText() != "Ralls" {
+		t.Fatal("lower-case and ends-with not supported")
+	}
+	if n := FindOne(doc, `//book[matches(title, '^Mae')]`); n == nil {
+		t.Fatal("matches not supported")
+	}
+	if n := FindOne(doc, `//book[replace(author, 'R', 'H') = 'Halls']`); n == nil {
+		t.Fatal("replace not supported")
+	}
+	expr, err := getQuery(`string-join(//book/author, ', ')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Evaluate(CreateXPathNavigator(doc)); got != "Ralls, Corets" {
+		t.Fatalf("string-join: got %v", got)
+	}
+}
+
+func TestCompareISODates(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<records><record id="1" updated="2024-02-28T23:59:59Z"/><record id="2" updated="2024-03-01T12:00:01Z"/><record id="3" updated="2025-01-01T00:00:00Z"/></records>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := Find(doc, `//record[number(translate(substring(@updated, 1, 19), '-:T', '')) > 20240301120000]`)
+	if len(list) != 2 || list[0].SelectAttr("id") != "2" || list[1].SelectAttr("id") != "3" {
+		t.Fatalf("unexpected records %v", list)
+	}
+}
+
+func TestFindEachErr(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<a><b>1</b><b>x</b><b>3</b></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	err = FindEachErr(doc, "//b", func(i int, n *Node) error {
+		seen = append(seen, n.InnerText())
+		if _, err := strconv.Atoi(n.InnerText()); err != nil {
+			return fmt.Errorf("b #%d: %v", i, err)
+		}
+		return nil
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "b #1: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("iteration did not stop at the error: %v", seen)
+	}
+	if err := FindEachErr(doc, "//b[", func(int, *Node) error { return nil }); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	var matches []Match
+	err = FindEachMatch(doc, "//b", func(m Match) error {
+		matches = append(matches, m)
+		return nil
+	})
+	if err != nil || len(matches) != 3 {
+		t.Fatalf("got %d matches, %v", len(matches), err)
+	}
+	for i, m := range matches {
+		if m.Index != i || m.Total != 3 || m.Node.Data != "b" {
+			t.Errorf("unexpected match %+v", m)
+		}
+	}
+}
+
+func TestQueryEvaluationError(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<a><b>1</b></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr := "//b[matches(., '(')]"
+	if _, err := QueryAll(doc, expr); err == nil {
+		t.Error("QueryAll: expected an evaluation error")
+	}
+	if _, err := Query(doc, expr); err == nil {
+		t.Error("Query: expected an evaluation error")
+	}
+	if _, err := Exists(doc, expr); err == nil {
+		t.Error("Exists: expected an evaluation error")
+	}
+	if err := FindEachErr(doc, expr, func(int, *Node) error { return nil }); err == nil {
+		t.Error("FindEachErr: expected an evaluation error")
+	}
+	q := MustCompile("//b[matches(., concat('(', .))]")
+	if _, err := q.QueryAll(doc); err == nil {
+		t.Error("CompiledQuery.QueryAll: expected an evaluation error")
+	}
+	if _, err := q.Query(doc); err == nil {
+		t.Error("CompiledQuery.Query: expected an evaluation error")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Find: expected a panic")
+		}
+	}()
+	Find(doc, expr)
+}
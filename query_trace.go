@@ -0,0 +1,242 @@
+package xmlquery
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/antchfx/xpath"
+)
+
+// traceCounts counts the moves of a tracingNavigator and its copies, by
+// axis.
+type traceCounts struct {
+	child, sibling, parent, attribute, root int
+}
+
+func (c *traceCounts) total() int {
+	return c.child + c.sibling + c.parent + c.attribute + c.root
+}
+
+// tracingNavigator is a NodeNavigator counting the moves made by the
+// evaluation of an expression.
+type tracingNavigator struct {
+	*NodeNavigator
+	counts *traceCounts
+}
+
+func (x *tracingNavigator) Copy() xpath.NodeNavigator {
+	return &tracingNavigator{NodeNavigator: x.NodeNavigator.Copy().(*NodeNavigator), counts: x.counts}
+}
+
+func (x *tracingNavigator) MoveTo(other xpath.NodeNavigator) bool {
+	if node, ok := other.(*tracingNavigator); ok {
+		other = node.NodeNavigator
+	}
+	return x.NodeNavigator.MoveTo(other)
+}
+
+func (x *tracingNavigator) MoveToRoot() {
+	x.counts.root++
+	x.NodeNavigator.MoveToRoot()
+}
+
+func (x *tracingNavigator) MoveToParent() bool {
+	x.counts.parent++
+	return x.NodeNavigator.MoveToParent()
+}
+
+func (x *tracingNavigator) MoveToNextAttribute() bool {
+	x.counts.attribute++
+	return x.NodeNavigator.MoveToNextAttribute()
+}
+
+func (x *tracingNavigator) MoveToChild() bool {
+	x.counts.child++
+	return x.NodeNavigator.MoveToChild()
+}
+
+func (x *tracingNavigator) MoveToFirst() bool {
+	x.counts.sibling++
+	return x.NodeNavigator.MoveToFirst()
+}
+
+func (x *tracingNavigator) MoveToNext() bool {
+	x.counts.sibling++
+	return x.NodeNavigator.MoveToNext()
+}
+
+func (x *tracingNavigator) MoveToPrevious() bool {
+	x.counts.sibling++
+	return x.NodeNavigator.MoveToPrevious()
+}
+
+// traceSelect evaluates exp from top and returns the selected nodes and the
+// moves made, or an error if exp cannot be evaluated.
+func traceSelect(top *Node, exp *xpath.Expr) (elems []*Node, counts *traceCounts, err error) {
+	defer recoverEval(exp.String(), &err)
+	counts = &traceCounts{}
+	t := exp.Select(&tracingNavigator{NodeNavigator: CreateXPathNavigator(top), counts: counts})
+	for t.MoveNext() {
+		nav := t.Current().(*tracingNavigator)
+		elems = append(elems, navigatorNode(nav.NodeNavigator))
+	}
+	return elems, counts, nil
+}
+
+// QueryTrace is like QueryAll, but also writes to w an account of the
+// evaluation, to help finding out why an expression does not select the
+// expected nodes. For a location path, every step is evaluated on its own,
+// and then again with each of its predicates, showing the number of nodes
+// selected so far and the number of navigator moves it took:
+//
+//	/library                   1 node     4 moves
+//	/library/book              3 nodes   12 moves
+//	/library/book[@lang='en']  0 nodes   18 moves   predicate removed 3
+//
+// The trace ends with the moves made by the full expression, by axis. If a
+// step cannot be evaluated, the trace ends with it and its error, which is
+// returned.
+func QueryTrace(top *Node, expr string, w io.Writer) ([]*Node, error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	type line struct {
+		expr    string
+		nodes   int
+		moves   int
+		removed int
+		err     error
+	}
+	var lines []line
+	prefix, prev := "", -1
+	var stepErr error
+	for _, step := range splitXPathSteps(expr) {
+		if stepErr != nil {
+			break
+		}
+		parts := splitXPathPredicates(step)
+		for i := range parts {
+			prefix += parts[i]
+			e, err := xpath.Compile(prefix)
+			if err != nil {
+				// Not a prefix that can be evaluated on its own.
+				continue
+			}
+			list, counts, err := traceSelect(top, e)
+			if err != nil {
+				lines = append(lines, line{expr: prefix, err: err})
+				stepErr = err
+				break
+			}
+			l := line{expr: prefix, nodes: len(list), moves: counts.total(), removed: -1}
+			if i > 0 && prev >= 0 {
+				l.removed = prev - len(list)
+			}
+			lines = append(lines, l)
+			prev = len(list)
+		}
+	}
+	width := 0
+	for _, l := range lines {
+		if len(l.expr) > width {
+			width = len(l.expr)
+		}
+	}
+	for _, l := range lines {
+		if l.err != nil {
+			fmt.Fprintf(w, "%-*s  error: %v\n", width, l.expr, l.err)
+			continue
+		}
+		fmt.Fprintf(w, "%-*s  %s  %5d moves", width, l.expr, plural(l.nodes, "node"), l.moves)
+		if l.removed >= 0 {
+			fmt.Fprintf(w, "   predicate removed %d", l.removed)
+		}
+		fmt.Fprintln(w)
+	}
+	if stepErr != nil {
+		return nil, stepErr
+	}
+	elems, counts, err := traceSelect(top, exp)
+	if err != nil {
+		fmt.Fprintf(w, "result: error: %v\n", err)
+		return nil, err
+	}
+	fmt.Fprintf(w, "result: %s, %d moves (child %d, sibling %d, parent %d, attribute %d, root %d)\n",
+		plural(len(elems), "node"), counts.total(),
+		counts.child, counts.sibling, counts.parent, counts.attribute, counts.root)
+	return elems, nil
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%5d %s ", n, noun)
+	}
+	return fmt.Sprintf("%5d %ss", n, noun)
+}
+
+// splitXPathSteps splits a location path into its steps, each with its
+// leading separator. Separators within predicates, parentheses and string
+// literals are ignored. An expression that is not a plain location path,
+// such as a union, is returned as a single step.
+func splitXPathSteps(expr string) []string {
+	var steps []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 0 && c == '|':
+			return []string{expr}
+		case depth == 0 && c == '/':
+			if i > start && expr[i-1] != '/' {
+				steps = append(steps, expr[start:i])
+				start = i
+			}
+		}
+	}
+	return append(steps, expr[start:])
+}
+
+// splitXPathPredicates splits a step into its node test and its
+// predicates.
+func splitXPathPredicates(step string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(step); i++ {
+		c := step[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '[':
+			if depth == 0 {
+				parts = append(parts, step[start:i])
+				start = i
+			}
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	parts = append(parts, step[start:])
+	return parts
+}
@@ -0,0 +1,74 @@
+package xmlquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryTrace(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<library><book lang="fr">A</book><book lang="de">B</book><book>C</book></library>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	list, err := QueryTrace(doc, "/library/book[@lang][@lang='en']", &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("got %d nodes", len(list))
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("unexpected trace:\n%s", b.String())
+	}
+	for i, want := range []string{
+		"/library ", "/library/book ", "/library/book[@lang] ", "/library/book[@lang][@lang='en'] ", "result:",
+	} {
+		if !strings.HasPrefix(lines[i], want) {
+			t.Errorf("line %d: %q does not start with %q", i, lines[i], want)
+		}
+	}
+	if !strings.Contains(lines[2], "2 nodes") || !strings.Contains(lines[2], "predicate removed 1") {
+		t.Errorf("unexpected line %q", lines[2])
+	}
+	if !strings.Contains(lines[3], "0 nodes") || !strings.Contains(lines[3], "predicate removed 2") {
+		t.Errorf("unexpected line %q", lines[3])
+	}
+
+	b.Reset()
+	list, err = QueryTrace(doc, "//book | /library", &b)
+	if err != nil || len(list) != 4 {
+		t.Fatalf("got %d nodes, err %v", len(list), err)
+	}
+	if _, err := QueryTrace(doc, "//book[", &b); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+
+	b.Reset()
+	if _, err := QueryTrace(doc, "/library/book[matches(., concat('(', .))]/@lang", &b); err == nil {
+		t.Fatal("expected an evaluation error")
+	}
+	lines = strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], "/library/book[matches(., concat('(', .))] ") || !strings.Contains(lines[2], "error:") {
+		t.Fatalf("unexpected trace:\n%s", b.String())
+	}
+}
+
+func TestSplitXPathSteps(t *testing.T) {
+	for expr, want := range map[string][]string{
+		"/a/b":            {"/a", "/b"},
+		"//a[b/c='/']//d": {"//a[b/c='/']", "//d"},
+		"a/b[f(1, '/')]":  {"a", "/b[f(1, '/')]"},
+		"/a | /b":         {"/a | /b"},
+		"count(/a/b)":     {"count(/a/b)"},
+	} {
+		if got := splitXPathSteps(expr); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", expr, got, want)
+		}
+	}
+	if got := splitXPathPredicates("b[@x][c[1]]"); !reflect.DeepEqual(got, []string{"b", "[@x]", "[c[1]]"}) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,44 @@
+package xmlquery
+
+import "math"
+
+// rawText is the source text of a text node, as written in the input.
+type rawText struct {
+	data string // the Data the text was decoded to
+	text string
+}
+
+// RawText returns the source text of the text node n, with its entity and
+// character references and line endings as written, and whether it is
+// known: it is recorded when parsing with ParserOptions.PreserveRawText,
+// and no longer known once Data is changed. OutputXML writes the source
+// text of the text nodes for which it is known, applying the
+// ControlCharPolicy to it as to Data.
+func (n *Node) RawText() (string, bool) {
+	if n.raw == nil || n.raw.data != n.Data {
+		return "", false
+	}
+	return n.raw.text, true
+}
+
+// preserveRawText makes the token cache hold whole tokens, so that the
+// source text of text nodes is not truncated.
+func (p *parser) preserveRawText() {
+	p.rawText = true
+	p.reader.SetCapacity(math.MaxInt32)
+}
+
+// newRawText returns the source text raw of a text node decoded to data,
+// read from start to end, or nil unless it is recorded in full.
+func (p *parser) newRawText(data string, raw []byte, start, end int64) *rawText {
+	if !p.rawText || p.reader.Truncated() || int64(len(raw)) != end-start {
+		return nil
+	}
+	text := string(raw)
+	if p.xml11 && restoreControls(text) != text {
+		// The references to control characters were rewritten, see
+		// xml11Reader, so the source text is not known.
+		return nil
+	}
+	return &rawText{data: data, text: text}
+}
@@ -0,0 +1,56 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreserveRawText(t *testing.T) {
+	long := strings.Repeat("&amp;#48;", 1000)
+	s := `<a>1 &lt; 2 &amp;#48; &#x41;<b>` + long + `</b><![CDATA[&c]]></a>`
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{PreserveRawText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := FindOne(doc, "/a")
+	text := a.FirstChild
+	testValue(t, text.Data, "1 < 2 &#48; A")
+	if raw, ok := text.RawText(); !ok || raw != "1 &lt; 2 &amp;#48; &#x41;" {
+		t.Fatalf("got raw text %q, %v", raw, ok)
+	}
+	if raw, _ := FindOne(a, "b").FirstChild.RawText(); raw != long {
+		t.Fatalf("the raw text of a long text node was truncated to %d bytes", len(raw))
+	}
+	testValue(t, a.OutputXML(true), s)
+
+	text.Data = "changed"
+	if _, ok := text.RawText(); ok {
+		t.Fatal("the raw text of changed data is still known")
+	}
+	testValue(t, text.OutputXML(true), "changed")
+
+	doc = loadXML(`<a>&amp;#48;</a>`)
+	if _, ok := FindOne(doc, "/a").FirstChild.RawText(); ok {
+		t.Fatal("the raw text is recorded by default")
+	}
+}
+
+func TestPreserveRawTextControlChars(t *testing.T) {
+	doc, err := ParseWithOptions(strings.NewReader(`<a>x &amp; y</a>`), ParserOptions{PreserveRawText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := FindOne(doc, "/a")
+	// The parser rejects literal control characters, so the source text
+	// holding one is set here.
+	text := a.FirstChild
+	text.Data = "x & \x01y"
+	text.raw = &rawText{data: text.Data, text: "x &amp; \x01y"}
+	testValue(t, a.OutputXML(true), "<a>x &amp; \x01y</a>")
+	testValue(t, a.OutputXMLWithOptions(WithOutputSelf(), WithControlCharPolicy(ControlCharStrip)), `<a>x &amp; y</a>`)
+	testValue(t, a.OutputXMLWithOptions(WithOutputSelf(), WithControlCharPolicy(ControlCharEscape)), `<a>x &amp; &#x1;y</a>`)
+	var b strings.Builder
+	if err := a.WriteChecked(&b, WithOutputSelf(), WithControlCharPolicy(ControlCharError)); err == nil {
+		t.Fatal("expected a control character error but nil")
+	}
+}
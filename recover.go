@@ -0,0 +1,134 @@
+package xmlquery
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseWarning describes a malformation repaired while parsing with
+// ParserOptions.Recover.
+type ParseWarning struct {
+	// Line is the line, counted from 1, and Offset the byte offset in the
+	// input of the token where the malformation was found.
+	Line   int
+	Offset int64
+	// Message describes the malformation and how it was repaired.
+	Message string
+}
+
+func (w ParseWarning) String() string {
+	return fmt.Sprintf("%d: %s", w.Line, w.Message)
+}
+
+// ParseWithWarnings is like ParseWithOptions, but with options.Recover set,
+// and also returns the malformations repaired in the document, in input
+// order.
+func ParseWithWarnings(r io.Reader, options ParserOptions) (*Node, []ParseWarning, error) {
+	if !options.DisableDecompression {
+		var err error
+		if r, err = decompress(r); err != nil {
+			return nil, nil, err
+		}
+	}
+	options.Recover = true
+	p := createParser(r, options.BufferSize)
+	options.apply(p)
+	for {
+		_, err := p.parse()
+		if err == io.EOF {
+			return p.doc, p.warnings, nil
+		}
+		if err != nil {
+			return nil, p.warnings, p.sourceError(err)
+		}
+	}
+}
+
+// warn records a warning about the token starting at pos.
+func (p *parser) warn(pos Position, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, ParseWarning{Line: pos.Line, Offset: pos.Offset, Message: fmt.Sprintf(format, args...)})
+}
+
+// recoverError reports whether err, returned by the decoder for the token
+// starting at pos, ends a malformed document that can be repaired by
+// closing the elements left open. The warnings are recorded if so.
+func (p *parser) recoverError(err error, pos Position) bool {
+	syntaxErr, ok := err.(*xml.SyntaxError)
+	if !ok {
+		return false
+	}
+	switch {
+	case syntaxErr.Msg == "unexpected EOF":
+		for n := p.prev; n != nil; n = n.Parent {
+			if n.Type == ElementNode && n.level < p.level {
+				p.warn(pos, "element <%s> not closed at end of input", n.qualifiedName())
+			}
+		}
+	case strings.HasPrefix(syntaxErr.Msg, "unexpected end element"):
+		// In non-strict mode, the decoder has closed the open elements
+		// before failing on the end tag.
+		p.warn(pos, "%s matches no open element, rest of input ignored", strings.TrimPrefix(syntaxErr.Msg, "unexpected end element "))
+	default:
+		return false
+	}
+	return true
+}
+
+// checkEndTag warns if the end tag tok, whose raw text is raw, was closed
+// by the decoder for an end tag of another name. The end tag that follows
+// such an implicit close has no raw text.
+func (p *parser) checkEndTag(tok xml.EndElement, raw []byte, pos Position) {
+	name := bytes.TrimPrefix(raw, []byte("</"))
+	if len(name) == len(raw) {
+		return
+	}
+	if i := bytes.IndexAny(name, " \t\r\n>"); i >= 0 {
+		name = name[:i]
+	}
+	local := name
+	if i := bytes.IndexByte(local, ':'); i >= 0 {
+		local = local[i+1:]
+	}
+	if string(local) != tok.Name.Local {
+		p.warn(pos, "element <%s> closed by </%s>", tok.Name.Local, name)
+	}
+}
+
+// checkReferences warns about the ampersands of the raw text of a token
+// that do not start a character reference or a reference to a known
+// entity. In non-strict mode, the decoder keeps them as written.
+func (p *parser) checkReferences(raw []byte, pos Position) {
+	if p.reader.IsCDATA(pos.Offset) {
+		return
+	}
+	for i := bytes.IndexByte(raw, '&'); i >= 0; i = bytes.IndexByte(raw, '&') {
+		raw = raw[i+1:]
+		end := bytes.IndexAny(raw, "; \t\r\n<&\"'")
+		switch {
+		case end < 0 || raw[end] != ';':
+			p.warn(pos, "stray & kept as text")
+		case !p.knownReference(string(raw[:end])):
+			p.warn(pos, "undeclared entity &%s; kept as text", raw[:end])
+		}
+	}
+}
+
+// knownReference reports whether &ref; is a character reference or a
+// reference to a predefined or declared entity.
+func (p *parser) knownReference(ref string) bool {
+	if strings.HasPrefix(ref, "#x") {
+		return len(ref) > 2 && strings.Trim(ref[2:], "0123456789abcdefABCDEF") == ""
+	}
+	if strings.HasPrefix(ref, "#") {
+		return len(ref) > 1 && strings.Trim(ref[1:], "0123456789") == ""
+	}
+	switch ref {
+	case "lt", "gt", "amp", "apos", "quot":
+		return true
+	}
+	_, ok := p.decoder.Entity[ref]
+	return ok
+}
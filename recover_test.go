@@ -0,0 +1,66 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWithWarnings(t *testing.T) {
+	tests := []struct {
+		s, out   string
+		warnings []string
+	}{
+		{`<a><b>x`, `<a><b>x</b></a>`, []string{
+			"element <b> not closed at end of input",
+			"element <a> not closed at end of input",
+		}},
+		{`<a>1 & 2 &foo; &amp; &#48;<b x="a&b"/></a>`, `<a>1 &amp; 2 &amp;foo; &amp; 0<b x="a&amp;b"></b></a>`, []string{
+			"stray & kept as text",
+			"undeclared entity &foo; kept as text",
+			"stray & kept as text",
+		}},
+		{`<a><b><c></b>t</a>`, `<a><b><c></c></b>t</a>`, []string{
+			"element <c> closed by </b>",
+		}},
+		{`<r><a></x></r>`, `<r><a></a></r>`, []string{
+			"element <a> closed by </x>",
+			"</x> matches no open element, rest of input ignored",
+		}},
+		{`<a><![CDATA[&]]></a>`, `<a><![CDATA[&]]></a>`, nil},
+	}
+	for _, test := range tests {
+		doc, warnings, err := ParseWithWarnings(strings.NewReader(test.s), ParserOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+		testValue(t, doc.SelectElement("*").OutputXML(true), test.out)
+		if len(warnings) != len(test.warnings) {
+			t.Errorf("%s: got warnings %v", test.s, warnings)
+			continue
+		}
+		for i, w := range warnings {
+			testValue(t, w.Message, test.warnings[i])
+		}
+	}
+
+	_, warnings, err := ParseWithWarnings(strings.NewReader("<a>\n<b>\n</a>"), ParserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Line != 3 || warnings[0].Offset != 8 {
+		t.Fatalf("got warnings %+v", warnings)
+	}
+}
+
+func TestParseRecover(t *testing.T) {
+	s := `<a><b>x`
+	if _, err := Parse(strings.NewReader(s)); err == nil {
+		t.Fatal("expected an error")
+	}
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{Recover: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "/a/b").InnerText(), "x")
+}
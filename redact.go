@@ -0,0 +1,129 @@
+package xmlquery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactionStrategy specifies how Redact scrubs a matched node.
+type RedactionStrategy int
+
+const (
+	// RedactDrop removes the matched element, attribute or text.
+	RedactDrop RedactionStrategy = iota
+	// RedactReplace replaces the value with RedactionRule.Replacement.
+	RedactReplace
+	// RedactHash replaces the value with its hex-encoded SHA-256 digest, so
+	// equal values can still be correlated.
+	RedactHash
+	// RedactKeepLength replaces every character of the value with the first
+	// character of RedactionRule.Replacement, or '*' if it is empty.
+	RedactKeepLength
+)
+
+// RedactionRule pairs an XPath expression with the strategy used to scrub
+// the nodes it selects.
+type RedactionRule struct {
+	XPath       string
+	Strategy    RedactionStrategy
+	Replacement string
+}
+
+type redactTarget struct {
+	node *Node
+	attr *xml.Name // nil unless the target is an attribute of node
+	rule *RedactionRule
+}
+
+// Redact scrubs the nodes of doc selected by each rule. Rules are applied in
+// order, all matches of a rule being collected before any of them is
+// modified. The value of a matched element is its text content, which is
+// replaced by a single text node. Redact returns an error if an expression
+// cannot be parsed, in which case doc is left unchanged.
+func Redact(doc *Node, rules []RedactionRule) error {
+	for i := range rules {
+		if _, err := getQuery(rules[i].XPath); err != nil {
+			return err
+		}
+	}
+	for i := range rules {
+		rule := &rules[i]
+		expr, _ := getQuery(rule.XPath)
+		var targets []redactTarget
+		t := expr.Select(CreateXPathNavigator(doc))
+		for t.MoveNext() {
+			nav := t.Current().(*NodeNavigator)
+			target := redactTarget{node: nav.Current(), rule: rule}
+			if attr := nav.CurrentAttr(); attr != nil {
+				name := attr.Name
+				target.attr = &name
+			}
+			targets = append(targets, target)
+		}
+		for _, target := range targets {
+			target.apply()
+		}
+	}
+	return nil
+}
+
+func (t redactTarget) apply() {
+	n := t.node
+	if t.attr != nil {
+		for i, attr := range n.Attr {
+			if attr.Name != *t.attr {
+				continue
+			}
+			touch(n)
+			if t.rule.Strategy == RedactDrop {
+				n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+			} else {
+				n.Attr[i].Value = t.rule.redact(attr.Value)
+			}
+			return
+		}
+		return
+	}
+	switch n.Type {
+	case DocumentNode, FragmentNode:
+		return
+	case ElementNode:
+		if t.rule.Strategy == RedactDrop {
+			RemoveFromTree(n)
+			return
+		}
+		value := t.rule.redact(n.InnerText())
+		for n.FirstChild != nil {
+			RemoveFromTree(n.FirstChild)
+		}
+		AddChild(n, &Node{Type: TextNode, Data: value, level: n.level + 1})
+	default:
+		if t.rule.Strategy == RedactDrop {
+			RemoveFromTree(n)
+			return
+		}
+		n.Data = t.rule.redact(n.Data)
+		touch(n)
+	}
+}
+
+func (r *RedactionRule) redact(s string) string {
+	switch r.Strategy {
+	case RedactReplace:
+		return r.Replacement
+	case RedactHash:
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	case RedactKeepLength:
+		mask := "*"
+		if r.Replacement != "" {
+			_, size := utf8.DecodeRuneInString(r.Replacement)
+			mask = r.Replacement[:size]
+		}
+		return strings.Repeat(mask, utf8.RuneCountInString(s))
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	doc := loadXML(`<users><user id="1" ssn="123-45"><name>Alice</name><email>a@x.io</email><card>4111</card><!-- internal --></user><user id="2" ssn="987-65"><name>Bob</name><email>b@x.io</email><card>5500</card></user></users>`)
+	err := Redact(doc, []RedactionRule{
+		{XPath: "//user/@ssn", Strategy: RedactDrop},
+		{XPath: "//comment()", Strategy: RedactDrop},
+		{XPath: "//name", Strategy: RedactReplace, Replacement: "[redacted]"},
+		{XPath: "//email", Strategy: RedactHash},
+		{XPath: "//card/text()", Strategy: RedactKeepLength, Replacement: "X"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := doc.OutputXML(false)
+	for _, s := range []string{"ssn", "internal", "Alice", "Bob", "a@x.io", "4111"} {
+		if strings.Contains(out, s) {
+			t.Fatalf("%q was not redacted: %s", s, out)
+		}
+	}
+	testValue(t, FindOne(doc, "//user[1]/name").InnerText(), "[redacted]")
+	testValue(t, FindOne(doc, "//user[2]/card").InnerText(), "XXXX")
+	testValue(t, len(FindOne(doc, "//user[1]/email").InnerText()), 64)
+	testAttr(t, FindOne(doc, "//user[2]"), "id", "2")
+}
+
+func TestRedactInvalidXPath(t *testing.T) {
+	doc := loadXML(`<a><b>secret</b></a>`)
+	err := Redact(doc, []RedactionRule{
+		{XPath: "//b", Strategy: RedactDrop},
+		{XPath: "//a[@a==1]", Strategy: RedactDrop},
+	})
+	if err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+	if FindOne(doc, "//b") == nil {
+		t.Fatal("document was modified despite the error")
+	}
+}
+
+func TestRedactIndexedAttributes(t *testing.T) {
+	doc := loadXML(`<users><user id="1"/><user id="2" ref="a"/></users>`)
+	EnableIndex(doc)
+	testValue(t, len(Find(doc, "//user[@id='2']")), 1)
+	err := Redact(doc, []RedactionRule{
+		{XPath: "//user/@id", Strategy: RedactReplace, Replacement: "x"},
+		{XPath: "//user/@ref", Strategy: RedactDrop},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, len(Find(doc, "//user[@id='2']")), 0)
+	testValue(t, len(Find(doc, "//user[@id='x']")), 2)
+	testValue(t, len(Find(doc, "//user[@ref]")), 0)
+}
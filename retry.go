@@ -0,0 +1,80 @@
+package xmlquery
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures how failed requests for documents are retried,
+// see WithRetry.
+type RetryPolicy struct {
+	// Attempts is the maximum number of requests, the first one included.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for each
+	// further retry up to MaxBackoff, if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter randomizes each delay by up to this fraction of it, for
+	// example 0.2 for ±20%, so clients do not retry in lockstep.
+	Jitter float64
+	// RetryStatus lists the HTTP status codes that are retried. If empty,
+	// 429, 502, 503 and 504 are.
+	RetryStatus []int
+}
+
+var defaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// WithRetry makes LoadURLWithOptions and CreateStreamParserFromURL retry
+// requests that fail with a transport error or a retryable status,
+// following policy. Only the requests are retried: once a document is
+// being parsed, errors reading the response body are returned.
+func WithRetry(policy RetryPolicy) URLOption {
+	return func(c *urlConfiguration) {
+		c.retry = policy
+	}
+}
+
+// do sends req with the client of c, retrying as configured. The response
+// of the last attempt is returned, whatever its status.
+func (c *urlConfiguration) do(req *http.Request) (*http.Response, error) {
+	delay := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.client.Do(req)
+		if attempt >= c.retry.Attempts || (err == nil && !c.retry.retryable(resp.StatusCode)) {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		time.Sleep(c.retry.jitter(delay))
+		if delay *= 2; c.retry.MaxBackoff > 0 && delay > c.retry.MaxBackoff {
+			delay = c.retry.MaxBackoff
+		}
+	}
+}
+
+func (p *RetryPolicy) retryable(status int) bool {
+	codes := p.RetryStatus
+	if len(codes) == 0 {
+		codes = defaultRetryStatus
+	}
+	for _, code := range codes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*p.Jitter*float64(d))
+}
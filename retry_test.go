@@ -0,0 +1,53 @@
+package xmlquery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadURLWithRetry(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<feed><item>a</item><item>b</item></feed>`))
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Jitter: 0.5}
+	doc, err := LoadURLWithOptions(server.URL, WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 || FindOne(doc, "//item") == nil {
+		t.Fatalf("unexpected result after %d requests", requests)
+	}
+
+	requests = 0
+	sp, err := CreateStreamParserFromURL(server.URL, "//item", WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	if n, err := sp.Read(); err != nil || n.InnerText() != "a" {
+		t.Fatalf("unexpected result %v, %v", n, err)
+	}
+
+	requests = 0
+	policy.Attempts = 2
+	if _, err := LoadURLWithOptions(server.URL, WithRetry(policy)); err == nil || requests != 2 {
+		t.Fatalf("expected an error after 2 requests, got %v after %d", err, requests)
+	}
+
+	requests = 0
+	policy.RetryStatus = []int{http.StatusTooManyRequests}
+	if _, err := LoadURLWithOptions(server.URL, WithRetry(policy)); err == nil || requests != 1 {
+		t.Fatalf("status 503 should not be retried, got %v after %d requests", err, requests)
+	}
+}
@@ -0,0 +1,67 @@
+package xmlquery
+
+import (
+	"fmt"
+	"io"
+)
+
+// LimitError is returned by parsing when one of the Limits of the
+// ParserOptions is exceeded.
+type LimitError struct {
+	// Limit is the name of the exceeded limit: MaxDepth, MaxNodes,
+	// MaxNodeBytes or MaxBytes.
+	Limit string
+	// Max is the value of the limit.
+	Max int64
+	// Offset is the byte offset in the input where the limit was exceeded.
+	Offset int64
+	// Element is, for MaxNodes and MaxNodeBytes, the qualified name of the
+	// target candidate a StreamParser was reading, or else of the element
+	// holding the node that exceeded the limit.
+	Element string
+}
+
+func (e *LimitError) Error() string {
+	if e.Element != "" {
+		return fmt.Sprintf("xmlquery: limit %s of %d exceeded in element %s at offset %d", e.Limit, e.Max, e.Element, e.Offset)
+	}
+	return fmt.Sprintf("xmlquery: limit %s of %d exceeded at offset %d", e.Limit, e.Max, e.Offset)
+}
+
+// SecureOptions returns parser options suited to untrusted input, with
+// every defensive limit set to a default that well-formed documents of
+// reasonable size stay within:
+//
+//   - the input is limited to 64 MiB and a nesting depth of 256 elements,
+//     and the tree to 1 million nodes, or those a StreamParser retains
+//     between two target nodes, see Limits;
+//   - elements are limited to 256 attributes and attribute values to
+//     64 KiB, see MaxAttributes;
+//   - compressed input is not decompressed, as a small input could expand
+//     beyond the size limit before parsing starts;
+//   - entity references expand to at most 1 MiB of text, nested at most 16
+//     deep, should ExpandEntities be set, see MaxEntityExpansion.
+//
+// The decoder is strict, so undeclared namespace prefixes and entities are
+// errors. Entities declared in the DTD are not expanded and external
+// entities and DTDs are never loaded, see ExternalResolver. The returned
+// options can be adjusted before use.
+func SecureOptions() ParserOptions {
+	return ParserOptions{
+		DisableDecompression:    true,
+		MaxAttributes:           256,
+		MaxAttributeValueLength: 64 << 10,
+		MaxEntityExpansion:      1 << 20,
+		MaxEntityDepth:          16,
+		Limits: Limits{
+			MaxDepth: 256,
+			MaxNodes: 1000000,
+			MaxBytes: 64 << 20,
+		},
+	}
+}
+
+// ParseSecure is like Parse, but with the options of SecureOptions.
+func ParseSecure(r io.Reader) (*Node, error) {
+	return ParseWithOptions(r, SecureOptions())
+}
@@ -0,0 +1,140 @@
+package xmlquery
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseSecure(t *testing.T) {
+	doc, err := ParseSecure(strings.NewReader(`<?xml version="1.0"?><a><b x="1">text</b></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "//b").InnerText(), "text")
+	if _, err := ParseSecure(strings.NewReader(`<a xmlns:p="urn:p" p:x="1" xml:lang="en"><p:b p:y="2"/></a>`)); err != nil {
+		t.Fatal(err)
+	}
+
+	deep := strings.Repeat("<a>", 300) + strings.Repeat("</a>", 300)
+	_, err = ParseSecure(strings.NewReader(deep))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxDepth" {
+		t.Fatalf("expected a MaxDepth error, got %v", err)
+	}
+
+	for _, s := range []string{
+		`<a>&undeclared;</a>`,
+		`<a><p:b/></a>`,
+		`<a foo:bar="1"/>`,
+		`<!DOCTYPE a SYSTEM "file:///etc/passwd"><a>&xxe;</a>`,
+	} {
+		if _, err := ParseSecure(strings.NewReader(s)); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := `<a><b>1</b><b>2</b><b>3</b></a>`
+	tests := []struct {
+		limits Limits
+		limit  string
+	}{
+		{Limits{MaxDepth: 2}, ""},
+		{Limits{MaxDepth: 1}, "MaxDepth"},
+		{Limits{MaxNodes: 7}, ""},
+		{Limits{MaxNodes: 6}, "MaxNodes"},
+		{Limits{MaxNodeBytes: 4 << 10}, ""},
+		{Limits{MaxNodeBytes: 1 << 9}, "MaxNodeBytes"},
+		{Limits{MaxBytes: int64(len(s))}, ""},
+		{Limits{MaxBytes: int64(len(s)) - 1}, "MaxBytes"},
+	}
+	for _, test := range tests {
+		_, err := ParseWithOptions(strings.NewReader(s), ParserOptions{Limits: test.limits})
+		var limitErr *LimitError
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("%+v: %v", test.limits, err)
+			}
+		} else if !errors.As(err, &limitErr) || limitErr.Limit != test.limit {
+			t.Errorf("%+v: expected a %s error, got %v", test.limits, test.limit, err)
+		}
+	}
+
+	// A stream parser counts the nodes it retains, not those released.
+	sp, err := CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{Limits: Limits{MaxNodes: 3}}, "//b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := sp.Read(); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+	if _, err := sp.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	sp, err = CreateStreamParserWithOptions(strings.NewReader(s), ParserOptions{Limits: Limits{MaxNodes: 2}}, "//b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limitErr *LimitError
+	if _, err := sp.Read(); !errors.As(err, &limitErr) || limitErr.Element != "b" {
+		t.Fatalf("expected a limit error in b, got %v", err)
+	}
+}
+
+func TestParseSecureStream(t *testing.T) {
+	// The stream holds more nodes than SecureOptions allows in a tree.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("<feed>"))
+		for i := 0; i < 400000; i++ {
+			pw.Write([]byte("<r>1</r>"))
+		}
+		pw.Write([]byte("</feed>"))
+		pw.Close()
+	}()
+	sp, err := CreateStreamParserWithOptions(pr, SecureOptions(), "/feed/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for ; ; n++ {
+		if _, err := sp.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("read %d: %v", n, err)
+		}
+	}
+	testValue(t, n, 400000)
+}
+
+func TestFragmentLimits(t *testing.T) {
+	s := `<b>1</b><b>2</b>`
+	tests := []struct {
+		limits Limits
+		limit  string
+	}{
+		{Limits{MaxDepth: 1}, ""},
+		{Limits{MaxNodes: 4}, ""},
+		{Limits{MaxNodes: 3}, "MaxNodes"},
+		{Limits{MaxBytes: int64(len(s))}, ""},
+		{Limits{MaxBytes: int64(len(s)) - 1}, "MaxBytes"},
+	}
+	for _, test := range tests {
+		_, err := ParseFragmentWithOptions(strings.NewReader(s), ParserOptions{Limits: test.limits})
+		var limitErr *LimitError
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("%+v: %v", test.limits, err)
+			}
+		} else if !errors.As(err, &limitErr) || limitErr.Limit != test.limit {
+			t.Errorf("%+v: expected a %s error, got %v", test.limits, test.limit, err)
+		} else if limitErr.Max != int64(test.limits.MaxNodes)+test.limits.MaxBytes {
+			t.Errorf("%+v: got limit %d", test.limits, limitErr.Max)
+		}
+	}
+}
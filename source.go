@@ -0,0 +1,103 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// documentInfo holds the data about a parsed document kept on its
+// DocumentNode.
+type documentInfo struct {
+	source string
+	base   string // see ParserOptions.BaseURI
+	bom    string // see Node.ByteOrderMark
+	// declaredEncoding and encoding are the encodings declared by and
+	// decoded from the document, see Node.Encoding.
+	declaredEncoding string
+	encoding         string
+}
+
+// documentInfo returns the data kept on the document being parsed.
+func (p *parser) documentInfo() *documentInfo {
+	if p.doc.document == nil {
+		p.doc.document = &documentInfo{}
+	}
+	return p.doc.document
+}
+
+// SourceName returns the name of the source the tree of n was parsed from,
+// as given by ParserOptions.SourceName, or the empty string.
+func (n *Node) SourceName() string {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.document == nil {
+		return ""
+	}
+	return n.document.source
+}
+
+// DeclaredEncoding returns the encoding declared by the XML declaration of
+// the document of n when parsed, as written, or the empty string if there
+// was none.
+func (n *Node) DeclaredEncoding() string {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.document == nil {
+		return ""
+	}
+	return n.document.declaredEncoding
+}
+
+// Encoding returns the encoding the document of n was decoded from when
+// parsed: the one denoted by its byte order mark, if any, else the one it
+// declared if other than UTF-8, else "UTF-8". It differs from
+// DeclaredEncoding when the byte order mark contradicts the declaration or
+// the declaration is missing.
+func (n *Node) Encoding() string {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	switch {
+	case n.document == nil:
+		return "UTF-8"
+	case n.document.bom != "":
+		return n.document.bom
+	case n.document.encoding != "":
+		return n.document.encoding
+	}
+	return "UTF-8"
+}
+
+// SourceError is returned by the parsing functions when a
+// ParserOptions.SourceName is set, locating the error Err in the source.
+type SourceError struct {
+	Source string
+	// Line is the line of the error, if known, or 0.
+	Line int
+	Err  error
+}
+
+func (e *SourceError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.Source, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Source, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// sourceError returns err located in the source of p, if named.
+func (p *parser) sourceError(err error) error {
+	if p.doc.document == nil || p.doc.document.source == "" {
+		return err
+	}
+	e := &SourceError{Source: p.doc.document.source, Err: err}
+	if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+		e.Line = syntaxErr.Line
+	}
+	return e
+}
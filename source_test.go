@@ -0,0 +1,86 @@
+package xmlquery
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestParseWithOptions_SourceName(t *testing.T) {
+	options := ParserOptions{SourceName: "config.xml"}
+	doc, err := ParseWithOptions(strings.NewReader(`<a><b/></a>`), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FindOne(doc, "//b").SourceName(); got != "config.xml" {
+		t.Fatalf("got source name %q", got)
+	}
+	if doc, _ := Parse(strings.NewReader(`<a/>`)); doc.SourceName() != "" {
+		t.Fatal("unexpected source name")
+	}
+
+	_, err = ParseWithOptions(strings.NewReader("<a>\n<b>\n</a>"), options)
+	var sourceErr *SourceError
+	if !errors.As(err, &sourceErr) {
+		t.Fatalf("expected a *SourceError but got %v", err)
+	}
+	if sourceErr.Source != "config.xml" || sourceErr.Line != 3 || !strings.HasPrefix(err.Error(), "config.xml:3: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var syntaxErr *xml.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatal("the syntax error is not wrapped")
+	}
+
+	_, err = ParseWithOptions(strings.NewReader(`<a b="1" c="2"/>`), ParserOptions{SourceName: "x.xml", MaxAttributes: 1})
+	var limitErr *AttrLimitError
+	if !errors.As(err, &limitErr) || !strings.HasPrefix(err.Error(), "x.xml: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	sp, err := CreateStreamParserWithOptions(strings.NewReader("<a><b/>\n<b>"), ParserOptions{SourceName: "feed.xml"}, "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := sp.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.SourceName() != "feed.xml" {
+		t.Fatal("stream node has no source name")
+	}
+	if _, err := sp.Read(); err == nil || !strings.HasPrefix(err.Error(), "feed.xml:2: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		name              string
+		data              []byte
+		declared, encoded string
+	}{
+		{"undeclared", []byte(`<a>é</a>`), "", "UTF-8"},
+		{"UTF-8", []byte(`<?xml version="1.0" encoding="utf-8"?><a>é</a>`), "utf-8", "UTF-8"},
+		{"ISO-8859-1", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>\xe9</a>"), "ISO-8859-1", "ISO-8859-1"},
+		{"BOM", []byte(utf8BOM + `<?xml version="1.0" encoding="ISO-8859-1"?><a>é</a>`), "ISO-8859-1", "UTF-8"},
+		{"UTF-16", encodeUTF16(t, `<?xml version="1.0"?><a>é</a>`, unicode.LittleEndian), "", "UTF-16LE"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := Parse(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := FindOne(doc, "//a")
+			testValue(t, a.InnerText(), "é")
+			testValue(t, a.DeclaredEncoding(), test.declared)
+			testValue(t, a.Encoding(), test.encoded)
+		})
+	}
+	testValue(t, (&Node{Type: ElementNode}).Encoding(), "UTF-8")
+}
@@ -0,0 +1,108 @@
+package xmlquery
+
+import (
+	"regexp"
+
+	"github.com/antchfx/xpath"
+)
+
+// streamPI is the processing instruction target of a stream parser. The
+// xpath package does not select processing instructions, so expressions
+// ending with a processing-instruction() step are evaluated here.
+type streamPI struct {
+	target string      // The target name, "" for any.
+	parent *xpath.Expr // Selects the parent, or the ancestors if anyDepth, nil for the document.
+	// anyDepth reports whether the step follows '//' rather than '/'.
+	anyDepth bool
+}
+
+var streamPIExpr = regexp.MustCompile(`^(.*?)/(/?)processing-instruction\(\s*(?:'([^']*)'|"([^"]*)")?\s*\)$`)
+
+// parseStreamPI returns the processing instruction target of expr, or nil
+// if expr does not end with a processing-instruction() step.
+func parseStreamPI(expr string, compile func(string) (*xpath.Expr, error)) (*streamPI, error) {
+	m := streamPIExpr.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, nil
+	}
+	pi := &streamPI{target: m[3] + m[4], anyDepth: m[2] != ""}
+	if m[1] != "" {
+		var err error
+		if pi.parent, err = compile(m[1]); err != nil {
+			return nil, err
+		}
+	}
+	return pi, nil
+}
+
+var streamCommentExpr = regexp.MustCompile(`(?:^|/)comment\(\s*\)\s*(?:\[.*\])?$`)
+
+// isStreamComment reports whether expr ends with a comment() step, so that
+// comments may be target nodes.
+func isStreamComment(expr string) bool {
+	return streamCommentExpr.MatchString(expr)
+}
+
+// matches reports whether the processing instruction n is a target node.
+func (t *streamPI) matches(p *parser, n *Node) bool {
+	if n.Data == "xml" || (t.target != "" && n.Data != t.target) {
+		return false
+	}
+	for a := n.Parent; a != nil; a = a.Parent {
+		if t.parent == nil {
+			if a == p.doc {
+				return true
+			}
+		} else if p.selects(t.parent, a) {
+			return true
+		}
+		if !t.anyDepth {
+			break
+		}
+	}
+	return false
+}
+
+// selects reports whether exp evaluated against the document selects n.
+func (p *parser) selects(exp *xpath.Expr, n *Node) bool {
+	it := exp.Select(CreateXPathNavigator(p.doc))
+	for it.MoveNext() {
+		if getCurrentNode(it) == n {
+			return true
+		}
+	}
+	return false
+}
+
+// streamLeaf reports whether the comment or processing instruction n, just
+// added to the tree after prev, is a target node of the stream parser, and
+// if so makes it the current one. Comments are selected by the element
+// XPath and filter like elements; for processing instructions, the filter
+// is not used.
+func (p *parser) streamLeaf(n, prev *Node) bool {
+	if p.streamElementXPath == nil || p.streamNode != nil {
+		return false
+	}
+	switch {
+	case n.Type == DeclarationNode && p.streamPI != nil:
+		if !p.streamPI.matches(p, n) {
+			return false
+		}
+	case n.Type == CommentNode && p.streamComments:
+		if !p.selects(p.streamElementXPath, n) {
+			return false
+		}
+		if p.streamElementFilter != nil && !p.selects(p.streamElementFilter, n) {
+			p.stats.Filtered++
+			p.release(n)
+			removeFromTree(n)
+			return false
+		}
+	default:
+		return false
+	}
+	p.stats.Matched++
+	p.streamNode = n
+	p.streamNodePrev = prev
+	return true
+}
@@ -0,0 +1,102 @@
+package xmlquery
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// URLOption configures CreateStreamParserFromURL and LoadURLWithOptions.
+type URLOption func(*urlConfiguration)
+
+type urlConfiguration struct {
+	client  *http.Client
+	options ParserOptions
+	filter  []string
+	cache   URLCache
+	retry   RetryPolicy
+}
+
+// WithHTTPClient makes CreateStreamParserFromURL and LoadURLWithOptions
+// fetch the document with client instead of http.DefaultClient.
+func WithHTTPClient(client *http.Client) URLOption {
+	return func(c *urlConfiguration) {
+		c.client = client
+	}
+}
+
+// WithStreamParserOptions sets the options the document is parsed with.
+func WithStreamParserOptions(options ParserOptions) URLOption {
+	return func(c *urlConfiguration) {
+		c.options = options
+	}
+}
+
+// WithStreamElementFilter sets the streamElementFilter argument of the
+// stream parser, see CreateStreamParser.
+func WithStreamElementFilter(filter string) URLOption {
+	return func(c *urlConfiguration) {
+		c.filter = []string{filter}
+	}
+}
+
+// CreateStreamParserFromURL fetches the XML document at url and parses it
+// in a streaming fashion as the response body is received, like
+// CreateStreamParser. The response must have an XML Content-Type, as for
+// LoadURL; compressed bodies are decompressed and the encoding declared by
+// the document is honored unless the parser options, see
+// WithStreamParserOptions, which default to those set by Configure, say
+// otherwise.
+//
+// The response body is closed once Read returns an error, io.EOF included,
+// or when Close is called; callers stopping early must call Close.
+func CreateStreamParserFromURL(url, streamElementXPath string, opts ...URLOption) (*StreamParser, error) {
+	config := &urlConfiguration{client: http.DefaultClient, options: currentConfig().parserOptions}
+	for _, opt := range opts {
+		opt(config)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := config.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("xmlquery: unexpected HTTP status %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !xmlMIMERegex.MatchString(contentType) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid XML document(%s)", contentType)
+	}
+	if config.options.BaseURI == "" && resp.Request != nil {
+		config.options.BaseURI = resp.Request.URL.String()
+	}
+	sp, err := CreateStreamParserWithOptions(resp.Body, config.options, streamElementXPath, config.filter...)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	sp.closer = resp.Body
+	return sp, nil
+}
+
+// Close releases the resources held by the stream parser, such as the
+// response body of CreateStreamParserFromURL. It is safe to call Close
+// more than once.
+func (sp *StreamParser) Close() error {
+	if sp.closer == nil {
+		return nil
+	}
+	err := sp.closer.Close()
+	sp.closer = nil
+	return err
+}
+
+// closeOnError closes the stream parser once Read fails.
+func (sp *StreamParser) closeOnError(err error) {
+	if err != nil && sp.closer != nil {
+		sp.Close()
+	}
+}
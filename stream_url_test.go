@@ -0,0 +1,102 @@
+package xmlquery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateStreamParserFromURL(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><feed><item>caf` + "\xe9" + `</item><item>b</item><item>c</item></feed>`))
+	zw.Close()
+	var agent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: userAgentTransport("feed-reader")}
+	sp, err := CreateStreamParserFromURL(server.URL, "/feed/item",
+		WithHTTPClient(client), WithStreamElementFilter("/feed/item[. != 'b']"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		n, err := sp.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, n.InnerText())
+	}
+	if len(got) != 2 || got[0] != "café" || got[1] != "c" {
+		t.Fatalf("got %q", got)
+	}
+	if agent != "feed-reader" {
+		t.Fatalf("custom client not used, User-Agent %q", agent)
+	}
+	if sp.closer != nil {
+		t.Fatal("response body not closed at EOF")
+	}
+	if err := sp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer restoreConfig()()
+	Configure(WithDefaultParserOptions(ParserOptions{Limits: Limits{MaxDepth: 1}}))
+	sp, err = CreateStreamParserFromURL(server.URL, "/feed/item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	var limitErr *LimitError
+	if _, err := sp.Read(); !errors.As(err, &limitErr) {
+		t.Fatalf("default parser options not applied, got %v", err)
+	}
+}
+
+func TestCreateStreamParserFromURLFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html></html>`))
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/html", "/missing"} {
+		if _, err := CreateStreamParserFromURL(server.URL+path, "/a"); err == nil {
+			t.Fatalf("%s: expected an error", path)
+		}
+	}
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+	}))
+	defer server2.Close()
+	if _, err := CreateStreamParserFromURL(server2.URL, "/a["); err == nil {
+		t.Fatal("expected an invalid XPath error")
+	}
+}
+
+type userAgentTransport string
+
+func (t userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", string(t))
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,33 @@
+package xmlquery
+
+import "fmt"
+
+// StreamValidationError is returned by StreamParser.Read along with a
+// target node rejected by the validator, see SetValidator. Unlike other
+// errors, it does not stop the stream: Read can be called again to get the
+// next target node.
+type StreamValidationError struct {
+	Node *Node
+	Err  error
+}
+
+func (e *StreamValidationError) Error() string {
+	return fmt.Sprintf("xmlquery: invalid %s element: %v", e.Node.qualifiedName(), e.Err)
+}
+
+func (e *StreamValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SetValidator makes Read check each target node with validate once the
+// node has been read completely, before its subtree is pruned. A node
+// rejected by validate is returned along with a *StreamValidationError,
+// so invalid records can be quarantined while the stream goes on.
+//
+// xmlquery does not implement XML Schema itself; validate may check the
+// node against an element declaration with any schema library, for
+// example one reading the output of n.OutputXML(true), or implement the
+// constraints directly with queries.
+func (sp *StreamParser) SetValidator(validate func(n *Node) error) {
+	sp.validate = validate
+}
@@ -0,0 +1,52 @@
+package xmlquery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStreamParserValidator(t *testing.T) {
+	s := `<orders><order id="1"><qty>2</qty></order><order id="2"><qty>x</qty></order><order><qty>1</qty></order></orders>`
+	sp, err := CreateStreamParser(strings.NewReader(s), "/orders/order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.SetValidator(func(n *Node) error {
+		if n.SelectAttr("id") == "" {
+			return errors.New("missing id attribute")
+		}
+		if _, err := strconv.Atoi(FindOne(n, "qty").InnerText()); err != nil {
+			return err
+		}
+		return nil
+	})
+	var valid, invalid []string
+	for {
+		n, err := sp.Read()
+		if err == io.EOF {
+			break
+		}
+		var verr *StreamValidationError
+		switch {
+		case errors.As(err, &verr):
+			if verr.Node != n {
+				t.Fatal("the error does not hold the node")
+			}
+			invalid = append(invalid, n.SelectAttr("id")+": "+verr.Err.Error())
+		case err != nil:
+			t.Fatal(err)
+		default:
+			valid = append(valid, n.SelectAttr("id"))
+		}
+	}
+	testValue(t, fmt.Sprint(valid), "[1]")
+	testValue(t, fmt.Sprint(invalid), `[2: strconv.Atoi: parsing "x": invalid syntax : missing id attribute]`)
+	stats := sp.Stats()
+	if stats.Matched != 3 || stats.Invalid != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,71 @@
+package xmlquery
+
+// Stylesheet is an <?xml-stylesheet?> processing instruction of a document,
+// as described by https://www.w3.org/TR/xml-stylesheet/.
+type Stylesheet struct {
+	Type      string
+	Href      string
+	Title     string
+	Media     string
+	Charset   string
+	Alternate bool
+	// Node is the processing instruction node the stylesheet was read from.
+	Node *Node
+}
+
+// GetStylesheets returns the stylesheets associated with doc by the
+// <?xml-stylesheet?> processing instructions of its prolog, in document
+// order.
+func GetStylesheets(doc *Node) []Stylesheet {
+	var list []Stylesheet
+	for n := doc.FirstChild; n != nil && n.Type != ElementNode; n = n.NextSibling {
+		if n.Type != DeclarationNode || n.Data != "xml-stylesheet" {
+			continue
+		}
+		list = append(list, Stylesheet{
+			Type:      n.SelectAttr("type"),
+			Href:      n.SelectAttr("href"),
+			Title:     n.SelectAttr("title"),
+			Media:     n.SelectAttr("media"),
+			Charset:   n.SelectAttr("charset"),
+			Alternate: n.SelectAttr("alternate") == "yes",
+			Node:      n,
+		})
+	}
+	return list
+}
+
+// AddStylesheet associates a stylesheet with doc by adding an
+// <?xml-stylesheet?> processing instruction at the end of its prolog, just
+// before the root element. It returns the new node, whose other
+// pseudo-attributes such as title or media can be set with SetAttr.
+func AddStylesheet(doc *Node, typ, href string) *Node {
+	n := &Node{Type: DeclarationNode, Data: "xml-stylesheet", level: 1}
+	AddAttr(n, "type", typ)
+	AddAttr(n, "href", href)
+	root := doc.FirstChild
+	for root != nil && root.Type != ElementNode {
+		root = root.NextSibling
+	}
+	if root == nil {
+		AddChild(doc, n)
+	} else {
+		addBefore(root, n)
+	}
+	return n
+}
+
+// addBefore inserts n into the tree as the previous sibling of ref.
+func addBefore(ref, n *Node) {
+	touch(ref)
+	n.Parent = ref.Parent
+	n.PrevSibling = ref.PrevSibling
+	n.NextSibling = ref
+	if ref.PrevSibling != nil {
+		ref.PrevSibling.NextSibling = n
+	} else if ref.Parent != nil {
+		ref.Parent.FirstChild = n
+	}
+	ref.PrevSibling = n
+	joinTree(ref, n)
+}
@@ -0,0 +1,49 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetStylesheets(t *testing.T) {
+	s := `<?xml version="1.0"?>
+<?xml-stylesheet type="text/xsl" href="style.xsl" title='My "Print" Style' media="print"?>
+<?xml-stylesheet href = "alt.css" type="text/css" alternate="yes" title="a &amp; b"?>
+<doc><?xml-stylesheet href="ignored.css"?></doc>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := GetStylesheets(doc)
+	if len(list) != 2 {
+		t.Fatalf("expected 2 stylesheets but got %d", len(list))
+	}
+	if v := list[0]; v.Type != "text/xsl" || v.Href != "style.xsl" || v.Title != `My "Print" Style` || v.Media != "print" || v.Alternate {
+		t.Errorf("unexpected first stylesheet %+v", v)
+	}
+	if v := list[1]; v.Type != "text/css" || v.Href != "alt.css" || v.Title != "a & b" || !v.Alternate {
+		t.Errorf("unexpected second stylesheet %+v", v)
+	}
+}
+
+func TestAddStylesheet(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<?xml version="1.0"?><!-- c --><doc/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := AddStylesheet(doc, "text/css", "a b.css")
+	n.SetAttr("title", `say "hi"`)
+	expected := `<?xml version="1.0"?><!-- c --><?xml-stylesheet type="text/css" href="a b.css" title="say &#34;hi&#34;"?><doc></doc>`
+	if v := doc.OutputXML(false); v != expected {
+		t.Fatalf("expected %s but got %s", expected, v)
+	}
+
+	doc, err = Parse(strings.NewReader(doc.OutputXML(false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := GetStylesheets(doc)
+	if len(list) != 1 || list[0].Href != "a b.css" || list[0].Title != `say "hi"` {
+		t.Errorf("unexpected stylesheets after round trip %+v", list)
+	}
+}
@@ -0,0 +1,117 @@
+package xmlquery
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var placeholderRegex = regexp.MustCompile(`\{\{\s*(\.[\w.]*)\s*\}\}`)
+
+// Template is an XML document whose text and attribute values may contain
+// placeholders such as {{.Name}} or {{.Customer.ID}}. Executing a template
+// returns a new tree with the placeholders replaced; the values are stored
+// as node data, so they are escaped when the tree is written.
+type Template struct {
+	doc *Node
+}
+
+// ParseTemplate parses a template document from the given Reader.
+func ParseTemplate(r io.Reader) (*Template, error) {
+	doc, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{doc: doc}, nil
+}
+
+// MustParseTemplate is like ParseTemplate but panics if the template cannot
+// be parsed.
+func MustParseTemplate(r io.Reader) *Template {
+	t, err := ParseTemplate(r)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute returns a copy of the template document with its placeholders
+// filled from data, which may be a map with string keys or a struct, or
+// pointers to them. A placeholder path walks nested maps and structs,
+// {{.}} refers to data itself. Values are formatted with fmt.Sprint.
+// Execute returns an error if a placeholder cannot be resolved.
+func (t *Template) Execute(data interface{}) (*Node, error) {
+	doc := copyNode(t.doc, nil, nil)
+	var err error
+	fill := func(s string) string {
+		return placeholderRegex.ReplaceAllStringFunc(s, func(m string) string {
+			path := placeholderRegex.FindStringSubmatch(m)[1]
+			v, e := lookupTemplateValue(data, path)
+			if e != nil && err == nil {
+				err = e
+			}
+			return v
+		})
+	}
+	var walk func(*Node)
+	walk = func(n *Node) {
+		switch n.Type {
+		case TextNode, CommentNode:
+			n.Data = fill(n.Data)
+		case CharDataNode:
+			n.Data = fill(n.Data)
+			if strings.Contains(n.Data, "]]>") {
+				n.Type = TextNode
+			}
+		}
+		for i := range n.Attr {
+			n.Attr[i].Value = fill(n.Attr[i].Value)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func lookupTemplateValue(data interface{}, path string) (string, error) {
+	v := reflect.ValueOf(data)
+	for _, name := range strings.Split(path, ".")[1:] {
+		if name == "" {
+			continue
+		}
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return "", fmt.Errorf("xmlquery: template placeholder %s: nil value at %s", path, name)
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return "", fmt.Errorf("xmlquery: template placeholder %s: map key is not a string", path)
+			}
+			v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		case reflect.Struct:
+			v = v.FieldByName(name)
+			if v.IsValid() && !v.CanInterface() {
+				return "", fmt.Errorf("xmlquery: template placeholder %s: field %s is not exported", path, name)
+			}
+		default:
+			return "", fmt.Errorf("xmlquery: template placeholder %s: cannot look up %s in %s", path, name, v.Kind())
+		}
+		if !v.IsValid() {
+			return "", fmt.Errorf("xmlquery: template placeholder %s: %s not found", path, name)
+		}
+	}
+	if !v.IsValid() {
+		return "", nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
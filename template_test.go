@@ -0,0 +1,40 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateExecute(t *testing.T) {
+	tmpl := MustParseTemplate(strings.NewReader(`<order id="{{.ID}}"><customer>{{ .Customer.Name }}</customer><note><![CDATA[{{.Note}}]]></note></order>`))
+	type customer struct{ Name string }
+	doc, err := tmpl.Execute(map[string]interface{}{
+		"ID":       7,
+		"Customer": &customer{Name: `Tom & "Jerry" <co>`},
+		"Note":     "a]]>b",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0"?><order id="7"><customer>Tom &amp; &#34;Jerry&#34; &lt;co&gt;</customer><note>a]]&gt;b</note></order>`
+	testValue(t, doc.OutputXML(false), expected)
+	testValue(t, FindOne(doc, "//customer").InnerText(), `Tom & "Jerry" <co>`)
+
+	// The template itself is left untouched.
+	doc, err = tmpl.Execute(struct {
+		ID       string
+		Customer map[string]string
+		Note     string
+	}{"8", map[string]string{"Name": "Ann"}, "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.OutputXML(false), `<?xml version="1.0"?><order id="8"><customer>Ann</customer><note><![CDATA[n]]></note></order>`)
+}
+
+func TestTemplateMissingValue(t *testing.T) {
+	tmpl := MustParseTemplate(strings.NewReader(`<a>{{.Missing}}</a>`))
+	if _, err := tmpl.Execute(map[string]string{}); err == nil {
+		t.Fatal("expected a missing placeholder error but nil")
+	}
+}
@@ -0,0 +1,169 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TokenReader returns an xml.TokenReader that replays the subtree rooted at
+// n as encoding/xml tokens, so it can be decoded without serializing it first:
+//
+//	var v T
+//	err := xml.NewTokenDecoder(n.TokenReader()).Decode(&v)
+//
+// Element and attribute names carry the namespace URI in Name.Space, the same
+// as tokens returned by xml.Decoder.Token. The tree must not be modified while
+// the reader is in use.
+func (n *Node) TokenReader() xml.TokenReader {
+	return &nodeTokenReader{top: n}
+}
+
+// NodeTokenSource is like n.TokenReader, but the start element of n also
+// declares the namespaces n inherits from its ancestors, so the tokens form
+// a self-contained fragment: consumers tracking xmlns attributes, such as
+// token-rewriting middleware, can resolve every namespace of the subtree
+// without access to the rest of the document.
+func NodeTokenSource(n *Node) xml.TokenReader {
+	return &nodeTokenReader{top: n, inherited: inheritedNamespaces(n)}
+}
+
+type nodeTokenReader struct {
+	top, curr *Node
+	leaving   bool
+	done      bool
+	// inherited holds namespace declarations added to the start element
+	// of top.
+	inherited []xml.Attr
+}
+
+func (r *nodeTokenReader) Token() (xml.Token, error) {
+	for !r.done {
+		if r.curr == nil {
+			r.curr = r.top
+		} else if !r.leaving && r.curr.FirstChild != nil {
+			r.curr = r.curr.FirstChild
+		} else if !r.leaving {
+			r.leaving = true
+		} else if r.leave(); r.done {
+			break
+		}
+		var tok xml.Token
+		if r.leaving {
+			tok = nodeEndToken(r.curr)
+		} else {
+			tok = nodeStartToken(r.curr)
+		}
+		if start, ok := tok.(xml.StartElement); ok && r.curr == r.top && len(r.inherited) > 0 {
+			start.Attr = append(start.Attr, r.inherited...)
+			tok = start
+		}
+		if tok != nil {
+			return tok, nil
+		}
+	}
+	return nil, io.EOF
+}
+
+// leave moves to the node following r.curr once r.curr and its subtree have
+// been replayed.
+func (r *nodeTokenReader) leave() {
+	if r.curr == r.top {
+		r.done = true
+		return
+	}
+	if r.curr.NextSibling != nil {
+		r.curr = r.curr.NextSibling
+		r.leaving = false
+		return
+	}
+	r.curr = r.curr.Parent
+}
+
+func nodeStartToken(n *Node) xml.Token {
+	switch n.Type {
+	case ElementNode:
+		return xml.StartElement{Name: n.xmlName(), Attr: n.xmlAttrs()}
+	case TextNode, CharDataNode:
+		return xml.CharData(n.Data)
+	case CommentNode:
+		return xml.Comment(n.Data)
+	case NotationNode:
+		return xml.Directive(n.Data)
+	case DeclarationNode:
+		var b strings.Builder
+		for i, attr := range n.Attr {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, attr.Name.Local, attr.Value)
+		}
+		return xml.ProcInst{Target: n.Data, Inst: []byte(b.String())}
+	}
+	return nil
+}
+
+func nodeEndToken(n *Node) xml.Token {
+	if n.Type == ElementNode {
+		return xml.EndElement{Name: n.xmlName()}
+	}
+	return nil
+}
+
+// xmlName returns the name of the node the way xml.Decoder reports it, with
+// the namespace URI as the space, falling back to the prefix for nodes
+// without a namespace URI.
+func (n *Node) xmlName() xml.Name {
+	space := n.NamespaceURI
+	if space == "" {
+		space = n.Prefix
+	}
+	return xml.Name{Space: space, Local: n.Data}
+}
+
+func (n *Node) xmlAttrs() []xml.Attr {
+	if len(n.Attr) == 0 {
+		return nil
+	}
+	attrs := make([]xml.Attr, len(n.Attr))
+	for i, attr := range n.Attr {
+		name := attr.Name
+		if attr.NamespaceURI != "" {
+			name.Space = attr.NamespaceURI
+		}
+		attrs[i] = xml.Attr{Name: name, Value: attr.Value}
+	}
+	return attrs
+}
+
+// inheritedNamespaces returns the namespace declarations of the ancestors of
+// n that are in scope at n, nearest first, leaving out the prefixes n
+// declares itself.
+func inheritedNamespaces(n *Node) []xml.Attr {
+	if n.Type != ElementNode {
+		return nil
+	}
+	declared := make(map[string]bool)
+	var attrs []xml.Attr
+	for p := n; p != nil; p = p.Parent {
+		for _, attr := range p.Attr {
+			var prefix string
+			switch {
+			case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			case attr.Name.Space == "xmlns":
+				prefix = attr.Name.Local
+			default:
+				continue
+			}
+			if declared[prefix] {
+				continue
+			}
+			declared[prefix] = true
+			if p != n {
+				attrs = append(attrs, xml.Attr{Name: attr.Name, Value: attr.Value})
+			}
+		}
+	}
+	return attrs
+}
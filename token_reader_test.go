@@ -0,0 +1,116 @@
+package xmlquery
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestTokenReaderDecode(t *testing.T) {
+	doc := loadXML(`<?xml version="1.0"?>
+<envelope xmlns:p="urn:p">
+	<p:payload id="7" p:kind="a">
+		<name>x &amp; y</name>
+		<!-- note -->
+		<value><![CDATA[<raw>]]></value>
+	</p:payload>
+</envelope>`)
+	var v struct {
+		XMLName xml.Name `xml:"urn:p payload"`
+		ID      string   `xml:"id,attr"`
+		Kind    string   `xml:"urn:p kind,attr"`
+		Name    string   `xml:"name"`
+		Value   string   `xml:"value"`
+		Comment string   `xml:",comment"`
+	}
+	n := FindOne(doc, "//p:payload")
+	if err := xml.NewTokenDecoder(n.TokenReader()).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, v.ID, "7")
+	testValue(t, v.Kind, "a")
+	testValue(t, v.Name, "x & y")
+	testValue(t, v.Value, "<raw>")
+	testValue(t, v.Comment, " note ")
+}
+
+func TestTokenReaderTokens(t *testing.T) {
+	doc := loadXML(`<a><b>1</b><c/></a>`)
+	r := doc.TokenReader()
+	var names []string
+	for {
+		tok, err := r.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := tok.(type) {
+		case xml.ProcInst:
+			names = append(names, "?"+tok.Target)
+		case xml.StartElement:
+			names = append(names, tok.Name.Local)
+		case xml.EndElement:
+			names = append(names, "/"+tok.Name.Local)
+		case xml.CharData:
+			names = append(names, string(tok))
+		}
+	}
+	testValue(t, fmt.Sprint(names), "[?xml a b 1 /b c /c /a]")
+}
+
+func TestNodeTokenSource(t *testing.T) {
+	doc := loadXML(`<root xmlns="urn:d" xmlns:p="urn:p" xmlns:q="urn:q"><mid xmlns:q="urn:q2"><p:leaf xmlns:r="urn:r" q:x="1"/></mid></root>`)
+	n := FindOne(doc, "//p:leaf")
+	tok, err := NodeTokenSource(n).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decls []string
+	for _, attr := range tok.(xml.StartElement).Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			decls = append(decls, attr.Name.Local+"="+attr.Value)
+		}
+	}
+	testValue(t, fmt.Sprint(decls), "[r=urn:r q=urn:q2 xmlns=urn:d p=urn:p]")
+
+	// Every namespace of the subtree is declared within the fragment.
+	var scopes []map[string]bool
+	r := NodeTokenSource(n)
+	for {
+		tok, err := r.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			scope := make(map[string]bool)
+			if len(scopes) > 0 {
+				for uri := range scopes[len(scopes)-1] {
+					scope[uri] = true
+				}
+			}
+			for _, attr := range tok.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					scope[attr.Value] = true
+				}
+			}
+			scopes = append(scopes, scope)
+			if !scope[tok.Name.Space] {
+				t.Errorf("namespace %s of %s is not declared", tok.Name.Space, tok.Name.Local)
+			}
+			for _, attr := range tok.Attr {
+				if attr.Name.Space != "" && attr.Name.Space != "xmlns" && !scope[attr.Name.Space] {
+					t.Errorf("namespace %s of @%s is not declared", attr.Name.Space, attr.Name.Local)
+				}
+			}
+		case xml.EndElement:
+			scopes = scopes[:len(scopes)-1]
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package xmlquery
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/xpath"
+)
+
+var (
+	nodePtrType       = reflect.TypeOf((*Node)(nil))
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// UnmarshalXPath fills the fields of the struct pointed to by v that carry
+// an `xpath` tag with the result of evaluating the tag's expression against
+// top, for example:
+//
+//	type Book struct {
+//		ID      string   `xpath:"@id"`
+//		Title   string   `xpath:"title"`
+//		Price   float64  `xpath:"price"`
+//		Authors []string `xpath:"author"`
+//	}
+//	var v struct {
+//		Count int    `xpath:"count(//book)"`
+//		Books []Book `xpath:"//book"`
+//	}
+//	err := xmlquery.UnmarshalXPath(doc, &v)
+//
+// Slice fields receive every matched node, other fields the first one.
+// Struct fields are filled recursively, with their expressions evaluated
+// relative to the matched node. Fields of type *Node receive the node
+// itself; the other fields receive its inner text, converted to the field's
+// type. Strings, booleans, numbers and encoding.TextUnmarshaler are
+// supported. Fields whose expression matches nothing are left unchanged.
+// Returns an error if an expression cannot be parsed or evaluated.
+func UnmarshalXPath(top *Node, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("xmlquery: UnmarshalXPath requires a non-nil pointer to a struct")
+	}
+	return unmarshalStruct(top, rv.Elem())
+}
+
+func unmarshalStruct(n *Node, sv reflect.Value) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		expr := field.Tag.Get("xpath")
+		if expr == "" || expr == "-" || field.PkgPath != "" {
+			continue
+		}
+		if err := unmarshalField(n, sv.Field(i), expr); err != nil {
+			return fmt.Errorf("xmlquery: field %s: %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func unmarshalField(n *Node, fv reflect.Value, expr string) (err error) {
+	exp, err := getQuery(expr)
+	if err != nil {
+		return err
+	}
+	defer recoverEval(expr, &err)
+	nav := &NodeNavigator{curr: n, root: n, attr: -1}
+	for nav.root.Parent != nil {
+		nav.root = nav.root.Parent
+	}
+	return unmarshalResult(fv, exp.Evaluate(nav))
+}
+
+func unmarshalResult(fv reflect.Value, result interface{}) error {
+	t, ok := result.(*xpath.NodeIterator)
+	if !ok {
+		switch v := result.(type) {
+		case float64:
+			return unmarshalText(fv, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return unmarshalText(fv, fmt.Sprint(v))
+		}
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), 0, 0)
+		for t.MoveNext() {
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if err := unmarshalNode(elem, getCurrentNode(t)); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		fv.Set(slice)
+		return nil
+	}
+	if t.MoveNext() {
+		return unmarshalNode(fv, getCurrentNode(t))
+	}
+	return nil
+}
+
+func unmarshalNode(fv reflect.Value, n *Node) error {
+	if fv.Type() == nodePtrType {
+		fv.Set(reflect.ValueOf(n))
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return unmarshalNode(fv.Elem(), n)
+	}
+	if fv.Kind() == reflect.Struct && !reflect.PtrTo(fv.Type()).Implements(textUnmarshalType) {
+		return unmarshalStruct(n, fv)
+	}
+	return unmarshalText(fv, n.InnerText())
+}
+
+func unmarshalText(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return unmarshalText(fv.Elem(), s)
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(strings.TrimSpace(s)))
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(strings.TrimSpace(s), 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(v)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot unmarshal into %s", fv.Type())
+		}
+		fv.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("cannot unmarshal into %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package xmlquery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnmarshalXPath(t *testing.T) {
+	type book struct {
+		ID        string    `xpath:"@id"`
+		Title     string    `xpath:"title"`
+		Price     float64   `xpath:"price"`
+		Published time.Time `xpath:"concat(publish_date, 'T00:00:00Z')"`
+		Node      *Node     `xpath:"."`
+		Missing   *string   `xpath:"isbn"`
+	}
+	var v struct {
+		Count    int      `xpath:"count(//book)"`
+		Genres   []string `xpath:"//book/genre"`
+		Books    []book   `xpath:"//book"`
+		First    *book    `xpath:"//book[1]"`
+		HasCheap bool     `xpath:"boolean(//book[price < 10])"`
+		Ignored  string
+	}
+	if err := UnmarshalXPath(doc, &v); err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, v.Count, 3)
+	testValue(t, len(v.Genres), 3)
+	testValue(t, v.Genres[1], "Fantasy")
+	testValue(t, len(v.Books), 3)
+	testValue(t, v.Books[2].ID, "bk103")
+	testValue(t, v.Books[2].Title, "Maeve Ascendant")
+	testValue(t, v.Books[0].Price, 44.95)
+	testValue(t, v.Books[1].Published.Format("2006-01-02"), "2000-12-16")
+	testValue(t, v.Books[1].Node.SelectAttr("id"), "bk102")
+	testTrue(t, v.Books[0].Missing == nil)
+	testValue(t, v.First.ID, "bk101")
+	testTrue(t, v.HasCheap)
+}
+
+func TestUnmarshalXPathErrors(t *testing.T) {
+	var v struct {
+		Price int `xpath:"//book[1]/price"`
+	}
+	if err := UnmarshalXPath(doc, &v); err == nil {
+		t.Fatal("expected a conversion error but nil")
+	}
+	var w struct {
+		Bad string `xpath:"//a[@a==1]"`
+	}
+	if err := UnmarshalXPath(doc, &w); err == nil {
+		t.Fatal("expected a parsed error but nil")
+	}
+	if err := UnmarshalXPath(doc, w); err == nil {
+		t.Fatal("expected an invalid argument error but nil")
+	}
+	var x struct {
+		Bad []string `xpath:"//book[sum(string(.)) > 0]"`
+	}
+	if err := UnmarshalXPath(doc, &x); err == nil {
+		t.Fatal("expected an evaluation error but nil")
+	}
+}
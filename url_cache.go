@@ -0,0 +1,129 @@
+package xmlquery
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// CachedDocument is a document loaded by LoadURLWithOptions, with the
+// validators the server sent for it.
+type CachedDocument struct {
+	Doc          *Node
+	ETag         string
+	LastModified string
+}
+
+// URLCache stores the documents loaded by LoadURLWithOptions by URL, see
+// WithURLCache. Implementations must be safe for concurrent use.
+type URLCache interface {
+	Get(url string) (CachedDocument, bool)
+	Put(url string, doc CachedDocument)
+}
+
+type memoryURLCache struct {
+	mu   sync.Mutex
+	docs map[string]CachedDocument
+}
+
+// NewURLCache returns a URLCache keeping the documents in memory.
+func NewURLCache() URLCache {
+	return &memoryURLCache{docs: make(map[string]CachedDocument)}
+}
+
+func (c *memoryURLCache) Get(url string) (CachedDocument, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	doc, ok := c.docs[url]
+	return doc, ok
+}
+
+func (c *memoryURLCache) Put(url string, doc CachedDocument) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs[url] = doc
+}
+
+// WithURLCache makes LoadURLWithOptions revalidate the documents it loaded
+// before, using the ETag and Last-Modified headers of the earlier response,
+// and return the cached tree when the server responds 304 Not Modified.
+// Documents sent without validators are not cached. The option is ignored
+// by CreateStreamParserFromURL.
+func WithURLCache(cache URLCache) URLOption {
+	return func(c *urlConfiguration) {
+		c.cache = cache
+	}
+}
+
+// LoadURLWithOptions is like LoadURL, but configured by opts: the client
+// fetching the document, see WithHTTPClient, the options it is parsed
+// with, see WithStreamParserOptions, which default to those set by
+// Configure, a cache, see WithURLCache, and retries, see WithRetry. A
+// response with a status other than 2xx is an error.
+//
+// With a cache, the same tree is returned as long as the document is not
+// modified, so callers must not modify it.
+func LoadURLWithOptions(url string, opts ...URLOption) (*Node, error) {
+	config := &urlConfiguration{client: http.DefaultClient, options: currentConfig().parserOptions}
+	for _, opt := range opts {
+		opt(config)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var cached CachedDocument
+	var found bool
+	if config.cache != nil {
+		if cached, found = config.cache.Get(url); found {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+	}
+	resp, err := config.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && found {
+		return cached.Doc, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("xmlquery: unexpected HTTP status %s", resp.Status)
+	}
+	doc, err := parseResponse(resp, config.options)
+	if err != nil {
+		return nil, err
+	}
+	if config.cache != nil {
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			config.cache.Put(url, CachedDocument{Doc: doc, ETag: etag, LastModified: lastModified})
+		}
+	}
+	return doc, nil
+}
+
+// parseResponse parses the body of resp, which must have an XML
+// Content-Type.
+func parseResponse(resp *http.Response, options ParserOptions) (*Node, error) {
+	contentType := resp.Header.Get("Content-Type")
+	if !xmlMIMERegex.MatchString(contentType) {
+		return nil, fmt.Errorf("invalid XML document(%s)", contentType)
+	}
+	if options.BaseURI == "" && resp.Request != nil {
+		options.BaseURI = resp.Request.URL.String()
+	}
+	r := bufio.NewReader(resp.Body)
+	// Some servers label textual XML as WBXML, so also check that the
+	// body starts with a WBXML version byte rather than markup.
+	if b, err := r.Peek(1); err == nil && b[0] < '\t' && wbxmlMIMERegex.MatchString(contentType) {
+		return ParseWBXMLWithOptions(r, WBXMLOptions{Limits: options.Limits})
+	}
+	return ParseWithOptions(r, options)
+}
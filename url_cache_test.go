@@ -0,0 +1,62 @@
+package xmlquery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadURLWithCache(t *testing.T) {
+	var requests, downloads int
+	body := `<feed><item>a</item></feed>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := `"v1"`
+		if body != `<feed><item>a</item></feed>` {
+			etag = `"v2"`
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cache := NewURLCache()
+	first, err := LoadURLWithOptions(server.URL, WithURLCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadURLWithOptions(server.URL, WithURLCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first || requests != 2 || downloads != 1 {
+		t.Fatalf("document was not revalidated: %d requests, %d downloads", requests, downloads)
+	}
+
+	body = `<feed><item>b</item></feed>`
+	third, err := LoadURLWithOptions(server.URL, WithURLCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first || downloads != 2 {
+		t.Fatal("modified document was not downloaded")
+	}
+	testValue(t, FindOne(third, "//item").InnerText(), "b")
+	if cached, _ := cache.Get(server.URL); cached.Doc != third || cached.ETag != `"v2"` {
+		t.Fatalf("unexpected cache entry %+v", cached)
+	}
+}
+
+func TestLoadURLWithOptionsStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	if _, err := LoadURLWithOptions(server.URL); err == nil {
+		t.Fatal("expected an error for status 404")
+	}
+}
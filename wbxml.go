@@ -0,0 +1,570 @@
+package xmlquery
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// WBXML global tokens, see WAP-192-WBXML-20010725-a, section 7.1.
+const (
+	wbxmlSwitchPage = 0x00
+	wbxmlEnd        = 0x01
+	wbxmlEntity     = 0x02
+	wbxmlStrI       = 0x03
+	wbxmlLiteral    = 0x04
+	wbxmlExtI0      = 0x40
+	wbxmlExtI1      = 0x41
+	wbxmlExtI2      = 0x42
+	wbxmlPI         = 0x43
+	wbxmlLiteralC   = 0x44
+	wbxmlExtT0      = 0x80
+	wbxmlExtT1      = 0x81
+	wbxmlExtT2      = 0x82
+	wbxmlStrT       = 0x83
+	wbxmlLiteralA   = 0x84
+	wbxmlExt0       = 0xC0
+	wbxmlExt1       = 0xC1
+	wbxmlExt2       = 0xC2
+	wbxmlOpaque     = 0xC3
+	wbxmlLiteralAC  = 0xC4
+)
+
+// WBXMLCodePage holds the token tables of a single WBXML code page.
+type WBXMLCodePage struct {
+	// Namespace is the namespace URI of the elements of this code page.
+	// It is declared with an xmlns attribute wherever it changes.
+	Namespace string
+	// Tags maps tag tokens (without the attribute and content flags) to
+	// element names.
+	Tags map[byte]string
+	// AttrStarts maps attribute start tokens to either an attribute name,
+	// or to `name=prefix` when the token also carries a value prefix.
+	AttrStarts map[byte]string
+	// AttrValues maps attribute value tokens to value fragments.
+	AttrValues map[byte]string
+}
+
+// WBXMLCodeSpace describes the tokens used by a WBXML document type.
+type WBXMLCodeSpace struct {
+	// PublicID is the well-known numeric public identifier of the document
+	// type, or 0 if it has none.
+	PublicID uint32
+	// FPI is the formal public identifier of the document type, for example
+	// "-//SYNCML//DTD SyncML 1.2//EN".
+	FPI   string
+	Pages map[byte]*WBXMLCodePage
+}
+
+var (
+	wbxmlCodeSpacesMutex sync.RWMutex
+	wbxmlCodeSpacesByID  = map[uint32]*WBXMLCodeSpace{}
+	wbxmlCodeSpacesByFPI = map[string]*WBXMLCodeSpace{}
+)
+
+// RegisterWBXMLCodeSpace makes a WBXML code space available to ParseWBXML.
+// Documents are matched against registered code spaces by their numeric
+// public identifier or by their formal public identifier.
+func RegisterWBXMLCodeSpace(cs *WBXMLCodeSpace) {
+	wbxmlCodeSpacesMutex.Lock()
+	defer wbxmlCodeSpacesMutex.Unlock()
+	if cs.PublicID != 0 {
+		wbxmlCodeSpacesByID[cs.PublicID] = cs
+	}
+	if cs.FPI != "" {
+		wbxmlCodeSpacesByFPI[cs.FPI] = cs
+	}
+}
+
+func lookupWBXMLCodeSpace(id uint32, fpi string) *WBXMLCodeSpace {
+	wbxmlCodeSpacesMutex.RLock()
+	defer wbxmlCodeSpacesMutex.RUnlock()
+	if fpi != "" {
+		if cs, ok := wbxmlCodeSpacesByFPI[fpi]; ok {
+			return cs
+		}
+	}
+	return wbxmlCodeSpacesByID[id]
+}
+
+// WBXMLOptions configures ParseWBXMLWithOptions.
+type WBXMLOptions struct {
+	// CodeSpace overrides the code space selected by the document's public
+	// identifier.
+	CodeSpace *WBXMLCodeSpace
+	// Limits bounds the resources used by parsing, as it does for
+	// ParseWithOptions; the offsets of the errors are in the WBXML input.
+	Limits Limits
+}
+
+// ParseWBXML returns the parse tree for the WAP Binary XML document read
+// from r. The token tables are looked up among the code spaces registered
+// with RegisterWBXMLCodeSpace; SyncML 1.1 and 1.2 are registered by default.
+func ParseWBXML(r io.Reader) (*Node, error) {
+	return ParseWBXMLWithOptions(r, WBXMLOptions{})
+}
+
+// ParseWBXMLWithOptions is like ParseWBXML, but with custom options.
+func ParseWBXMLWithOptions(r io.Reader, options WBXMLOptions) (*Node, error) {
+	in := &wbxmlInput{r: r, limit: options.Limits.MaxBytes}
+	d := &wbxmlDecoder{r: bufio.NewReader(in), in: in, limits: options.Limits}
+	doc, err := d.decode(options)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return doc, err
+}
+
+// wbxmlMaxDepth is the maximum nesting depth of the elements of a WBXML
+// document, as they are decoded recursively.
+const wbxmlMaxDepth = 10000
+
+type wbxmlDecoder struct {
+	r        *bufio.Reader
+	in       *wbxmlInput
+	limits   Limits
+	nodes    int
+	size     int64
+	strtbl   []byte
+	charset  uint32
+	cs       *WBXMLCodeSpace
+	tagPage  byte
+	attrPage byte
+}
+
+func (d *wbxmlDecoder) decode(options WBXMLOptions) (*Node, error) {
+	// version
+	if _, err := d.r.ReadByte(); err != nil {
+		return nil, err
+	}
+	publicID, err := d.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	var fpiIndex uint32
+	if publicID == 0 {
+		if fpiIndex, err = d.readUint32(); err != nil {
+			return nil, err
+		}
+	}
+	if d.charset, err = d.readUint32(); err != nil {
+		return nil, err
+	}
+	switch d.charset {
+	case 0, 3, 4, 106:
+	default:
+		return nil, fmt.Errorf("xmlquery: unsupported WBXML charset MIBenum %d", d.charset)
+	}
+	n, err := d.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if d.strtbl, err = d.readBytes(n); err != nil {
+		return nil, err
+	}
+	var fpi string
+	if publicID == 0 {
+		if fpi, err = d.tableString(fpiIndex); err != nil {
+			return nil, err
+		}
+	}
+	d.cs = options.CodeSpace
+	if d.cs == nil {
+		d.cs = lookupWBXMLCodeSpace(publicID, fpi)
+	}
+	if d.cs == nil {
+		if fpi != "" {
+			return nil, fmt.Errorf("xmlquery: no WBXML code space registered for %q", fpi)
+		}
+		return nil, fmt.Errorf("xmlquery: no WBXML code space registered for public id 0x%X", publicID)
+	}
+
+	doc := &Node{Type: DocumentNode}
+	decl := &Node{
+		Type:  DeclarationNode,
+		Data:  "xml",
+		Attr:  []Attr{{Name: newXMLName("version"), Value: "1.0"}},
+		level: 1,
+	}
+	AddChild(doc, decl)
+	for {
+		tok, err := d.r.ReadByte()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case wbxmlSwitchPage:
+			if d.tagPage, err = d.r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case wbxmlPI:
+			if err = d.decodePI(doc, 1); err != nil {
+				return nil, err
+			}
+		default:
+			if err = d.decodeElement(doc, tok, 1, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *wbxmlDecoder) decodeElement(parent *Node, tok byte, level int, ns string) error {
+	if level > wbxmlMaxDepth {
+		return fmt.Errorf("xmlquery: WBXML elements nested deeper than %d", wbxmlMaxDepth)
+	}
+	if d.limits.MaxDepth > 0 && level > d.limits.MaxDepth {
+		return &LimitError{Limit: "MaxDepth", Max: int64(d.limits.MaxDepth), Offset: d.offset()}
+	}
+	name, err := d.tagName(tok)
+	if err != nil {
+		return err
+	}
+	node := &Node{Type: ElementNode, Data: name, level: level}
+	if page := d.cs.Pages[d.tagPage]; page != nil && page.Namespace != "" {
+		node.NamespaceURI = page.Namespace
+		if page.Namespace != ns {
+			node.Attr = append(node.Attr, Attr{Name: newXMLName("xmlns"), Value: page.Namespace})
+		}
+	}
+	if err = d.addNode(parent, node); err != nil {
+		return err
+	}
+	if tok&0x80 != 0 {
+		size := node.size()
+		if err = d.decodeAttrs(node); err != nil {
+			return err
+		}
+		if err = d.grow(node.size() - size); err != nil {
+			return err
+		}
+	}
+	if tok&0x40 == 0 {
+		return nil
+	}
+	for {
+		tok, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case wbxmlEnd:
+			return nil
+		case wbxmlSwitchPage:
+			if d.tagPage, err = d.r.ReadByte(); err != nil {
+				return err
+			}
+		case wbxmlPI:
+			if err = d.decodePI(node, level+1); err != nil {
+				return err
+			}
+		case wbxmlEntity, wbxmlStrI, wbxmlStrT, wbxmlOpaque,
+			wbxmlExtI0, wbxmlExtI1, wbxmlExtI2, wbxmlExtT0, wbxmlExtT1, wbxmlExtT2, wbxmlExt0, wbxmlExt1, wbxmlExt2:
+			s, err := d.decodeString(tok)
+			if err != nil {
+				return err
+			}
+			if s == "" {
+				continue
+			}
+			if last := node.LastChild; last != nil && last.Type == TextNode {
+				last.Data += s
+			} else {
+				if err = d.addNode(node, &Node{Type: TextNode, Data: s, level: level + 1}); err != nil {
+					return err
+				}
+			}
+		default:
+			if err = d.decodeElement(node, tok, level+1, node.NamespaceURI); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (d *wbxmlDecoder) tagName(tok byte) (string, error) {
+	switch tok {
+	case wbxmlLiteral, wbxmlLiteralA, wbxmlLiteralC, wbxmlLiteralAC:
+		index, err := d.readUint32()
+		if err != nil {
+			return "", err
+		}
+		return d.tableString(index)
+	}
+	if page := d.cs.Pages[d.tagPage]; page != nil {
+		if name, ok := page.Tags[tok&0x3F]; ok {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("xmlquery: unknown WBXML tag 0x%02X on code page %d", tok&0x3F, d.tagPage)
+}
+
+func (d *wbxmlDecoder) decodeAttrs(node *Node) error {
+	var name, value strings.Builder
+	flush := func() {
+		if name.Len() > 0 {
+			AddAttr(node, name.String(), value.String())
+		}
+		name.Reset()
+		value.Reset()
+	}
+	for {
+		tok, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case tok == wbxmlEnd:
+			flush()
+			return nil
+		case tok == wbxmlSwitchPage:
+			if d.attrPage, err = d.r.ReadByte(); err != nil {
+				return err
+			}
+		case tok == wbxmlLiteral:
+			flush()
+			index, err := d.readUint32()
+			if err != nil {
+				return err
+			}
+			s, err := d.tableString(index)
+			if err != nil {
+				return err
+			}
+			name.WriteString(s)
+		case tok == wbxmlEntity || tok == wbxmlStrI || tok == wbxmlStrT || tok == wbxmlOpaque ||
+			(tok&0x3F <= 0x02 && tok&0xC0 != 0):
+			s, err := d.decodeString(tok)
+			if err != nil {
+				return err
+			}
+			value.WriteString(s)
+		case tok < 0x80:
+			flush()
+			s, err := d.attrToken(tok, func(p *WBXMLCodePage) map[byte]string { return p.AttrStarts })
+			if err != nil {
+				return err
+			}
+			if i := strings.IndexByte(s, '='); i > 0 {
+				name.WriteString(s[:i])
+				value.WriteString(s[i+1:])
+			} else {
+				name.WriteString(s)
+			}
+		default:
+			s, err := d.attrToken(tok, func(p *WBXMLCodePage) map[byte]string { return p.AttrValues })
+			if err != nil {
+				return err
+			}
+			value.WriteString(s)
+		}
+	}
+}
+
+func (d *wbxmlDecoder) attrToken(tok byte, table func(*WBXMLCodePage) map[byte]string) (string, error) {
+	if page := d.cs.Pages[d.attrPage]; page != nil {
+		if s, ok := table(page)[tok]; ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("xmlquery: unknown WBXML attribute token 0x%02X on code page %d", tok, d.attrPage)
+}
+
+// decodePI decodes a processing instruction, whose target and data are
+// encoded like a single attribute.
+func (d *wbxmlDecoder) decodePI(parent *Node, level int) error {
+	tmp := &Node{}
+	if err := d.decodeAttrs(tmp); err != nil {
+		return err
+	}
+	if len(tmp.Attr) == 0 {
+		return errors.New("xmlquery: invalid WBXML processing instruction")
+	}
+	node := &Node{Type: DeclarationNode, Data: tmp.Attr[0].Name.Local, level: level}
+	for _, pair := range strings.Split(tmp.Attr[0].Value, " ") {
+		pair = strings.TrimSpace(pair)
+		if i := strings.Index(pair, "="); i > 0 {
+			AddAttr(node, pair[:i], strings.Trim(pair[i+1:], `"'`))
+		}
+	}
+	return d.addNode(parent, node)
+}
+
+// decodeString decodes the string-valued token tok.
+func (d *wbxmlDecoder) decodeString(tok byte) (string, error) {
+	switch tok {
+	case wbxmlEntity:
+		code, err := d.readUint32()
+		if err != nil {
+			return "", err
+		}
+		return string(rune(code)), nil
+	case wbxmlStrI, wbxmlExtI0, wbxmlExtI1, wbxmlExtI2:
+		b, err := d.r.ReadBytes(0)
+		if err != nil {
+			return "", err
+		}
+		return d.toUTF8(b[:len(b)-1]), nil
+	case wbxmlStrT, wbxmlExtT0, wbxmlExtT1, wbxmlExtT2:
+		index, err := d.readUint32()
+		if err != nil {
+			return "", err
+		}
+		return d.tableString(index)
+	case wbxmlOpaque:
+		n, err := d.readUint32()
+		if err != nil {
+			return "", err
+		}
+		b, err := d.readBytes(n)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	// EXT_0, EXT_1 and EXT_2 carry no data.
+	return "", nil
+}
+
+func (d *wbxmlDecoder) tableString(index uint32) (string, error) {
+	if int64(index) >= int64(len(d.strtbl)) {
+		return "", fmt.Errorf("xmlquery: WBXML string table index %d out of range", index)
+	}
+	b := d.strtbl[index:]
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return d.toUTF8(b), nil
+}
+
+func (d *wbxmlDecoder) toUTF8(b []byte) string {
+	if d.charset != 4 {
+		return string(b)
+	}
+	// ISO-8859-1
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// addNode adds node to parent, unless Limits.MaxNodes or
+// Limits.MaxNodeBytes is reached.
+func (d *wbxmlDecoder) addNode(parent, node *Node) error {
+	if d.limits.MaxNodes > 0 {
+		if d.nodes++; d.nodes > d.limits.MaxNodes {
+			return &LimitError{Limit: "MaxNodes", Max: int64(d.limits.MaxNodes), Offset: d.offset()}
+		}
+	}
+	if err := d.grow(node.size()); err != nil {
+		return err
+	}
+	AddChild(parent, node)
+	return nil
+}
+
+// grow accounts for n more bytes of nodes, see Limits.MaxNodeBytes.
+func (d *wbxmlDecoder) grow(n int64) error {
+	if d.limits.MaxNodeBytes > 0 {
+		if d.size += n; d.size > d.limits.MaxNodeBytes {
+			return &LimitError{Limit: "MaxNodeBytes", Max: d.limits.MaxNodeBytes, Offset: d.offset()}
+		}
+	}
+	return nil
+}
+
+// offset returns the offset in the input of the next byte decoded.
+func (d *wbxmlDecoder) offset() int64 {
+	return d.in.n - int64(d.r.Buffered())
+}
+
+// wbxmlInput counts the bytes read from the input of a WBXML document,
+// and fails once more than limit are read, if limit is positive.
+type wbxmlInput struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (in *wbxmlInput) Read(p []byte) (int, error) {
+	n, err := in.r.Read(p)
+	if in.limit > 0 && in.n+int64(n) > in.limit {
+		return 0, &LimitError{Limit: "MaxBytes", Max: in.limit, Offset: in.limit}
+	}
+	in.n += int64(n)
+	return n, err
+}
+
+// readBytes reads n bytes. The buffer grows as the bytes are read, so a
+// length larger than the input does not allocate more than the input.
+func (d *wbxmlDecoder) readBytes(n uint32) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readUint32 reads a multi-byte unsigned integer (mb_u_int32).
+func (d *wbxmlDecoder) readUint32() (uint32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("xmlquery: invalid WBXML multi-byte integer")
+}
+
+var syncMLTags = map[byte]string{
+	0x05: "Add", 0x06: "Alert", 0x07: "Archive", 0x08: "Atomic", 0x09: "Chal",
+	0x0A: "Cmd", 0x0B: "CmdID", 0x0C: "CmdRef", 0x0D: "Copy", 0x0E: "Cred",
+	0x0F: "Data", 0x10: "Delete", 0x11: "Exec", 0x12: "Final", 0x13: "Get",
+	0x14: "Item", 0x15: "Lang", 0x16: "LocName", 0x17: "LocURI", 0x18: "Map",
+	0x19: "MapItem", 0x1A: "Meta", 0x1B: "MsgID", 0x1C: "MsgRef", 0x1D: "NoResp",
+	0x1E: "NoResults", 0x1F: "Put", 0x20: "Replace", 0x21: "RespURI", 0x22: "Results",
+	0x23: "Search", 0x24: "Sequence", 0x25: "SessionID", 0x26: "SftDel", 0x27: "Source",
+	0x28: "SourceRef", 0x29: "Status", 0x2A: "Sync", 0x2B: "SyncBody", 0x2C: "SyncHdr",
+	0x2D: "SyncML", 0x2E: "Target", 0x2F: "TargetRef", 0x31: "VerDTD", 0x32: "VerProto",
+	0x33: "NumberOfChanges", 0x34: "MoreData", 0x35: "Field", 0x36: "Filter", 0x37: "Record",
+	0x38: "FilterType", 0x39: "SourceParent", 0x3A: "TargetParent", 0x3B: "Move", 0x3C: "Correlator",
+}
+
+var syncMLMetInfTags = map[byte]string{
+	0x05: "Anchor", 0x06: "EMI", 0x07: "Format", 0x08: "FreeID", 0x09: "FreeMem",
+	0x0A: "Last", 0x0B: "Mark", 0x0C: "MaxMsgSize", 0x0D: "Mem", 0x0E: "MetInf",
+	0x0F: "Next", 0x10: "NextNonce", 0x11: "SharedMem", 0x12: "Size", 0x13: "Type",
+	0x14: "Version", 0x15: "MaxObjSize", 0x16: "FieldLevel",
+}
+
+func init() {
+	RegisterWBXMLCodeSpace(&WBXMLCodeSpace{
+		PublicID: 0x0FD3,
+		FPI:      "-//SYNCML//DTD SyncML 1.1//EN",
+		Pages: map[byte]*WBXMLCodePage{
+			0: {Namespace: "SYNCML:SYNCML1.1", Tags: syncMLTags},
+			1: {Namespace: "syncml:metinf", Tags: syncMLMetInfTags},
+		},
+	})
+	RegisterWBXMLCodeSpace(&WBXMLCodeSpace{
+		PublicID: 0x1201,
+		FPI:      "-//SYNCML//DTD SyncML 1.2//EN",
+		Pages: map[byte]*WBXMLCodePage{
+			0: {Namespace: "SYNCML:SYNCML1.2", Tags: syncMLTags},
+			1: {Namespace: "syncml:metinf", Tags: syncMLMetInfTags},
+		},
+	})
+}
@@ -0,0 +1,143 @@
+package xmlquery
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func syncMLWBXML() []byte {
+	fpi := "-//SYNCML//DTD SyncML 1.2//EN"
+	var b bytes.Buffer
+	b.Write([]byte{0x02, 0x00, 0x00, 0x6A, byte(len(fpi) + 1)})
+	b.WriteString(fpi)
+	b.WriteByte(0)
+	b.Write([]byte{
+		0x6D,       // <SyncML>
+		0x6C,       // <SyncHdr>
+		0x71, 0x03, // <VerDTD>
+	})
+	b.WriteString("1.2")
+	b.Write([]byte{0x00, 0x01, // </VerDTD>
+		0x01,       // </SyncHdr>
+		0x6B,       // <SyncBody>
+		0x5A,       // <Meta>
+		0x00, 0x01, // SWITCH_PAGE MetInf
+		0x53, 0x03, // <Type>
+	})
+	b.WriteString("text/plain")
+	b.Write([]byte{0x00, 0x01, // </Type>
+		0x00, 0x00, // SWITCH_PAGE SyncML
+		0x01, // </Meta>
+		0x12, // <Final/>
+		0x01, // </SyncBody>
+		0x01, // </SyncML>
+	})
+	return b.Bytes()
+}
+
+func TestParseWBXML(t *testing.T) {
+	doc, err := ParseWBXML(bytes.NewReader(syncMLWBXML()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0"?><SyncML xmlns="SYNCML:SYNCML1.2"><SyncHdr><VerDTD>1.2</VerDTD></SyncHdr><SyncBody><Meta><Type xmlns="syncml:metinf">text/plain</Type></Meta><Final></Final></SyncBody></SyncML>`
+	if got := doc.OutputXML(false); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if n := FindOne(doc, "//SyncHdr/VerDTD"); n == nil || n.InnerText() != "1.2" {
+		t.Fatal("//SyncHdr/VerDTD != 1.2")
+	}
+	if n := FindOne(doc, "//Type"); n == nil || n.NamespaceURI != "syncml:metinf" {
+		t.Fatal("//Type is not in the metinf namespace")
+	}
+}
+
+func TestParseWBXMLWithAttributes(t *testing.T) {
+	cs := &WBXMLCodeSpace{
+		Pages: map[byte]*WBXMLCodePage{
+			0: {
+				Tags:       map[byte]string{0x05: "card", 0x06: "p"},
+				AttrStarts: map[byte]string{0x05: "id", 0x06: "href=http://"},
+				AttrValues: map[byte]string{0x85: ".com"},
+			},
+		},
+	}
+	data := []byte{0x03, 0x01, 0x6A, 0x00,
+		0xC5,                       // <card ...>
+		0x05, 0x03, 'c', '1', 0x00, // id="c1"
+		0x06, 0x03, 'x', 0x00, 0x85, // href="http://x.com"
+		0x01,                                         // end of attributes
+		0x46, 0x03, 'h', 'i', 0x00, 0x02, 0x21, 0x01, // <p>hi!</p>
+		0x01, // </card>
+	}
+	doc, err := ParseWBXMLWithOptions(bytes.NewReader(data), WBXMLOptions{CodeSpace: cs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := FindOne(doc, "//card")
+	testAttr(t, card, "id", "c1")
+	testAttr(t, card, "href", "http://x.com")
+	testValue(t, card.SelectElement("p").InnerText(), "hi!")
+}
+
+func TestParseWBXMLErrors(t *testing.T) {
+	if _, err := ParseWBXML(bytes.NewReader([]byte{0x03, 0x01, 0x6A, 0x00, 0x45})); err == nil {
+		t.Fatal("expected an unknown code space error but nil")
+	}
+	data := syncMLWBXML()
+	if _, err := ParseWBXML(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Fatal("expected an unexpected EOF error but nil")
+	}
+	// A string table or opaque data longer than the input is not
+	// allocated upfront.
+	if _, err := ParseWBXML(bytes.NewReader([]byte{0x03, 0x01, 0x6A, 0x8F, 0xFF, 0xFF, 0xFF, 0x7F})); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected an unexpected EOF error but got %v", err)
+	}
+	fpi := "-//SYNCML//DTD SyncML 1.2//EN"
+	deep := append([]byte{0x02, 0x00, 0x00, 0x6A, byte(len(fpi) + 1)}, fpi...)
+	deep = append(deep, 0x00, 0x6D, 0xC3, 0x8F, 0xFF, 0xFF, 0xFF, 0x7F)
+	if _, err := ParseWBXML(bytes.NewReader(deep)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected an unexpected EOF error but got %v", err)
+	}
+	deep = append(deep[:len(deep)-7], bytes.Repeat([]byte{0x6D}, wbxmlMaxDepth+1)...)
+	if _, err := ParseWBXML(bytes.NewReader(deep)); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Fatalf("expected a depth error but got %v", err)
+	}
+}
+
+func TestParseWBXMLLimits(t *testing.T) {
+	data := syncMLWBXML()
+	for _, limits := range []Limits{{MaxDepth: 3}, {MaxNodes: 5}, {MaxBytes: 40}} {
+		_, err := ParseWBXMLWithOptions(bytes.NewReader(data), WBXMLOptions{Limits: limits})
+		if _, ok := err.(*LimitError); !ok {
+			t.Fatalf("%+v: expected a LimitError but got %v", limits, err)
+		}
+	}
+	if _, err := ParseWBXMLWithOptions(bytes.NewReader(data), WBXMLOptions{Limits: Limits{MaxDepth: 4, MaxNodes: 11, MaxBytes: int64(len(data))}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadURLWBXML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.syncml+wbxml")
+		w.Write(syncMLWBXML())
+	}))
+	defer server.Close()
+	doc, err := LoadURL(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FindOne(doc, "//SyncBody/Final") == nil {
+		t.Fatal("//SyncBody/Final is not found")
+	}
+	// The limits of the parser options apply to WBXML documents.
+	_, err = LoadURLWithOptions(server.URL, WithStreamParserOptions(ParserOptions{Limits: Limits{MaxDepth: 2}}))
+	if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("expected a LimitError but got %v", err)
+	}
+}
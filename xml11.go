@@ -0,0 +1,230 @@
+package xmlquery
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The decoder only reads XML 1.0. With ParserOptions.XML11, the input of
+// an XML 1.1 document is rewritten by xml11Reader before being decoded:
+//
+//   - the version of the XML declaration is read as 1.0;
+//   - the NEL (U+0085) and LINE SEPARATOR (U+2028) line endings are
+//     replaced with LFs;
+//   - the character references to the control characters allowed by XML
+//     1.1 only, #x1 to #x1F but tab, LF and CR, are replaced with the
+//     noncharacters U+FDD0 plus the character, which the parser turns
+//     back into the control characters.
+//
+// The control characters are restored in text and attribute values, where
+// references are read; the noncharacters U+FDD1 to U+FDEF must not be
+// written literally in the document.
+
+// xml11Base is the noncharacter standing for the control character 0.
+const xml11Base = 0xfdd0
+
+var (
+	xml11Version = regexp.MustCompile(`version\s*=\s*(?:"1\.1"|'1\.1')`)
+	xml10Version = regexp.MustCompile(`version(\s*=\s*["'])1\.0`)
+)
+
+// xml11LiteralParts are the parts of the input where references are not
+// read.
+var xml11LiteralParts = []struct{ start, end string }{
+	{cdataStart, "]]>"},
+	{"<!--", "-->"},
+	{"<?", "?>"},
+}
+
+// The parts of the input rewritten differently.
+const (
+	xml11Start   = iota // before the XML declaration
+	xml11Content        // where references are read
+	xml11Literal        // in a CDATA section, comment or processing instruction
+	xml11Raw            // left as is
+)
+
+// xml11Reader rewrites the input of an XML 1.1 document for the decoder.
+type xml11Reader struct {
+	r     *bufio.Reader
+	out   []byte // rewritten bytes, returned up to pos
+	pos   int
+	state int
+	end   string // the end of the literal part
+	// decoded reports whether the input is UTF-8 whatever the encoding
+	// declared, as it was decoded already.
+	decoded bool
+	// version11 reports whether the document is declared XML 1.1.
+	version11 bool
+}
+
+// newXML11Reader returns an xml11Reader rewriting r from the start of the
+// document.
+func newXML11Reader(r io.Reader, decoded bool) *xml11Reader {
+	return &xml11Reader{r: newBufferedReader(r, 0), decoded: decoded}
+}
+
+func (x *xml11Reader) Read(p []byte) (int, error) {
+	for len(x.out)-x.pos < len(p) && x.state != xml11Raw {
+		if err := x.step(); err != nil {
+			if len(x.out) > x.pos {
+				break
+			}
+			return 0, err
+		}
+	}
+	if len(x.out) == x.pos {
+		return x.r.Read(p)
+	}
+	n := copy(p, x.out[x.pos:])
+	if x.pos += n; x.pos == len(x.out) {
+		x.out, x.pos = x.out[:0], 0
+	}
+	return n, nil
+}
+
+// step rewrites the next part of the input into x.out.
+func (x *xml11Reader) step() error {
+	if x.state == xml11Start {
+		return x.declaration()
+	}
+	b, err := x.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case b == 0xc2 || b == 0xe2:
+		// A NEL or LINE SEPARATOR is two or three bytes long.
+		x.r.UnreadByte()
+		head, _ := x.r.Peek(3)
+		if r, size := utf8.DecodeRune(head); r == '\u0085' || r == '\u2028' {
+			x.r.Discard(size)
+			x.out = append(x.out, '\n')
+			return nil
+		}
+		x.r.ReadByte()
+	case x.state == xml11Literal:
+		if b == x.end[0] {
+			if head, _ := x.r.Peek(len(x.end) - 1); string(head) == x.end[1:] {
+				x.r.Discard(len(head))
+				x.out = append(x.out, x.end...)
+				x.state = xml11Content
+				return nil
+			}
+		}
+	case b == '<':
+		head, _ := x.r.Peek(len(cdataStart) - 1)
+		for _, part := range xml11LiteralParts {
+			if bytes.HasPrefix(head, []byte(part.start[1:])) {
+				x.r.Discard(len(part.start) - 1)
+				x.out = append(x.out, part.start...)
+				x.state, x.end = xml11Literal, part.end
+				return nil
+			}
+		}
+	case b == '&':
+		head, _ := x.r.Peek(8)
+		if r, size := controlReference(head); size > 0 {
+			x.r.Discard(size)
+			x.out = append(x.out, string(xml11Base+r)...)
+			return nil
+		}
+	}
+	x.out = append(x.out, b)
+	return nil
+}
+
+// declaration reads the XML declaration, if any, and decides how the rest
+// of the input is rewritten.
+func (x *xml11Reader) declaration() error {
+	x.state = xml11Raw
+	head, _ := x.r.Peek(len("<?xml "))
+	if !bytes.HasPrefix(head, []byte("<?xml")) || len(head) < len("<?xml ") || !isXMLSpace(rune(head[5])) {
+		return nil
+	}
+	var decl []byte
+	for !bytes.HasSuffix(decl, []byte("?>")) {
+		b, err := x.r.ReadSlice('>')
+		decl = append(decl, b...)
+		if err != nil && err != bufio.ErrBufferFull {
+			x.out = append(x.out, decl...)
+			return nil
+		}
+	}
+	loc := xml11Version.FindIndex(decl)
+	if loc == nil {
+		x.out = append(x.out, decl...)
+		return nil
+	}
+	x.version11 = true
+	decl[loc[1]-2] = '0'
+	x.out = append(x.out, decl...)
+	for _, attr := range parsePseudoAttrs(string(decl[len("<?xml") : len(decl)-len("?>")])) {
+		if attr.Name.Local == "encoding" && !x.decoded && !strings.EqualFold(attr.Value, "UTF-8") {
+			// The input is decoded from the declared encoding by the
+			// decoder, then rewritten, see parser.start.
+			return nil
+		}
+	}
+	x.state = xml11Content
+	return nil
+}
+
+// controlReference returns the control character referenced by the start
+// of b, following an ampersand, and the length of the reference, if it is
+// a character allowed by XML 1.1 only.
+func controlReference(b []byte) (rune, int) {
+	end := bytes.IndexByte(b, ';')
+	if end < 2 || b[0] != '#' {
+		return 0, 0
+	}
+	s, base := string(b[1:end]), 10
+	if s[0] == 'x' {
+		s, base = s[1:], 16
+	}
+	n, err := strconv.ParseUint(s, base, 8)
+	if err != nil || n == 0 || n >= 0x20 || n == '\t' || n == '\n' || n == '\r' {
+		return 0, 0
+	}
+	return rune(n), end + 1
+}
+
+// restoreControls returns s with the noncharacters standing for control
+// characters turned back into them.
+func restoreControls(s string) string {
+	// U+FDD0 to U+FDEF are encoded as EF B7 90 to EF B7 AF.
+	if !strings.Contains(s, "\xef\xb7") {
+		return s
+	}
+	return string(restoreControlBytes([]byte(s)))
+}
+
+// restoreControlBytes is like restoreControls, but rewrites b in place.
+func restoreControlBytes(b []byte) []byte {
+	out := b[:0]
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r > xml11Base && r < xml11Base+0x20 {
+			out = append(out, byte(r-xml11Base))
+		} else {
+			out = append(out, b[i:i+size]...)
+		}
+		i += size
+	}
+	return out
+}
+
+// declarationInst returns inst, the instruction of the processing
+// instruction target, as written in the document: the version of the XML
+// declaration of an XML 1.1 document is read as 1.0 by the decoder.
+func (p *parser) declarationInst(target string, inst []byte) []byte {
+	if target != "xml" || p.xml11Input == nil || !p.xml11Input.version11 {
+		return inst
+	}
+	return xml10Version.ReplaceAll(inst, []byte("version${1}1.1"))
+}
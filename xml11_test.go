@@ -0,0 +1,150 @@
+package xmlquery
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestParseWithOptions_XML11(t *testing.T) {
+	s := "<?xml version=\"1.1\" encoding=\"UTF-8\"?>\n" +
+		"<doc a=\"x&#x1;y\">line 1\u0085line 2 line 3&#7;" +
+		"<![CDATA[&#x1;\u0085]]><!-- &#x2; --><?pi &#3;?></doc>"
+	if _, err := Parse(strings.NewReader(s)); err == nil {
+		t.Fatal("expected XML 1.1 to be rejected without the option")
+	}
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{XML11: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.FirstChild.SelectAttr("version"), "1.1")
+	testValue(t, doc.DeclaredEncoding(), "UTF-8")
+	root := FindOne(doc, "/doc")
+	testValue(t, root.SelectAttr("a"), "x\x01y")
+	testValue(t, root.FirstChild.Data, "line 1\nline 2\nline 3\x07")
+	testValue(t, root.FirstChild.NextSibling.Type, CharDataNode)
+	testValue(t, root.FirstChild.NextSibling.Data, "&#x1;\n")
+	testValue(t, FindOne(doc, "//comment()").Data, " &#x2; ")
+	testValue(t, root.LastChild.Type, DeclarationNode)
+
+	// Line numbers count the NEL and LINE SEPARATOR line endings.
+	doc, err = ParseWithOptions(strings.NewReader("<?xml version='1.1'?><a>\u0085<b/>\u2028<c/></a>"), ParserOptions{XML11: true, WithLineNumbers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.FirstChild.SelectAttr("version"), "1.1")
+	pos, _ := FindOne(doc, "//c").Position()
+	testValue(t, pos.Line, 3)
+
+	// ParseBytes reads the document likewise.
+	doc, err = ParseBytesWithOptions([]byte(s), ParserOptions{XML11: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "/doc").SelectAttr("a"), "x\x01y")
+}
+
+func TestParseWithOptions_XML11Version10(t *testing.T) {
+	// The XML 1.0 documents are left as they are.
+	s := "<?xml version=\"1.0\"?><a>x\u0085y</a>"
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{XML11: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, doc.FirstChild.SelectAttr("version"), "1.0")
+	testValue(t, FindOne(doc, "/a").InnerText(), "x\u0085y")
+	if _, err := ParseWithOptions(strings.NewReader(`<a>&#x1;</a>`), ParserOptions{XML11: true}); err == nil {
+		t.Fatal("expected a reference to a control character to be rejected in XML 1.0")
+	}
+}
+
+func TestParseWithOptions_XML11Encoding(t *testing.T) {
+	s := "<?xml version=\"1.1\" encoding=\"ISO-8859-1\"?><a b=\"&#x1F;\">caf\xe9\x85&#31;</a>"
+	options := ParserOptions{
+		XML11: true,
+		// charset.NewReaderLabel reads ISO-8859-1 as windows-1252, where
+		// 0x85 is not NEL.
+		CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+			return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+		},
+	}
+	doc, err := ParseWithOptions(strings.NewReader(s), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := FindOne(doc, "/a")
+	testValue(t, a.SelectAttr("b"), "\x1f")
+	testValue(t, a.InnerText(), "café\n\x1f")
+}
+
+func TestParseEventsXML11(t *testing.T) {
+	s := "<?xml version=\"1.1\"?><a b=\"&#x1;\">&#x2;</a>"
+	var texts []string
+	var inst string
+	err := ParseEvents(strings.NewReader(s), EventHandlers{
+		OnStartElement: func(e *ElementEvent) error {
+			texts = append(texts, e.Attr[0].Value)
+			return nil
+		},
+		OnText: func(text []byte, cdata bool) error {
+			texts = append(texts, string(text))
+			return nil
+		},
+		OnProcInst: func(target string, b []byte) error {
+			inst = string(b)
+			return nil
+		},
+	}, ParserOptions{XML11: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, strings.Join(texts, ","), "\x01,\x02")
+	testValue(t, inst, `version="1.1"`)
+}
+
+func TestXML11Reader(t *testing.T) {
+	// The rewritten input is the same whatever the size of the reads.
+	s := "<?xml version=\"1.1\"?><a>" + strings.Repeat("x&#1;\u0085<!--&#1;-->", 1000) + "</a>"
+	var want []byte
+	for _, size := range []int{1, 7, 4096} {
+		x := newXML11Reader(strings.NewReader(s), false)
+		var got bytes.Buffer
+		buf := make([]byte, size)
+		for {
+			n, err := x.Read(buf)
+			got.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		if want == nil {
+			want = got.Bytes()
+			continue
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Fatalf("got a different input with reads of %d bytes", size)
+		}
+	}
+	testValue(t, strings.Count(string(want), "\ufdd1"), 1000)
+	testValue(t, strings.Count(string(want), "&#1;"), 1000)
+}
+
+func TestParseWithOptions_XML11RawText(t *testing.T) {
+	s := "<?xml version=\"1.1\"?><a>x &amp; &#x1;y<b>&amp;</b></a>"
+	doc, err := ParseWithOptions(strings.NewReader(s), ParserOptions{XML11: true, PreserveRawText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source text of the text with references to control characters
+	// is not known, as they are rewritten before being decoded.
+	if raw, ok := FindOne(doc, "/a").FirstChild.RawText(); ok {
+		t.Fatalf("got raw text %q", raw)
+	}
+	if raw, _ := FindOne(doc, "//b").FirstChild.RawText(); raw != "&amp;" {
+		t.Fatalf("got raw text %q", raw)
+	}
+	testValue(t, FindOne(doc, "/a").OutputXML(true), "<a>x &amp; \x01y<b>&amp;</b></a>")
+}
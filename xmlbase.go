@@ -0,0 +1,55 @@
+package xmlquery
+
+import "net/url"
+
+// BaseURI returns the base URI of n as defined by XML Base: that given by
+// the nearest xml:base attribute of n or its ancestors, resolved against
+// the base URI of the parent of its element, and ultimately against the
+// base URI of the document, see ParserOptions.BaseURI. It returns the
+// empty string if no base URI is known.
+func (n *Node) BaseURI() string {
+	var bases []string
+	base := ""
+	for ; n != nil; n = n.Parent {
+		if n.Type == ElementNode {
+			if b := n.SelectAttr("xml:base"); b != "" {
+				bases = append(bases, b)
+			}
+		}
+		if n.Parent == nil && n.document != nil {
+			base = n.document.base
+			if base == "" {
+				base = n.document.source
+			}
+		}
+	}
+	for i := len(bases) - 1; i >= 0; i-- {
+		var err error
+		if base, err = resolveURI(base, bases[i]); err != nil {
+			return ""
+		}
+	}
+	return base
+}
+
+// ResolveURI resolves the URI reference ref, such as the value of an href
+// attribute, against the base URI of n, see BaseURI. ref is returned as is
+// if no base URI is known.
+func (n *Node) ResolveURI(ref string) (string, error) {
+	return resolveURI(n.BaseURI(), ref)
+}
+
+func resolveURI(base, ref string) (string, error) {
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if base == "" {
+		return ref, nil
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
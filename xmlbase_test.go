@@ -0,0 +1,70 @@
+package xmlquery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBaseURI(t *testing.T) {
+	s := `<feed xml:base="http://example.com/blog/">
+	<entry xml:base="2024/"><link href="post.html"/><img src="/logo.png"/></entry>
+	<entry xml:base="http://other.org/"><link href="a/b.html"/></entry>
+	<link href="about.html"/>
+</feed>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := Find(doc, "//link")
+	testValue(t, links[0].BaseURI(), "http://example.com/blog/2024/")
+	tests := []struct {
+		n    *Node
+		ref  string
+		want string
+	}{
+		{links[0], "post.html", "http://example.com/blog/2024/post.html"},
+		{FindOne(doc, "//img"), "/logo.png", "http://example.com/logo.png"},
+		{links[1], "a/b.html", "http://other.org/a/b.html"},
+		{FindOne(doc, "/feed/link/@href"), "about.html", "http://example.com/blog/about.html"},
+	}
+	for _, test := range tests {
+		got, err := test.n.ResolveURI(test.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testValue(t, got, test.want)
+	}
+
+	// The base URI of the document applies, and relative xml:base
+	// attributes are resolved against it.
+	doc, err = ParseWithOptions(strings.NewReader(`<a xml:base="sub/"><b/></a>`), ParserOptions{BaseURI: "http://example.com/dir/doc.xml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, FindOne(doc, "//b").BaseURI(), "http://example.com/dir/sub/")
+
+	doc = loadXML(`<a><b/></a>`)
+	testValue(t, FindOne(doc, "//b").BaseURI(), "")
+	if got, _ := FindOne(doc, "//b").ResolveURI("x.html"); got != "x.html" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestLoadURLBaseURI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<a><b href="c.xml"/></a>`))
+	}))
+	defer server.Close()
+	doc, err := LoadURL(server.URL + "/docs/index.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FindOne(doc, "//b").ResolveURI("c.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testValue(t, got, server.URL+"/docs/c.xml")
+}
@@ -0,0 +1,113 @@
+package xmlquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// isXMLID reports whether attr is an xml:id attribute, as defined by
+// https://www.w3.org/TR/xml-id/. The xml prefix is bound to its namespace
+// by definition, so attributes added with AddAttr(n, "xml:id", v) are
+// recognized as well as parsed ones.
+func isXMLID(attr Attr) bool {
+	if attr.Name.Local != "id" {
+		return false
+	}
+	if attr.NamespaceURI != "" {
+		return attr.NamespaceURI == xmlNamespaceURI
+	}
+	return attr.Name.Space == "xml"
+}
+
+// xmlIDOf returns the normalized xml:id value of n, if any.
+func xmlIDOf(n *Node) (string, bool) {
+	for _, attr := range n.Attr {
+		if isXMLID(attr) {
+			return strings.Join(strings.Fields(attr.Value), " "), true
+		}
+	}
+	return "", false
+}
+
+// GetElementByID returns the element of the tree rooted at top whose xml:id
+// attribute is id or, if there is none, the first element whose unprefixed
+// id attribute is id. No DTD is needed. If top is indexed, see EnableIndex,
+// the lookup is served from the index.
+func GetElementByID(top *Node, id string) *Node {
+	if top.index != nil {
+		idx := top.currentIndex()
+		if n := idx.xmlIDs[id]; n != nil {
+			return n
+		}
+		if list := idx.byID[id]; len(list) > 0 {
+			return list[0]
+		}
+		return nil
+	}
+	var found *Node
+	var walk func(*Node) *Node
+	walk = func(n *Node) *Node {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != ElementNode {
+				continue
+			}
+			if v, ok := xmlIDOf(child); ok && v == id {
+				return child
+			}
+			if found == nil {
+				for _, attr := range child.Attr {
+					if attr.Name.Space == "" && attr.Name.Local == "id" && attr.Value == id {
+						found = child
+						break
+					}
+				}
+			}
+			if n := walk(child); n != nil {
+				return n
+			}
+		}
+		return nil
+	}
+	if n := walk(top); n != nil {
+		return n
+	}
+	return found
+}
+
+// isNCName reports whether s is a name without colon, as required of
+// xml:id values.
+func isNCName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i == 0:
+			return false
+		case r == '-' || r == '.' || r == '·' || unicode.IsDigit(r) ||
+			unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Nl):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// checkXMLID checks the xml:id attribute of n, if any, which starts at
+// offset in the input: its value must be an NCName unique in the document.
+func (p *parser) checkXMLID(n *Node, offset int64) error {
+	id, ok := xmlIDOf(n)
+	if !ok {
+		return nil
+	}
+	if !isNCName(id) {
+		return fmt.Errorf("xmlquery: xml:id %q of element %s at offset %d is not an NCName", id, n.Data, offset)
+	}
+	if p.xmlIDs[id] {
+		return fmt.Errorf("xmlquery: duplicate xml:id %q of element %s at offset %d", id, n.Data, offset)
+	}
+	p.xmlIDs[id] = true
+	return nil
+}
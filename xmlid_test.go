@@ -0,0 +1,64 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetElementByID(t *testing.T) {
+	s := `<doc xmlns:x="urn:x">
+		<sec id="intro"><p xml:id="intro">text</p></sec>
+		<sec xml:id=" s2 "/>
+		<sec x:id="other"/>
+		<sec id="plain"/>
+	</doc>`
+	doc, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() {
+		t.Helper()
+		if n := GetElementByID(doc, "intro"); n == nil || n.Data != "p" {
+			t.Fatal("xml:id must take precedence over id")
+		}
+		if n := GetElementByID(doc, "s2"); n == nil || n.Data != "sec" {
+			t.Fatal("xml:id value not normalized")
+		}
+		if n := GetElementByID(doc, "plain"); n == nil || n.SelectAttr("id") != "plain" {
+			t.Fatal("id attribute not found")
+		}
+		if n := GetElementByID(doc, "other"); n != nil {
+			t.Fatal("attribute in another namespace taken as an ID")
+		}
+	}
+	check()
+	EnableIndex(doc)
+	check()
+
+	n := &Node{Type: ElementNode, Data: "added"}
+	AddAttr(n, "xml:id", "new")
+	AddChild(FindOne(doc, "/doc"), n)
+	if GetElementByID(doc, "new") != n {
+		t.Fatal("xml:id added with AddAttr not indexed")
+	}
+}
+
+func TestParseWithOptions_ValidateXMLID(t *testing.T) {
+	options := ParserOptions{ValidateXMLID: true}
+	for s, valid := range map[string]bool{
+		`<a xml:id="a1"><b xml:id="_b"/><c xml:id="é-c.1"/></a>`: true,
+		`<a xml:id="1a"/>`:                    false,
+		`<a xml:id="p:a"/>`:                   false,
+		`<a xml:id=""/>`:                      false,
+		`<a xml:id="x"><b xml:id=" x "/></a>`: false,
+		`<a id="1"><b id="1"/></a>`:           true,
+	} {
+		_, err := ParseWithOptions(strings.NewReader(s), options)
+		if (err == nil) != valid {
+			t.Errorf("%s: got error %v", s, err)
+		}
+	}
+	if _, err := Parse(strings.NewReader(`<a xml:id="1a"/>`)); err != nil {
+		t.Fatal("xml:id validated by default")
+	}
+}
@@ -0,0 +1,91 @@
+// Package xmlquerytest provides assertion helpers for tests of code that
+// produces or queries XML documents with xmlquery.
+package xmlquerytest
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden rewrite the
+// golden files with the actual output instead of comparing, when it is set
+// to a non-empty value.
+const UpdateEnv = "XMLQUERYTEST_UPDATE"
+
+// AssertEqualXML parses the documents want and got and reports a test error
+// unless they are equal according to xmlquery.Equal with the given options.
+func AssertEqualXML(t testing.TB, want, got string, opts ...xmlquery.CompareOption) {
+	t.Helper()
+	wantDoc, err := xmlquery.Parse(strings.NewReader(want))
+	if err != nil {
+		t.Fatalf("xmlquerytest: cannot parse wanted XML: %v", err)
+		return
+	}
+	gotDoc, err := xmlquery.Parse(strings.NewReader(got))
+	if err != nil {
+		t.Errorf("xmlquerytest: cannot parse XML: %v\n%s", err, got)
+		return
+	}
+	if !xmlquery.Equal(wantDoc, gotDoc, opts...) {
+		t.Errorf("xmlquerytest: XML differs\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+// AssertXPathEquals reports a test error unless the string value of expr,
+// evaluated against doc as by the XPath string() function, is want. For an
+// expression selecting nodes, that is the text of the first node.
+func AssertXPathEquals(t testing.TB, doc *xmlquery.Node, expr, want string) {
+	t.Helper()
+	exp, err := xpath.Compile("string(" + expr + ")")
+	if err != nil {
+		t.Fatalf("xmlquerytest: invalid expression %s: %v", expr, err)
+		return
+	}
+	if got, _ := exp.Evaluate(xmlquery.CreateXPathNavigator(doc)).(string); got != want {
+		t.Errorf("xmlquerytest: %s = %q, want %q", expr, got, want)
+	}
+}
+
+// AssertGolden compares the document or element got with the golden file at
+// path, using xmlquery.Equal with the given options. Whitespace-only text is
+// ignored, so golden files can be indented. When the UpdateEnv environment
+// variable is set, the golden file is written instead, with got indented by
+// two spaces.
+func AssertGolden(t testing.TB, path string, got *xmlquery.Node, opts ...xmlquery.CompareOption) {
+	t.Helper()
+	opts = append([]xmlquery.CompareOption{xmlquery.WithCompareIgnoreWhitespace()}, opts...)
+	if os.Getenv(UpdateEnv) != "" {
+		data := got.OutputXMLWithOptions(xmlquery.WithIndentation("  "), xmlquery.WithEmptyTagSupport(), xmlquery.WithOutputSelf())
+		if err := ioutil.WriteFile(path, []byte(data+"\n"), 0644); err != nil {
+			t.Fatalf("xmlquerytest: cannot update golden file: %v", err)
+		}
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("xmlquerytest: cannot open golden file: %v", err)
+		return
+	}
+	defer f.Close()
+	want, err := xmlquery.Parse(f)
+	if err != nil {
+		t.Fatalf("xmlquerytest: cannot parse golden file %s: %v", path, err)
+		return
+	}
+	if got.Type != xmlquery.DocumentNode {
+		doc := &xmlquery.Node{Type: xmlquery.DocumentNode}
+		if decl := want.FirstChild; decl != nil && decl.Type == xmlquery.DeclarationNode && decl.Data == "xml" {
+			xmlquery.RemoveFromTree(decl)
+		}
+		xmlquery.AddChild(doc, xmlquery.CloneFiltered(got, func(*xmlquery.Node) bool { return true }))
+		got = doc
+	}
+	if !xmlquery.Equal(want, got, opts...) {
+		t.Errorf("xmlquerytest: XML differs from golden file %s, set %s=1 to update it\ngot: %s", path, UpdateEnv, got.OutputXML(false))
+	}
+}
@@ -0,0 +1,96 @@
+package xmlquerytest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// recorder records the failures reported by the helpers.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func TestAssertEqualXML(t *testing.T) {
+	r := &recorder{TB: t}
+	AssertEqualXML(r, `<a x="1" y="2"><b/></a>`, `<a y="2" x="1"><b></b></a>`)
+	AssertEqualXML(r, `<a><b/></a>`, "<a>\n  <b/>\n</a>", xmlquery.WithCompareIgnoreWhitespace())
+	if len(r.failures) != 0 {
+		t.Fatalf("expected no failures but got %v", r.failures)
+	}
+	AssertEqualXML(r, `<a><b/></a>`, `<a><c/></a>`)
+	AssertEqualXML(r, `<a/>`, `<a>`)
+	if len(r.failures) != 2 {
+		t.Fatalf("expected 2 failures but got %v", r.failures)
+	}
+}
+
+func TestAssertXPathEquals(t *testing.T) {
+	doc, err := xmlquery.Parse(strings.NewReader(`<r><item id="1">one</item><item id="2">two</item></r>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	AssertXPathEquals(r, doc, "//item[@id='2']", "two")
+	AssertXPathEquals(r, doc, "count(//item)", "2")
+	AssertXPathEquals(r, doc, "//item/@id", "1")
+	if len(r.failures) != 0 {
+		t.Fatalf("expected no failures but got %v", r.failures)
+	}
+	AssertXPathEquals(r, doc, "//item", "two")
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], `"one"`) {
+		t.Fatalf("expected a failure reporting the actual value but got %v", r.failures)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlquerytest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "golden.xml")
+	doc, err := xmlquery.Parse(strings.NewReader(`<r><item id="1">one</item><empty/></r>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(UpdateEnv, "1")
+	AssertGolden(t, path, doc)
+	os.Unsetenv(UpdateEnv)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\n  <item") {
+		t.Fatalf("expected an indented golden file but got %s", data)
+	}
+
+	r := &recorder{TB: t}
+	AssertGolden(r, path, doc)
+	AssertGolden(r, path, xmlquery.FindOne(doc, "/r"))
+	if len(r.failures) != 0 {
+		t.Fatalf("expected no failures but got %v", r.failures)
+	}
+	xmlquery.FindOne(doc, "//item").SetAttr("id", "2")
+	AssertGolden(r, path, doc)
+	if len(r.failures) != 1 {
+		t.Fatalf("expected a failure but got %v", r.failures)
+	}
+}
@@ -0,0 +1,132 @@
+package xmlquery
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ResolvePointer returns the element of doc identified by an XPointer, as
+// used by XInclude and in URI fragments. A leading '#' is removed and the
+// rest is percent-decoded. Supported are:
+//
+//   - shorthand pointers: intro identifies the element with xml:id, or
+//     failing that id, "intro", see GetElementByID;
+//   - the element() scheme: element(/1/2) identifies the second child
+//     element of the document element, element(intro/3) the third child
+//     element of the element identified by intro;
+//   - sequences of pointer parts such as xpointer(id('a')) element(/1/2),
+//     which are tried in order. Parts of unsupported schemes, including
+//     xpointer() and xmlns(), are skipped.
+//
+// ResolvePointer returns an error if the pointer is malformed or
+// identifies no element.
+func ResolvePointer(doc *Node, pointer string) (*Node, error) {
+	s := pointer
+	if strings.HasPrefix(s, "#") {
+		var err error
+		if s, err = url.PathUnescape(s[1:]); err != nil {
+			return nil, fmt.Errorf("xmlquery: invalid pointer %s: %v", pointer, err)
+		}
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("xmlquery: empty pointer")
+	}
+	if isNCName(s) {
+		if n := GetElementByID(doc, s); n != nil {
+			return n, nil
+		}
+		return nil, fmt.Errorf("xmlquery: pointer %s identifies no element", pointer)
+	}
+	for s != "" {
+		open := strings.IndexByte(s, '(')
+		if open <= 0 {
+			return nil, fmt.Errorf("xmlquery: invalid pointer %s", pointer)
+		}
+		scheme := s[:open]
+		data, rest, err := pointerSchemeData(s[open+1:])
+		if err != nil {
+			return nil, fmt.Errorf("xmlquery: invalid pointer %s: %v", pointer, err)
+		}
+		if scheme == "element" {
+			n, err := resolveElementScheme(doc, data)
+			if err != nil {
+				return nil, fmt.Errorf("xmlquery: invalid pointer %s: %v", pointer, err)
+			}
+			if n != nil {
+				return n, nil
+			}
+		}
+		s = strings.TrimLeft(rest, " \t\r\n")
+	}
+	return nil, fmt.Errorf("xmlquery: pointer %s identifies no element", pointer)
+}
+
+// pointerSchemeData returns the unescaped scheme data at the start of s, up
+// to the parenthesis closing it, and the rest of s. Within scheme data,
+// balanced parentheses are allowed and '^' escapes '(', ')' and '^'.
+func pointerSchemeData(s string) (string, string, error) {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '^':
+			if i+1 == len(s) || !strings.ContainsRune("()^", rune(s[i+1])) {
+				return "", "", fmt.Errorf("invalid escape at %d", i)
+			}
+			i++
+			b.WriteByte(s[i])
+		case '(':
+			depth++
+			b.WriteByte(c)
+		case ')':
+			if depth == 0 {
+				return b.String(), s[i+1:], nil
+			}
+			depth--
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("missing closing parenthesis")
+}
+
+// resolveElementScheme resolves the child sequence of an element() pointer
+// part, returning nil if it identifies no element.
+func resolveElementScheme(doc *Node, data string) (*Node, error) {
+	steps := strings.Split(data, "/")
+	n := doc
+	if steps[0] != "" {
+		if !isNCName(steps[0]) {
+			return nil, fmt.Errorf("invalid element() data %s", data)
+		}
+		if n = GetElementByID(doc, steps[0]); n == nil {
+			return nil, nil
+		}
+	} else if len(steps) == 1 {
+		return nil, fmt.Errorf("empty element() data")
+	}
+	for _, step := range steps[1:] {
+		i, err := strconv.Atoi(step)
+		if err != nil || i < 1 {
+			return nil, fmt.Errorf("invalid element() data %s", data)
+		}
+		var child *Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == ElementNode {
+				if i--; i == 0 {
+					child = c
+					break
+				}
+			}
+		}
+		if child == nil {
+			return nil, nil
+		}
+		n = child
+	}
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package xmlquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolvePointer(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<?xml version="1.0"?>
+<!-- comment -->
+<book>
+	<title>T</title>
+	<chapter xml:id="intro"><p>a</p><p id="p2">b</p></chapter>
+	<chapter id="c2"><p>c</p></chapter>
+</book>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pointer, want := range map[string]string{
+		"intro":                             "chapter:intro",
+		"#intro":                            "chapter:intro",
+		"#p2":                               "p:p2",
+		"element(/1)":                       "book:",
+		"element(/1/1)":                     "title:T",
+		"element(/1/3/1)":                   "p:c",
+		"element(intro/2)":                  "p:p2",
+		"element(c2)":                       "chapter:c2",
+		"xpointer(id('x')) element(/1/2/1)": "p:a",
+		"element(/1/9) element(intro)":      "chapter:intro",
+		"xmlns(a=urn:a)element(/1/2/2)":     "p:p2",
+		"foo(a^)b^^)element(/1/1)":          "title:T",
+		"%23intro":                          "",
+		"#element(%2F1%2F1)":                "title:T",
+	} {
+		n, err := ResolvePointer(doc, pointer)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", pointer)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", pointer, err)
+			continue
+		}
+		got := n.Data + ":"
+		if id := n.SelectAttr("id"); id != "" {
+			got += id
+		} else if id := n.SelectAttr("xml:id"); id != "" {
+			got += id
+		} else if n.Data != "book" {
+			got += n.InnerText()
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", pointer, got, want)
+		}
+	}
+
+	for _, pointer := range []string{"", "missing", "element(/0)", "element(/a)", "element(", "element(/1/9)", "(x)", "foo(^x)"} {
+		if _, err := ResolvePointer(doc, pointer); err == nil {
+			t.Errorf("%q: expected an error", pointer)
+		}
+	}
+}
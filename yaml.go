@@ -0,0 +1,231 @@
+package xmlquery
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type yamlConfiguration struct {
+	attrPrefix string
+	textKey    string
+	indent     int
+}
+
+// YAMLOption configures ToYAML.
+type YAMLOption func(*yamlConfiguration)
+
+// WithYAMLAttrPrefix sets the prefix added to attribute names to tell them
+// apart from child elements. The default is "@".
+func WithYAMLAttrPrefix(prefix string) YAMLOption {
+	return func(c *yamlConfiguration) {
+		c.attrPrefix = prefix
+	}
+}
+
+// WithYAMLTextKey sets the key used for the text of elements that also have
+// attributes or child elements. The default is "#text".
+func WithYAMLTextKey(key string) YAMLOption {
+	return func(c *yamlConfiguration) {
+		c.textKey = key
+	}
+}
+
+// WithYAMLIndent sets the number of spaces per indentation level. The
+// default, and minimum, is 2.
+func WithYAMLIndent(n int) YAMLOption {
+	return func(c *yamlConfiguration) {
+		c.indent = n
+	}
+}
+
+// yamlMap is a mapping that keeps its keys in insertion order.
+type yamlMap struct {
+	keys   []string
+	values []interface{} // string, *yamlMap or []interface{}
+}
+
+func (m *yamlMap) set(key string, value interface{}) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+// ToYAML converts the element n, or the root element of the document n, to
+// a YAML document. An element holding only text becomes a string, other
+// elements become mappings of their attributes, text and children. Children
+// sharing a name are grouped into a sequence; when that would change the
+// order of the children, the element instead becomes a sequence of
+// single-key mappings in document order.
+func ToYAML(n *Node, opts ...YAMLOption) string {
+	config := &yamlConfiguration{attrPrefix: "@", textKey: "#text", indent: 2}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if config.indent < 2 {
+		config.indent = 2
+	}
+	root := &yamlMap{}
+	if n.Type == ElementNode {
+		root.set(n.qualifiedName(), config.value(n))
+	} else {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == ElementNode {
+				root.set(child.qualifiedName(), config.value(child))
+			}
+		}
+	}
+	var b strings.Builder
+	config.writeMap(&b, root, 0)
+	return b.String()
+}
+
+func (c *yamlConfiguration) value(n *Node) interface{} {
+	var text strings.Builder
+	var children []*Node
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case TextNode, CharDataNode:
+			text.WriteString(child.Data)
+		case ElementNode:
+			children = append(children, child)
+		}
+	}
+	s := text.String()
+	if len(children) > 0 {
+		s = strings.TrimSpace(s)
+	}
+	if len(n.Attr) == 0 && len(children) == 0 {
+		return s
+	}
+
+	// Grouping children by name keeps their order only if every name
+	// appears in a single run.
+	ordered := true
+	seen := map[string]bool{}
+	for i, child := range children {
+		name := child.qualifiedName()
+		if seen[name] && children[i-1].qualifiedName() != name {
+			ordered = false
+			break
+		}
+		seen[name] = true
+	}
+
+	if !ordered {
+		var items []interface{}
+		for _, attr := range n.Attr {
+			m := &yamlMap{}
+			m.set(c.attrPrefix+attrQualifiedName(attr), attr.Value)
+			items = append(items, m)
+		}
+		if s != "" {
+			m := &yamlMap{}
+			m.set(c.textKey, s)
+			items = append(items, m)
+		}
+		for _, child := range children {
+			m := &yamlMap{}
+			m.set(child.qualifiedName(), c.value(child))
+			items = append(items, m)
+		}
+		return items
+	}
+
+	m := &yamlMap{}
+	for _, attr := range n.Attr {
+		m.set(c.attrPrefix+attrQualifiedName(attr), attr.Value)
+	}
+	if s != "" {
+		m.set(c.textKey, s)
+	}
+	for i := 0; i < len(children); {
+		name := children[i].qualifiedName()
+		j := i + 1
+		for j < len(children) && children[j].qualifiedName() == name {
+			j++
+		}
+		if j-i == 1 {
+			m.set(name, c.value(children[i]))
+		} else {
+			var items []interface{}
+			for _, child := range children[i:j] {
+				items = append(items, c.value(child))
+			}
+			m.set(name, items)
+		}
+		i = j
+	}
+	return m
+}
+
+func attrQualifiedName(attr Attr) string {
+	if attr.Name.Space == "" {
+		return attr.Name.Local
+	}
+	return attr.Name.Space + ":" + attr.Name.Local
+}
+
+func (c *yamlConfiguration) writeMap(b *strings.Builder, m *yamlMap, level int) {
+	for i, key := range m.keys {
+		b.WriteString(strings.Repeat(" ", level*c.indent))
+		b.WriteString(yamlScalar(key))
+		b.WriteString(":")
+		c.writeValue(b, m.values[i], level)
+	}
+}
+
+func (c *yamlConfiguration) writeValue(b *strings.Builder, v interface{}, level int) {
+	switch v := v.(type) {
+	case string:
+		b.WriteString(" ")
+		b.WriteString(yamlScalar(v))
+		b.WriteString("\n")
+	case *yamlMap:
+		if len(v.keys) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteString("\n")
+		c.writeMap(b, v, level+1)
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+		b.WriteString("\n")
+		c.writeSeq(b, v, level+1)
+	}
+}
+
+func (c *yamlConfiguration) writeSeq(b *strings.Builder, items []interface{}, level int) {
+	indent := strings.Repeat(" ", level*c.indent)
+	for _, item := range items {
+		m, ok := item.(*yamlMap)
+		if !ok || len(m.keys) == 0 {
+			b.WriteString(indent + "-")
+			c.writeValue(b, item, level)
+			continue
+		}
+		// Write the mapping one level deeper, then put the dash in place
+		// of the indentation of its first key.
+		var sub strings.Builder
+		c.writeMap(&sub, m, level+1)
+		s := sub.String()
+		b.WriteString(indent + "-" + s[len(indent)+1:])
+	}
+}
+
+var yamlReservedRegex = regexp.MustCompile(`(?i)^(y|n|yes|no|on|off|true|false|null|~|[-+]?\.(inf|nan)|[-+]?[0-9.][0-9_.:eExXoObB+-]*)$`)
+
+// yamlScalar returns s as a plain scalar when that is unambiguous, or as a
+// double-quoted scalar otherwise.
+func yamlScalar(s string) string {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") ||
+		yamlReservedRegex.MatchString(s) || !utf8.ValidString(s) ||
+		strings.IndexFunc(s, func(r rune) bool { return r < ' ' || r == 0x7F }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
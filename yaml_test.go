@@ -0,0 +1,36 @@
+package xmlquery
+
+import "testing"
+
+func TestToYAML(t *testing.T) {
+	doc := loadXML(`<catalog>
+	<book id="bk101" lang="en"><title>XML: a guide</title><price>44.95</price><tag>a</tag><tag>b</tag></book>
+	<book id="bk102"><title>Midnight Rain</title><note/></book>
+</catalog>`)
+	expected := `catalog:
+  book:
+    - "@id": bk101
+      "@lang": en
+      title: "XML: a guide"
+      price: "44.95"
+      tag:
+        - a
+        - b
+    - "@id": bk102
+      title: Midnight Rain
+      note: ""
+`
+	testValue(t, ToYAML(doc), expected)
+}
+
+func TestToYAMLKeepsOrder(t *testing.T) {
+	doc := loadXML(`<p class="x">Hello <b>big</b> <i>new</i> <b>world</b></p>`)
+	expected := `p:
+  - _class: x
+  - text: Hello
+  - b: big
+  - i: new
+  - b: world
+`
+	testValue(t, ToYAML(FindOne(doc, "/p"), WithYAMLAttrPrefix("_"), WithYAMLTextKey("text")), expected)
+}